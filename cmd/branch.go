@@ -4,18 +4,29 @@ import (
 	"fmt"
 	"os"
 	"senpai/core"
+	"strings"
 
 	"github.com/spf13/cobra"
 )
 
 var (
-	deleteFlag  bool
-	allFlag     bool
-	verboseFlag bool
+	deleteFlag        bool
+	allFlag           bool
+	verboseFlag       int
+	setUpstreamFlag   string
+	unsetUpstreamFlag bool
+	forceDeleteFlag   bool
+	moveFlag          bool
+	forceMoveFlag     bool
+	copyFlag          bool
+	forceCopyFlag     bool
+	mergedFlag        string
+	noMergedFlag      string
+	containsFlag      string
 )
 
 var branchCmd = &cobra.Command{
-	Use:   "branch [flags] <name>",
+	Use:   "branch [flags] [<name> [<start-point>]]",
 	Short: "List, create, or delete branches",
 	Long: `Manage branches in your repository.
 
@@ -25,58 +36,204 @@ marking the current branch with an asterisk (*).
 You can also create or delete branches:
 
   senpai branch new-feature     # Create a new branch
-  senpai branch -d old-feature  # Delete a branch
+  senpai branch fix v1.0~2      # Create a branch at any revision
+  senpai branch -d old-feature  # Delete a branch merged into HEAD
+  senpai branch -D experiment   # Delete a branch even if unmerged
+  senpai branch -m old new      # Rename a branch
+  senpai branch -c main backup  # Copy a branch
   senpai branch                 # List all branches
+  senpai branch -a              # Include remote-tracking branches
+
+Renaming or copying a branch carries its reflog and configuration along,
+and renaming the current branch keeps HEAD on it. -M and -C overwrite an
+existing target branch.
+
+The list can be filtered by reachability:
+
+  senpai branch --merged           # Branches already merged into HEAD
+  senpai branch --no-merged main   # Branches with commits not in main
+  senpai branch --contains v1.0    # Branches that contain v1.0
+
+A branch can track an upstream branch, stored as branch.<name>.remote and
+branch.<name>.merge in the config. -v shows how far each branch is ahead
+of or behind its upstream, and -vv names the upstream too:
+
+  senpai branch -u origin/main           # Track origin/main
+  senpai branch -u main topic            # Make topic track local main
+  senpai branch --unset-upstream         # Stop tracking
+  senpai branch -vv                      # * main 1a2b3c4 [origin/main: ahead 2, behind 1] ...
 
 Branches are simple references stored under .senpai/refs/heads/.
 Each branch points to a specific commit hash.`,
+	Args: cobra.ArbitraryArgs,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		repoPath, err := os.Getwd()
 		if err != nil {
 			return fmt.Errorf("failed to get working directory: %w", err)
 		}
 
-		if len(args) == 0 {
-			branches, err := core.ListBranches(repoPath)
-			if err != nil {
+		switch {
+		case cmd.Flags().Changed("set-upstream-to"):
+			if len(args) > 1 {
+				return fmt.Errorf("too many arguments to set new upstream")
+			}
+			branch := optionalArg(args)
+			if err := core.SetUpstream(repoPath, branch, setUpstreamFlag); err != nil {
 				return err
 			}
-
-			current, err := core.GetCurrentBranch(repoPath)
-			if err != nil {
-				current = ""
+			if branch == "" {
+				branch, _ = core.GetCurrentBranch(repoPath)
 			}
-
-			for _, b := range branches {
-				prefix := "  "
-				if b == current {
-					prefix = "* "
+			fmt.Printf("branch '%s' set up to track '%s'.\n", branch, setUpstreamFlag)
+			return nil
+		case unsetUpstreamFlag:
+			if len(args) > 1 {
+				return fmt.Errorf("too many arguments to unset upstream")
+			}
+			return core.UnsetUpstream(repoPath, optionalArg(args))
+		case deleteFlag || forceDeleteFlag:
+			if len(args) == 0 {
+				return fmt.Errorf("branch name required")
+			}
+			for _, name := range args {
+				hash, err := core.ResolveBranchCommit(repoPath, name)
+				if err != nil {
+					return err
 				}
-				if verboseFlag {
-					hash, err := core.ResolveBranchCommit(repoPath, b)
-					if err == nil && len(hash) >= 7 {
-						fmt.Printf("%s%s %s\n", prefix, b, hash[:7])
-					} else {
-						fmt.Printf("%s%s\n", prefix, b)
-					}
-				} else {
-					fmt.Printf("%s%s\n", prefix, b)
+				if err := core.DeleteBranch(repoPath, name, forceDeleteFlag); err != nil {
+					return err
 				}
+				fmt.Printf("Deleted branch %s (was %s).\n", name, hash[:7])
 			}
 			return nil
+		case moveFlag || forceMoveFlag || copyFlag || forceCopyFlag:
+			var oldName, newName string
+			switch len(args) {
+			case 1:
+				newName = args[0]
+			case 2:
+				oldName, newName = args[0], args[1]
+			default:
+				return fmt.Errorf("expected [<old-branch>] <new-branch>")
+			}
+			if moveFlag || forceMoveFlag {
+				return core.RenameBranch(repoPath, oldName, newName, forceMoveFlag)
+			}
+			return core.CopyBranch(repoPath, oldName, newName, forceCopyFlag)
+		}
+
+		if len(args) == 0 || mergedFlag != "" || noMergedFlag != "" || containsFlag != "" {
+			// "--merged main" leaves main as an argument since the commit
+			// is optional; hand it to the filter that defaulted to HEAD
+			for _, filter := range []*string{&mergedFlag, &noMergedFlag, &containsFlag} {
+				if len(args) == 1 && *filter == "HEAD" {
+					*filter, args = args[0], nil
+				}
+			}
+			if len(args) > 0 {
+				return fmt.Errorf("--merged, --no-merged and --contains only apply when listing branches")
+			}
+			return listBranches(repoPath)
+		}
+		if len(args) > 2 {
+			return fmt.Errorf("too many arguments")
 		}
 
 		name := args[0]
-		if deleteFlag {
-			return core.DeleteBranch(repoPath, name)
+		if len(args) > 1 {
+			return core.CreateBranchAt(repoPath, name, args[1])
 		}
 		return core.CreateBranch(repoPath, name)
 	},
 }
 
+func listBranches(repoPath string) error {
+	branches, err := core.ListBranchInfo(repoPath, core.BranchListOptions{
+		Remotes:  allFlag,
+		Merged:   mergedFlag,
+		NoMerged: noMergedFlag,
+		Contains: containsFlag,
+	})
+	if err != nil {
+		return err
+	}
+
+	current, err := core.GetCurrentBranch(repoPath)
+	if err != nil {
+		current = ""
+	}
+
+	width := 0
+	for _, b := range branches {
+		width = max(width, len(b.Name))
+	}
+
+	for _, b := range branches {
+		prefix := "  "
+		if !b.Remote && b.Name == current {
+			prefix = "* "
+		}
+		if verboseFlag == 0 {
+			fmt.Printf("%s%s\n", prefix, b.Name)
+			continue
+		}
+
+		line := fmt.Sprintf("%s%-*s %s", prefix, width, b.Name, b.Hash[:7])
+		if tracking := formatTracking(b.Tracking, verboseFlag > 1); tracking != "" {
+			line += " " + tracking
+		}
+		fmt.Printf("%s %s\n", line, b.Subject)
+	}
+	return nil
+}
+
+// formatTracking renders upstream information as "branch -v" does, e.g.
+// "[ahead 2, behind 1]", or "[origin/main: ahead 2, behind 1]" with
+// withName.
+func formatTracking(t *core.TrackingInfo, withName bool) string {
+	if t == nil {
+		return ""
+	}
+
+	var parts []string
+	if t.Gone {
+		parts = append(parts, "gone")
+	}
+	if t.Ahead > 0 {
+		parts = append(parts, fmt.Sprintf("ahead %d", t.Ahead))
+	}
+	if t.Behind > 0 {
+		parts = append(parts, fmt.Sprintf("behind %d", t.Behind))
+	}
+
+	status := strings.Join(parts, ", ")
+	switch {
+	case withName && status != "":
+		return fmt.Sprintf("[%s: %s]", t.Upstream, status)
+	case withName:
+		return fmt.Sprintf("[%s]", t.Upstream)
+	case status != "":
+		return fmt.Sprintf("[%s]", status)
+	}
+	return ""
+}
+
 func init() {
 	rootCmd.AddCommand(branchCmd)
-	branchCmd.Flags().BoolVarP(&deleteFlag, "delete", "d", false, "Delete the specified branch")
+	branchCmd.Flags().BoolVarP(&deleteFlag, "delete", "d", false, "Delete the specified branches if they are fully merged")
+	branchCmd.Flags().BoolVarP(&forceDeleteFlag, "force-delete", "D", false, "Delete the specified branches even if unmerged")
+	branchCmd.Flags().BoolVarP(&moveFlag, "move", "m", false, "Rename a branch along with its reflog and config")
+	branchCmd.Flags().BoolVarP(&forceMoveFlag, "force-move", "M", false, "Rename a branch even if the new name exists")
+	branchCmd.Flags().BoolVarP(&copyFlag, "copy", "c", false, "Copy a branch along with its reflog and config")
+	branchCmd.Flags().BoolVarP(&forceCopyFlag, "force-copy", "C", false, "Copy a branch even if the new name exists")
 	branchCmd.Flags().BoolVarP(&allFlag, "all", "a", false, "List all branches (local + remote)")
-	branchCmd.Flags().BoolVarP(&verboseFlag, "verbose", "v", false, "Show commit hashes next to branch names")
+	branchCmd.Flags().CountVarP(&verboseFlag, "verbose", "v", "Show hash and subject; give twice to also name the upstream")
+	branchCmd.Flags().StringVarP(&setUpstreamFlag, "set-upstream-to", "u", "", "Set the upstream of the current or given branch")
+	branchCmd.Flags().BoolVar(&unsetUpstreamFlag, "unset-upstream", false, "Remove the upstream of the current or given branch")
+	branchCmd.Flags().StringVar(&mergedFlag, "merged", "", "List only branches merged into the commit (HEAD by default)")
+	branchCmd.Flags().StringVar(&noMergedFlag, "no-merged", "", "List only branches not merged into the commit (HEAD by default)")
+	branchCmd.Flags().StringVar(&containsFlag, "contains", "", "List only branches that contain the commit (HEAD by default)")
+	for _, name := range []string{"merged", "no-merged", "contains"} {
+		branchCmd.Flags().Lookup(name).NoOptDefVal = "HEAD"
+	}
 }
@@ -2,20 +2,67 @@ package cmd
 
 import (
 	"fmt"
+	"os"
 	"senpai/core"
 
 	"github.com/spf13/cobra"
 )
 
 var catFileCmd = &cobra.Command{
-	Use:   "cat-file <object hash> [flags]",
+	Use:   "cat-file <object> [flags]",
 	Short: "Provide contents or details of repository objects",
-	Long:  "Output the contents or other properties such as size, type or delta information of one or more objects",
+	Long: `Output the contents or other properties such as size, type or delta information of one or more objects.
+
+With --batch or --batch-check, object names are read from standard input,
+one per line, and a "<hash> <type> <size>" line is written for each, with
+--batch following it with the content of the object. A format such as
+'%(objectname) %(rest)' can be given to either. --batch-all-objects
+writes every object in the repository instead:
+
+  senpai cat-file --batch-check < names
+  senpai cat-file --batch-all-objects --batch-check='%(objectname) %(objectsize:disk)'
+
+--textconv converts a blob named as <rev>:<path> with the textconv command
+of the diff driver that .gitattributes gives its path. With --batch, the
+path is taken from the rest of each input line.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
+		textconv, err := cmd.Flags().GetBool("textconv")
+		if err != nil {
+			return fmt.Errorf("failed to read flag 'textconv': %w", err)
+		}
+
+		allObjects, err := cmd.Flags().GetBool("batch-all-objects")
+		if err != nil {
+			return fmt.Errorf("failed to read flag 'batch-all-objects': %w", err)
+		}
+
+		batch, batchCheck := cmd.Flags().Changed("batch"), cmd.Flags().Changed("batch-check")
+		if batch && batchCheck {
+			return fmt.Errorf("options '--batch' and '--batch-check' cannot be used together")
+		}
+		if batch || batchCheck {
+			if len(args) > 0 {
+				return fmt.Errorf("batch modes take no arguments")
+			}
+			opts := core.CatFileBatchOptions{Contents: batch, AllObjects: allObjects, Textconv: textconv}
+			if batch {
+				opts.Format, _ = cmd.Flags().GetString("batch")
+			} else {
+				opts.Format, _ = cmd.Flags().GetString("batch-check")
+			}
+			return core.CatFileBatch(".", os.Stdin, os.Stdout, opts)
+		}
+		if allObjects {
+			return fmt.Errorf("'--batch-all-objects' requires a batch mode")
+		}
+
 		if len(args) < 1 {
 			return fmt.Errorf("no object specified")
 		}
 		hash := args[0]
+		if textconv {
+			return core.CatFileTextconv(".", os.Stdout, hash)
+		}
 
 		showType, err := cmd.Flags().GetBool("type")
 		if err != nil {
@@ -48,4 +95,10 @@ func init() {
 	catFileCmd.Flags().BoolP("size", "s", false, "Show object size")
 	catFileCmd.Flags().BoolP("pretty", "p", false, "Pretty-print contents of object")
 	catFileCmd.Flags().BoolP("exists", "e", false, "Check if object exists (exit code 0 if true)")
+	catFileCmd.Flags().String("batch", "", "Show the info and contents of each object named on stdin, in the given format")
+	catFileCmd.Flags().Lookup("batch").NoOptDefVal = core.CatFileBatchFormat
+	catFileCmd.Flags().String("batch-check", "", "Show the info of each object named on stdin, in the given format")
+	catFileCmd.Flags().Lookup("batch-check").NoOptDefVal = core.CatFileBatchFormat
+	catFileCmd.Flags().Bool("batch-all-objects", false, "With --batch or --batch-check, show every object instead of reading stdin")
+	catFileCmd.Flags().Bool("textconv", false, "Convert blobs with the textconv driver of their path")
 }
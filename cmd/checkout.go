@@ -3,26 +3,54 @@ package cmd
 import (
 	"fmt"
 	"senpai/core"
+	"strings"
 
 	"github.com/spf13/cobra"
 )
 
 var (
-	newBranch bool
+	newBranch     bool
+	checkoutForce bool
+	checkoutMerge bool
 )
 
 var checkoutCmd = &cobra.Command{
-	Use:   "checkout [flags] <branch | commit>",
+	Use:   "checkout [flags] <branch | commit> | [<tree-ish>] -- <paths>...",
 	Short: "Switch branches or restore working tree files",
 	Long: `Switches to a specified branch or commit.
 
+Local changes to files that are the same in both commits are carried over.
+If switching would overwrite local changes or untracked files, checkout
+refuses; use --force to throw the changes away or --merge to merge them into
+the target.
+
+With paths, HEAD is not moved. Instead the named files are restored from the
+index, or from <tree-ish> (updating the index too) when one is given.
+
 Examples:
   senpai checkout main
   senpai checkout -b feature/api
   senpai checkout a1b2c3d
+  senpai checkout -m feature/api
+  senpai checkout -- notes.txt
+  senpai checkout a1b2c3d -- src
 `,
-	Args: cobra.ExactArgs(1),
+	Args: cobra.MinimumNArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
+		if dash := cmd.ArgsLenAtDash(); dash >= 0 || len(args) > 1 {
+			treeish := ""
+			paths := args
+			if dash > 1 {
+				return fmt.Errorf("only one tree-ish may be given before --")
+			} else if dash >= 0 {
+				treeish = strings.Join(args[:dash], "")
+				paths = args[dash:]
+			} else {
+				treeish, paths = args[0], args[1:]
+			}
+			return core.CheckoutPaths(".", treeish, paths)
+		}
+
 		target := args[0]
 
 		if newBranch {
@@ -30,12 +58,21 @@ Examples:
 			return core.CheckoutNewBranch(".", target)
 		}
 
+		if checkoutForce && checkoutMerge {
+			return fmt.Errorf("--force and --merge are incompatible")
+		}
+
 		fmt.Printf("Switching to branch or commit: %s\n", target)
-		return core.Checkout(".", target)
+		return core.CheckoutWithOptions(".", target, core.CheckoutOptions{
+			Force: checkoutForce,
+			Merge: checkoutMerge,
+		})
 	},
 }
 
 func init() {
 	rootCmd.AddCommand(checkoutCmd)
 	checkoutCmd.Flags().BoolVarP(&newBranch, "branch", "b", false, "Create and switch to a new branch")
+	checkoutCmd.Flags().BoolVarP(&checkoutForce, "force", "f", false, "Throw away local changes when switching")
+	checkoutCmd.Flags().BoolVarP(&checkoutMerge, "merge", "m", false, "Merge local changes into the target")
 }
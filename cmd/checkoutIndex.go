@@ -0,0 +1,40 @@
+package cmd
+
+import (
+	"fmt"
+	"senpai/core"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	checkoutIndexAll    bool
+	checkoutIndexForce  bool
+	checkoutIndexPrefix string
+)
+
+var checkoutIndexCmd = &cobra.Command{
+	Use:   "checkout-index [-a] [-f] [--prefix=<string>] [<file>...]",
+	Short: "Copy files from the index to the working tree",
+	Long: `Writes the named files, or with -a every file, from the index to the
+working tree. Files that already exist and differ are left alone unless -f
+is given. --prefix is put in front of every path, so a trailing slash
+exports the index into a directory:
+
+  senpai checkout-index -a -f
+  senpai checkout-index -a --prefix=export/`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if checkoutIndexAll && len(args) > 0 {
+			return fmt.Errorf("-a cannot be used with paths")
+		}
+		opts := core.CheckoutIndexOptions{All: checkoutIndexAll, Force: checkoutIndexForce, Prefix: checkoutIndexPrefix}
+		return core.CheckoutIndex(".", args, opts)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(checkoutIndexCmd)
+	checkoutIndexCmd.Flags().BoolVarP(&checkoutIndexAll, "all", "a", false, "Check out every file in the index")
+	checkoutIndexCmd.Flags().BoolVarP(&checkoutIndexForce, "force", "f", false, "Overwrite existing files")
+	checkoutIndexCmd.Flags().StringVar(&checkoutIndexPrefix, "prefix", "", "Write files under this prefix")
+}
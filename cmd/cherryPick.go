@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"senpai/core"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	cherryPickNoCommit bool
+	cherryPickOrigin   bool
+	cherryPickMainline int
+	cherryPickContinue bool
+	cherryPickSkip     bool
+	cherryPickAbort    bool
+)
+
+var cherryPickCmd = &cobra.Command{
+	Use:   "cherry-pick [flags] <commit>...",
+	Short: "Apply the changes introduced by some existing commits",
+	Long: `Given one or more existing commits, apply the change each one introduces
+relative to its parent, recording a new commit for each. The original author
+is kept; you become the committer.
+
+If a pick conflicts, resolve the conflict, "senpai add" the files and run
+"senpai cherry-pick --continue", or give up with "senpai cherry-pick --abort".
+A pick that changes nothing stops the sequence too: "--continue" commits it
+anyway and "--skip" drops it.
+
+Examples:
+  senpai cherry-pick a1b2c3d
+  senpai cherry-pick -x feature
+  senpai cherry-pick -m 1 d4e5f6a
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runSequencerCommand(args, cherryPickContinue, cherryPickSkip, cherryPickAbort, func(repoPath string, opts core.CherryPickOptions) (string, error) {
+			opts.NoCommit = cherryPickNoCommit
+			opts.RecordOrigin = cherryPickOrigin
+			opts.Mainline = cherryPickMainline
+			return core.CherryPick(repoPath, args, opts)
+		})
+	},
+}
+
+// runSequencerCommand holds the plumbing shared by cherry-pick and revert:
+// --continue, --skip and --abort handling, identity lookup and printing the
+// result.
+func runSequencerCommand(args []string, cont, skip, abort bool, start func(string, core.CherryPickOptions) (string, error)) error {
+	repoPath, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("failed to get working directory: %w", err)
+	}
+
+	if abort {
+		return core.SequencerAbort(repoPath)
+	}
+
+	name, email, err := committerIdentity()
+	if err != nil {
+		return err
+	}
+
+	var msg string
+	switch {
+	case cont:
+		msg, err = core.SequencerContinue(repoPath, name, email)
+	case skip:
+		msg, err = core.SequencerSkip(repoPath, name, email)
+	default:
+		if len(args) == 0 {
+			return fmt.Errorf("no commits specified")
+		}
+		msg, err = start(repoPath, core.CherryPickOptions{
+			CommitterName:  name,
+			CommitterEmail: email,
+		})
+	}
+
+	if msg != "" {
+		fmt.Println(msg)
+	}
+	return err
+}
+
+func init() {
+	rootCmd.AddCommand(cherryPickCmd)
+	cherryPickCmd.Flags().BoolVarP(&cherryPickNoCommit, "no-commit", "n", false, "Apply the changes without committing")
+	cherryPickCmd.Flags().BoolVarP(&cherryPickOrigin, "record-origin", "x", false, "Append a \"(cherry picked from commit ...)\" line")
+	cherryPickCmd.Flags().IntVarP(&cherryPickMainline, "mainline", "m", 0, "Parent number to diff against when picking a merge")
+	cherryPickCmd.Flags().BoolVar(&cherryPickContinue, "continue", false, "Continue after resolving conflicts")
+	cherryPickCmd.Flags().BoolVar(&cherryPickSkip, "skip", false, "Drop the commit the sequence stopped at and continue")
+	cherryPickCmd.Flags().BoolVar(&cherryPickAbort, "abort", false, "Cancel and return to the pre-sequence state")
+}
@@ -22,18 +22,9 @@ point to it`,
 		if msg == "" {
 			return fmt.Errorf("commit message required (use -m)")
 		}
-		authorName := os.Getenv("GIT_AUTHOR_NAME")
-		authorEmail := os.Getenv("GIT_AUTHOR_EMAIL")
-
-		if authorName == "" {
-			authorName = os.Getenv("GIT_COMMITTER_NAME")
-		}
-		if authorEmail == "" {
-			authorEmail = os.Getenv("GIT_COMMITTER_EMAIL")
-		}
-
-		if authorName == "" || authorEmail == "" {
-			return fmt.Errorf("missing author info: set GIT_AUTHOR_NAME and GIT_AUTHOR_EMAIL (or committer variants)")
+		authorName, authorEmail, err := authorIdentity()
+		if err != nil {
+			return err
 		}
 		cwd, err := os.Getwd()
 		if err != nil {
@@ -50,6 +41,36 @@ point to it`,
 	},
 }
 
+// authorIdentity reads the author name and email from the environment,
+// falling back to the committer variables.
+func authorIdentity() (string, string, error) {
+	authorName := os.Getenv("GIT_AUTHOR_NAME")
+	authorEmail := os.Getenv("GIT_AUTHOR_EMAIL")
+
+	if authorName == "" {
+		authorName = os.Getenv("GIT_COMMITTER_NAME")
+	}
+	if authorEmail == "" {
+		authorEmail = os.Getenv("GIT_COMMITTER_EMAIL")
+	}
+
+	if authorName == "" || authorEmail == "" {
+		return "", "", fmt.Errorf("missing author info: set GIT_AUTHOR_NAME and GIT_AUTHOR_EMAIL (or committer variants)")
+	}
+	return authorName, authorEmail, nil
+}
+
+// committerIdentity is authorIdentity with the committer variables taking
+// precedence, used when rewriting commits that keep their original author.
+func committerIdentity() (string, string, error) {
+	name := os.Getenv("GIT_COMMITTER_NAME")
+	email := os.Getenv("GIT_COMMITTER_EMAIL")
+	if name != "" && email != "" {
+		return name, email, nil
+	}
+	return authorIdentity()
+}
+
 func init() {
 	rootCmd.AddCommand(commitCmd)
 	commitCmd.Flags().StringP("message", "m", "", "commit message")
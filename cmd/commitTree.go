@@ -17,11 +17,24 @@ var (
 
 // commitTreeCmd represents the commitTree command
 var commitTreeCmd = &cobra.Command{
-	Use:   "commit-tree <tree hash> [flags]",
+	Use:   "commit-tree <tree-ish> [flags]",
 	Short: "Create a new commit object",
 	Long:  "Creates a new commit object based on the provided tree object and emits the new commit object id on stdout. The log message is read from the standard input, unless -m option is given.",
+	Args:  cobra.ExactArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
-		treeHash := args[0]
+		treeHash, err := core.ResolveRevision(".", args[0]+"^{tree}")
+		if err != nil {
+			return err
+		}
+
+		var parents []string
+		for _, parent := range parentHashes {
+			hash, err := core.ResolveRevision(".", parent+"^{commit}")
+			if err != nil {
+				return err
+			}
+			parents = append(parents, hash)
+		}
 
 		var commitMsg string
 		if len(messages) > 0 {
@@ -35,21 +48,12 @@ var commitTreeCmd = &cobra.Command{
 			commitMsg = string(data)
 		}
 
-		authorName := os.Getenv("GIT_AUTHOR_NAME")
-		authorEmail := os.Getenv("GIT_AUTHOR_EMAIL")
-
-		if authorName == "" {
-			authorName = os.Getenv("GIT_COMMITTER_NAME")
-		}
-		if authorEmail == "" {
-			authorEmail = os.Getenv("GIT_COMMITTER_EMAIL")
-		}
-
-		if authorName == "" || authorEmail == "" {
-			return fmt.Errorf("missing author info: set GIT_AUTHOR_NAME and GIT_AUTHOR_EMAIL (or committer variants)")
+		authorName, authorEmail, err := authorIdentity()
+		if err != nil {
+			return err
 		}
 
-		commitHash, err := core.CommitTree(treeHash, parentHashes, commitMsg, authorName, authorEmail)
+		commitHash, err := core.CommitTree(treeHash, parents, commitMsg, authorName, authorEmail)
 		if err != nil {
 			return fmt.Errorf("failed to create commit: %w", err)
 		}
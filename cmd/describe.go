@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"fmt"
+	"senpai/core"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	describeTags   bool
+	describeLong   bool
+	describeAbbrev int
+	describeDirty  string
+)
+
+var describeCmd = &cobra.Command{
+	Use:   "describe [--tags] [--long] [--dirty[=<mark>]] [--abbrev=<n>] [<commit-ish>...]",
+	Short: "Give an object a human readable name based on an available ref",
+	Long: `Names each commit (HEAD by default) after the nearest annotated tag it can
+reach, as "<tag>-<n>-g<hash>" for a commit n commits on top of the tag,
+or the tag name alone for a tagged commit. --tags lets lightweight tags
+name commits as well.
+
+  senpai describe                  # v1.2-14-gabcdef0
+  senpai describe --tags main~3
+  senpai describe --long --abbrev=10 v1.2
+
+--dirty appends "-dirty", or the given mark, when HEAD is described and
+the index or working tree has changes:
+
+  senpai describe --dirty=.modified`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if describeDirty != "" && len(args) > 0 {
+			return fmt.Errorf("option '--dirty' and commit-ishes cannot be used together")
+		}
+		if len(args) == 0 {
+			args = []string{"HEAD"}
+		}
+
+		opts := core.DescribeOptions{
+			Tags:   describeTags,
+			Long:   describeLong,
+			Abbrev: describeAbbrev,
+			Dirty:  describeDirty,
+		}
+		if opts.Long && opts.Abbrev == 0 {
+			return fmt.Errorf("options '--long' and '--abbrev=0' cannot be used together")
+		}
+		for _, arg := range args {
+			description, err := core.Describe(".", arg, opts)
+			if err != nil {
+				return err
+			}
+			fmt.Println(description)
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(describeCmd)
+	describeCmd.Flags().BoolVar(&describeTags, "tags", false, "Use lightweight tags as well as annotated ones")
+	describeCmd.Flags().BoolVar(&describeLong, "long", false, "Always show the number of commits and the hash, even for a tagged commit")
+	describeCmd.Flags().IntVar(&describeAbbrev, "abbrev", 7, "Show this many hex digits of the commit hash, or only the tag with 0")
+	describeCmd.Flags().StringVar(&describeDirty, "dirty", "", "Append a mark, -dirty by default, when the working tree has changes")
+	describeCmd.Flags().Lookup("dirty").NoOptDefVal = "-dirty"
+}
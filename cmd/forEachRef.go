@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"senpai/core"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	forEachRefFormat   string
+	forEachRefSort     []string
+	forEachRefCount    int
+	forEachRefPointsAt string
+)
+
+var forEachRefCmd = &cobra.Command{
+	Use:   "for-each-ref [--format=<format>] [--sort=<key>...] [--count=<n>] [--points-at=<object>] [<pattern>...]",
+	Short: "Output information on each ref",
+	Long: `Lists every ref matching the patterns (all refs by default), one line per
+ref formatted by --format. A pattern matches a ref either as a glob over the
+full name or as a prefix ending at a slash, so "refs/heads" lists branches.
+
+The format interpolates %(<atom>) placeholders, %% and %xx hex escapes.
+Useful atoms include:
+
+  %(refname) %(refname:short) %(refname:lstrip=2)
+  %(objectname) %(objectname:short) %(objecttype) %(objectsize)
+  %(subject) %(contents:subject) %(contents:body) %(HEAD)
+  %(authorname) %(authoremail) %(authordate) %(committerdate:iso)
+  %(taggerdate:relative) %(creatordate:short)
+  %(upstream) %(upstream:short) %(upstream:track) %(upstream:trackshort)
+
+Prefixing an atom with * reads it from the object an annotated tag points
+at, e.g. %(*objectname). --sort takes any atom, or version:refname, and is
+reversed with a leading "-"; the last --sort is the primary key:
+
+  senpai for-each-ref --sort=-committerdate --count=5 refs/heads
+  senpai for-each-ref --format='%(refname:short) %(upstream:track)' refs/heads
+  senpai for-each-ref --points-at=HEAD refs/tags`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		repoPath, err := os.Getwd()
+		if err != nil {
+			return fmt.Errorf("failed to get working directory: %w", err)
+		}
+
+		return core.ForEachRef(repoPath, core.ForEachRefOptions{
+			Format:   forEachRefFormat,
+			Sort:     forEachRefSort,
+			Count:    forEachRefCount,
+			PointsAt: forEachRefPointsAt,
+			Patterns: args,
+		}, os.Stdout)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(forEachRefCmd)
+	forEachRefCmd.Flags().StringVar(&forEachRefFormat, "format", "", "Format string with %(atom) placeholders")
+	forEachRefCmd.Flags().StringArrayVar(&forEachRefSort, "sort", nil, "Sort by this atom; prefix with - for descending order")
+	forEachRefCmd.Flags().IntVar(&forEachRefCount, "count", 0, "Stop after this many refs")
+	forEachRefCmd.Flags().StringVar(&forEachRefPointsAt, "points-at", "", "Only list refs pointing at this object")
+}
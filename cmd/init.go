@@ -9,12 +9,13 @@ import (
 
 // initCmd represents the init command
 var initialBranch string
+var initRefFormat string
 var initCmd = &cobra.Command{
 	Use:   "init",
 	Short: "Initializes an empty git repository in the current directory",
 	Long:  `This command creates an empty Git repository - basically a .git directory with subdirectories for objects, refs/heads, refs/tags, and template files. An initial branch without any commits will be created`,
 	Run: func(cmd *cobra.Command, args []string) {
-		if err := core.InitRepo(".", initialBranch); err != nil {
+		if err := core.InitRepoWithRefFormat(".", initialBranch, initRefFormat); err != nil {
 			fmt.Println("Error:", err)
 			return
 		}
@@ -28,4 +29,5 @@ func init() {
 	// Cobra supports local flags which will only run when this command
 	// is called directly, e.g.:
 	initCmd.Flags().StringVar(&initialBranch, "initial-branch", "master", "Name of initial branch")
+	initCmd.Flags().StringVar(&initRefFormat, "ref-format", core.RefFormatFiles, "Ref storage format: files or reftable")
 }
@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"fmt"
+	"os"
 	"senpai/core"
 	"time"
 
@@ -9,35 +10,215 @@ import (
 )
 
 var logCmd = &cobra.Command{
-	Use:   "log",
+	Use:   "log [<revision-range>...] [-- <path>...]",
 	Short: "show commit logs",
-	Long:  "show commit logs",
+	Long: `Show the commits reachable from the given revisions (HEAD by default).
+
+Revisions can be prefixed with ^ to exclude what they reach, and ranges
+are written A..B (reachable from B but not A) or A...B (reachable from
+either but not both):
+
+  senpai log main..feature
+  senpai log v1.0~3 ^v0.9
+  senpai log HEAD@{u}...HEAD
+
+--pretty picks a preset layout or a format string, and --format takes a
+format string directly:
+
+  senpai log --oneline --decorate
+  senpai log --format='%h %an %ad%d %s' --date=short
+
+Format strings understand %H/%h (commit), %T/%t (tree), %P/%p (parents),
+%an/%ae/%ad and %cn/%ce/%cd (author and committer, with %ar, %at, %ai,
+%aI and %as variants of the date), %s/%b/%B (subject, body, message),
+%d/%D (decorations), %n and %%.
+
+Commits can be limited by count, author, message and date, and to those
+that change the given paths:
+
+  senpai log -n 5 --skip 10
+  senpai log --author='^Ann' --grep=fix -i --since='2 weeks ago'
+  senpai log main -- core/ README.md
+
+-S finds the commits that change how often a string occurs in a file, such
+as the ones that added or removed a function, and -G those whose diff adds
+or removes a line matching a regular expression. --follow tracks a single
+file back through the renames in its history:
+
+  senpai log -S parseConfig
+  senpai log -G 'TODO|FIXME' -- core/
+  senpai log --follow -- cmd/catFile.go
+
+-p, --stat, --name-only and --name-status show what each commit changed
+since its first parent, limited to the given paths:
+
+  senpai log -p -n 1
+  senpai log --stat --oneline -- core/`,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		commits, err := core.Log(".")
+		opts := core.WalkOptions{
+			Reverse:     logReverse,
+			FirstParent: logFirstParent,
+			MaxCount:    logMaxCount,
+			Skip:        logSkip,
+			Author:      logAuthor,
+			Committer:   logCommitter,
+			Grep:        logGrep,
+			AllMatch:    logAllMatch,
+			IgnoreCase:  logIgnoreCase,
+
+			PickaxeString: logPickaxeString,
+			PickaxeRegex:  logPickaxeRegex,
+			PickaxeAll:    logPickaxeAll,
+			Follow:        logFollow,
+		}
+		var err error
+		if dash := cmd.ArgsLenAtDash(); dash >= 0 {
+			args, opts.Paths = args[:dash], args[dash:]
+		} else if args, opts.Paths, err = core.SplitRevisionsAndPaths(".", args, logFollow); err != nil {
+			return err
+		}
+		if logSince != "" {
+			if opts.Since, err = core.ParseApproxidate(logSince, time.Now()); err != nil {
+				return err
+			}
+		}
+		if logUntil != "" {
+			if opts.Until, err = core.ParseApproxidate(logUntil, time.Now()); err != nil {
+				return err
+			}
+		}
+		switch {
+		case logTopoOrder:
+			opts.Order = core.OrderTopo
+		case logAuthorDateOrder:
+			opts.Order = core.OrderAuthorDate
+		case logDateOrder:
+			opts.Order = core.OrderDate
+		case logGraph:
+			opts.Order = core.OrderTopo
+		}
+		if logGraph && logReverse {
+			return fmt.Errorf("options '--reverse' and '--graph' cannot be used together")
+		}
+		if logNameOnly && logNameStatus {
+			return fmt.Errorf("options '--name-only' and '--name-status' cannot be used together")
+		}
+
+		pretty := core.PrettyOptions{Format: logPretty, Date: logDate, AbbrevCommit: logAbbrevCommit, Decorate: logDecorate}
+		if logOneline {
+			pretty.Format, pretty.AbbrevCommit = "oneline", true
+		}
+		if logFormat != "" {
+			pretty.Format = logFormat
+		}
+		formatter, err := core.NewCommitFormatter(".", pretty)
 		if err != nil {
-			return fmt.Errorf("error reading log: %w", err)
+			return err
 		}
 
-		for _, commit := range commits {
-			fmt.Printf("commit %s\n", commit.Hash)
+		walker, err := core.WalkRevisions(".", args, opts)
+		if err != nil {
+			return fmt.Errorf("error reading log: %w", err)
+		}
 
-			if commit.Author != "" && commit.Email != "" {
-				fmt.Printf("Author: %s <%s>\n", commit.Author, commit.Email)
+		var graph *core.Graph
+		if logGraph {
+			graph = core.NewGraph()
+		}
+		diffFormat := core.DiffFormat{Patch: logPatch, Stat: logStat, NameOnly: logNameOnly, NameStatus: logNameStatus}
+		out := core.NewLogWriter(os.Stdout, formatter, graph)
+		for walker.Next() {
+			commit := walker.Commit()
+			var render func(width int) (string, error)
+			if !diffFormat.IsZero() {
+				render = func(width int) (string, error) {
+					changes, err := walker.Changes(commit)
+					if err != nil {
+						return "", err
+					}
+					return core.FormatDiff(".", changes, diffFormat, width)
+				}
 			}
-
-			if commit.Timestamp > 0 {
-				t := time.Unix(commit.Timestamp, 0)
-				dateStr := t.Format("Mon Jan 2 15:04:05 2006")
-				fmt.Printf("Date:   %s %s\n", dateStr, commit.Timezone)
+			if err := out.WriteWithDiff(commit, walker.Parents(commit), diffFormat, render); err != nil {
+				return err
 			}
-
-			fmt.Printf("\n    %s\n\n", commit.Message)
+		}
+		if err := walker.Err(); err != nil {
+			return fmt.Errorf("error reading log: %w", err)
 		}
 
 		return nil
 	},
 }
 
+var (
+	logTopoOrder       bool
+	logDateOrder       bool
+	logAuthorDateOrder bool
+	logReverse         bool
+	logFirstParent     bool
+
+	logOneline      bool
+	logPretty       string
+	logFormat       string
+	logDate         string
+	logDecorate     bool
+	logAbbrevCommit bool
+	logGraph        bool
+
+	logMaxCount   int
+	logSkip       int
+	logAuthor     []string
+	logCommitter  []string
+	logGrep       []string
+	logAllMatch   bool
+	logIgnoreCase bool
+	logSince      string
+	logUntil      string
+
+	logPickaxeString string
+	logPickaxeRegex  string
+	logPickaxeAll    bool
+	logFollow        bool
+
+	logPatch      bool
+	logStat       bool
+	logNameOnly   bool
+	logNameStatus bool
+)
+
 func init() {
+	logCmd.Flags().BoolVar(&logTopoOrder, "topo-order", false, "show no parents before all of their children, without interleaving lines of history")
+	logCmd.Flags().BoolVar(&logDateOrder, "date-order", false, "show no parents before all of their children, otherwise by commit date")
+	logCmd.Flags().BoolVar(&logAuthorDateOrder, "author-date-order", false, "show no parents before all of their children, otherwise by author date")
+	logCmd.Flags().BoolVar(&logReverse, "reverse", false, "output the selected commits in reverse order")
+	logCmd.Flags().BoolVar(&logFirstParent, "first-parent", false, "follow only the first parent of merge commits")
+	logCmd.Flags().BoolVar(&logOneline, "oneline", false, "shorthand for --pretty=oneline --abbrev-commit")
+	logCmd.Flags().StringVar(&logPretty, "pretty", "", "pretty-print with a preset (oneline, short, medium, full, fuller, raw) or format:<string>")
+	logCmd.Flags().Lookup("pretty").NoOptDefVal = "medium"
+	logCmd.Flags().StringVar(&logFormat, "format", "", "pretty-print with a format string such as '%h %s'")
+	logCmd.Flags().StringVar(&logDate, "date", "", "date style: relative, local, iso, iso-strict, rfc, short, raw, unix or format:<strftime>")
+	logCmd.Flags().BoolVar(&logDecorate, "decorate", false, "show the refs pointing at each commit")
+	logCmd.Flags().BoolVar(&logAbbrevCommit, "abbrev-commit", false, "show abbreviated commit hashes")
+	logCmd.Flags().BoolVar(&logGraph, "graph", false, "draw the commit history as a graph beside the log")
+	logCmd.Flags().IntVarP(&logMaxCount, "max-count", "n", 0, "show at most this many commits")
+	logCmd.Flags().IntVar(&logSkip, "skip", 0, "skip this many commits before showing any")
+	logCmd.Flags().StringArrayVar(&logAuthor, "author", nil, "show commits whose author matches the regular expression")
+	logCmd.Flags().StringArrayVar(&logCommitter, "committer", nil, "show commits whose committer matches the regular expression")
+	logCmd.Flags().StringArrayVar(&logGrep, "grep", nil, "show commits whose message matches the regular expression")
+	logCmd.Flags().BoolVar(&logAllMatch, "all-match", false, "require every --grep pattern to match")
+	logCmd.Flags().BoolVarP(&logIgnoreCase, "regexp-ignore-case", "i", false, "match --author, --committer, --grep, -S and -G patterns regardless of case")
+	logCmd.Flags().StringVar(&logSince, "since", "", "show commits more recent than a date")
+	logCmd.Flags().StringVar(&logSince, "after", "", "same as --since")
+	logCmd.Flags().StringVar(&logUntil, "until", "", "show commits older than a date")
+	logCmd.Flags().StringVar(&logUntil, "before", "", "same as --until")
+	logCmd.Flags().StringVarP(&logPickaxeString, "pickaxe-string", "S", "", "show commits that change the number of occurrences of the string")
+	logCmd.Flags().StringVarP(&logPickaxeRegex, "pickaxe-grep", "G", "", "show commits whose diff adds or removes a line matching the regular expression")
+	logCmd.Flags().BoolVar(&logPickaxeAll, "pickaxe-all", false, "with -S or -G, take all the changes of a matching commit rather than only the matching files")
+	logCmd.Flags().BoolVar(&logFollow, "follow", false, "follow a single file back through renames")
+	logCmd.Flags().BoolVarP(&logPatch, "patch", "p", false, "show the changes each commit makes as a patch")
+	logCmd.Flags().BoolVar(&logStat, "stat", false, "show a diffstat of the changes each commit makes")
+	logCmd.Flags().BoolVar(&logNameOnly, "name-only", false, "show the names of the files each commit changes")
+	logCmd.Flags().BoolVar(&logNameStatus, "name-status", false, "show the names of the files each commit changes and how they changed")
 	rootCmd.AddCommand(logCmd)
 }
@@ -0,0 +1,50 @@
+package cmd
+
+import (
+	"os"
+	"senpai/core"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	lsFilesCached          bool
+	lsFilesStage           bool
+	lsFilesModified        bool
+	lsFilesDeleted         bool
+	lsFilesOthers          bool
+	lsFilesExcludeStandard bool
+)
+
+var lsFilesCmd = &cobra.Command{
+	Use:   "ls-files [-c] [-s] [-m] [-d] [-o] [--exclude-standard] [<path>...]",
+	Short: "Show information about files in the index and the working tree",
+	Long: `Lists the paths in the index. -s shows the mode, hash and stage of each
+entry, so an unmerged path is listed once per version. -m and -d list the
+tracked files that are modified or deleted in the working tree, and -o the
+untracked ones, skipping those .gitignore excludes with --exclude-standard.
+
+  senpai ls-files -s
+  senpai ls-files -o --exclude-standard`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		opts := core.LsFilesOptions{
+			Cached:          lsFilesCached,
+			Stage:           lsFilesStage,
+			Modified:        lsFilesModified,
+			Deleted:         lsFilesDeleted,
+			Others:          lsFilesOthers,
+			ExcludeStandard: lsFilesExcludeStandard,
+		}
+		return core.LsFiles(".", os.Stdout, args, opts)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(lsFilesCmd)
+	lsFilesCmd.Flags().BoolVarP(&lsFilesCached, "cached", "c", false, "Show the files in the index (the default)")
+	lsFilesCmd.Flags().BoolVarP(&lsFilesStage, "stage", "s", false, "Show the mode, hash and stage of index entries")
+	lsFilesCmd.Flags().BoolVarP(&lsFilesModified, "modified", "m", false, "Show files modified in the working tree")
+	lsFilesCmd.Flags().BoolVarP(&lsFilesDeleted, "deleted", "d", false, "Show files deleted from the working tree")
+	lsFilesCmd.Flags().BoolVarP(&lsFilesOthers, "others", "o", false, "Show untracked files")
+	lsFilesCmd.Flags().BoolVar(&lsFilesExcludeStandard, "exclude-standard", false, "Leave out untracked files that .gitignore excludes")
+}
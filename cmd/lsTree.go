@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"senpai/core"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	lsTreeRecursive bool
+	lsTreeShowTrees bool
+	lsTreeLong      bool
+	lsTreeNameOnly  bool
+)
+
+var lsTreeCmd = &cobra.Command{
+	Use:   "ls-tree [-r] [-t] [-l] [--name-only] <tree-ish> [<path>...]",
+	Short: "List the contents of a tree object",
+	Long: `Lists the entries of a tree, or of the tree of a commit or tag, as
+"<mode> <type> <hash>\t<path>" lines. With -r, subtrees are listed by their
+contents instead, and -t keeps the subtrees in the listing as well.
+
+Paths limit the listing: "dir" lists the tree itself and "dir/" its entries.
+
+  senpai ls-tree HEAD
+  senpai ls-tree -r --name-only HEAD
+  senpai ls-tree -l main core/`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if lsTreeLong && lsTreeNameOnly {
+			return fmt.Errorf("options '--name-only' and '-l' cannot be used together")
+		}
+		opts := core.LsTreeOptions{
+			Recursive: lsTreeRecursive,
+			ShowTrees: lsTreeShowTrees,
+			Long:      lsTreeLong,
+			NameOnly:  lsTreeNameOnly,
+		}
+		return core.LsTree(".", os.Stdout, args[0], args[1:], opts)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(lsTreeCmd)
+	lsTreeCmd.Flags().BoolVarP(&lsTreeRecursive, "recursive", "r", false, "Recurse into subtrees")
+	lsTreeCmd.Flags().BoolVarP(&lsTreeShowTrees, "trees", "t", false, "Show subtrees even when recursing into them")
+	lsTreeCmd.Flags().BoolVarP(&lsTreeLong, "long", "l", false, "Show the size of blobs")
+	lsTreeCmd.Flags().BoolVar(&lsTreeNameOnly, "name-only", false, "List only the paths")
+}
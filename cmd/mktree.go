@@ -0,0 +1,35 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"senpai/core"
+
+	"github.com/spf13/cobra"
+)
+
+var mktreeMissing bool
+
+var mktreeCmd = &cobra.Command{
+	Use:   "mktree [--missing]",
+	Short: "Build a tree object from ls-tree formatted text",
+	Long: `Reads "<mode> <type> <hash>\t<name>" lines, as ls-tree writes them, from
+standard input and writes a tree object with those entries, printing its
+hash. The objects the entries name must exist unless --missing is given.
+
+  senpai ls-tree HEAD | grep -v old.txt | senpai mktree`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		hash, err := core.Mktree(".", os.Stdin, mktreeMissing)
+		if err != nil {
+			return err
+		}
+		fmt.Println(hash)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(mktreeCmd)
+	mktreeCmd.Flags().BoolVar(&mktreeMissing, "missing", false, "Allow entries naming objects that don't exist")
+}
@@ -0,0 +1,47 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"senpai/core"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	packRefsAll     bool
+	packRefsPrune   bool
+	packRefsNoPrune bool
+)
+
+var packRefsCmd = &cobra.Command{
+	Use:   "pack-refs [--all] [--no-prune]",
+	Short: "Pack heads and tags for efficient repository access",
+	Long: `Moves refs from individual files under .senpai/refs into the single
+.senpai/packed-refs file. Tags are always packed; --all packs branches and
+every other ref as well. Annotated tags are stored together with the commit
+they peel to.
+
+Packed refs are read alongside loose ones, and a loose ref always wins over
+a packed entry of the same name. The loose copies are removed after packing
+unless --no-prune is given.
+
+In a repository using the reftable ref format, the table stack is compacted
+into a single table instead.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		repoPath, err := os.Getwd()
+		if err != nil {
+			return fmt.Errorf("failed to get working directory: %w", err)
+		}
+
+		return core.PackRefs(repoPath, packRefsAll, packRefsPrune && !packRefsNoPrune)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(packRefsCmd)
+	packRefsCmd.Flags().BoolVar(&packRefsAll, "all", false, "Pack all refs, not just tags and already packed refs")
+	packRefsCmd.Flags().BoolVar(&packRefsPrune, "prune", true, "Remove loose refs after packing them")
+	packRefsCmd.Flags().BoolVar(&packRefsNoPrune, "no-prune", false, "Keep loose refs after packing them")
+}
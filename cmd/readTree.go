@@ -0,0 +1,35 @@
+package cmd
+
+import (
+	"senpai/core"
+
+	"github.com/spf13/cobra"
+)
+
+var readTreeMerge bool
+
+var readTreeCmd = &cobra.Command{
+	Use:   "read-tree [-m] <tree-ish> [<tree-ish> [<tree-ish>]]",
+	Short: "Read tree information into the index",
+	Long: `Replaces the index with the files of a tree. The working tree is not
+touched; checkout-index writes the index out.
+
+With -m, two trees move the index from the first to the second, keeping
+changes that don't conflict, and three trees merge the last two with the
+first as their common ancestor. Paths that merge trivially are staged,
+and the rest are left unmerged with an entry per version, as ls-files -s
+shows:
+
+  senpai read-tree HEAD
+  senpai read-tree -m HEAD feature
+  senpai read-tree -m base HEAD feature`,
+	Args: cobra.RangeArgs(1, 3),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return core.ReadTree(".", args, readTreeMerge)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(readTreeCmd)
+	readTreeCmd.Flags().BoolVarP(&readTreeMerge, "merge", "m", false, "Merge the trees into the index")
+}
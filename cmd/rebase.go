@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"senpai/core"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	rebaseInteractive bool
+	rebaseAutosquash  bool
+	rebaseOnto        string
+	rebaseContinue    bool
+	rebaseSkip        bool
+	rebaseAbort       bool
+)
+
+var rebaseCmd = &cobra.Command{
+	Use:   "rebase [flags] <upstream>",
+	Short: "Reapply commits on top of another base tip",
+	Long: `Replays the commits of the current branch that are not in <upstream>
+on top of <upstream> (or the commit given with --onto).
+
+With -i the list of commits is opened in your editor (core.editor) first, where
+each line can be changed to pick, reword, edit, squash, fixup, drop, exec or
+break. With --autosquash, commits whose subject starts with "fixup! " or
+"squash! " are moved after the commit they refer to.
+
+If the rebase stops because of a conflict, an edit or a break, fix things up
+and run "senpai rebase --continue". "senpai rebase --abort" puts the branch
+back where it was before the rebase started.
+
+Examples:
+  senpai rebase main
+  senpai rebase -i HEAD~3
+  senpai rebase -i --autosquash main
+  senpai rebase --onto main feature
+`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		repoPath, err := os.Getwd()
+		if err != nil {
+			return fmt.Errorf("failed to get working directory: %w", err)
+		}
+
+		if rebaseAbort {
+			return core.RebaseAbort(repoPath)
+		}
+
+		name, email, err := committerIdentity()
+		if err != nil {
+			return err
+		}
+
+		var msg string
+		switch {
+		case rebaseContinue:
+			msg, err = core.RebaseContinue(repoPath, name, email)
+		case rebaseSkip:
+			msg, err = core.RebaseSkip(repoPath, name, email)
+		default:
+			if len(args) == 0 {
+				return fmt.Errorf("no upstream specified")
+			}
+			msg, err = core.Rebase(repoPath, core.RebaseOptions{
+				Upstream:       args[0],
+				Onto:           rebaseOnto,
+				Interactive:    rebaseInteractive,
+				Autosquash:     rebaseAutosquash,
+				CommitterName:  name,
+				CommitterEmail: email,
+			})
+		}
+		if err != nil {
+			return err
+		}
+
+		fmt.Println(msg)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(rebaseCmd)
+	rebaseCmd.Flags().BoolVarP(&rebaseInteractive, "interactive", "i", false, "Edit the list of commits before rebasing")
+	rebaseCmd.Flags().BoolVar(&rebaseAutosquash, "autosquash", false, "Move fixup!/squash! commits next to their targets")
+	rebaseCmd.Flags().StringVar(&rebaseOnto, "onto", "", "Starting point at which to create the new commits")
+	rebaseCmd.Flags().BoolVar(&rebaseContinue, "continue", false, "Continue the rebase after resolving a stop")
+	rebaseCmd.Flags().BoolVar(&rebaseSkip, "skip", false, "Skip the current commit and continue")
+	rebaseCmd.Flags().BoolVar(&rebaseAbort, "abort", false, "Abort and restore the original branch")
+}
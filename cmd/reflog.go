@@ -0,0 +1,127 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"senpai/core"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	reflogExpire    string
+	reflogExpireAll bool
+)
+
+var reflogCmd = &cobra.Command{
+	Use:   "reflog [show] [<ref>]",
+	Short: "Manage reflog information",
+	Long: `Reference logs record when the tips of branches and HEAD were updated.
+Any entry can be named as <ref>@{<n>} or <ref>@{<date>} wherever a revision
+is expected, which makes it possible to recover from a bad reset:
+
+  senpai reflog                    # Show the HEAD reflog
+  senpai reflog show main          # Show the reflog of main
+  senpai reset --hard HEAD@{1}     # Undo the last HEAD movement
+  senpai log main@{yesterday}      # Where main was a day ago
+  senpai reflog expire --expire=30.days.ago --all
+  senpai reflog delete HEAD@{2}`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return showReflog(args)
+	},
+}
+
+var reflogShowCmd = &cobra.Command{
+	Use:   "show [<ref>]",
+	Short: "Show the log of a reference",
+	Args:  cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return showReflog(args)
+	},
+}
+
+var reflogExpireCmd = &cobra.Command{
+	Use:   "expire [--expire=<time>] [--all | <ref>...]",
+	Short: "Prune older reflog entries",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		repoPath, err := os.Getwd()
+		if err != nil {
+			return fmt.Errorf("failed to get working directory: %w", err)
+		}
+
+		before := time.Now()
+		if reflogExpire != "all" {
+			if before, err = core.ParseApproxidate(reflogExpire, time.Now()); err != nil {
+				return err
+			}
+		}
+
+		refs := args
+		if reflogExpireAll {
+			if refs, err = core.ListReflogs(repoPath); err != nil {
+				return err
+			}
+		} else if len(refs) == 0 {
+			return fmt.Errorf("no reflog specified; use --all to expire every reflog")
+		}
+
+		for _, ref := range refs {
+			if _, err := core.ExpireReflog(repoPath, ref, before); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+}
+
+var reflogDeleteCmd = &cobra.Command{
+	Use:   "delete <ref>@{<n>}...",
+	Short: "Delete entries from the reflog",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		repoPath, err := os.Getwd()
+		if err != nil {
+			return fmt.Errorf("failed to get working directory: %w", err)
+		}
+
+		for _, spec := range args {
+			if err := core.DeleteReflogEntry(repoPath, spec); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+}
+
+func showReflog(args []string) error {
+	repoPath, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("failed to get working directory: %w", err)
+	}
+
+	name := "HEAD"
+	if len(args) > 0 {
+		name = args[0]
+	}
+
+	entries, err := core.Reflog(repoPath, name)
+	if err != nil {
+		return err
+	}
+	for i, entry := range entries {
+		fmt.Printf("%s %s@{%d}: %s\n", entry.NewHash[:7], name, i, entry.Message)
+	}
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(reflogCmd)
+	reflogCmd.AddCommand(reflogShowCmd)
+	reflogCmd.AddCommand(reflogExpireCmd)
+	reflogCmd.AddCommand(reflogDeleteCmd)
+
+	reflogExpireCmd.Flags().StringVar(&reflogExpire, "expire", "90.days.ago", "Prune entries older than this time")
+	reflogExpireCmd.Flags().BoolVar(&reflogExpireAll, "all", false, "Process the reflogs of all references")
+}
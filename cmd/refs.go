@@ -0,0 +1,53 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"senpai/core"
+
+	"github.com/spf13/cobra"
+)
+
+var refsMigrateFormat string
+
+var refsCmd = &cobra.Command{
+	Use:   "refs",
+	Short: "Low-level access to the ref database",
+	Long: `Refs are stored either as files (one file per ref under .senpai/refs,
+plus .senpai/packed-refs) or in a reftable stack under .senpai/reftable. The
+format is recorded in extensions.refStorage and chosen with
+"senpai init --ref-format".
+
+  senpai refs migrate --ref-format=reftable   # Move every ref into reftables
+  senpai refs migrate --ref-format=files      # And back again`,
+}
+
+var refsMigrateCmd = &cobra.Command{
+	Use:   "migrate --ref-format=<format>",
+	Short: "Move refs into a different ref storage format",
+	Long: `Copies HEAD and every ref into the given storage format, switches the
+repository over to it and removes the old storage. Reflogs are kept in
+.senpai/logs with either format and are not touched.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		repoPath, err := os.Getwd()
+		if err != nil {
+			return fmt.Errorf("failed to get working directory: %w", err)
+		}
+		if refsMigrateFormat == "" {
+			return fmt.Errorf("missing --ref-format")
+		}
+
+		if err := core.MigrateRefStorage(repoPath, refsMigrateFormat); err != nil {
+			return err
+		}
+		fmt.Printf("Migrated refs to the %s format\n", refsMigrateFormat)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(refsCmd)
+	refsCmd.AddCommand(refsMigrateCmd)
+	refsMigrateCmd.Flags().StringVar(&refsMigrateFormat, "ref-format", "", "Target ref storage format: files or reftable")
+}
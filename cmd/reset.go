@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"senpai/core"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	resetSoft  bool
+	resetMixed bool
+	resetHard  bool
+)
+
+var resetCmd = &cobra.Command{
+	Use:   "reset [--soft | --mixed | --hard] [<commit>] [-- <paths>...]",
+	Short: "Reset current HEAD to the specified state",
+	Long: `Moves the current branch to <commit> (HEAD by default).
+
+  --soft   only move the branch; the index and working tree are left alone
+  --mixed  also reset the index to <commit> (the default)
+  --hard   also reset tracked files in the working tree, discarding changes
+
+With paths, the branch is not moved; instead the index entries for those paths
+are restored from <commit>, which unstages changes made to them.
+
+Examples:
+  senpai reset HEAD~1
+  senpai reset --hard main
+  senpai reset -- notes.txt
+  senpai reset a1b2c3d -- src
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		repoPath, err := os.Getwd()
+		if err != nil {
+			return fmt.Errorf("failed to get working directory: %w", err)
+		}
+
+		rev := ""
+		var paths []string
+		if dash := cmd.ArgsLenAtDash(); dash >= 0 {
+			if dash > 1 {
+				return fmt.Errorf("only one commit may be given before --")
+			}
+			if dash == 1 {
+				rev = args[0]
+			}
+			paths = args[dash:]
+		} else {
+			if rev, paths, err = core.SplitResetArgs(repoPath, args); err != nil {
+				return err
+			}
+		}
+
+		modes := 0
+		for _, set := range []bool{resetSoft, resetMixed, resetHard} {
+			if set {
+				modes++
+			}
+		}
+		if modes > 1 {
+			return fmt.Errorf("--soft, --mixed and --hard are mutually exclusive")
+		}
+
+		if len(paths) > 0 {
+			if resetSoft || resetHard {
+				return fmt.Errorf("cannot do a soft or hard reset with paths")
+			}
+			return core.ResetPaths(repoPath, rev, paths)
+		}
+
+		mode := core.ResetMixed
+		if resetSoft {
+			mode = core.ResetSoft
+		} else if resetHard {
+			mode = core.ResetHard
+		}
+
+		commit, err := core.Reset(repoPath, rev, mode)
+		if err != nil {
+			return err
+		}
+
+		if mode == core.ResetHard {
+			fmt.Printf("HEAD is now at %s %s\n", commit.Hash[:7], commit.Subject())
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(resetCmd)
+	resetCmd.Flags().BoolVar(&resetSoft, "soft", false, "Only move HEAD")
+	resetCmd.Flags().BoolVar(&resetMixed, "mixed", false, "Move HEAD and reset the index (default)")
+	resetCmd.Flags().BoolVar(&resetHard, "hard", false, "Move HEAD and reset the index and working tree")
+}
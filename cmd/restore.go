@@ -0,0 +1,42 @@
+package cmd
+
+import (
+	"senpai/core"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	restoreSource   string
+	restoreStaged   bool
+	restoreWorktree bool
+)
+
+var restoreCmd = &cobra.Command{
+	Use:   "restore [--source=<tree>] [--staged] [--worktree] <paths>...",
+	Short: "Restore working tree files",
+	Long: `Restore the given paths in the working tree from the index, or in the
+index from HEAD with --staged. Use --source to restore from another commit.
+Tracked files that don't exist in the source are removed.
+
+Examples:
+  senpai restore notes.txt
+  senpai restore --staged notes.txt
+  senpai restore --source=HEAD~2 --staged --worktree src
+`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return core.Restore(".", args, core.RestoreOptions{
+			Source:   restoreSource,
+			Staged:   restoreStaged,
+			Worktree: restoreWorktree,
+		})
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(restoreCmd)
+	restoreCmd.Flags().StringVarP(&restoreSource, "source", "s", "", "Restore from the given tree-ish")
+	restoreCmd.Flags().BoolVarP(&restoreStaged, "staged", "S", false, "Restore the index")
+	restoreCmd.Flags().BoolVarP(&restoreWorktree, "worktree", "W", false, "Restore the working tree (default)")
+}
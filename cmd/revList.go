@@ -0,0 +1,132 @@
+package cmd
+
+import (
+	"os"
+	"senpai/core"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	revListCount      bool
+	revListLeftRight  bool
+	revListObjects    bool
+	revListMaxParents int
+	revListMinParents int
+	revListMerges     bool
+	revListNoMerges   bool
+	revListNot        revListNotFlag
+
+	revListMaxCount    int
+	revListSkip        int
+	revListReverse     bool
+	revListTopoOrder   bool
+	revListDateOrder   bool
+	revListFirstParent bool
+)
+
+// revListNotFlag records where --not appears among the revisions: the flag
+// is set once pflag has collected the arguments before it.
+type revListNotFlag struct {
+	positions []int
+}
+
+func (f *revListNotFlag) String() string { return "false" }
+func (f *revListNotFlag) Type() string   { return "bool" }
+
+func (f *revListNotFlag) Set(string) error {
+	f.positions = append(f.positions, len(revListCmd.Flags().Args()))
+	return nil
+}
+
+var revListCmd = &cobra.Command{
+	Use:   "rev-list [<options>] <revision>... [-- <path>...]",
+	Short: "Lists commit objects in reverse chronological order",
+	Long: `Lists the commits reachable from the given revisions, newest first, one
+hash per line. Revisions are written as for log: ^A excludes what A
+reaches, A..B and A...B are ranges, and --not flips the meaning of the
+revisions that follow it.
+
+  senpai rev-list main ^v1.0
+  senpai rev-list feature --not main
+  senpai rev-list --count HEAD
+
+--left-right marks the commits of a symmetric difference with the side
+they come from, and with --count counts each side:
+
+  senpai rev-list --left-right --count main...feature
+
+--max-parents and --min-parents select commits by their number of parents,
+so --max-parents=0 finds root commits. --objects also lists every tree and
+blob the commits have that the excluded ones don't:
+
+  senpai rev-list --objects v1.0..v1.1`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		walk := core.WalkOptions{
+			Reverse:     revListReverse,
+			FirstParent: revListFirstParent,
+			MaxCount:    revListMaxCount,
+			Skip:        revListSkip,
+			MinParents:  revListMinParents,
+		}
+		if dash := cmd.ArgsLenAtDash(); dash >= 0 {
+			args, walk.Paths = args[:dash], args[dash:]
+		}
+		if revListMerges {
+			walk.MinParents = 2
+		}
+		if revListNoMerges {
+			noMerges := 1
+			walk.MaxParents = &noMerges
+		}
+		if revListMaxParents >= 0 {
+			walk.MaxParents = &revListMaxParents
+		}
+		switch {
+		case revListTopoOrder:
+			walk.Order = core.OrderTopo
+		case revListDateOrder:
+			walk.Order = core.OrderDate
+		}
+
+		var revisions []string
+		positions := revListNot.positions
+		for i, arg := range args {
+			for len(positions) > 0 && positions[0] <= i {
+				revisions, positions = append(revisions, "--not"), positions[1:]
+			}
+			revisions = append(revisions, arg)
+		}
+		revs, err := core.ParseRevisionArgs(".", revisions)
+		if err != nil {
+			return err
+		}
+
+		opts := core.RevListOptions{
+			Count:     revListCount,
+			LeftRight: revListLeftRight,
+			Objects:   revListObjects,
+		}
+		return core.RevList(".", os.Stdout, revs, walk, opts)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(revListCmd)
+	revListCmd.Flags().BoolVar(&revListCount, "count", false, "Print the number of commits instead of listing them")
+	revListCmd.Flags().BoolVar(&revListLeftRight, "left-right", false, "Mark which side of a symmetric difference each commit comes from")
+	revListCmd.Flags().BoolVar(&revListObjects, "objects", false, "Also list the trees and blobs the commits reference")
+	revListCmd.Flags().IntVar(&revListMaxParents, "max-parents", -1, "List only commits with at most this many parents (-1 for no limit)")
+	revListCmd.Flags().IntVar(&revListMinParents, "min-parents", 0, "List only commits with at least this many parents")
+	revListCmd.Flags().BoolVar(&revListMerges, "merges", false, "List only merge commits, same as --min-parents=2")
+	revListCmd.Flags().BoolVar(&revListNoMerges, "no-merges", false, "Leave out merge commits, same as --max-parents=1")
+	revListCmd.Flags().Var(&revListNot, "not", "Flip between including and excluding the revisions that follow")
+	revListCmd.Flags().Lookup("not").NoOptDefVal = "true"
+	revListCmd.Flags().IntVarP(&revListMaxCount, "max-count", "n", 0, "List at most this many commits")
+	revListCmd.Flags().IntVar(&revListSkip, "skip", 0, "Skip this many commits before listing any")
+	revListCmd.Flags().BoolVar(&revListReverse, "reverse", false, "List the selected commits in reverse order")
+	revListCmd.Flags().BoolVar(&revListTopoOrder, "topo-order", false, "List no parents before all of their children, without interleaving lines of history")
+	revListCmd.Flags().BoolVar(&revListDateOrder, "date-order", false, "List no parents before all of their children, otherwise by commit date")
+	revListCmd.Flags().BoolVar(&revListFirstParent, "first-parent", false, "Follow only the first parent of merge commits")
+}
@@ -0,0 +1,49 @@
+package cmd
+
+import (
+	"senpai/core"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	revertNoCommit bool
+	revertMainline int
+	revertContinue bool
+	revertSkip     bool
+	revertAbort    bool
+)
+
+var revertCmd = &cobra.Command{
+	Use:   "revert [flags] <commit>...",
+	Short: "Revert some existing commits",
+	Long: `Given one or more existing commits, revert the changes they introduce,
+recording a new commit for each that undoes it.
+
+If a revert conflicts, resolve the conflict, "senpai add" the files and run
+"senpai revert --continue", or give up with "senpai revert --abort".
+A revert that changes nothing stops the sequence too: "--continue" commits
+it anyway and "--skip" drops it.
+
+Examples:
+  senpai revert a1b2c3d
+  senpai revert -n a1b2c3d d4e5f6a
+  senpai revert -m 1 d4e5f6a
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runSequencerCommand(args, revertContinue, revertSkip, revertAbort, func(repoPath string, opts core.CherryPickOptions) (string, error) {
+			opts.NoCommit = revertNoCommit
+			opts.Mainline = revertMainline
+			return core.Revert(repoPath, args, opts)
+		})
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(revertCmd)
+	revertCmd.Flags().BoolVarP(&revertNoCommit, "no-commit", "n", false, "Apply the inverse changes without committing")
+	revertCmd.Flags().IntVarP(&revertMainline, "mainline", "m", 0, "Parent number to diff against when reverting a merge")
+	revertCmd.Flags().BoolVar(&revertContinue, "continue", false, "Continue after resolving conflicts")
+	revertCmd.Flags().BoolVar(&revertSkip, "skip", false, "Drop the commit the sequence stopped at and continue")
+	revertCmd.Flags().BoolVar(&revertAbort, "abort", false, "Cancel and return to the pre-sequence state")
+}
@@ -0,0 +1,53 @@
+package cmd
+
+import (
+	"os"
+	"senpai/core"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	shortlogSummary  bool
+	shortlogNumbered bool
+	shortlogEmail    bool
+)
+
+var shortlogCmd = &cobra.Command{
+	Use:   "shortlog [-s] [-n] [-e] [<revision-range>...] [-- <path>...]",
+	Short: "Summarize log output",
+	Long: `Groups the commits reachable from the given revisions (HEAD by default) by
+author, listing each author with their number of commits and the subjects
+of those commits. Authors are sorted by name, or with -n by number of
+commits.
+
+Names and emails are mapped through the .mailmap file at the top of the
+worktree, so one person committing under several identities is counted
+once:
+
+  senpai shortlog v1.0..v1.1
+  senpai shortlog -sne`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var walk core.WalkOptions
+		if dash := cmd.ArgsLenAtDash(); dash >= 0 {
+			args, walk.Paths = args[:dash], args[dash:]
+		}
+		walker, err := core.WalkRevisions(".", args, walk)
+		if err != nil {
+			return err
+		}
+		opts := core.ShortlogOptions{
+			Summary:  shortlogSummary,
+			Numbered: shortlogNumbered,
+			Email:    shortlogEmail,
+		}
+		return core.Shortlog(".", os.Stdout, walker, opts)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(shortlogCmd)
+	shortlogCmd.Flags().BoolVarP(&shortlogSummary, "summary", "s", false, "Show only the number of commits of each author")
+	shortlogCmd.Flags().BoolVarP(&shortlogNumbered, "numbered", "n", false, "Sort authors by number of commits")
+	shortlogCmd.Flags().BoolVarP(&shortlogEmail, "email", "e", false, "Show the email of each author")
+}
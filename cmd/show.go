@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"senpai/core"
+
+	"github.com/spf13/cobra"
+)
+
+var showCmd = &cobra.Command{
+	Use:   "show [<object>...]",
+	Short: "show various types of objects",
+	Long: `Show one or more objects (HEAD by default).
+
+A commit is shown with its log message and the changes it made as a patch;
+a merge with a combined diff that only shows what differs from all of its
+parents. An annotated tag is shown with its message, followed by the
+object it tags. A tree lists its entries, and a blob prints its content:
+
+  senpai show
+  senpai show v1.0 main~2
+  senpai show HEAD:core/ HEAD:README.md
+
+--format, --pretty and the other log options pick how commits look, and
+--stat, --name-only and --name-status replace the patch:
+
+  senpai show --stat --oneline
+  senpai show -s --format='%h %an %s'`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) == 0 {
+			args = []string{"HEAD"}
+		}
+		names := 0
+		for _, set := range []bool{showNameOnly, showNameStatus, showNoPatch} {
+			if set {
+				names++
+			}
+		}
+		if names > 1 {
+			return fmt.Errorf("options '--name-only', '--name-status' and '-s' cannot be used together")
+		}
+
+		pretty := core.PrettyOptions{Format: showPretty, Date: showDate, AbbrevCommit: showAbbrevCommit, Decorate: showDecorate}
+		if showOneline {
+			pretty.Format, pretty.AbbrevCommit = "oneline", true
+		}
+		if showFormat != "" {
+			pretty.Format = showFormat
+		}
+
+		diff := core.DiffFormat{Patch: showPatch, Stat: showStat, NameOnly: showNameOnly, NameStatus: showNameStatus}
+		if diff.IsZero() {
+			diff.Patch = true
+		}
+		if showNoPatch {
+			diff = core.DiffFormat{}
+		}
+
+		return core.Show(".", os.Stdout, args, core.ShowOptions{Pretty: pretty, Diff: diff})
+	},
+}
+
+var (
+	showOneline      bool
+	showPretty       string
+	showFormat       string
+	showDate         string
+	showDecorate     bool
+	showAbbrevCommit bool
+
+	showPatch      bool
+	showStat       bool
+	showNameOnly   bool
+	showNameStatus bool
+	showNoPatch    bool
+)
+
+func init() {
+	showCmd.Flags().BoolVar(&showOneline, "oneline", false, "shorthand for --pretty=oneline --abbrev-commit")
+	showCmd.Flags().StringVar(&showPretty, "pretty", "", "pretty-print with a preset (oneline, short, medium, full, fuller, raw) or format:<string>")
+	showCmd.Flags().Lookup("pretty").NoOptDefVal = "medium"
+	showCmd.Flags().StringVar(&showFormat, "format", "", "pretty-print with a format string such as '%h %s'")
+	showCmd.Flags().StringVar(&showDate, "date", "", "date style: relative, local, iso, iso-strict, rfc, short, raw, unix or format:<strftime>")
+	showCmd.Flags().BoolVar(&showDecorate, "decorate", false, "show the refs pointing at each commit")
+	showCmd.Flags().BoolVar(&showAbbrevCommit, "abbrev-commit", false, "show abbreviated commit hashes")
+	showCmd.Flags().BoolVarP(&showPatch, "patch", "p", false, "show the changes as a patch (the default)")
+	showCmd.Flags().BoolVar(&showStat, "stat", false, "show a diffstat of the changes")
+	showCmd.Flags().BoolVar(&showNameOnly, "name-only", false, "show the names of the changed files")
+	showCmd.Flags().BoolVar(&showNameStatus, "name-status", false, "show the names of the changed files and how they changed")
+	showCmd.Flags().BoolVarP(&showNoPatch, "no-patch", "s", false, "show no changes, only the commit")
+	rootCmd.AddCommand(showCmd)
+}
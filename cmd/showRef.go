@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"senpai/core"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	showRefHeads       bool
+	showRefTags        bool
+	showRefHead        bool
+	showRefDereference bool
+	showRefHash        int
+	showRefAbbrev      int
+	showRefVerify      bool
+	showRefQuiet       bool
+)
+
+var showRefCmd = &cobra.Command{
+	Use:   "show-ref [--heads] [--tags] [-d] [-s] [--verify [-q]] [<pattern>...]",
+	Short: "List references in a local repository",
+	Long: `Shows refs and the objects they point at as "<hash> <ref>" lines. A pattern
+matches the end of a ref name on a slash boundary, so "main" matches both
+refs/heads/main and refs/remotes/origin/main.
+
+With --verify, each argument must be an exact ref name such as
+refs/heads/main, and the command fails if one doesn't exist:
+
+  senpai show-ref --heads                  # All branches
+  senpai show-ref --tags -d                # Tags, plus peeled annotated tags
+  senpai show-ref --verify -q refs/tags/v1 # Exit status only`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		repoPath, err := os.Getwd()
+		if err != nil {
+			return fmt.Errorf("failed to get working directory: %w", err)
+		}
+
+		opts := core.ShowRefOptions{
+			Heads:       showRefHeads,
+			Tags:        showRefTags,
+			Head:        showRefHead,
+			Dereference: showRefDereference,
+			HashOnly:    cmd.Flags().Changed("hash"),
+			Abbrev:      max(showRefHash, showRefAbbrev),
+			Verify:      showRefVerify,
+		}
+		if opts.Verify && len(args) == 0 {
+			return fmt.Errorf("--verify requires a reference")
+		}
+
+		var out io.Writer = os.Stdout
+		if showRefQuiet {
+			out = io.Discard
+		}
+		count, err := core.ShowRef(repoPath, args, opts, out)
+		if err != nil && !showRefQuiet {
+			return err
+		}
+		// like git, finding nothing is only reported through the exit status
+		if err != nil || count == 0 {
+			os.Exit(1)
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(showRefCmd)
+	showRefCmd.Flags().BoolVar(&showRefHeads, "heads", false, "Only show branches")
+	showRefCmd.Flags().BoolVar(&showRefTags, "tags", false, "Only show tags")
+	showRefCmd.Flags().BoolVar(&showRefHead, "head", false, "Show HEAD as well")
+	showRefCmd.Flags().BoolVarP(&showRefDereference, "dereference", "d", false, "Also show the objects annotated tags point at")
+	showRefCmd.Flags().IntVarP(&showRefHash, "hash", "s", 0, "Only show object names, abbreviated to n digits when given")
+	showRefCmd.Flags().Lookup("hash").NoOptDefVal = "0"
+	showRefCmd.Flags().IntVar(&showRefAbbrev, "abbrev", 0, "Abbreviate object names to n digits")
+	showRefCmd.Flags().BoolVar(&showRefVerify, "verify", false, "Require exact ref names")
+	showRefCmd.Flags().BoolVarP(&showRefQuiet, "quiet", "q", false, "Print nothing; only set the exit status")
+}
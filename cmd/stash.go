@@ -0,0 +1,196 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"senpai/core"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	stashIncludeUntracked bool
+	stashKeepIndex        bool
+	stashMessage          string
+	stashRestoreIndex     bool
+)
+
+var stashCmd = &cobra.Command{
+	Use:   "stash",
+	Short: "Stash the changes in a dirty working directory away",
+	Long: `Record the current state of the working directory and the index, and go
+back to a clean working directory. Without a subcommand this is "stash push".
+
+Examples:
+  senpai stash
+  senpai stash push -u -m "half-done refactor"
+  senpai stash list
+  senpai stash pop stash@{1}
+`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runStashPush(nil)
+	},
+}
+
+var stashPushCmd = &cobra.Command{
+	Use:   "push [-u] [-k] [-m <message>] [-- <paths>...]",
+	Short: "Save local modifications to a new stash entry",
+	Long: `Save your local modifications to a new stash entry and roll them back to
+HEAD. With paths, only changes to those paths are stashed.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runStashPush(args)
+	},
+}
+
+var stashPopCmd = &cobra.Command{
+	Use:   "pop [--index] [<stash>]",
+	Short: "Apply a stash entry and remove it from the stash list",
+	Long:  `Apply a stash entry (stash@{0} by default) and drop it if it applied without conflicts.`,
+	Args:  cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		repoPath, err := os.Getwd()
+		if err != nil {
+			return fmt.Errorf("getting current directory: %w", err)
+		}
+
+		entry, err := core.StashPop(repoPath, optionalArg(args), stashRestoreIndex)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Dropped stash@{%d} (%s)\n", entry.Index, entry.Hash)
+		return nil
+	},
+}
+
+var stashApplyCmd = &cobra.Command{
+	Use:   "apply [--index] [<stash>]",
+	Short: "Apply a stash entry on top of the working directory",
+	Long:  `Like pop, but do not remove the entry from the stash list.`,
+	Args:  cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		repoPath, err := os.Getwd()
+		if err != nil {
+			return fmt.Errorf("getting current directory: %w", err)
+		}
+
+		_, err = core.StashApply(repoPath, optionalArg(args), stashRestoreIndex)
+		return err
+	},
+}
+
+var stashListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the stash entries",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		repoPath, err := os.Getwd()
+		if err != nil {
+			return fmt.Errorf("getting current directory: %w", err)
+		}
+
+		entries, err := core.StashList(repoPath)
+		if err != nil {
+			return err
+		}
+
+		for _, entry := range entries {
+			fmt.Printf("stash@{%d}: %s\n", entry.Index, entry.Message)
+		}
+		return nil
+	},
+}
+
+var stashDropCmd = &cobra.Command{
+	Use:   "drop [<stash>]",
+	Short: "Remove a single stash entry",
+	Args:  cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		repoPath, err := os.Getwd()
+		if err != nil {
+			return fmt.Errorf("getting current directory: %w", err)
+		}
+
+		entry, err := core.StashDrop(repoPath, optionalArg(args))
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Dropped stash@{%d} (%s)\n", entry.Index, entry.Hash)
+		return nil
+	},
+}
+
+var stashShowCmd = &cobra.Command{
+	Use:   "show [<stash>]",
+	Short: "Show the changes recorded in a stash entry",
+	Args:  cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		repoPath, err := os.Getwd()
+		if err != nil {
+			return fmt.Errorf("getting current directory: %w", err)
+		}
+
+		stats, err := core.StashShow(repoPath, optionalArg(args))
+		if err != nil {
+			return err
+		}
+
+		fmt.Print(core.FormatDiffStat(stats))
+		return nil
+	},
+}
+
+func runStashPush(paths []string) error {
+	repoPath, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("getting current directory: %w", err)
+	}
+
+	name, email, err := authorIdentity()
+	if err != nil {
+		return err
+	}
+
+	msg, err := core.StashPush(repoPath, core.StashOptions{
+		Message:          stashMessage,
+		IncludeUntracked: stashIncludeUntracked,
+		KeepIndex:        stashKeepIndex,
+		Paths:            paths,
+		Name:             name,
+		Email:            email,
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(msg)
+	return nil
+}
+
+func optionalArg(args []string) string {
+	if len(args) == 0 {
+		return ""
+	}
+	return args[0]
+}
+
+func init() {
+	rootCmd.AddCommand(stashCmd)
+	stashCmd.AddCommand(stashPushCmd)
+	stashCmd.AddCommand(stashPopCmd)
+	stashCmd.AddCommand(stashApplyCmd)
+	stashCmd.AddCommand(stashListCmd)
+	stashCmd.AddCommand(stashDropCmd)
+	stashCmd.AddCommand(stashShowCmd)
+
+	for _, c := range []*cobra.Command{stashCmd, stashPushCmd} {
+		c.Flags().BoolVarP(&stashIncludeUntracked, "include-untracked", "u", false, "Also stash untracked files")
+		c.Flags().BoolVarP(&stashKeepIndex, "keep-index", "k", false, "Leave changes already added to the index intact")
+		c.Flags().StringVarP(&stashMessage, "message", "m", "", "Description for the stash entry")
+	}
+	stashPopCmd.Flags().BoolVar(&stashRestoreIndex, "index", false, "Also restore the staged changes")
+	stashApplyCmd.Flags().BoolVar(&stashRestoreIndex, "index", false, "Also restore the staged changes")
+}
@@ -0,0 +1,73 @@
+package cmd
+
+import (
+	"fmt"
+	"senpai/core"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	switchCreate string
+	switchOrphan string
+	switchDetach bool
+	switchForce  bool
+	switchMerge  bool
+)
+
+var switchCmd = &cobra.Command{
+	Use:   "switch [flags] [<branch> | <start-point>]",
+	Short: "Switch branches",
+	Long: `Switch to a specified branch. The working tree and the index are updated
+to match the branch, and local changes are carried over as with checkout.
+
+Examples:
+  senpai switch main
+  senpai switch -c feature/api
+  senpai switch -c hotfix v1.0
+  senpai switch --detach HEAD~2
+  senpai switch --orphan gh-pages
+`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if switchForce && switchMerge {
+			return fmt.Errorf("--discard-changes and --merge are incompatible")
+		}
+
+		target := ""
+		if len(args) > 0 {
+			target = args[0]
+		}
+
+		if err := core.Switch(".", target, core.SwitchOptions{
+			Create: switchCreate,
+			Orphan: switchOrphan,
+			Detach: switchDetach,
+			Force:  switchForce,
+			Merge:  switchMerge,
+		}); err != nil {
+			return err
+		}
+
+		switch {
+		case switchCreate != "":
+			fmt.Printf("Switched to a new branch '%s'\n", switchCreate)
+		case switchOrphan != "":
+			fmt.Printf("Switched to a new branch '%s'\n", switchOrphan)
+		case switchDetach:
+			fmt.Printf("HEAD is now detached at %s\n", target)
+		default:
+			fmt.Printf("Switched to branch '%s'\n", target)
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(switchCmd)
+	switchCmd.Flags().StringVarP(&switchCreate, "create", "c", "", "Create a new branch and switch to it")
+	switchCmd.Flags().StringVar(&switchOrphan, "orphan", "", "Create a new branch with no history")
+	switchCmd.Flags().BoolVarP(&switchDetach, "detach", "d", false, "Detach HEAD at the named commit")
+	switchCmd.Flags().BoolVarP(&switchForce, "discard-changes", "f", false, "Throw away local changes")
+	switchCmd.Flags().BoolVarP(&switchMerge, "merge", "m", false, "Merge local changes into the target branch")
+}
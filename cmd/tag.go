@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"senpai/core"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	tagAnnotate bool
+	tagMessage  string
+	tagDelete   bool
+	tagList     bool
+	tagForce    bool
+	tagSort     string
+)
+
+var tagCmd = &cobra.Command{
+	Use:   "tag [flags] [<name> [<commit>] | <pattern>...]",
+	Short: "Create, list or delete tags",
+	Long: `Manage tags in your repository.
+
+Lightweight tags are plain references stored under .senpai/refs/tags/.
+Annotated tags (-a or -m) point at a tag object that also records who made
+the tag, when, and a message.
+
+  senpai tag v1.0                       # Tag HEAD
+  senpai tag -a v1.1 -m "Release 1.1"   # Create an annotated tag
+  senpai tag v0.9 a1b2c3d               # Tag an older commit
+  senpai tag -d v0.9                    # Delete a tag
+  senpai tag -l "v1.*"                  # List tags matching a pattern
+  senpai tag --sort=version:refname     # List tags in version order`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		repoPath, err := os.Getwd()
+		if err != nil {
+			return fmt.Errorf("failed to get working directory: %w", err)
+		}
+
+		if tagDelete {
+			if len(args) == 0 {
+				return fmt.Errorf("tag name required")
+			}
+			for _, name := range args {
+				hash, err := core.DeleteTag(repoPath, name)
+				if err != nil {
+					return err
+				}
+				fmt.Printf("Deleted tag '%s' (was %s)\n", name, hash[:7])
+			}
+			return nil
+		}
+
+		if tagList || len(args) == 0 {
+			tags, err := core.ListTags(repoPath, args, tagSort)
+			if err != nil {
+				return err
+			}
+			for _, tag := range tags {
+				fmt.Println(tag)
+			}
+			return nil
+		}
+
+		if len(args) > 2 {
+			return fmt.Errorf("too many arguments")
+		}
+		target := ""
+		if len(args) == 2 {
+			target = args[1]
+		}
+
+		opts := core.TagOptions{
+			Annotate: tagAnnotate,
+			Message:  tagMessage,
+			Force:    tagForce,
+		}
+		if tagAnnotate || tagMessage != "" {
+			if opts.Name, opts.Email, err = authorIdentity(); err != nil {
+				return err
+			}
+		}
+
+		_, err = core.CreateTag(repoPath, args[0], target, opts)
+		return err
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(tagCmd)
+	tagCmd.Flags().BoolVarP(&tagAnnotate, "annotate", "a", false, "Make an annotated tag object")
+	tagCmd.Flags().StringVarP(&tagMessage, "message", "m", "", "Tag message (implies -a)")
+	tagCmd.Flags().BoolVarP(&tagDelete, "delete", "d", false, "Delete tags")
+	tagCmd.Flags().BoolVarP(&tagList, "list", "l", false, "List tags, optionally matching patterns")
+	tagCmd.Flags().BoolVarP(&tagForce, "force", "f", false, "Replace an existing tag")
+	tagCmd.Flags().StringVar(&tagSort, "sort", "", "Sort tags by refname or version:refname (prefix - to reverse)")
+}
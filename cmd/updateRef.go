@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"senpai/core"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	updateRefMessage string
+	updateRefDelete  bool
+	updateRefNoDeref bool
+	updateRefStdin   bool
+)
+
+var updateRefCmd = &cobra.Command{
+	Use:   "update-ref [-m <reason>] [--no-deref] (-d <ref> [<old>] | <ref> <new> [<old>] | --stdin)",
+	Short: "Update the object name stored in a ref safely",
+	Long: `Updates a ref to point at a new object, optionally only if it currently
+points at <old>. An <old> of all zeros means the ref must not exist yet.
+The ref is locked while it is written, so concurrent updates can't be lost.
+
+With --stdin, commands are read from standard input and applied as a single
+atomic transaction: either every ref is updated or none is.
+
+  update <ref> <new> [<old>]
+  create <ref> <new>
+  delete <ref> [<old>]
+  verify <ref> [<old>]
+  option no-deref
+
+The control commands start, prepare, commit and abort manage transactions
+explicitly and are acknowledged with "<command>: ok" on standard output.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		repoPath, err := os.Getwd()
+		if err != nil {
+			return fmt.Errorf("failed to get working directory: %w", err)
+		}
+
+		switch {
+		case updateRefStdin:
+			if len(args) > 0 {
+				return fmt.Errorf("--stdin takes no arguments")
+			}
+			return core.UpdateRefStdin(repoPath, os.Stdin, os.Stdout, updateRefMessage)
+		case updateRefDelete:
+			if len(args) < 1 || len(args) > 2 {
+				return fmt.Errorf("usage: update-ref -d <ref> [<old>]")
+			}
+			return core.DeleteRefChecked(repoPath, args[0], optionalArg(args[1:]), updateRefMessage, updateRefNoDeref)
+		default:
+			if len(args) < 2 || len(args) > 3 {
+				return fmt.Errorf("usage: update-ref <ref> <new> [<old>]")
+			}
+			return core.UpdateRef(repoPath, args[0], args[1], optionalArg(args[2:]), updateRefMessage, updateRefNoDeref)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(updateRefCmd)
+	updateRefCmd.Flags().StringVarP(&updateRefMessage, "message", "m", "", "Reason recorded in the reflog")
+	updateRefCmd.Flags().BoolVarP(&updateRefDelete, "delete", "d", false, "Delete the ref")
+	updateRefCmd.Flags().BoolVar(&updateRefNoDeref, "no-deref", false, "Update a symbolic ref itself rather than the ref it points at")
+	updateRefCmd.Flags().BoolVar(&updateRefStdin, "stdin", false, "Read update commands from standard input")
+}
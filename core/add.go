@@ -41,18 +41,24 @@ func addSingleFile(repoPath string, filePath string) error {
 		lines = strings.Split(strings.TrimSpace(string(data)), "\n")
 	}
 
+	// adding a path replaces its entry, and resolves it when it is
+	// unmerged by dropping the entries of its other stages
 	found := false
-	for i, line := range lines {
+	kept := lines[:0]
+	for _, line := range lines {
 		parts := strings.Fields(line)
 		if len(parts) >= 2 && parts[1] == filePath {
-			lines[i] = strings.TrimSpace(entry)
-			found = true
-			break
+			if !found {
+				kept = append(kept, strings.TrimSpace(entry))
+				found = true
+			}
+			continue
 		}
+		kept = append(kept, line)
 	}
 	if !found {
-		lines = append(lines, strings.TrimSpace(entry))
+		kept = append(kept, strings.TrimSpace(entry))
 	}
 
-	return os.WriteFile(repoIndex, []byte(strings.Join(lines, "\n")+"\n"), 0644)
+	return os.WriteFile(repoIndex, []byte(strings.Join(kept, "\n")+"\n"), 0644)
 }
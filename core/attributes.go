@@ -0,0 +1,130 @@
+package core
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// attributeRule is one line of .gitattributes: a pattern and the values it
+// gives the attributes it names.
+type attributeRule struct {
+	rule  ignoreRule
+	attrs map[string]string
+}
+
+// loadAttributes reads the .gitattributes file at the top of the worktree.
+// "name=value" gives an attribute a value, "name" sets it to "true", "-name"
+// unsets it to "false" and "!name" leaves it unspecified.
+func loadAttributes(repoPath string) ([]attributeRule, error) {
+	data, err := os.ReadFile(filepath.Join(repoPath, GitAttributesFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var rules []attributeRule
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		r := attributeRule{attrs: make(map[string]string)}
+		pattern := fields[0]
+		if strings.HasPrefix(pattern, "/") {
+			r.rule.rootAnchored = true
+			pattern = pattern[1:]
+		}
+		r.rule.pattern = pattern
+		for _, attr := range fields[1:] {
+			switch {
+			case strings.HasPrefix(attr, "-"):
+				r.attrs[attr[1:]] = "false"
+			case strings.HasPrefix(attr, "!"):
+				r.attrs[attr[1:]] = ""
+			default:
+				name, value, ok := strings.Cut(attr, "=")
+				if !ok {
+					value = "true"
+				}
+				r.attrs[name] = value
+			}
+		}
+		rules = append(rules, r)
+	}
+	return rules, nil
+}
+
+// attributeValue returns the value that the last rule matching path gives
+// the attribute name, or "" when none does.
+func attributeValue(rules []attributeRule, path, name string) string {
+	value := ""
+	for _, r := range rules {
+		if v, ok := r.attrs[name]; ok && ruleMatches(r.rule, path) {
+			value = v
+		}
+	}
+	return value
+}
+
+// textconvDrivers holds what is needed to find the textconv command for a
+// path: the attribute rules and the configuration. Load it once per run of
+// a command rather than once per blob.
+type textconvDrivers struct {
+	repoPath string
+	rules    []attributeRule
+	config   *GitConfig
+}
+
+func loadTextconvDrivers(repoPath string) (*textconvDrivers, error) {
+	rules, err := loadAttributes(repoPath)
+	if err != nil {
+		return nil, err
+	}
+	// without a readable config no driver has a command
+	config, _ := ParseConfig(repoPath)
+	return &textconvDrivers{repoPath: repoPath, rules: rules, config: config}, nil
+}
+
+// textconv converts the content of the blob at path with the textconv
+// command of its diff driver, set with the "diff" attribute and configured
+// as diff.<driver>.textconv. Content without one is returned as it is.
+func (d *textconvDrivers) textconv(path string, content []byte) ([]byte, error) {
+	driver := attributeValue(d.rules, path, "diff")
+	if driver == "" || driver == "true" || driver == "false" || d.config == nil {
+		return content, nil
+	}
+	command := d.config.Sections[fmt.Sprintf("diff \"%s\"", driver)]["textconv"]
+	if command == "" {
+		return content, nil
+	}
+
+	// like git, hand the command a temporary file holding the content
+	file, err := os.CreateTemp("", "senpai-textconv-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(file.Name())
+	if _, err := file.Write(content); err != nil {
+		file.Close()
+		return nil, err
+	}
+	if err := file.Close(); err != nil {
+		return nil, err
+	}
+
+	var out, stderr bytes.Buffer
+	cmd := exec.Command("sh", "-c", command+` "$@"`, command, file.Name())
+	cmd.Dir = d.repoPath
+	cmd.Stdout = &out
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("textconv '%s' failed for %s: %w: %s", command, path, err, strings.TrimSpace(stderr.String()))
+	}
+	return out.Bytes(), nil
+}
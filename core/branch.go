@@ -2,48 +2,23 @@ package core
 
 import (
 	"fmt"
-	"os"
-	"path/filepath"
 	"strings"
 )
 
 func ListBranches(repoPath string) ([]string, error) {
-	refsHeadsPath := filepath.Join(repoPath, RepoDirName, "refs", "heads")
-
-	if _, err := os.Stat(refsHeadsPath); os.IsNotExist(err) {
-		return []string{}, nil
-	}
-
-	var branches []string
-
-	err := filepath.Walk(refsHeadsPath, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-
-		if info.IsDir() {
-			return nil
-		}
-
-		relPath, err := filepath.Rel(refsHeadsPath, path)
-		if err != nil {
-			return err
-		}
-
-		branches = append(branches, relPath)
-		return nil
-	})
-
+	refs, err := listRefs(repoPath, "refs/heads/")
 	if err != nil {
 		return nil, fmt.Errorf("failed to list branches: %w", err)
 	}
 
+	branches := []string{}
+	for _, name := range sortedRefNames(refs) {
+		branches = append(branches, strings.TrimPrefix(name, "refs/heads/"))
+	}
 	return branches, nil
 }
 
 func CreateBranch(repoPath, branchName string) error {
-	repoDir := filepath.Join(repoPath, RepoDirName)
-
 	exists, err := BranchExists(repoPath, branchName)
 	if err != nil {
 		return err
@@ -52,92 +27,219 @@ func CreateBranch(repoPath, branchName string) error {
 		return fmt.Errorf("branch '%s' already exists", branchName)
 	}
 
-	headPath := filepath.Join(repoDir, "HEAD")
-	headContent, err := os.ReadFile(headPath)
+	commitHash, err := resolveHead(repoPath)
 	if err != nil {
-		return fmt.Errorf("failed to read HEAD: %w", err)
+		return err
+	}
+	if commitHash == "" {
+		return fmt.Errorf("cannot create branch: no commits yet")
 	}
 
-	headStr := strings.TrimSpace(string(headContent))
-	var commitHash string
-
-	if strings.HasPrefix(headStr, "ref: ") {
-		refPath := strings.TrimPrefix(headStr, "ref: ")
-		refFullPath := filepath.Join(repoDir, refPath)
+	return createBranch(repoPath, branchName, commitHash, "HEAD")
+}
 
-		refContent, err := os.ReadFile(refFullPath)
-		if err != nil {
-			return fmt.Errorf("cannot create branch: no commits yet")
-		}
-		commitHash = strings.TrimSpace(string(refContent))
-	} else {
-		commitHash = headStr
+// CreateBranchAt creates a branch pointing at the commit startPoint names,
+// which may be any revision.
+func CreateBranchAt(repoPath, branchName, startPoint string) error {
+	commitHash, err := resolveCommitish(repoPath, startPoint)
+	if err != nil {
+		return err
 	}
+	return createBranch(repoPath, branchName, commitHash, startPoint)
+}
 
-	if commitHash == "" {
-		return fmt.Errorf("cannot create branch: no commits yet")
+func createBranch(repoPath, branchName, commitHash, startPoint string) error {
+	exists, err := BranchExists(repoPath, branchName)
+	if err != nil {
+		return err
 	}
-
-	branchPath := filepath.Join(repoDir, "refs", "heads", branchName)
-	if err := os.MkdirAll(filepath.Dir(branchPath), 0755); err != nil {
-		return fmt.Errorf("failed to create branch directory: %w", err)
+	if exists {
+		return fmt.Errorf("branch '%s' already exists", branchName)
 	}
 
-	if err := os.WriteFile(branchPath, []byte(commitHash+"\n"), 0644); err != nil {
+	tx := BeginRefTransaction(repoPath)
+	if err := tx.Create("refs/heads/"+branchName, commitHash, "branch: Created from "+startPoint); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
 		return fmt.Errorf("failed to create branch: %w", err)
 	}
 
 	return nil
 }
 
-func DeleteBranch(repoPath, branchName string) error {
-	repoDir := filepath.Join(repoPath, RepoDirName)
-
-	exists, err := BranchExists(repoPath, branchName)
+// DeleteBranch deletes a branch along with its reflog and config. Unless
+// force is set, the branch must be merged into its upstream, or into HEAD
+// when it has none, so that no commits are lost.
+func DeleteBranch(repoPath, branchName string, force bool) error {
+	hash, err := ResolveBranchCommit(repoPath, branchName)
 	if err != nil {
 		return err
 	}
-	if !exists {
-		return fmt.Errorf("branch '%s' not found", branchName)
-	}
 
 	currentBranch, err := GetCurrentBranch(repoPath)
 	if err == nil && currentBranch == branchName {
 		return fmt.Errorf("cannot delete branch '%s': currently checked out", branchName)
 	}
 
-	branchPath := filepath.Join(repoDir, "refs", "heads", branchName)
-	if err := os.Remove(branchPath); err != nil {
+	if !force {
+		merged, err := branchIsMerged(repoPath, branchName, hash)
+		if err != nil {
+			return err
+		}
+		if !merged {
+			return fmt.Errorf("the branch '%s' is not fully merged; if you are sure you want to delete it, run 'senpai branch -D %s'", branchName, branchName)
+		}
+	}
+
+	if err := deleteRef(repoPath, "refs/heads/"+branchName); err != nil {
 		return fmt.Errorf("failed to delete branch: %w", err)
 	}
+	if err := deleteReflog(repoPath, "refs/heads/"+branchName); err != nil {
+		return err
+	}
+	if err := RemoveConfigSection(repoPath, branchSection(branchName)); err != nil {
+		return err
+	}
 
 	return nil
 }
 
-func BranchExists(repoPath, branchName string) (bool, error) {
-	branchPath := filepath.Join(repoPath, RepoDirName, "refs", "heads", branchName)
-	_, err := os.Stat(branchPath)
+// branchIsMerged reports whether hash, the tip of branch, is reachable from
+// the branch's upstream or, without one, from HEAD.
+func branchIsMerged(repoPath, branch, hash string) (bool, error) {
+	target := ""
+	if upstream, err := upstreamRef(repoPath, branch); err == nil {
+		target, _, _ = readRef(repoPath, upstream)
+	}
+	if target == "" {
+		head, err := resolveHead(repoPath)
+		if err != nil {
+			return false, err
+		}
+		target = head
+	}
+	if target == "" {
+		return false, nil
+	}
+	return isAncestor(repoPath, hash, target)
+}
 
-	if err == nil {
-		return true, nil
+// RenameBranch renames oldName (the current branch when empty) to newName,
+// moving its reflog and config along and updating HEAD if it points at the
+// branch. An existing newName is only overwritten with force.
+func RenameBranch(repoPath, oldName, newName string, force bool) error {
+	return moveBranch(repoPath, oldName, newName, force, false)
+}
+
+// CopyBranch creates newName as a copy of oldName (the current branch when
+// empty), including its reflog and config.
+func CopyBranch(repoPath, oldName, newName string, force bool) error {
+	return moveBranch(repoPath, oldName, newName, force, true)
+}
+
+func moveBranch(repoPath, oldName, newName string, force, copy bool) error {
+	oldName, err := branchOrCurrent(repoPath, oldName)
+	if err != nil {
+		return err
+	}
+	if err := validateRefName(newName); err != nil {
+		return err
+	}
+	hash, err := ResolveBranchCommit(repoPath, oldName)
+	if err != nil {
+		return err
 	}
 
-	if os.IsNotExist(err) {
-		return false, nil
+	oldRef, newRef := "refs/heads/"+oldName, "refs/heads/"+newName
+	existing, exists, err := readRef(repoPath, newRef)
+	if err != nil {
+		return err
+	}
+	current, _ := GetCurrentBranch(repoPath)
+	if exists && oldName != newName {
+		if !force {
+			return fmt.Errorf("a branch named '%s' already exists", newName)
+		}
+		if current == newName {
+			return fmt.Errorf("cannot force update the current branch")
+		}
+	}
+
+	action, verb := "rename", "renamed"
+	if copy {
+		action, verb = "copy", "copied"
+	}
+	message := fmt.Sprintf("Branch: %s %s to %s", verb, oldRef, newRef)
+	if oldName == newName {
+		if copy {
+			return fmt.Errorf("cannot copy branch '%s' onto itself", oldName)
+		}
+		return nil
+	}
+
+	if exists {
+		if err := deleteReflog(repoPath, newRef); err != nil {
+			return err
+		}
+	}
+	if copy {
+		err = copyReflog(repoPath, oldRef, newRef)
+	} else {
+		err = renameReflog(repoPath, oldRef, newRef)
+	}
+	if err != nil {
+		return err
+	}
+
+	tx := BeginRefTransaction(repoPath)
+	if !exists {
+		existing = zeroHash
+	}
+	if err := tx.Update(newRef, hash, existing, message); err != nil {
+		return err
+	}
+	if !copy {
+		if err := tx.Delete(oldRef, hash, message); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		if !copy {
+			renameReflog(repoPath, newRef, oldRef)
+		}
+		return fmt.Errorf("failed to %s branch: %w", action, err)
+	}
+
+	if !copy && current == oldName {
+		if err := writeSymref(repoPath, "HEAD", newRef); err != nil {
+			return err
+		}
 	}
 
-	return false, fmt.Errorf("failed to check branch existence: %w", err)
+	if err := RemoveConfigSection(repoPath, branchSection(newName)); err != nil {
+		return err
+	}
+	if copy {
+		return CopyConfigSection(repoPath, branchSection(oldName), branchSection(newName))
+	}
+	return RenameConfigSection(repoPath, branchSection(oldName), branchSection(newName))
+}
+
+func BranchExists(repoPath, branchName string) (bool, error) {
+	_, ok, err := readRef(repoPath, "refs/heads/"+branchName)
+	if err != nil {
+		return false, fmt.Errorf("failed to check branch existence: %w", err)
+	}
+	return ok, nil
 }
 
 func GetCurrentBranch(repoPath string) (string, error) {
-	headPath := filepath.Join(repoPath, RepoDirName, "HEAD")
-	headContent, err := os.ReadFile(headPath)
+	headStr, _, err := readRawRef(repoPath, "HEAD")
 	if err != nil {
 		return "", fmt.Errorf("failed to read HEAD: %w", err)
 	}
 
-	headStr := strings.TrimSpace(string(headContent))
-
 	if strings.HasPrefix(headStr, "ref: ") {
 		refPath := strings.TrimPrefix(headStr, "ref: ")
 		if strings.HasPrefix(refPath, "refs/heads/") {
@@ -151,20 +253,224 @@ func GetCurrentBranch(repoPath string) (string, error) {
 }
 
 func ResolveBranchCommit(repoPath, branchName string) (string, error) {
-	branchPath := filepath.Join(repoPath, RepoDirName, "refs", "heads", branchName)
+	commitHash, ok, err := readRef(repoPath, "refs/heads/"+branchName)
+	if err != nil {
+		return "", fmt.Errorf("failed to read branch: %w", err)
+	}
+	if !ok {
+		return "", fmt.Errorf("branch '%s' not found", branchName)
+	}
+	return commitHash, nil
+}
+
+// BranchInfo describes a branch the way "branch -v" lists it.
+type BranchInfo struct {
+	// Name is the branch name, or remotes/<remote>/<branch> for a
+	// remote-tracking branch.
+	Name     string
+	Hash     string
+	Subject  string
+	Remote   bool
+	Tracking *TrackingInfo
+}
 
-	content, err := os.ReadFile(branchPath)
+// TrackingInfo relates a branch to its configured upstream.
+type TrackingInfo struct {
+	// Upstream is the short name of the upstream, such as origin/main.
+	Upstream string
+	Ahead    int
+	Behind   int
+	// Gone is set when the upstream is configured but its ref is missing.
+	Gone bool
+}
+
+// BranchListOptions selects the branches ListBranchInfo describes.
+type BranchListOptions struct {
+	// Remotes adds the remote-tracking branches under refs/remotes.
+	Remotes bool
+	// Merged keeps only branches whose tip is reachable from this commit.
+	Merged string
+	// NoMerged keeps only branches whose tip isn't reachable from it.
+	NoMerged string
+	// Contains keeps only branches that contain this commit.
+	Contains string
+}
+
+// ListBranchInfo describes every local branch, followed by the
+// remote-tracking branches when requested, filtered by opts.
+func ListBranchInfo(repoPath string, opts BranchListOptions) ([]BranchInfo, error) {
+	prefixes := []string{"refs/heads/"}
+	if opts.Remotes {
+		prefixes = append(prefixes, "refs/remotes/")
+	}
+	filter, err := branchFilter(repoPath, opts)
 	if err != nil {
-		if os.IsNotExist(err) {
-			return "", fmt.Errorf("branch '%s' not found", branchName)
+		return nil, err
+	}
+
+	var infos []BranchInfo
+	for _, prefix := range prefixes {
+		refs, err := listRefs(repoPath, prefix)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list branches: %w", err)
+		}
+		for _, ref := range sortedRefNames(refs) {
+			if keep, err := filter(refs[ref]); err != nil {
+				return nil, err
+			} else if !keep {
+				continue
+			}
+			info := BranchInfo{Name: strings.TrimPrefix(ref, "refs/heads/"), Hash: refs[ref]}
+			if prefix == "refs/remotes/" {
+				info.Name = strings.TrimPrefix(ref, "refs/")
+				info.Remote = true
+			} else if info.Tracking, err = BranchTracking(repoPath, info.Name); err != nil {
+				return nil, err
+			}
+			if commit, err := readCommit(repoPath, info.Hash); err == nil {
+				info.Subject = commit.Subject()
+			}
+			infos = append(infos, info)
 		}
-		return "", fmt.Errorf("failed to read branch: %w", err)
 	}
+	return infos, nil
+}
 
-	commitHash := strings.TrimSpace(string(content))
-	if commitHash == "" {
-		return "", fmt.Errorf("branch '%s' has no commit", branchName)
+// branchFilter returns a function telling whether a branch tip passes the
+// --merged, --no-merged and --contains filters of opts.
+func branchFilter(repoPath string, opts BranchListOptions) (func(string) (bool, error), error) {
+	reachableFrom := func(rev string) (map[string]bool, error) {
+		if rev == "" {
+			return nil, nil
+		}
+		hash, err := resolveCommitish(repoPath, rev)
+		if err != nil {
+			return nil, err
+		}
+		return reachableCommits(repoPath, hash)
 	}
 
-	return commitHash, nil
+	merged, err := reachableFrom(opts.Merged)
+	if err != nil {
+		return nil, err
+	}
+	noMerged, err := reachableFrom(opts.NoMerged)
+	if err != nil {
+		return nil, err
+	}
+	contains := ""
+	if opts.Contains != "" {
+		if contains, err = resolveCommitish(repoPath, opts.Contains); err != nil {
+			return nil, err
+		}
+	}
+
+	return func(tip string) (bool, error) {
+		if merged != nil && !merged[tip] {
+			return false, nil
+		}
+		if noMerged != nil && noMerged[tip] {
+			return false, nil
+		}
+		if contains != "" {
+			return isAncestor(repoPath, contains, tip)
+		}
+		return true, nil
+	}, nil
+}
+
+func branchSection(branch string) string {
+	return fmt.Sprintf("branch \"%s\"", branch)
+}
+
+// SetUpstream makes upstream, a remote-tracking branch such as origin/main
+// or a local branch, the upstream of branch (the current branch when
+// empty) by setting branch.<name>.remote and branch.<name>.merge.
+func SetUpstream(repoPath, branch, upstream string) error {
+	branch, err := branchOrCurrent(repoPath, branch)
+	if err != nil {
+		return err
+	}
+
+	var remote, merge string
+	name := strings.TrimPrefix(strings.TrimPrefix(upstream, "refs/remotes/"), "refs/heads/")
+	if _, ok, err := readRef(repoPath, "refs/remotes/"+name); err != nil {
+		return err
+	} else if ok {
+		remoteName, remoteBranch, _ := strings.Cut(name, "/")
+		if _, err := GetRemoteURL(repoPath, remoteName); err != nil {
+			return fmt.Errorf("cannot track '%s': remote '%s' is not configured", upstream, remoteName)
+		}
+		remote, merge = remoteName, "refs/heads/"+remoteBranch
+	} else if exists, err := BranchExists(repoPath, name); err != nil {
+		return err
+	} else if exists {
+		remote, merge = ".", "refs/heads/"+name
+	} else {
+		return fmt.Errorf("the requested upstream branch '%s' does not exist", upstream)
+	}
+
+	if err := SetConfig(repoPath, branchSection(branch), "remote", remote); err != nil {
+		return err
+	}
+	return SetConfig(repoPath, branchSection(branch), "merge", merge)
+}
+
+// UnsetUpstream removes the upstream configuration of branch (the current
+// branch when empty).
+func UnsetUpstream(repoPath, branch string) error {
+	branch, err := branchOrCurrent(repoPath, branch)
+	if err != nil {
+		return err
+	}
+	if err := UnsetConfig(repoPath, branchSection(branch), "merge"); err != nil {
+		return fmt.Errorf("branch '%s' has no upstream information", branch)
+	}
+	UnsetConfig(repoPath, branchSection(branch), "remote")
+	return nil
+}
+
+// BranchTracking reports how branch compares to its upstream, or returns
+// nil when it has none.
+func BranchTracking(repoPath, branch string) (*TrackingInfo, error) {
+	upstream, err := upstreamRef(repoPath, branch)
+	if err != nil {
+		return nil, nil
+	}
+	info := &TrackingInfo{Upstream: strings.TrimPrefix(strings.TrimPrefix(upstream, "refs/remotes/"), "refs/heads/")}
+
+	upstreamHash, ok, err := readRef(repoPath, upstream)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		info.Gone = true
+		return info, nil
+	}
+	branchHash, err := ResolveBranchCommit(repoPath, branch)
+	if err != nil {
+		return nil, err
+	}
+	if info.Ahead, info.Behind, err = aheadBehind(repoPath, branchHash, upstreamHash); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+func branchOrCurrent(repoPath, branch string) (string, error) {
+	if branch == "" {
+		current, err := GetCurrentBranch(repoPath)
+		if err != nil {
+			return "", fmt.Errorf("HEAD does not point to a branch")
+		}
+		return current, nil
+	}
+	exists, err := BranchExists(repoPath, branch)
+	if err != nil {
+		return "", err
+	}
+	if !exists {
+		return "", fmt.Errorf("branch '%s' not found", branch)
+	}
+	return branch, nil
 }
@@ -3,6 +3,7 @@ package core
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -120,7 +121,7 @@ func TestDeleteBranch(t *testing.T) {
 		t.Fatalf("CreateBranch failed: %v", err)
 	}
 
-	if err := DeleteBranch(tmpDir, "feature"); err != nil {
+	if err := DeleteBranch(tmpDir, "feature", true); err != nil {
 		t.Fatalf("DeleteBranch failed: %v", err)
 	}
 
@@ -132,12 +133,12 @@ func TestDeleteBranch(t *testing.T) {
 		t.Error("expected branch 'feature' to not exist after deletion")
 	}
 
-	err = DeleteBranch(tmpDir, "nonexistent")
+	err = DeleteBranch(tmpDir, "nonexistent", true)
 	if err == nil {
 		t.Error("expected error when deleting non-existent branch")
 	}
 
-	err = DeleteBranch(tmpDir, "main")
+	err = DeleteBranch(tmpDir, "main", true)
 	if err == nil {
 		t.Error("expected error when deleting current branch")
 	}
@@ -272,7 +273,7 @@ func TestMultipleBranches(t *testing.T) {
 		}
 	}
 
-	if err := DeleteBranch(tmpDir, "feature1"); err != nil {
+	if err := DeleteBranch(tmpDir, "feature1", true); err != nil {
 		t.Fatalf("DeleteBranch failed: %v", err)
 	}
 
@@ -284,3 +285,246 @@ func TestMultipleBranches(t *testing.T) {
 		t.Errorf("expected 4 branches after deletion, got %d", len(allBranches))
 	}
 }
+
+func TestUpstreamTracking(t *testing.T) {
+	repo := setupTestRepo(t)
+	base := commitFile(t, repo, "file.txt", "one\n", "base")
+	if err := AddRemote(repo, "origin", "/nowhere"); err != nil {
+		t.Fatal(err)
+	}
+	if err := UpdateRef(repo, "refs/remotes/origin/main", base, "", "", false); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetUpstream(repo, "", "origin/missing"); err == nil {
+		t.Error("expected an error for an unknown upstream")
+	}
+	if err := SetUpstream(repo, "", "origin/main"); err != nil {
+		t.Fatalf("SetUpstream failed: %v", err)
+	}
+	if merge, _ := GetConfig(repo, `branch "main"`, "merge"); merge != "refs/heads/main" {
+		t.Errorf("expected branch.main.merge to be refs/heads/main, got %q", merge)
+	}
+
+	remote := commitFile(t, repo, "other.txt", "x\n", "remote")
+	if err := UpdateRef(repo, "refs/remotes/origin/main", remote, "", "", false); err != nil {
+		t.Fatal(err)
+	}
+	if err := UpdateRef(repo, "refs/heads/main", base, "", "", false); err != nil {
+		t.Fatal(err)
+	}
+	commitFile(t, repo, "file.txt", "two\n", "local one")
+	commitFile(t, repo, "file.txt", "three\n", "local two")
+
+	tracking, err := BranchTracking(repo, "main")
+	if err != nil || tracking == nil {
+		t.Fatalf("BranchTracking failed: %v", err)
+	}
+	if tracking.Upstream != "origin/main" || tracking.Ahead != 2 || tracking.Behind != 1 {
+		t.Errorf("expected origin/main ahead 2, behind 1, got %+v", tracking)
+	}
+
+	infos, err := ListBranchInfo(repo, BranchListOptions{Remotes: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 2 || infos[0].Tracking == nil || infos[1].Name != "remotes/origin/main" || infos[1].Subject != "remote" {
+		t.Errorf("unexpected branch list %+v", infos)
+	}
+
+	if err := UnsetUpstream(repo, "main"); err != nil {
+		t.Fatalf("UnsetUpstream failed: %v", err)
+	}
+	if err := UnsetUpstream(repo, "main"); err == nil {
+		t.Error("expected an error without an upstream")
+	}
+	if tracking, _ := BranchTracking(repo, "main"); tracking != nil {
+		t.Errorf("expected no tracking information, got %+v", tracking)
+	}
+}
+
+func TestAheadBehindStopsAtSharedHistory(t *testing.T) {
+	repo := setupTestRepo(t)
+	first := commitFile(t, repo, "file.txt", "one\n", "first")
+	firstCommit, _ := readCommit(repo, first)
+	tree := firstCommit.Tree
+
+	// the shared history ends in a parent that isn't there, so walking all
+	// of it fails
+	tip := strings.Repeat("0", 2*HashSize)
+	for i := 1; i <= 20; i++ {
+		tip = datedCommit(t, tree, "shared", int64(i), int64(i), tip)
+	}
+	a := datedCommit(t, tree, "a1", 100, 100, tip)
+	a = datedCommit(t, tree, "a2", 101, 101, a)
+	b := datedCommit(t, tree, "b1", 102, 102, tip)
+
+	ahead, behind, err := aheadBehind(repo, a, b)
+	if err != nil || ahead != 2 || behind != 1 {
+		t.Errorf("expected 2 ahead and 1 behind, got %d, %d (%v)", ahead, behind, err)
+	}
+}
+
+func TestRenameBranch(t *testing.T) {
+	repo := setupTestRepo(t)
+	first := commitFile(t, repo, "file.txt", "one\n", "first")
+	if err := CreateBranch(repo, "other"); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetUpstream(repo, "main", "other"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := RenameBranch(repo, "", "other", false); err == nil {
+		t.Error("expected an error when the new name exists")
+	}
+	if err := RenameBranch(repo, "", "trunk", false); err != nil {
+		t.Fatalf("RenameBranch failed: %v", err)
+	}
+
+	if branch, _ := GetCurrentBranch(repo); branch != "trunk" {
+		t.Errorf("HEAD should follow the rename, got %q", branch)
+	}
+	if exists, _ := BranchExists(repo, "main"); exists {
+		t.Error("the old branch should be gone")
+	}
+	if hash, _ := ResolveBranchCommit(repo, "trunk"); hash != first {
+		t.Errorf("trunk should point at %s, got %s", first, hash)
+	}
+	entries, _ := Reflog(repo, "trunk")
+	if len(entries) != 2 || entries[0].Message != "Branch: renamed refs/heads/main to refs/heads/trunk" {
+		t.Errorf("the reflog should move with the branch, got %+v", entries)
+	}
+	if _, err := os.Stat(reflogPath(repo, "refs/heads/main")); !os.IsNotExist(err) {
+		t.Error("the old reflog should be gone")
+	}
+	if merge, _ := GetConfig(repo, `branch "trunk"`, "merge"); merge != "refs/heads/other" {
+		t.Errorf("the upstream should move with the branch, got %q", merge)
+	}
+	if _, err := GetConfig(repo, `branch "main"`, "merge"); err == nil {
+		t.Error("the old branch config should be gone")
+	}
+
+	second := commitFile(t, repo, "file.txt", "two\n", "second")
+	if err := RenameBranch(repo, "other", "trunk", true); err == nil {
+		t.Error("expected an error when force-renaming over the current branch")
+	}
+	if err := RenameBranch(repo, "trunk", "other", true); err != nil {
+		t.Fatalf("forced RenameBranch failed: %v", err)
+	}
+	if hash, _ := ResolveBranchCommit(repo, "other"); hash != second {
+		t.Errorf("other should have been overwritten with %s, got %s", second, hash)
+	}
+}
+
+func TestCopyBranch(t *testing.T) {
+	repo := setupTestRepo(t)
+	first := commitFile(t, repo, "file.txt", "one\n", "first")
+	if err := CreateBranch(repo, "other"); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetUpstream(repo, "main", "other"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := CopyBranch(repo, "main", "backup", false); err != nil {
+		t.Fatalf("CopyBranch failed: %v", err)
+	}
+	if branch, _ := GetCurrentBranch(repo); branch != "main" {
+		t.Errorf("copying must not move HEAD, got %q", branch)
+	}
+	for _, branch := range []string{"main", "backup"} {
+		if hash, _ := ResolveBranchCommit(repo, branch); hash != first {
+			t.Errorf("%s should point at %s, got %s", branch, first, hash)
+		}
+		if merge, _ := GetConfig(repo, branchSection(branch), "merge"); merge != "refs/heads/other" {
+			t.Errorf("%s should track other, got %q", branch, merge)
+		}
+	}
+	if entries, _ := Reflog(repo, "backup"); len(entries) != 2 {
+		t.Errorf("backup should get a copy of the reflog, got %+v", entries)
+	}
+	if err := CopyBranch(repo, "main", "other", false); err == nil {
+		t.Error("expected an error when the new name exists")
+	}
+}
+
+func TestDeleteUnmergedBranch(t *testing.T) {
+	repo := setupTestRepo(t)
+	commitFile(t, repo, "file.txt", "one\n", "first")
+	if err := CreateBranch(repo, "topic"); err != nil {
+		t.Fatal(err)
+	}
+	if err := Switch(repo, "topic", SwitchOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	commitFile(t, repo, "file.txt", "two\n", "topic work")
+	if err := Switch(repo, "main", SwitchOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := DeleteBranch(repo, "topic", false); err == nil || !strings.Contains(err.Error(), "not fully merged") {
+		t.Errorf("expected an unmerged error, got %v", err)
+	}
+	if err := CreateBranchAt(repo, "keep", "topic"); err != nil {
+		t.Fatal(err)
+	}
+	if err := CopyBranch(repo, "topic", "scratch", false); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetUpstream(repo, "topic", "keep"); err != nil {
+		t.Fatal(err)
+	}
+	if err := DeleteBranch(repo, "topic", false); err != nil {
+		t.Errorf("a branch merged into its upstream should be deletable: %v", err)
+	}
+	if err := DeleteBranch(repo, "scratch", true); err != nil {
+		t.Errorf("a forced delete should succeed: %v", err)
+	}
+}
+
+func TestBranchFilters(t *testing.T) {
+	repo := setupTestRepo(t)
+	first := commitFile(t, repo, "file.txt", "one\n", "first")
+	if err := CreateBranch(repo, "old"); err != nil {
+		t.Fatal(err)
+	}
+	commitFile(t, repo, "file.txt", "two\n", "second")
+	if err := CreateBranch(repo, "new"); err != nil {
+		t.Fatal(err)
+	}
+	if err := CreateBranchAt(repo, "side", first); err != nil {
+		t.Fatal(err)
+	}
+	if err := UpdateRef(repo, "refs/heads/side", commitFile(t, repo, "side.txt", "x\n", "side"), "", "", false); err != nil {
+		t.Fatal(err)
+	}
+	if err := UpdateRef(repo, "refs/heads/main", "HEAD~1", "", "", false); err != nil {
+		t.Fatal(err)
+	}
+
+	names := func(opts BranchListOptions) string {
+		t.Helper()
+		infos, err := ListBranchInfo(repo, opts)
+		if err != nil {
+			t.Fatalf("ListBranchInfo failed: %v", err)
+		}
+		var names []string
+		for _, info := range infos {
+			names = append(names, info.Name)
+		}
+		return strings.Join(names, ",")
+	}
+
+	if got := names(BranchListOptions{Merged: "HEAD"}); got != "main,new,old" {
+		t.Errorf("--merged: got %s", got)
+	}
+	if got := names(BranchListOptions{NoMerged: "main"}); got != "side" {
+		t.Errorf("--no-merged: got %s", got)
+	}
+	if got := names(BranchListOptions{Contains: "main"}); got != "main,new,side" {
+		t.Errorf("--contains: got %s", got)
+	}
+	if got := names(BranchListOptions{Contains: first, NoMerged: "old"}); got != "main,new,side" {
+		t.Errorf("combined filters: got %s", got)
+	}
+}
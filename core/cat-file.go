@@ -1,16 +1,32 @@
 package core
 
 import (
+	"bufio"
 	"bytes"
 	"compress/zlib"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 )
 
-func CatFile(hash string, showType, showSize, pretty, exists bool) error {
+func CatFile(name string, showType, showSize, pretty, exists bool) error {
+	hash := name
+	if len(name) != 2*HashSize || !isHexString(name) {
+		resolved, err := resolveObjectName(".", name)
+		if err != nil {
+			return err
+		}
+		hash = resolved
+	}
+	if len(hash) != 2*HashSize || !isHexString(hash) {
+		return fmt.Errorf("not a valid object name '%s'", name)
+	}
+
 	objectDir := filepath.Join(RepoDirName, "objects", hash[:2])
 	objectPath := filepath.Join(objectDir, hash[2:])
 
@@ -47,6 +63,12 @@ func CatFile(hash string, showType, showSize, pretty, exists bool) error {
 	objectType := parts[0]
 	objectSize := parts[1]
 
+	switch objectType {
+	case "blob", "tree", "commit", "tag":
+	default:
+		return fmt.Errorf("unknown object type '%s'", objectType)
+	}
+
 	if exists {
 		return nil
 	}
@@ -57,9 +79,247 @@ func CatFile(hash string, showType, showSize, pretty, exists bool) error {
 	if showSize {
 		fmt.Println(objectSize)
 	}
+	if pretty && objectType == "tree" {
+		return writeTreeListing(os.Stdout, hash, content)
+	}
 	if pretty || (!showType && !showSize && !exists) {
 		fmt.Print(string(content))
 	}
 
 	return nil
 }
+
+// writeTreeListing pretty-prints the content of a tree the way git does,
+// as a "<mode> <type> <hash>\t<name>" line per entry.
+func writeTreeListing(out io.Writer, hash string, content []byte) error {
+	entries, err := parseTreeEntries(hash, content)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if _, err := fmt.Fprintf(out, "%s %s %s\t%s\n", fullMode(entry.Mode), treeEntryType(entry.Mode), entry.Hash, entry.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// treeEntryType returns the type of the object a tree entry with mode
+// points at.
+func treeEntryType(mode string) string {
+	switch {
+	case isTreeMode(mode):
+		return "tree"
+	case mode == "160000":
+		return "commit"
+	}
+	return "blob"
+}
+
+// CatFileTextconv writes the object named by <rev>:<path> with the blob
+// converted by the textconv driver of path, as git cat-file --textconv
+// does. Other objects are pretty-printed as with -p.
+func CatFileTextconv(repoPath string, out io.Writer, name string) error {
+	idx := indexOutsideBraces(name, ":")
+	if idx < 0 || idx == len(name)-1 {
+		return fmt.Errorf("<object>:<path> required, only <object> '%s' given", name)
+	}
+	path := name[idx+1:]
+
+	hash, err := resolveObjectName(repoPath, name)
+	if err != nil {
+		return err
+	}
+	objectType, content, err := readObjectWithType(repoPath, hash)
+	if err != nil {
+		return err
+	}
+	switch objectType {
+	case "blob":
+		drivers, err := loadTextconvDrivers(repoPath)
+		if err != nil {
+			return err
+		}
+		if content, err = drivers.textconv(path, content); err != nil {
+			return err
+		}
+	case "tree":
+		return writeTreeListing(out, hash, content)
+	}
+	_, err = out.Write(content)
+	return err
+}
+
+// CatFileBatchFormat is the line git cat-file --batch and --batch-check
+// write for each object by default.
+const CatFileBatchFormat = "%(objectname) %(objecttype) %(objectsize)"
+
+type CatFileBatchOptions struct {
+	// Format is the line written for each object, such as
+	// CatFileBatchFormat. It may use %(objectname), %(objecttype),
+	// %(objectsize), %(objectsize:disk), %(deltabase) and %(rest), the
+	// text following the object name on its input line.
+	Format string
+	// Contents follows each line with the content of the object, as
+	// --batch does, rather than writing the line alone like --batch-check.
+	Contents bool
+	// AllObjects writes every object in the repository, in hash order,
+	// instead of those named on the input.
+	AllObjects bool
+	// Textconv converts the content of blobs with the textconv driver of
+	// their path, which is taken from the rest of each input line.
+	Textconv bool
+}
+
+var batchFormatAtom = regexp.MustCompile(`%\(([^)]*)\)`)
+
+// batchObject is what a batch format line can show of an object.
+type batchObject struct {
+	hash, objectType, rest string
+	size, diskSize         int64
+}
+
+// CatFileBatch reads object names from in, one per line, and writes a
+// line formatted with opts.Format for each, followed by its content when
+// opts.Contents is set. Names that can't be resolved are reported as
+// "<name> missing". Output is flushed after every object, so a caller can
+// feed names and read the answers over a pipe without a process per
+// object.
+func CatFileBatch(repoPath string, in io.Reader, out io.Writer, opts CatFileBatchOptions) error {
+	for _, match := range batchFormatAtom.FindAllStringSubmatch(opts.Format, -1) {
+		switch match[1] {
+		case "objectname", "objecttype", "objectsize", "objectsize:disk", "deltabase", "rest":
+		default:
+			return fmt.Errorf("unknown format element: %s", match[1])
+		}
+	}
+	// as in git, the name ends at the first space or tab only when there
+	// is a use for the rest of the line
+	splitRest := opts.Textconv || strings.Contains(opts.Format, "%(rest)")
+	var drivers *textconvDrivers
+	if opts.Textconv {
+		var err error
+		if drivers, err = loadTextconvDrivers(repoPath); err != nil {
+			return err
+		}
+	}
+
+	bw := bufio.NewWriter(out)
+	if opts.AllObjects {
+		hashes, err := listLooseObjects(repoPath)
+		if err != nil {
+			return err
+		}
+		for _, hash := range hashes {
+			if err := writeBatchObject(repoPath, bw, hash, hash, "", drivers, opts); err != nil {
+				return err
+			}
+		}
+		return bw.Flush()
+	}
+
+	scanner := bufio.NewScanner(in)
+	for scanner.Scan() {
+		name, rest := scanner.Text(), ""
+		if splitRest {
+			if idx := strings.IndexAny(name, " \t"); idx >= 0 {
+				name, rest = name[:idx], strings.TrimLeft(name[idx+1:], " \t")
+			}
+		}
+		hash, err := resolveObjectName(repoPath, name)
+		if err != nil {
+			fmt.Fprintf(bw, "%s missing\n", name)
+			if err := bw.Flush(); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := writeBatchObject(repoPath, bw, name, hash, rest, drivers, opts); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// writeBatchObject writes the batch output for one object and flushes it.
+// Drivers is set when opts.Textconv is.
+func writeBatchObject(repoPath string, bw *bufio.Writer, name, hash, rest string, drivers *textconvDrivers, opts CatFileBatchOptions) error {
+	objectType, content, err := readObjectWithType(repoPath, hash)
+	if err != nil {
+		fmt.Fprintf(bw, "%s missing\n", name)
+		return bw.Flush()
+	}
+	object := batchObject{hash: hash, objectType: objectType, rest: rest, size: int64(len(content))}
+	if info, err := os.Stat(looseObjectPath(repoPath, hash)); err == nil {
+		object.diskSize = info.Size()
+	}
+
+	bw.WriteString(expandBatchFormat(opts.Format, object))
+	bw.WriteString("\n")
+	if opts.Contents {
+		if opts.Textconv && objectType == "blob" {
+			if rest == "" {
+				bw.Flush()
+				return fmt.Errorf("missing path for '%s'", hash)
+			}
+			if content, err = drivers.textconv(rest, content); err != nil {
+				return err
+			}
+		}
+		bw.Write(content)
+		bw.WriteString("\n")
+	}
+	return bw.Flush()
+}
+
+func expandBatchFormat(format string, object batchObject) string {
+	return batchFormatAtom.ReplaceAllStringFunc(format, func(atom string) string {
+		switch atom[2 : len(atom)-1] {
+		case "objectname":
+			return object.hash
+		case "objecttype":
+			return object.objectType
+		case "objectsize":
+			return strconv.FormatInt(object.size, 10)
+		case "objectsize:disk":
+			return strconv.FormatInt(object.diskSize, 10)
+		case "deltabase":
+			// loose objects are never stored as deltas
+			return strings.Repeat("0", 2*HashSize)
+		}
+		return object.rest
+	})
+}
+
+func looseObjectPath(repoPath, hash string) string {
+	return filepath.Join(repoPath, RepoDirName, "objects", hash[:2], hash[2:])
+}
+
+// listLooseObjects returns the hashes of all the objects in the object
+// directory, sorted.
+func listLooseObjects(repoPath string) ([]string, error) {
+	objectsDir := filepath.Join(repoPath, RepoDirName, "objects")
+	dirs, err := os.ReadDir(objectsDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var hashes []string
+	for _, dir := range dirs {
+		if !dir.IsDir() || len(dir.Name()) != 2 || !isHexString(dir.Name()) {
+			continue
+		}
+		files, err := os.ReadDir(filepath.Join(objectsDir, dir.Name()))
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			hash := dir.Name() + file.Name()
+			if len(hash) == 2*HashSize && isHexString(hash) {
+				hashes = append(hashes, hash)
+			}
+		}
+	}
+	sort.Strings(hashes)
+	return hashes, nil
+}
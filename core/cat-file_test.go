@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"sort"
 	"strings"
 	"testing"
 )
@@ -79,3 +80,118 @@ func TestCatFileInvalidHash(t *testing.T) {
 		t.Errorf("expected error for invalid hash, got nil")
 	}
 }
+
+func TestCatFileShortName(t *testing.T) {
+	setupTestRepo(t)
+
+	for _, name := range []string{"a", "ab", ""} {
+		if err := CatFile(name, false, false, true, false); err == nil {
+			t.Errorf("expected an error for %q", name)
+		}
+	}
+}
+
+func TestCatFilePrettyTree(t *testing.T) {
+	repo := setupTestRepo(t)
+	commitFile(t, repo, "dir/file.txt", "hello\n", "first")
+	commitFile(t, repo, "README", "readme\n", "second")
+
+	tree, err := ResolveRevision(repo, "HEAD^{tree}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, _ := ResolveRevision(repo, "HEAD:dir")
+	readme, _ := ResolveRevision(repo, "HEAD:README")
+
+	out := captureOutput(func() {
+		if err := CatFile(tree, false, false, true, false); err != nil {
+			t.Errorf("CatFile() error = %v", err)
+		}
+	})
+	want := "100644 blob " + readme + "\tREADME\n" + "040000 tree " + dir + "\tdir\n"
+	if out != want {
+		t.Errorf("output = %q, want %q", out, want)
+	}
+}
+
+func TestCatFileBatch(t *testing.T) {
+	repo := setupTestRepo(t)
+	commitFile(t, repo, "a.txt", "hello\n", "first")
+	blob, _ := ResolveRevision(repo, "HEAD:a.txt")
+	head, _ := ResolveRevision(repo, "HEAD")
+	in := "HEAD:a.txt\nnope\n" + head + "\n"
+
+	var out bytes.Buffer
+	if err := CatFileBatch(repo, strings.NewReader(in), &out, CatFileBatchOptions{Format: CatFileBatchFormat}); err != nil {
+		t.Fatal(err)
+	}
+	commit, _ := readObject(repo, head)
+	want := fmt.Sprintf("%s blob 6\nnope missing\n%s commit %d\n", blob, head, len(commit))
+	if out.String() != want {
+		t.Errorf("--batch-check output = %q, want %q", out.String(), want)
+	}
+
+	out.Reset()
+	opts := CatFileBatchOptions{Format: "%(objecttype) %(rest)", Contents: true}
+	if err := CatFileBatch(repo, strings.NewReader("HEAD:a.txt  some text\n"), &out, opts); err != nil {
+		t.Fatal(err)
+	}
+	if want := "blob some text\nhello\n\n"; out.String() != want {
+		t.Errorf("--batch output = %q, want %q", out.String(), want)
+	}
+
+	out.Reset()
+	opts = CatFileBatchOptions{Format: "%(objectname)", AllObjects: true}
+	if err := CatFileBatch(repo, nil, &out, opts); err != nil {
+		t.Fatal(err)
+	}
+	tree, _ := ResolveRevision(repo, "HEAD^{tree}")
+	all := []string{blob, head, tree}
+	sort.Strings(all)
+	if want := strings.Join(all, "\n") + "\n"; out.String() != want {
+		t.Errorf("--batch-all-objects output = %q, want %q", out.String(), want)
+	}
+
+	if err := CatFileBatch(repo, nil, &out, CatFileBatchOptions{Format: "%(bogus)"}); err == nil {
+		t.Error("expected an error for an unknown format element")
+	}
+}
+
+func TestCatFileTextconv(t *testing.T) {
+	repo := setupTestRepo(t)
+	commitFile(t, repo, ".gitattributes", "*.txt diff=upper\n", "attributes")
+	commitFile(t, repo, "a.txt", "hello\n", "text")
+	commitFile(t, repo, "b.md", "plain\n", "markdown")
+	if err := SetConfig(repo, `diff "upper"`, "textconv", "tr a-z A-Z <"); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	if err := CatFileTextconv(repo, &out, "HEAD:a.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "HELLO\n" {
+		t.Errorf("textconv output = %q, want %q", out.String(), "HELLO\n")
+	}
+
+	out.Reset()
+	if err := CatFileTextconv(repo, &out, "HEAD:b.md"); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "plain\n" {
+		t.Errorf("a blob without a driver should be unchanged, got %q", out.String())
+	}
+
+	if err := CatFileTextconv(repo, &out, "HEAD"); err == nil {
+		t.Error("expected an error without a path")
+	}
+
+	out.Reset()
+	opts := CatFileBatchOptions{Format: "%(objecttype)", Contents: true, Textconv: true}
+	if err := CatFileBatch(repo, strings.NewReader("HEAD:a.txt a.txt\n"), &out, opts); err != nil {
+		t.Fatal(err)
+	}
+	if want := "blob\nHELLO\n\n"; out.String() != want {
+		t.Errorf("--batch --textconv output = %q, want %q", out.String(), want)
+	}
+}
@@ -0,0 +1,115 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type CheckoutIndexOptions struct {
+	// All checks out every path in the index instead of the paths given.
+	All bool
+	// Force overwrites files that already exist and differ.
+	Force bool
+	// Prefix is prepended to the path of every file written, so
+	// "export/" checks the index out into another directory. A relative
+	// prefix is taken from the top of the worktree.
+	Prefix string
+}
+
+// CheckoutIndex writes files from the index to the working tree, as git
+// checkout-index does. Files that already hold the index version are left
+// alone, and unless opts.Force is set neither are files that differ: they
+// are reported once everything else has been written. Unmerged paths are
+// skipped by opts.All, and refused when named.
+func CheckoutIndex(repoPath string, paths []string, opts CheckoutIndexOptions) error {
+	entries, err := readIndexEntries(repoPath)
+	if err != nil {
+		return err
+	}
+
+	var selected []IndexEntry
+	if opts.All {
+		for _, entry := range entries {
+			if entry.Stage == 0 {
+				selected = append(selected, entry)
+			}
+		}
+	} else {
+		for _, path := range paths {
+			path = cleanPathspec(path)
+			found := false
+			for _, entry := range entries {
+				if entry.Path != path {
+					continue
+				}
+				if entry.Stage != 0 {
+					return fmt.Errorf("%s is unmerged", path)
+				}
+				selected = append(selected, entry)
+				found = true
+			}
+			if !found {
+				return fmt.Errorf("%s is not in the index", path)
+			}
+		}
+	}
+
+	// an absolute prefix names a directory of its own
+	root := repoPath
+	if filepath.IsAbs(opts.Prefix) {
+		root = ""
+	}
+	var existing []string
+	for _, entry := range selected {
+		target := opts.Prefix + entry.Path
+		if !opts.Force {
+			hash, exists, err := worktreeFileHash(root, target)
+			if err != nil {
+				return err
+			}
+			if exists && hash == entry.Hash {
+				continue
+			}
+			if exists {
+				existing = append(existing, target)
+				continue
+			}
+		}
+		if err := checkoutIndexEntry(repoPath, filepath.Join(root, target), entry); err != nil {
+			return err
+		}
+	}
+	if len(existing) > 0 {
+		return fmt.Errorf("already exists, no checkout:\n\t%s", strings.Join(existing, "\n\t"))
+	}
+	return nil
+}
+
+// checkoutIndexEntry writes the blob of an index entry to the file at
+// fullPath, as a symlink or an executable file when its mode says so. A
+// submodule only gets its directory.
+func checkoutIndexEntry(repoPath, fullPath string, entry IndexEntry) error {
+	if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+		return fmt.Errorf("failed to create directory for %s: %w", fullPath, err)
+	}
+	if entry.Mode == "160000" {
+		return os.MkdirAll(fullPath, 0755)
+	}
+
+	content, err := readObject(repoPath, entry.Hash)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", entry.Path, err)
+	}
+	if err := os.Remove(fullPath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	switch entry.Mode {
+	case "120000":
+		return os.Symlink(string(content), fullPath)
+	case "100755":
+		return os.WriteFile(fullPath, content, 0755)
+	}
+	return os.WriteFile(fullPath, content, 0644)
+}
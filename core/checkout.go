@@ -7,41 +7,76 @@ import (
 	"strings"
 )
 
+type CheckoutOptions struct {
+	// Force discards local changes to tracked files and overwrites untracked
+	// files that are in the way.
+	Force bool
+	// Merge carries local changes over to the target with a three-way merge
+	// instead of refusing to switch.
+	Merge bool
+}
+
+// Checkout switches HEAD to a branch or commit. Only paths that differ
+// between the current HEAD and the target are touched; local changes to
+// other paths are carried over, and untracked files are left alone.
 func Checkout(repoPath, target string) error {
-	repoDir := filepath.Join(repoPath, RepoDirName)
+	return CheckoutWithOptions(repoPath, target, CheckoutOptions{})
+}
 
+func CheckoutWithOptions(repoPath, target string, opts CheckoutOptions) error {
 	branchExists, err := BranchExists(repoPath, target)
 	if err != nil {
 		return err
 	}
 
 	var commitHash string
-
-	headPath := filepath.Join(repoDir, "HEAD")
 	if branchExists {
 		commitHash, err = ResolveBranchCommit(repoPath, target)
 		if err != nil {
 			return fmt.Errorf("failed to resolve branch: %w", err)
 		}
-
-		refPath := fmt.Sprintf("ref: refs/heads/%s", target)
-		if err := os.WriteFile(headPath, []byte(refPath+"\n"), 0644); err != nil {
-			return fmt.Errorf("failed to update HEAD: %w", err)
-		}
 	} else {
-		objectPath := filepath.Join(repoDir, "objects", target[:2], target[2:])
-		if _, err := os.Stat(objectPath); os.IsNotExist(err) {
+		commitHash, err = resolveCommitish(repoPath, target)
+		if err != nil {
 			return fmt.Errorf("reference '%s' not found (not a branch or commit)", target)
 		}
+	}
+
+	oldHead, err := resolveHead(repoPath)
+	if err != nil {
+		return err
+	}
+	from := oldHead
+	if branch, err := GetCurrentBranch(repoPath); err == nil {
+		from = branch
+	}
+
+	conflicts, err := switchWorkingTree(repoPath, commitHash, target, opts)
+	if err != nil {
+		return err
+	}
 
-		commitHash = target
-		if err := os.WriteFile(headPath, []byte(commitHash+"\n"), 0644); err != nil {
-			return fmt.Errorf("failed to update HEAD: %w", err)
+	message := fmt.Sprintf("checkout: moving from %s to %s", from, target)
+	if branchExists {
+		if err := writeSymref(repoPath, "HEAD", "refs/heads/"+target); err != nil {
+			return err
+		}
+		if err := logRefUpdate(repoPath, "HEAD", oldHead, commitHash, message); err != nil {
+			return err
+		}
+	} else {
+		tx := BeginRefTransaction(repoPath)
+		tx.NoDeref()
+		if err := tx.Update("HEAD", commitHash, "", message); err != nil {
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
 		}
 	}
 
-	if err := updateWorkingTreeToCommit(repoPath, commitHash); err != nil {
-		return fmt.Errorf("failed to update working tree: %w", err)
+	if len(conflicts) > 0 {
+		return fmt.Errorf("switched to '%s' with conflicts in:\n\t%s", target, strings.Join(conflicts, "\n\t"))
 	}
 	return nil
 }
@@ -54,26 +89,128 @@ func CheckoutNewBranch(repoPath, branchName string) error {
 	return Checkout(repoPath, branchName)
 }
 
-func updateWorkingTreeToCommit(repoPath, commitHash string) error {
-	treeFiles, err := getCommitTree(repoPath, commitHash)
+// switchWorkingTree moves the index and working tree from the current HEAD
+// to commitHash. It returns the paths left with conflict markers by a
+// --merge checkout.
+func switchWorkingTree(repoPath, commitHash, label string, opts CheckoutOptions) ([]string, error) {
+	target, err := getCommitTree(repoPath, commitHash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get commit tree: %w", err)
+	}
+	return switchToTree(repoPath, target, label, opts)
+}
+
+// switchToTree is switchWorkingTree for a tree given as a path to hash map.
+func switchToTree(repoPath string, target map[string]string, label string, opts CheckoutOptions) ([]string, error) {
+	if opts.Force {
+		if err := resetHardToTree(repoPath, target); err != nil {
+			return nil, fmt.Errorf("failed to update working tree: %w", err)
+		}
+		return nil, nil
+	}
+
+	head, err := resolveHead(repoPath)
+	if err != nil {
+		return nil, err
+	}
+	headTree, err := commitTreeMap(repoPath, head)
+	if err != nil {
+		return nil, err
+	}
+	index, err := readIndexMap(repoPath)
 	if err != nil {
-		return fmt.Errorf("failed to get commit tree: %w", err)
+		return nil, err
 	}
 
-	if err := clearWorkingDirectory(repoPath); err != nil {
-		return fmt.Errorf("failed to cleear working directory: %w", err)
+	clobberErr := checkWorktreeClobber(repoPath, headTree, index, target)
+	if clobberErr == nil {
+		if err := updateWorkingTree(repoPath, headTree, target); err != nil {
+			return nil, fmt.Errorf("failed to update working tree: %w", err)
+		}
+
+		// paths the switch doesn't touch keep whatever is staged for them
+		for path, hash := range target {
+			if headTree[path] != hash {
+				index[path] = hash
+			}
+		}
+		for path := range headTree {
+			if _, ok := target[path]; !ok {
+				delete(index, path)
+			}
+		}
+		return nil, updateIndexToTree(repoPath, index)
+	}
+	if !opts.Merge {
+		return nil, clobberErr
 	}
 
-	for filepath, fileHash := range treeFiles {
-		if err := restoreFile(repoPath, filepath, fileHash); err != nil {
-			return fmt.Errorf("failed to resotre file %s: %w", filepath, err)
+	return mergeLocalChanges(repoPath, headTree, index, target, label)
+}
+
+// mergeLocalChanges implements checkout --merge: the working tree copies of
+// tracked files are merged with the target using HEAD as the base. The
+// index is set to the target tree and the merged results are left unstaged.
+// A conflicted path is left unmerged, as git does: HEAD's version is stage
+// 1, the target's stage 2 and the local one stage 3.
+func mergeLocalChanges(repoPath string, headTree, index, target map[string]string, label string) ([]string, error) {
+	local := make(map[string]string)
+	for _, tracked := range []map[string]string{headTree, index} {
+		for path := range tracked {
+			content, err := os.ReadFile(filepath.Join(repoPath, path))
+			if os.IsNotExist(err) {
+				continue
+			}
+			if err != nil {
+				return nil, fmt.Errorf("failed to read %s: %w", path, err)
+			}
+			hash, err := HashObject(content, "blob", true)
+			if err != nil {
+				return nil, err
+			}
+			local[path] = hash
 		}
 	}
 
-	if err := updateIndexToTree(repoPath, treeFiles); err != nil {
-		return fmt.Errorf("failed to update index: %w", err)
+	// untracked files are never merged, so they still block the switch
+	if err := checkWorktreeClobber(repoPath, local, local, target); err != nil {
+		return nil, err
 	}
-	return nil
+
+	result, err := mergeTrees(repoPath, headTree, local, target, "local", label)
+	if err != nil {
+		return nil, err
+	}
+	if err := updateWorkingTree(repoPath, local, result.Tree); err != nil {
+		return nil, fmt.Errorf("failed to update working tree: %w", err)
+	}
+	newIndex := copyTree(target)
+	for path, hash := range result.Tree {
+		_, inHead := headTree[path]
+		_, inTarget := target[path]
+		if !inHead && !inTarget {
+			// keep locally added files tracked
+			newIndex[path] = hash
+		}
+	}
+	for _, path := range result.Conflicts {
+		delete(newIndex, path)
+	}
+	var entries []IndexEntry
+	for path, hash := range newIndex {
+		entries = append(entries, IndexEntry{Mode: "100644", Path: path, Hash: hash})
+	}
+	for _, path := range result.Conflicts {
+		for stage, tree := range []map[string]string{headTree, target, local} {
+			if hash, ok := tree[path]; ok {
+				entries = append(entries, IndexEntry{Mode: "100644", Path: path, Hash: hash, Stage: stage + 1})
+			}
+		}
+	}
+	if err := writeIndexEntries(repoPath, entries); err != nil {
+		return nil, fmt.Errorf("failed to update index: %w", err)
+	}
+	return result.Conflicts, nil
 }
 
 func getCommitTree(repoPath, commitHash string) (map[string]string, error) {
@@ -98,26 +235,6 @@ func getCommitTree(repoPath, commitHash string) (map[string]string, error) {
 	return readTreeRecursive(repoPath, treeHash, "")
 }
 
-func clearWorkingDirectory(repoPath string) error {
-	entries, err := os.ReadDir(repoPath)
-	if err != nil {
-		return err
-	}
-
-	for _, entry := range entries {
-		if entry.Name() == RepoDirName {
-			continue
-		}
-
-		fullPath := filepath.Join(repoPath, entry.Name())
-		if err := os.RemoveAll(fullPath); err != nil {
-			return fmt.Errorf("failed to remove %s: %w", fullPath, err)
-		}
-	}
-
-	return nil
-}
-
 func restoreFile(repoPath, filePath, blobHash string) error {
 	blobContent, err := readObject(repoPath, blobHash)
 	if err != nil {
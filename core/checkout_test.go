@@ -1 +1,142 @@
 package core
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+func setupTwoBranches(t *testing.T) string {
+	t.Helper()
+	repo := setupTestRepo(t)
+	commitFile(t, repo, "shared.txt", "shared\n", "base")
+	commitFile(t, repo, "file.txt", "main\n", "main file")
+	if err := CreateBranch(repo, "feature"); err != nil {
+		t.Fatalf("CreateBranch failed: %v", err)
+	}
+	if err := Checkout(repo, "feature"); err != nil {
+		t.Fatalf("Checkout failed: %v", err)
+	}
+	commitFile(t, repo, "file.txt", "feature\n", "feature file")
+	if err := Checkout(repo, "main"); err != nil {
+		t.Fatalf("Checkout failed: %v", err)
+	}
+	return repo
+}
+
+func TestCheckoutKeepsUntrackedAndCarriesChanges(t *testing.T) {
+	repo := setupTwoBranches(t)
+
+	if err := os.WriteFile(".env", []byte("SECRET=1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile("shared.txt", []byte("edited\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Checkout(repo, "feature"); err != nil {
+		t.Fatalf("Checkout failed: %v", err)
+	}
+
+	if got := readTestFile(t, repo, ".env"); got != "SECRET=1\n" {
+		t.Errorf("untracked file should survive checkout, got %q", got)
+	}
+	if got := readTestFile(t, repo, "shared.txt"); got != "edited\n" {
+		t.Errorf("local change to an unaffected file should be carried over, got %q", got)
+	}
+	if got := readTestFile(t, repo, "file.txt"); got != "feature\n" {
+		t.Errorf("file.txt should match feature, got %q", got)
+	}
+}
+
+func TestCheckoutRefusesToClobber(t *testing.T) {
+	repo := setupTwoBranches(t)
+
+	if err := os.WriteFile("file.txt", []byte("local\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	err := Checkout(repo, "feature")
+	if err == nil || !strings.Contains(err.Error(), "would be overwritten") {
+		t.Fatalf("expected clobber error, got %v", err)
+	}
+	if branch, _ := GetCurrentBranch(repo); branch != "main" {
+		t.Errorf("HEAD should not move on a refused checkout, got %s", branch)
+	}
+	if got := readTestFile(t, repo, "file.txt"); got != "local\n" {
+		t.Errorf("local change should be untouched, got %q", got)
+	}
+
+	if err := CheckoutWithOptions(repo, "feature", CheckoutOptions{Force: true}); err != nil {
+		t.Fatalf("forced checkout failed: %v", err)
+	}
+	if got := readTestFile(t, repo, "file.txt"); got != "feature\n" {
+		t.Errorf("--force should discard local changes, got %q", got)
+	}
+}
+
+func TestCheckoutMerge(t *testing.T) {
+	repo := setupTestRepo(t)
+	commitFile(t, repo, "file.txt", "one\ntwo\nthree\n", "base")
+	if err := CreateBranch(repo, "feature"); err != nil {
+		t.Fatalf("CreateBranch failed: %v", err)
+	}
+	if err := Checkout(repo, "feature"); err != nil {
+		t.Fatalf("Checkout failed: %v", err)
+	}
+	commitFile(t, repo, "file.txt", "one\ntwo\nthree\nfour\n", "add four")
+	if err := Checkout(repo, "main"); err != nil {
+		t.Fatalf("Checkout failed: %v", err)
+	}
+
+	if err := os.WriteFile("file.txt", []byte("ONE\ntwo\nthree\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := CheckoutWithOptions(repo, "feature", CheckoutOptions{Merge: true}); err != nil {
+		t.Fatalf("merge checkout failed: %v", err)
+	}
+	if branch, _ := GetCurrentBranch(repo); branch != "feature" {
+		t.Errorf("expected to be on feature, got %s", branch)
+	}
+	if got := readTestFile(t, repo, "file.txt"); got != "ONE\ntwo\nthree\nfour\n" {
+		t.Errorf("local change should be merged into the target, got %q", got)
+	}
+}
+
+func TestCheckoutMergeConflict(t *testing.T) {
+	repo := setupTestRepo(t)
+	base := commitFile(t, repo, "file.txt", "one\n", "base")
+	if err := CreateBranch(repo, "feature"); err != nil {
+		t.Fatalf("CreateBranch failed: %v", err)
+	}
+	if err := Checkout(repo, "feature"); err != nil {
+		t.Fatalf("Checkout failed: %v", err)
+	}
+	feature := commitFile(t, repo, "file.txt", "feature\n", "change")
+	if err := Checkout(repo, "main"); err != nil {
+		t.Fatalf("Checkout failed: %v", err)
+	}
+	if err := os.WriteFile("file.txt", []byte("local\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := CheckoutWithOptions(repo, "feature", CheckoutOptions{Merge: true}); err == nil || !strings.Contains(err.Error(), "conflicts") {
+		t.Fatalf("expected the switch to report a conflict, got %v", err)
+	}
+	baseTree, _ := getCommitTree(repo, base)
+	featureTree, _ := getCommitTree(repo, feature)
+	local, _ := HashObject([]byte("local\n"), "blob", false)
+	want := fmt.Sprintf("100644 %s 1\tfile.txt\n100644 %s 2\tfile.txt\n100644 %s 3\tfile.txt\n",
+		baseTree["file.txt"], featureTree["file.txt"], local)
+	if got := lsFilesStage(t, repo); got != want {
+		t.Errorf("the conflicted path should be left unmerged, got\n%s\nwant\n%s", got, want)
+	}
+	if statuses, err := Status(repo); err != nil || len(statuses) != 1 || statuses[0] != (FileStatus{Path: "file.txt", Status: Unmerged}) {
+		t.Errorf("status should report file.txt as unmerged, got %+v (%v)", statuses, err)
+	}
+	if _, err := Commit(repo, "too early", "Test Author", "test@example.com"); err == nil {
+		t.Error("committing should be refused while file.txt is unmerged")
+	}
+}
@@ -0,0 +1,515 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const sequencerStateDir = "sequencer"
+
+type CherryPickOptions struct {
+	NoCommit       bool
+	RecordOrigin   bool
+	Mainline       int
+	CommitterName  string
+	CommitterEmail string
+}
+
+type sequencerItem struct {
+	Action string
+	Hash   string
+}
+
+func sequencerDir(repoPath string) string {
+	return filepath.Join(repoPath, RepoDirName, sequencerStateDir)
+}
+
+func SequencerInProgress(repoPath string) bool {
+	_, err := os.Stat(sequencerDir(repoPath))
+	return err == nil
+}
+
+// CherryPick applies the changes introduced by each of the given commits on
+// top of HEAD, creating one new commit per pick.
+func CherryPick(repoPath string, revs []string, opts CherryPickOptions) (string, error) {
+	return startSequencer(repoPath, "pick", revs, opts)
+}
+
+// Revert records new commits that undo the changes introduced by each of the
+// given commits.
+func Revert(repoPath string, revs []string, opts CherryPickOptions) (string, error) {
+	return startSequencer(repoPath, "revert", revs, opts)
+}
+
+func startSequencer(repoPath, action string, revs []string, opts CherryPickOptions) (string, error) {
+	if SequencerInProgress(repoPath) {
+		return "", fmt.Errorf("a cherry-pick or revert is already in progress; use --continue or --abort")
+	}
+	if RebaseInProgress(repoPath) {
+		return "", fmt.Errorf("cannot %s during a rebase", action)
+	}
+	if len(revs) == 0 {
+		return "", fmt.Errorf("no commits specified")
+	}
+
+	var items []sequencerItem
+	for _, rev := range revs {
+		if strings.Contains(rev, "..") {
+			// ranges are picked oldest first and reverted newest first
+			commits, err := LogRange(repoPath, []string{rev})
+			if err != nil {
+				return "", err
+			}
+			if action == "pick" {
+				slices.Reverse(commits)
+			}
+			for _, commit := range commits {
+				items = append(items, sequencerItem{Action: action, Hash: commit.Hash})
+			}
+			continue
+		}
+		hash, err := resolveCommitish(repoPath, rev)
+		if err != nil {
+			return "", err
+		}
+		items = append(items, sequencerItem{Action: action, Hash: hash})
+	}
+
+	// refuse merges without a mainline and the like before anything is
+	// touched, rather than stopping halfway through the sequence
+	for _, item := range items {
+		commit, err := readCommit(repoPath, item.Hash)
+		if err != nil {
+			return "", err
+		}
+		if _, err := mainlineParent(commit, opts.Mainline); err != nil {
+			return "", err
+		}
+	}
+
+	head, err := resolveHead(repoPath)
+	if err != nil {
+		return "", err
+	}
+
+	if opts.NoCommit {
+		return applyWithoutCommit(repoPath, items, opts)
+	}
+	if head == "" {
+		return "", fmt.Errorf("cannot %s: no commits yet", action)
+	}
+	// the picks replace the index, which mustn't hold changes of its own
+	if err := requireIndexMatchesHead(repoPath, head, action); err != nil {
+		return "", err
+	}
+
+	dir := sequencerDir(repoPath)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create sequencer state: %w", err)
+	}
+	state := map[string]string{
+		"head":          head,
+		"record-origin": strconv.FormatBool(opts.RecordOrigin),
+		"mainline":      strconv.Itoa(opts.Mainline),
+	}
+	for name, value := range state {
+		if err := writeStateFile(dir, name, value); err != nil {
+			return "", err
+		}
+	}
+	if err := writeSequencerTodo(repoPath, items); err != nil {
+		os.RemoveAll(dir)
+		return "", err
+	}
+
+	output, err := runSequencer(repoPath, opts.CommitterName, opts.CommitterEmail)
+	if err != nil && !sequencerStarted(repoPath, head) {
+		// nothing was applied, so there is no sequence to continue or abort
+		os.RemoveAll(dir)
+	}
+	return output, err
+}
+
+// sequencerStarted reports whether a sequence begun at head has committed
+// a pick or stopped on a conflict.
+func sequencerStarted(repoPath, head string) bool {
+	repoDir := filepath.Join(repoPath, RepoDirName)
+	for _, name := range []string{"CHERRY_PICK_HEAD", "REVERT_HEAD"} {
+		if _, err := readStateFile(repoDir, name); err == nil {
+			return true
+		}
+	}
+	current, err := resolveHead(repoPath)
+	return err != nil || current != head
+}
+
+// requireIndexMatchesHead makes sure the index has nothing staged, as a
+// cherry-pick or revert that commits rewrites it from HEAD.
+func requireIndexMatchesHead(repoPath, head, action string) error {
+	headCommit, err := readCommit(repoPath, head)
+	if err != nil {
+		return err
+	}
+	headEntries, err := treeIndexEntries(repoPath, headCommit.Tree)
+	if err != nil {
+		return err
+	}
+	entries, err := readIndexEntries(repoPath)
+	if err != nil {
+		return err
+	}
+	staged := len(entries) != len(headEntries)
+	for _, entry := range entries {
+		if headEntry, ok := headEntries[entry.Path]; !ok || entry.Stage != 0 || !sameIndexEntry(entry, headEntry) {
+			staged = true
+		}
+	}
+	if staged {
+		name := "cherry-pick"
+		if action == "revert" {
+			name = "revert"
+		}
+		return fmt.Errorf("your local changes would be overwritten by %s; commit your changes or stash them to proceed", name)
+	}
+	return nil
+}
+
+// applyWithoutCommit applies every change to the index and working tree in
+// turn without recording any commits, like "cherry-pick -n".
+func applyWithoutCommit(repoPath string, items []sequencerItem, opts CherryPickOptions) (string, error) {
+	for _, item := range items {
+		commit, err := readCommit(repoPath, item.Hash)
+		if err != nil {
+			return "", err
+		}
+		index, err := readIndexMap(repoPath)
+		if err != nil {
+			return "", err
+		}
+
+		result, err := applyCommitChanges(repoPath, commit, index, opts.Mainline, item.Action == "revert")
+		if err != nil {
+			return "", err
+		}
+		if len(result.Conflicts) > 0 {
+			return "", sequencerConflictError(item, commit, result.Conflicts)
+		}
+	}
+	return "", nil
+}
+
+// SequencerContinue commits the resolved conflict of a stopped cherry-pick
+// or revert and applies the remaining commits.
+func SequencerContinue(repoPath, committerName, committerEmail string) (string, error) {
+	if !SequencerInProgress(repoPath) {
+		return "", fmt.Errorf("no cherry-pick or revert in progress")
+	}
+
+	repoDir := filepath.Join(repoPath, RepoDirName)
+	for _, name := range []string{"CHERRY_PICK_HEAD", "REVERT_HEAD"} {
+		stopped, err := readStateFile(repoDir, name)
+		if err != nil {
+			continue
+		}
+
+		index, err := readIndexMap(repoPath)
+		if err != nil {
+			return "", err
+		}
+		unstaged, err := unstagedChanges(repoPath, index)
+		if err != nil {
+			return "", err
+		}
+		if len(unstaged) > 0 {
+			return "", fmt.Errorf("you must edit all merge conflicts and then mark them as resolved using senpai add:\n\t%s",
+				strings.Join(unstaged, "\n\t"))
+		}
+
+		commit, err := readCommit(repoPath, stopped)
+		if err != nil {
+			return "", err
+		}
+		message, err := os.ReadFile(filepath.Join(repoDir, "MERGE_MSG"))
+		if err != nil {
+			return "", fmt.Errorf("failed to read MERGE_MSG: %w", err)
+		}
+		treeHash, err := writeTreeFromMap(index)
+		if err != nil {
+			return "", err
+		}
+
+		committer := formatSignature(committerName, committerEmail, time.Now())
+		author := commit.authorSignature()
+		if name == "REVERT_HEAD" {
+			author = committer
+		}
+
+		action := "cherry-pick"
+		if name == "REVERT_HEAD" {
+			action = "revert"
+		}
+		line, err := commitSequencerResult(repoPath, treeHash, string(message), author, committer, action)
+		if err != nil {
+			return "", err
+		}
+		removeStateFiles(repoDir, name, "MERGE_MSG")
+
+		rest, err := runSequencer(repoPath, committerName, committerEmail)
+		if rest != "" {
+			line += "\n" + rest
+		}
+		return line, err
+	}
+
+	return runSequencer(repoPath, committerName, committerEmail)
+}
+
+// SequencerSkip drops the pick a cherry-pick or revert stopped at, resetting
+// the index and working tree to HEAD, and applies the remaining commits.
+func SequencerSkip(repoPath, committerName, committerEmail string) (string, error) {
+	if !SequencerInProgress(repoPath) {
+		return "", fmt.Errorf("no cherry-pick or revert in progress")
+	}
+
+	head, err := resolveHead(repoPath)
+	if err != nil {
+		return "", err
+	}
+	headTree, err := commitTreeMap(repoPath, head)
+	if err != nil {
+		return "", err
+	}
+	if err := resetHardToTree(repoPath, headTree); err != nil {
+		return "", err
+	}
+	removeStateFiles(filepath.Join(repoPath, RepoDirName), "CHERRY_PICK_HEAD", "REVERT_HEAD", "MERGE_MSG")
+
+	return runSequencer(repoPath, committerName, committerEmail)
+}
+
+// SequencerAbort cancels a cherry-pick or revert sequence, returning the
+// branch, index and working tree to where they were before it started.
+func SequencerAbort(repoPath string) error {
+	if !SequencerInProgress(repoPath) {
+		return fmt.Errorf("no cherry-pick or revert in progress")
+	}
+
+	origHead, err := readStateFile(sequencerDir(repoPath), "head")
+	if err != nil {
+		return fmt.Errorf("failed to read original HEAD: %w", err)
+	}
+	origTree, err := getCommitTree(repoPath, origHead)
+	if err != nil {
+		return err
+	}
+	if err := resetHardToTree(repoPath, origTree); err != nil {
+		return err
+	}
+
+	repoDir := filepath.Join(repoPath, RepoDirName)
+	if err := updateHEAD(repoPath, origHead, "reset: moving to "+origHead); err != nil {
+		return err
+	}
+
+	removeStateFiles(repoDir, "CHERRY_PICK_HEAD", "REVERT_HEAD", "MERGE_MSG")
+	return os.RemoveAll(sequencerDir(repoPath))
+}
+
+func runSequencer(repoPath, committerName, committerEmail string) (string, error) {
+	dir := sequencerDir(repoPath)
+	repoDir := filepath.Join(repoPath, RepoDirName)
+
+	recordOrigin := false
+	if value, err := readStateFile(dir, "record-origin"); err == nil {
+		recordOrigin, _ = strconv.ParseBool(value)
+	}
+	mainline := 0
+	if value, err := readStateFile(dir, "mainline"); err == nil {
+		mainline, _ = strconv.Atoi(value)
+	}
+
+	var output []string
+	for {
+		items, err := readSequencerTodo(repoPath)
+		if err != nil {
+			return "", err
+		}
+		if len(items) == 0 {
+			break
+		}
+
+		item := items[0]
+		if err := writeSequencerTodo(repoPath, items[1:]); err != nil {
+			return "", err
+		}
+
+		commit, err := readCommit(repoPath, item.Hash)
+		if err != nil {
+			return "", err
+		}
+		head, err := resolveHead(repoPath)
+		if err != nil {
+			return "", err
+		}
+		headTree, err := commitTreeMap(repoPath, head)
+		if err != nil {
+			return "", err
+		}
+
+		revert := item.Action == "revert"
+		result, err := applyCommitChanges(repoPath, commit, headTree, mainline, revert)
+		if err != nil {
+			return strings.Join(output, "\n"), err
+		}
+
+		message := sequencerMessage(commit, revert, recordOrigin, mainline)
+		committer := formatSignature(committerName, committerEmail, time.Now())
+		author := commit.authorSignature()
+		if revert {
+			author = committer
+		}
+
+		if len(result.Conflicts) > 0 {
+			if err := stopSequencer(repoDir, commit, revert, message); err != nil {
+				return "", err
+			}
+			return strings.Join(output, "\n"), sequencerConflictError(item, commit, result.Conflicts)
+		}
+
+		treeHash, err := writeTreeFromMap(result.Tree)
+		if err != nil {
+			return "", err
+		}
+
+		headCommit, err := readCommit(repoPath, head)
+		if err != nil {
+			return "", err
+		}
+		if treeHash == headCommit.Tree {
+			// leave it to the user whether an empty commit is wanted
+			if err := stopSequencer(repoDir, commit, revert, message); err != nil {
+				return "", err
+			}
+			return strings.Join(output, "\n"), sequencerEmptyError(item, commit)
+		}
+
+		action := "cherry-pick"
+		if revert {
+			action = "revert"
+		}
+		line, err := commitSequencerResult(repoPath, treeHash, message, author, committer, action)
+		if err != nil {
+			return "", err
+		}
+		output = append(output, line)
+	}
+
+	if err := os.RemoveAll(dir); err != nil {
+		return "", fmt.Errorf("failed to clean up sequencer state: %w", err)
+	}
+	return strings.Join(output, "\n"), nil
+}
+
+// stopSequencer records the pick the sequence stopped at, for --continue to
+// commit with message.
+func stopSequencer(repoDir string, commit CommitInfo, revert bool, message string) error {
+	headFile := "CHERRY_PICK_HEAD"
+	if revert {
+		headFile = "REVERT_HEAD"
+	}
+	if err := writeStateFile(repoDir, headFile, commit.Hash); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(repoDir, "MERGE_MSG"), []byte(message+"\n"), 0644); err != nil {
+		return fmt.Errorf("failed to write MERGE_MSG: %w", err)
+	}
+	return nil
+}
+
+func commitSequencerResult(repoPath, treeHash, message, author, committer, action string) (string, error) {
+	head, err := resolveHead(repoPath)
+	if err != nil {
+		return "", err
+	}
+
+	newHash, err := commitTreeWithSignatures(treeHash, []string{head}, message, author, committer)
+	if err != nil {
+		return "", err
+	}
+	subject, _, _ := strings.Cut(strings.TrimSpace(message), "\n")
+	if err := updateHEAD(repoPath, newHash, action+": "+subject); err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("[%s] %s", shortHash(newHash), subject), nil
+}
+
+func sequencerMessage(commit CommitInfo, revert, recordOrigin bool, mainline int) string {
+	if revert {
+		message := fmt.Sprintf("Revert \"%s\"\n\nThis reverts commit %s", commit.Subject(), commit.Hash)
+		if mainline > 0 && len(commit.Parents) > 1 {
+			message += fmt.Sprintf(", reversing\nchanges made to %s", commit.Parents[mainline-1])
+		}
+		return message + "."
+	}
+
+	message := commit.Message
+	if recordOrigin {
+		message += fmt.Sprintf("\n\n(cherry picked from commit %s)", commit.Hash)
+	}
+	return message
+}
+
+func sequencerConflictError(item sequencerItem, commit CommitInfo, conflicts []string) error {
+	verb := "apply"
+	if item.Action == "revert" {
+		verb = "revert"
+	}
+	return fmt.Errorf("could not %s %s... %s\nCONFLICT in:\n\t%s\nAfter resolving the conflicts, mark them with \"senpai add <paths>\"\nand run \"senpai cherry-pick --continue\" (or \"senpai revert --continue\").",
+		verb, shortHash(commit.Hash), commit.Subject(), strings.Join(conflicts, "\n\t"))
+}
+
+func sequencerEmptyError(item sequencerItem, commit CommitInfo) error {
+	command := "cherry-pick"
+	if item.Action == "revert" {
+		command = "revert"
+	}
+	return fmt.Errorf("%s %s... %s is now empty\nRun \"senpai %s --continue\" to commit it anyway, or \"senpai %s --skip\" to drop it.",
+		command, shortHash(commit.Hash), commit.Subject(), command, command)
+}
+
+func readSequencerTodo(repoPath string) ([]sequencerItem, error) {
+	data, err := os.ReadFile(filepath.Join(sequencerDir(repoPath), "todo"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read sequencer todo: %w", err)
+	}
+
+	var items []sequencerItem
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		items = append(items, sequencerItem{Action: fields[0], Hash: fields[1]})
+	}
+	return items, nil
+}
+
+func writeSequencerTodo(repoPath string, items []sequencerItem) error {
+	var sb strings.Builder
+	for _, item := range items {
+		sb.WriteString(fmt.Sprintf("%s %s\n", item.Action, item.Hash))
+	}
+	if err := os.WriteFile(filepath.Join(sequencerDir(repoPath), "todo"), []byte(sb.String()), 0644); err != nil {
+		return fmt.Errorf("failed to write sequencer todo: %w", err)
+	}
+	return nil
+}
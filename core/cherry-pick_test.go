@@ -0,0 +1,259 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func testCherryPickOptions() CherryPickOptions {
+	return CherryPickOptions{CommitterName: "Test Committer", CommitterEmail: "committer@example.com"}
+}
+
+func TestCherryPick(t *testing.T) {
+	repo := setupTestRepo(t)
+	commitFile(t, repo, "file.txt", "one\ntwo\nthree\n", "base")
+	if err := CreateBranch(repo, "feature"); err != nil {
+		t.Fatalf("CreateBranch failed: %v", err)
+	}
+	if err := Checkout(repo, "feature"); err != nil {
+		t.Fatalf("Checkout failed: %v", err)
+	}
+	picked := commitFile(t, repo, "file.txt", "one\ntwo\nthree\nfour\n", "add four")
+
+	if err := Checkout(repo, "main"); err != nil {
+		t.Fatalf("Checkout failed: %v", err)
+	}
+	commitFile(t, repo, "file.txt", "ONE\ntwo\nthree\n", "shout one")
+
+	opts := testCherryPickOptions()
+	opts.RecordOrigin = true
+	if _, err := CherryPick(repo, []string{picked[:8]}, opts); err != nil {
+		t.Fatalf("CherryPick failed: %v", err)
+	}
+
+	if got := readTestFile(t, repo, "file.txt"); got != "ONE\ntwo\nthree\nfour\n" {
+		t.Errorf("unexpected content after cherry-pick: %q", got)
+	}
+
+	head, _ := resolveHead(repo)
+	commit, err := readCommit(repo, head)
+	if err != nil {
+		t.Fatalf("readCommit failed: %v", err)
+	}
+	if commit.Author != "Test Author" || !strings.HasPrefix(commit.Committer, "Test Committer") {
+		t.Errorf("expected original author and new committer, got %q / %q", commit.Author, commit.Committer)
+	}
+	if !strings.HasSuffix(commit.Message, "(cherry picked from commit "+picked+")") {
+		t.Errorf("expected -x trailer, got %q", commit.Message)
+	}
+	if SequencerInProgress(repo) {
+		t.Error("sequencer state should be removed after success")
+	}
+}
+
+func TestRevert(t *testing.T) {
+	repo := setupTestRepo(t)
+	commitFile(t, repo, "file.txt", "one\n", "base")
+	bad := commitFile(t, repo, "file.txt", "one\nbad\n", "add bad line")
+	commitFile(t, repo, "other.txt", "other\n", "add other")
+
+	if _, err := Revert(repo, []string{bad}, testCherryPickOptions()); err != nil {
+		t.Fatalf("Revert failed: %v", err)
+	}
+
+	if got := readTestFile(t, repo, "file.txt"); got != "one\n" {
+		t.Errorf("expected bad line to be reverted, got %q", got)
+	}
+	if got := readTestFile(t, repo, "other.txt"); got != "other\n" {
+		t.Errorf("later commit should be untouched, got %q", got)
+	}
+
+	commits, err := Log(repo)
+	if err != nil {
+		t.Fatalf("Log failed: %v", err)
+	}
+	if !strings.HasPrefix(commits[0].Message, `Revert "add bad line"`) {
+		t.Errorf("unexpected revert message %q", commits[0].Message)
+	}
+	if commits[0].Author != "Test Committer" {
+		t.Errorf("revert should be authored by the committer, got %q", commits[0].Author)
+	}
+}
+
+func TestCherryPickNoCommit(t *testing.T) {
+	repo := setupTestRepo(t)
+	base := commitFile(t, repo, "a.txt", "a\n", "base")
+	first := commitFile(t, repo, "b.txt", "b\n", "add b")
+	second := commitFile(t, repo, "c.txt", "c\n", "add c")
+
+	if _, err := Revert(repo, []string{second, first}, CherryPickOptions{NoCommit: true}); err != nil {
+		t.Fatalf("Revert -n failed: %v", err)
+	}
+
+	head, _ := resolveHead(repo)
+	if head != second {
+		t.Errorf("HEAD should not move with --no-commit")
+	}
+	index, err := readIndexMap(repo)
+	if err != nil {
+		t.Fatalf("readIndexMap failed: %v", err)
+	}
+	baseTree, _ := getCommitTree(repo, base)
+	if len(index) != len(baseTree) || index["a.txt"] != baseTree["a.txt"] {
+		t.Errorf("expected index to match base tree, got %v", index)
+	}
+}
+
+func TestCherryPickMergeNeedsMainline(t *testing.T) {
+	repo := setupTestRepo(t)
+	base := commitFile(t, repo, "a.txt", "a\n", "base")
+	side := commitFile(t, repo, "b.txt", "b\n", "side")
+	other := commitFile(t, repo, "c.txt", "c\n", "other")
+
+	sideCommit, _ := readCommit(repo, side)
+	merge, err := commitTreeWithSignatures(sideCommit.Tree, []string{base, side}, "merge", sideCommit.authorSignature(), sideCommit.authorSignature())
+	if err != nil {
+		t.Fatalf("failed to create merge commit: %v", err)
+	}
+
+	if err := Checkout(repo, base); err != nil {
+		t.Fatalf("Checkout failed: %v", err)
+	}
+	if _, err := CherryPick(repo, []string{side, merge}, testCherryPickOptions()); err == nil {
+		t.Fatal("expected error when picking a merge without -m")
+	}
+	if SequencerInProgress(repo) {
+		t.Error("a sequence refused up front should leave no state behind")
+	}
+	if head, _ := resolveHead(repo); head != base {
+		t.Errorf("nothing should be picked when one of the commits is refused, HEAD is %s", head)
+	}
+
+	// -m only applies to the merges of a range
+	opts := testCherryPickOptions()
+	opts.Mainline = 1
+	if _, err := CherryPick(repo, []string{merge, other}, opts); err != nil {
+		t.Fatalf("CherryPick -m 1 failed: %v", err)
+	}
+	if got := readTestFile(t, repo, "b.txt"); got != "b\n" {
+		t.Errorf("expected side changes to be picked, got %q", got)
+	}
+	if got := readTestFile(t, repo, "c.txt"); got != "c\n" {
+		t.Errorf("expected the ordinary commit to be picked too, got %q", got)
+	}
+}
+
+func TestCherryPickRefusesStagedChanges(t *testing.T) {
+	repo := setupTestRepo(t)
+	base := commitFile(t, repo, "a.txt", "a\n", "base")
+	side := commitFile(t, repo, "b.txt", "b\n", "side")
+	if err := Checkout(repo, base); err != nil {
+		t.Fatalf("Checkout failed: %v", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(repo, "a.txt"), []byte("staged\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Add(repo, "a.txt"); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	for name, run := range map[string]func(string, []string, CherryPickOptions) (string, error){"cherry-pick": CherryPick, "revert": Revert} {
+		if _, err := run(repo, []string{side}, testCherryPickOptions()); err == nil || !strings.Contains(err.Error(), "local changes would be overwritten") {
+			t.Errorf("%s should refuse to run over staged changes, got %v", name, err)
+		}
+		if SequencerInProgress(repo) {
+			t.Errorf("a refused %s should leave no state behind", name)
+		}
+	}
+	index, _ := readIndexMap(repo)
+	if hash, _ := HashObject([]byte("staged\n"), "blob", false); index["a.txt"] != hash {
+		t.Error("the staged change should still be in the index")
+	}
+}
+
+func TestCherryPickConflictContinueAndAbort(t *testing.T) {
+	repo := setupTestRepo(t)
+	base := commitFile(t, repo, "file.txt", "base\n", "base")
+	theirs := commitFile(t, repo, "file.txt", "theirs\n", "theirs")
+	other := commitFile(t, repo, "other.txt", "other\n", "other")
+
+	if err := Checkout(repo, base); err != nil {
+		t.Fatalf("Checkout failed: %v", err)
+	}
+	ours := commitFile(t, repo, "file.txt", "ours\n", "ours")
+
+	if _, err := CherryPick(repo, []string{theirs, other}, testCherryPickOptions()); err == nil {
+		t.Fatal("expected conflict")
+	}
+	if err := SequencerAbort(repo); err != nil {
+		t.Fatalf("SequencerAbort failed: %v", err)
+	}
+	if head, _ := resolveHead(repo); head != ours {
+		t.Errorf("abort should restore HEAD to %s, got %s", ours, head)
+	}
+	if got := readTestFile(t, repo, "file.txt"); got != "ours\n" {
+		t.Errorf("abort should restore the working tree, got %q", got)
+	}
+
+	if _, err := CherryPick(repo, []string{theirs, other}, testCherryPickOptions()); err == nil {
+		t.Fatal("expected conflict")
+	}
+	if err := os.WriteFile("file.txt", []byte("merged\n"), 0644); err != nil {
+		t.Fatalf("failed to resolve: %v", err)
+	}
+	if err := Add(repo, "file.txt"); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	if _, err := SequencerContinue(repo, "Test Committer", "committer@example.com"); err != nil {
+		t.Fatalf("SequencerContinue failed: %v", err)
+	}
+
+	commits, err := Log(repo)
+	if err != nil {
+		t.Fatalf("Log failed: %v", err)
+	}
+	if len(commits) != 4 || commits[0].Message != "other" || commits[1].Message != "theirs" {
+		t.Errorf("unexpected history after continue: %+v", commits)
+	}
+	if got := readTestFile(t, repo, "other.txt"); got != "other\n" {
+		t.Errorf("remaining pick was not applied, got %q", got)
+	}
+}
+
+func TestCherryPickStopsAtEmptyPick(t *testing.T) {
+	repo := setupTestRepo(t)
+	base := commitFile(t, repo, "file.txt", "base\n", "base")
+	same := commitFile(t, repo, "file.txt", "changed\n", "same")
+	other := commitFile(t, repo, "other.txt", "other\n", "other")
+	if err := Checkout(repo, base); err != nil {
+		t.Fatalf("Checkout failed: %v", err)
+	}
+	dup := commitFile(t, repo, "file.txt", "changed\n", "dup")
+
+	if _, err := CherryPick(repo, []string{same, other}, testCherryPickOptions()); err == nil || !strings.Contains(err.Error(), "is now empty") {
+		t.Fatalf("expected the empty pick to stop the sequence, got %v", err)
+	}
+	if head, _ := resolveHead(repo); head != dup || !SequencerInProgress(repo) {
+		t.Fatalf("the sequence should stop before committing anything, HEAD is %s", head)
+	}
+	if _, err := SequencerSkip(repo, "Test Committer", "committer@example.com"); err != nil {
+		t.Fatalf("SequencerSkip failed: %v", err)
+	}
+	commits, _ := Log(repo)
+	if len(commits) != 3 || commits[0].Message != "other" || commits[1].Hash != dup {
+		t.Errorf("skip should drop the empty pick and apply the rest: %+v", commits)
+	}
+
+	if _, err := CherryPick(repo, []string{same}, testCherryPickOptions()); err == nil {
+		t.Fatal("expected the empty pick to stop the sequence")
+	}
+	if _, err := SequencerContinue(repo, "Test Committer", "committer@example.com"); err != nil {
+		t.Fatalf("SequencerContinue failed: %v", err)
+	}
+	commits, _ = Log(repo)
+	if len(commits) != 4 || commits[0].Message != "same" || SequencerInProgress(repo) {
+		t.Errorf("continue should record the empty pick: %+v", commits)
+	}
+}
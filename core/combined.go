@@ -0,0 +1,604 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+)
+
+// combinedPath is a path a merge changed compared to every one of its
+// parents, with how it changed compared to each.
+type combinedPath struct {
+	Path    string
+	Mode    string
+	Hash    string
+	Parents []FileChange
+}
+
+// combinedChanges diffs a merge against each of its parents, with renames
+// detected, and keeps the paths that differ from all of them. It also
+// returns the changes against the first parent, which the diffstat of a
+// merge shows.
+func combinedChanges(repoPath string, commit CommitInfo) ([]combinedPath, []FileChange, error) {
+	var paths []combinedPath
+	var firstParent []FileChange
+	for i, parentHash := range commit.Parents {
+		parent, err := readCommit(repoPath, parentHash)
+		if err != nil {
+			return nil, nil, err
+		}
+		changes, err := diffTrees(repoPath, parent.Tree, commit.Tree, nil)
+		if err != nil {
+			return nil, nil, err
+		}
+		if changes, err = detectRenames(repoPath, changes); err != nil {
+			return nil, nil, err
+		}
+
+		if i == 0 {
+			firstParent = changes
+			for _, change := range changes {
+				paths = append(paths, combinedPath{
+					Path:    change.Path,
+					Mode:    change.Mode,
+					Hash:    change.Hash,
+					Parents: []FileChange{change},
+				})
+			}
+			continue
+		}
+		byPath := make(map[string]FileChange, len(changes))
+		for _, change := range changes {
+			byPath[change.Path] = change
+		}
+		kept := paths[:0]
+		for _, path := range paths {
+			if change, ok := byPath[path.Path]; ok {
+				path.Parents = append(path.Parents, change)
+				kept = append(kept, path)
+			}
+		}
+		paths = kept
+	}
+	return paths, firstParent, nil
+}
+
+// FormatCombinedDiff renders what a merge changed the way git show does
+// by default: the diffstat against the first parent, then the paths that
+// differ from every parent, listed or as a combined patch. A combined
+// patch has a column of markers per parent, and leaves out the hunks
+// whose lines all come from one of the parents unchanged.
+func FormatCombinedDiff(repoPath string, commit CommitInfo, format DiffFormat, width int) (string, error) {
+	paths, firstParent, err := combinedChanges(repoPath, commit)
+	if err != nil {
+		return "", err
+	}
+	format = format.effective()
+
+	var sb strings.Builder
+	if format.Stat {
+		stat, err := FormatDiff(repoPath, firstParent, DiffFormat{Stat: true}, width)
+		if err != nil {
+			return "", err
+		}
+		sb.WriteString(stat)
+	}
+	if len(paths) == 0 {
+		return sb.String(), nil
+	}
+
+	if format.NameOnly || format.NameStatus {
+		for _, path := range paths {
+			if format.NameStatus {
+				for _, parent := range path.Parents {
+					sb.WriteByte(parent.Status)
+				}
+				sb.WriteString("\t")
+			}
+			sb.WriteString(path.Path + "\n")
+		}
+	}
+	if format.Patch {
+		if sb.Len() > 0 {
+			sb.WriteString("\n")
+		}
+		for _, path := range paths {
+			if err := writeCombinedPatch(&sb, repoPath, path); err != nil {
+				return "", err
+			}
+		}
+	}
+	return sb.String(), nil
+}
+
+// writeCombinedPatch writes the "diff --cc" header of a path and the hunks
+// of its combined diff, or nothing when no hunk survives and the mode
+// didn't change.
+func writeCombinedPatch(sb *strings.Builder, repoPath string, path combinedPath) error {
+	modeDiffers := false
+	for _, parent := range path.Parents {
+		if parent.OldMode != path.Mode {
+			modeDiffers = true
+		}
+	}
+
+	result, err := patchContent(repoPath, path.Mode, path.Hash)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", path.Path, err)
+	}
+	binary := isBinary(result)
+	parentContents := make([][]byte, len(path.Parents))
+	for i, parent := range path.Parents {
+		if parentContents[i], err = patchContent(repoPath, parent.OldMode, parent.OldHash); err != nil {
+			return fmt.Errorf("failed to read %s: %w", parent.OldPath, err)
+		}
+		binary = binary || isBinary(parentContents[i])
+	}
+	if binary {
+		writeCombinedHeader(sb, path, modeDiffers, false)
+		sb.WriteString("Binary files differ\n")
+		return nil
+	}
+
+	d := newCombinedDiff(splitLines(result), len(path.Parents))
+	for i, parent := range path.Parents {
+		reused := false
+		for j := 0; j < i; j++ {
+			if path.Parents[j].OldHash == parent.OldHash {
+				d.reuseParent(i, j)
+				reused = true
+				break
+			}
+		}
+		if !reused {
+			d.addParent(i, splitLines(parentContents[i]))
+		}
+	}
+
+	if d.makeHunks() || modeDiffers {
+		writeCombinedHeader(sb, path, modeDiffers, true)
+		d.write(sb)
+	}
+	return nil
+}
+
+// writeCombinedHeader writes the lines that introduce a path in a combined
+// patch: its name, the blobs it was in each parent and in the merge, the
+// modes when they differ, and with fileHeader the ---/+++ lines.
+func writeCombinedHeader(sb *strings.Builder, path combinedPath, modeDiffers, fileHeader bool) {
+	fmt.Fprintf(sb, "diff --cc %s\nindex ", path.Path)
+	for i, parent := range path.Parents {
+		if i > 0 {
+			sb.WriteString(",")
+		}
+		sb.WriteString(abbrevBlob(parent.OldHash))
+	}
+	fmt.Fprintf(sb, "..%s\n", abbrevBlob(path.Hash))
+
+	deleted, added := path.Hash == "", false
+	if modeDiffers {
+		// it was added if no parent had it
+		added = !deleted
+		for _, parent := range path.Parents {
+			if parent.Status != 'A' {
+				added = false
+			}
+		}
+		if added {
+			fmt.Fprintf(sb, "new file mode %s", fullMode(path.Mode))
+		} else {
+			if deleted {
+				sb.WriteString("deleted file ")
+			}
+			sb.WriteString("mode ")
+			for i, parent := range path.Parents {
+				if i > 0 {
+					sb.WriteString(",")
+				}
+				sb.WriteString(fullMode(parent.OldMode))
+			}
+			if !deleted {
+				fmt.Fprintf(sb, "..%s", fullMode(path.Mode))
+			}
+		}
+		sb.WriteString("\n")
+	}
+	if !fileHeader {
+		return
+	}
+
+	if added {
+		sb.WriteString("--- /dev/null\n")
+	} else {
+		fmt.Fprintf(sb, "--- a/%s\n", path.Path)
+	}
+	if deleted {
+		sb.WriteString("+++ /dev/null\n")
+	} else {
+		fmt.Fprintf(sb, "+++ b/%s\n", path.Path)
+	}
+}
+
+// combinedDiff lines up the lines of a merge result with each parent. The
+// lines of the result carry a bit per parent that doesn't have them, and
+// the lines parents lost are attached to the result line they come
+// before, with a bit for each parent that had them. Past the parent bits
+// are the marks of the lines that make it into a hunk.
+type combinedDiff struct {
+	result     []string
+	lines      []combinedLine
+	numParents int
+}
+
+type combinedLine struct {
+	text  string
+	flags uint
+	lost  []lostLine
+	// parentLine is where this line, or the lost lines before it, starts
+	// in each parent, counting from one
+	parentLine []int
+}
+
+type lostLine struct {
+	text    string
+	parents uint
+}
+
+func newCombinedDiff(result []string, numParents int) *combinedDiff {
+	// one line more for what was lost after the end, and one more to
+	// hold the length of each parent
+	d := &combinedDiff{result: result, lines: make([]combinedLine, len(result)+2), numParents: numParents}
+	for i := range d.lines {
+		d.lines[i].parentLine = make([]int, numParents)
+	}
+	for i, line := range result {
+		d.lines[i].text = strings.TrimSuffix(line, "\n")
+	}
+	return d
+}
+
+func (d *combinedDiff) hunkMark() uint { return 1 << d.numParents }
+
+func (d *combinedDiff) noPreDelete() uint { return 2 << d.numParents }
+
+func (d *combinedDiff) allParents() uint { return d.hunkMark() - 1 }
+
+// addParent diffs parent n against the result, and merges the lines it
+// lost with those earlier parents lost at the same place.
+func (d *combinedDiff) addParent(n int, parent []string) {
+	mask := uint(1) << n
+	count := len(d.result)
+	lost := make([][]lostLine, count+1)
+	for _, change := range lineChanges(parent, d.result) {
+		for _, line := range parent[change.oldStart : change.oldStart+change.oldCount] {
+			lost[change.newStart] = append(lost[change.newStart], lostLine{text: strings.TrimSuffix(line, "\n"), parents: mask})
+		}
+		for i := change.newStart; i < change.newStart+change.newCount; i++ {
+			d.lines[i].flags |= mask
+		}
+	}
+
+	parentLine := 1
+	for i := 0; i <= count; i++ {
+		line := &d.lines[i]
+		line.parentLine[n] = parentLine
+		line.lost = coalesceLost(line.lost, lost[i], mask)
+		for _, l := range line.lost {
+			if l.parents&mask != 0 {
+				parentLine++
+			}
+		}
+		if i < count && line.flags&mask == 0 {
+			parentLine++
+		}
+	}
+	d.lines[count+1].parentLine[n] = parentLine
+}
+
+// reuseParent copies what addParent found for parent j to parent i, which
+// had the same content.
+func (d *combinedDiff) reuseParent(i, j int) {
+	imask, jmask := uint(1)<<i, uint(1)<<j
+	for k := range d.lines {
+		line := &d.lines[k]
+		line.parentLine[i] = line.parentLine[j]
+		for l := range line.lost {
+			if line.lost[l].parents&jmask != 0 {
+				line.lost[l].parents |= imask
+			}
+		}
+		if line.flags&jmask != 0 {
+			line.flags |= imask
+		}
+	}
+}
+
+// coalesceLost merges the lines a parent lost before a result line into
+// those earlier parents lost there, sharing the lines they have in common
+// by their longest common subsequence.
+func coalesceLost(base, added []lostLine, mask uint) []lostLine {
+	if len(added) == 0 {
+		return base
+	}
+	if len(base) == 0 {
+		return added
+	}
+
+	const (
+		fromBase = iota
+		fromAdded
+		fromBoth
+	)
+	lcs := make([][]int, len(base)+1)
+	directions := make([][]int, len(base)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(added)+1)
+		directions[i] = make([]int, len(added)+1)
+		directions[i][0] = fromBase
+	}
+	for j := 1; j <= len(added); j++ {
+		directions[0][j] = fromAdded
+	}
+	for i := 1; i <= len(base); i++ {
+		for j := 1; j <= len(added); j++ {
+			switch {
+			case base[i-1].text == added[j-1].text:
+				lcs[i][j], directions[i][j] = lcs[i-1][j-1]+1, fromBoth
+			case lcs[i][j-1] >= lcs[i-1][j]:
+				lcs[i][j], directions[i][j] = lcs[i][j-1], fromAdded
+			default:
+				lcs[i][j], directions[i][j] = lcs[i-1][j], fromBase
+			}
+		}
+	}
+
+	var merged []lostLine
+	for i, j := len(base), len(added); i != 0 || j != 0; {
+		switch directions[i][j] {
+		case fromBoth:
+			line := base[i-1]
+			line.parents |= mask
+			merged = append(merged, line)
+			i--
+			j--
+		case fromAdded:
+			merged = append(merged, added[j-1])
+			j--
+		default:
+			merged = append(merged, base[i-1])
+			i--
+		}
+	}
+	for i, j := 0, len(merged)-1; i < j; i, j = i+1, j-1 {
+		merged[i], merged[j] = merged[j], merged[i]
+	}
+	return merged
+}
+
+// isInteresting reports whether a result line differs from some parent or
+// has lines some parent lost before it.
+func (d *combinedDiff) isInteresting(i int) bool {
+	return d.lines[i].flags&d.allParents() != 0 || len(d.lines[i].lost) > 0
+}
+
+// makeHunks marks the lines that go into hunks and reports whether there
+// are any. A hunk where the result only differs from one parent, or
+// differs the same way from all but one, shows nothing the merge itself
+// did and is dropped.
+func (d *combinedDiff) makeHunks() bool {
+	count, mark, all := len(d.result), d.hunkMark(), d.allParents()
+	for i := 0; i <= count; i++ {
+		if d.isInteresting(i) {
+			d.lines[i].flags |= mark
+		} else {
+			d.lines[i].flags &^= mark
+		}
+	}
+
+	for i := 0; i <= count; {
+		for i <= count && d.lines[i].flags&mark == 0 {
+			i++
+		}
+		if i > count {
+			break
+		}
+		begin := i
+		j := i + 1
+		for ; j <= count; j++ {
+			if d.lines[j].flags&mark != 0 {
+				continue
+			}
+			// look beyond the end for an interesting line within the
+			// context
+			lookahead := min(d.adjustHunkTail(begin, j)+patchContext, count+1)
+			continues := false
+			for lookahead > 0 {
+				lookahead--
+				if lookahead < j {
+					break
+				}
+				if d.lines[lookahead].flags&mark != 0 {
+					continues = true
+					break
+				}
+			}
+			if !continues {
+				break
+			}
+			j = lookahead
+		}
+		end := j
+
+		// Are there only two versions, with the result matching one?
+		var sameDiff uint
+		interesting := false
+		for j := begin; j < end && !interesting; j++ {
+			if diff := d.lines[j].flags & all; diff != 0 {
+				if sameDiff == 0 {
+					sameDiff = diff
+				} else if sameDiff != diff {
+					interesting = true
+					break
+				}
+			}
+			for _, l := range d.lines[j].lost {
+				if interesting {
+					break
+				}
+				if sameDiff == 0 {
+					sameDiff = l.parents
+				} else if sameDiff != l.parents {
+					interesting = true
+				}
+			}
+		}
+		if !interesting && sameDiff != all {
+			for j := begin; j < end; j++ {
+				d.lines[j].flags &^= mark
+			}
+		}
+		i = end
+	}
+	return d.giveContext()
+}
+
+// adjustHunkTail steps back from the first line after a hunk when the
+// hunk's last line is only there for the lines lost before it, since that
+// line is shown as context anyway.
+func (d *combinedDiff) adjustHunkTail(begin, i int) int {
+	if begin+1 <= i && d.lines[i-1].flags&d.allParents() == 0 {
+		i--
+	}
+	return i
+}
+
+// findNext returns the first line from i on that is marked, or unmarked
+// with unmarked set.
+func (d *combinedDiff) findNext(i int, unmarked bool) int {
+	for ; i <= len(d.result); i++ {
+		if (d.lines[i].flags&d.hunkMark() == 0) == unmarked {
+			return i
+		}
+	}
+	return i
+}
+
+// giveContext marks the lines of context around the marked lines, joining
+// groups whose contexts would meet, and reports whether any are marked.
+func (d *combinedDiff) giveContext() bool {
+	count, mark, noPreDelete := len(d.result), d.hunkMark(), d.noPreDelete()
+	i := d.findNext(0, false)
+	if i > count {
+		return false
+	}
+	for i <= count {
+		// context before the first marked line
+		for j := max(i-patchContext, 0); j < i; j++ {
+			if d.lines[j].flags&mark == 0 {
+				d.lines[j].flags |= noPreDelete
+			}
+			d.lines[j].flags |= mark
+		}
+
+		for {
+			j := d.findNext(i, true)
+			if j > count {
+				return true
+			}
+			k := d.findNext(j, false)
+			j = d.adjustHunkTail(i, j)
+			if k < j+patchContext {
+				// the gap is small, so join the groups
+				for ; j < k; j++ {
+					d.lines[j].flags |= mark
+				}
+				i = k
+				continue
+			}
+			i = k
+			for end := min(j+patchContext, count+1); j < end; j++ {
+				d.lines[j].flags |= mark
+			}
+			break
+		}
+	}
+	return true
+}
+
+// write writes the marked lines as hunks with a "@@@" header, a column of
+// markers per parent, and the lines lost before each result line.
+func (d *combinedDiff) write(sb *strings.Builder) {
+	count, mark, noPreDelete := len(d.result), d.hunkMark(), d.noPreDelete()
+	markers := strings.Repeat("@", d.numParents+1)
+	for lno := 0; ; {
+		comment := ""
+		for lno <= count && d.lines[lno].flags&mark == 0 {
+			if lno < count && d.lines[lno].text != "" && isFuncNameStart(d.lines[lno].text[0]) {
+				comment = d.lines[lno].text
+			}
+			lno++
+		}
+		if lno > count {
+			return
+		}
+		end := lno + 1
+		for end <= count && d.lines[end].flags&mark != 0 {
+			end++
+		}
+		resultLines := end - lno
+		if end > count {
+			// the end points at the lines lost after the last one
+			resultLines--
+		}
+
+		sb.WriteString(markers)
+		for n := 0; n < d.numParents; n++ {
+			start := d.lines[lno].parentLine[n]
+			fmt.Fprintf(sb, " -%d,%d", start, d.lines[end].parentLine[n]-start)
+		}
+		fmt.Fprintf(sb, " +%d,%d %s", lno+1, resultLines, markers)
+		// git shows up to 40 characters of the comment, but stops short
+		// of the last one that isn't a space
+		commentEnd := 0
+		for i := 0; i < len(comment) && i < 40; i++ {
+			if !isSpace(comment[i]) {
+				commentEnd = i
+			}
+		}
+		if commentEnd > 0 {
+			sb.WriteString(" " + comment[:commentEnd])
+		}
+		sb.WriteString("\n")
+
+		for lno < end {
+			line := d.lines[lno]
+			lno++
+			if line.flags&noPreDelete == 0 {
+				for _, l := range line.lost {
+					for n := 0; n < d.numParents; n++ {
+						if l.parents&(1<<n) != 0 {
+							sb.WriteByte('-')
+						} else {
+							sb.WriteByte(' ')
+						}
+					}
+					sb.WriteString(l.text + "\n")
+				}
+			}
+			if lno > count {
+				break
+			}
+			for n := 0; n < d.numParents; n++ {
+				if line.flags&(1<<n) != 0 {
+					sb.WriteByte('+')
+				} else {
+					sb.WriteByte(' ')
+				}
+			}
+			sb.WriteString(line.text + "\n")
+		}
+	}
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f' || c == '\v'
+}
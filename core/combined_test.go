@@ -0,0 +1,66 @@
+package core
+
+import "testing"
+
+func TestFormatCombinedDiff(t *testing.T) {
+	setupTestRepo(t)
+
+	base := datedCommit(t, writeTestTree(t, map[string]string{
+		"main.go": "func main() {\n\tone()\n\ttwo()\n\tthree()\n}\n",
+		"notes":   "notes\n",
+	}), "base", 1000000000, 1000000000)
+	ours := datedCommit(t, writeTestTree(t, map[string]string{
+		"main.go": "func main() {\n\tzero()\n\tone()\n\ttwo()\n\tthree()\n}\n",
+		"notes":   "notes\nmore\n",
+	}), "ours", 1000000100, 1000000100, base)
+	theirs := datedCommit(t, writeTestTree(t, map[string]string{
+		"main.go": "func main() {\n\tone()\n\ttwo()\n\tthree()\n\tfour()\n}\n",
+		"notes":   "notes\n",
+	}), "theirs", 1000000200, 1000000200, base)
+	merge := datedCommit(t, writeTestTree(t, map[string]string{
+		"main.go": "func main() {\n\tzero()\n\tone()\n\ttwo()\n\tthree()\n\tfour()\n\tfive()\n}\n",
+		"notes":   "notes\nmore\n",
+	}), "merge", 1000000300, 1000000300, ours, theirs)
+
+	commit, err := readCommit(".", merge)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// notes only took one side's change, and so did all of main.go but
+	// the line the merge added itself
+	got, err := FormatCombinedDiff(".", commit, DiffFormat{Patch: true}, 80)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "diff --cc main.go\n" +
+		"index 76d3c96,340661b..d9c4f58\n" +
+		"--- a/main.go\n" +
+		"+++ b/main.go\n" +
+		"@@@ -3,4 -2,5 +3,6 @@@ func main() \n" +
+		"  \tone()\n" +
+		"  \ttwo()\n" +
+		"  \tthree()\n" +
+		"+ \tfour()\n" +
+		"++\tfive()\n" +
+		"  }\n"
+	if got != want {
+		t.Errorf("unexpected combined diff:\n%s\nwant:\n%s", got, want)
+	}
+
+	got, err = FormatCombinedDiff(".", commit, DiffFormat{Stat: true, NameStatus: true}, 80)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "MM\tmain.go\n"; got != want {
+		t.Errorf("expected the paths changed against both parents, got %q", got)
+	}
+
+	got, err = FormatCombinedDiff(".", commit, DiffFormat{Stat: true}, 80)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := " main.go | 2 ++\n 1 file changed, 2 insertions(+)\n"; got != want {
+		t.Errorf("expected the diffstat against the first parent, got %q", got)
+	}
+}
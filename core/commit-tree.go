@@ -9,21 +9,25 @@ import (
 )
 
 func CommitTree(treeHash string, parentHashes []string, message string, author string, email string) (string, error) {
+	signature := formatSignature(author, email, time.Now())
+	return commitTreeWithSignatures(treeHash, parentHashes, message, signature, signature)
+}
+
+// commitTreeWithSignatures writes a commit object whose author and committer
+// lines are given verbatim as "Name <email> timestamp timezone".
+func commitTreeWithSignatures(treeHash string, parentHashes []string, message, author, committer string) (string, error) {
 	repoPath := filepath.Join(RepoDirName, "objects")
 	if _, err := os.Stat(repoPath); os.IsNotExist(err) {
 		return "", fmt.Errorf("repository not initialized")
 	}
 
-	timestamp := time.Now().Unix()
-	timezone, _ := time.Now().Zone()
-
 	var sb strings.Builder
 	sb.WriteString(fmt.Sprintf("tree %s\n", treeHash))
 	for _, parent := range parentHashes {
 		sb.WriteString(fmt.Sprintf("parent %s\n", parent))
 	}
-	sb.WriteString(fmt.Sprintf("author %s <%s> %d %s\n", author, email, timestamp, timezone))
-	sb.WriteString(fmt.Sprintf("committer %s <%s> %d %s\n", author, email, timestamp, timezone))
+	sb.WriteString(fmt.Sprintf("author %s\n", author))
+	sb.WriteString(fmt.Sprintf("committer %s\n", committer))
 	sb.WriteString("\n" + strings.TrimSpace(message) + "\n")
 
 	content := []byte(sb.String())
@@ -34,3 +38,9 @@ func CommitTree(treeHash string, parentHashes []string, message string, author s
 	}
 	return hash, nil
 }
+
+// formatSignature writes an author, committer or tagger line as
+// "Name <email> timestamp +hhmm", with the offset of when's zone.
+func formatSignature(name, email string, when time.Time) string {
+	return fmt.Sprintf("%s <%s> %d %s", name, email, when.Unix(), when.Format("-0700"))
+}
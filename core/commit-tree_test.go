@@ -5,6 +5,7 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestCommitTree(t *testing.T) {
@@ -57,3 +58,14 @@ func TestCommitTree(t *testing.T) {
 		t.Errorf("commit missing message")
 	}
 }
+
+func TestFormatSignature(t *testing.T) {
+	when := time.Date(2023, 11, 14, 18, 13, 20, 0, time.FixedZone("EDT", -4*3600))
+	if got, want := formatSignature("Neel", "neel@neel.com", when), "Neel <neel@neel.com> 1700000000 -0400"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	when = time.Unix(1700000000, 0).In(time.FixedZone("IST", 5*3600+1800))
+	if got := formatSignature("Neel", "neel@neel.com", when); !strings.HasSuffix(got, " 1700000000 +0530") {
+		t.Errorf("expected a +0530 offset, got %q", got)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"os"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
 )
 
@@ -37,8 +38,13 @@ func Commit(repoPath, message, author, email string) (string, error) {
 	if len(indexEntries) == 0 {
 		return "", fmt.Errorf("nothing to commit (staging area is empty)")
 	}
+	for _, entry := range indexEntries {
+		if entry.Stage != 0 {
+			return "", fmt.Errorf("cannot commit: '%s' is unmerged", entry.Path)
+		}
+	}
 
-	parentHashes, err := getParentCommit(repoDir)
+	parentHashes, err := getParentCommit(repoPath)
 	if err != nil {
 		return "", err
 	}
@@ -59,7 +65,16 @@ func Commit(repoPath, message, author, email string) (string, error) {
 		return "", fmt.Errorf("failed to create commit: %w", err)
 	}
 
-	if err := updateHEAD(repoDir, commitHash); err != nil {
+	reflogMessage := "commit: "
+	if len(parentHashes) == 0 {
+		reflogMessage = "commit (initial): "
+	}
+	oldHead := ""
+	if len(parentHashes) > 0 {
+		oldHead = parentHashes[0]
+	}
+	subject, _, _ := strings.Cut(strings.TrimSpace(message), "\n")
+	if err := moveHEAD(repoPath, oldHead, commitHash, reflogMessage+subject); err != nil {
 		return "", fmt.Errorf("failed to update HEAD: %w", err)
 	}
 
@@ -75,6 +90,10 @@ type IndexEntry struct {
 	Mode string
 	Path string
 	Hash string
+	// Stage is 0 for a merged entry. An unmerged path has an entry for
+	// each version that exists: 1 for the common ancestor, 2 for ours and
+	// 3 for theirs.
+	Stage int
 }
 
 func parseIndex(data string) ([]IndexEntry, error) {
@@ -89,11 +108,19 @@ func parseIndex(data string) ([]IndexEntry, error) {
 		if len(parts) < 3 {
 			return nil, fmt.Errorf("invalid index entry: %s", line)
 		}
-		entries = append(entries, IndexEntry{
+		entry := IndexEntry{
 			Mode: parts[0],
 			Path: parts[1],
 			Hash: parts[2],
-		})
+		}
+		if len(parts) > 3 {
+			stage, err := strconv.Atoi(parts[3])
+			if err != nil || stage < 0 || stage > 3 {
+				return nil, fmt.Errorf("invalid index entry: %s", line)
+			}
+			entry.Stage = stage
+		}
+		entries = append(entries, entry)
 	}
 	return entries, nil
 }
@@ -178,56 +205,39 @@ func createTreeObject(node *TreeNode) (string, error) {
 	return treeHash, nil
 }
 
-func getParentCommit(repoDir string) ([]string, error) {
-	headPath := filepath.Join(repoDir, "HEAD")
-	headContent, err := os.ReadFile(headPath)
+func getParentCommit(repoPath string) ([]string, error) {
+	head, err := resolveHead(repoPath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read HEAD: %w", err)
+		return nil, err
 	}
-	headStr := strings.TrimSpace(string(headContent))
-
-	if strings.HasPrefix(headStr, "ref: ") {
-		refPath := strings.TrimPrefix(headStr, "ref: ")
-		refFullPath := filepath.Join(repoDir, refPath)
-
-		refContent, err := os.ReadFile(refFullPath)
-		if err != nil {
-			return []string{}, nil
-		}
-		parentHash := strings.TrimSpace(string(refContent))
-		return []string{parentHash}, nil
+	if head == "" {
+		return []string{}, nil
 	}
-
-	return []string{headStr}, nil
+	return []string{head}, nil
 }
 
-func updateHEAD(repoDir string, commitHash string) error {
-	headPath := filepath.Join(repoDir, "HEAD")
-	headContent, err := os.ReadFile(headPath)
+// updateHEAD moves the current branch, or HEAD itself when detached, to
+// commitHash. The update is recorded in the reflogs of both HEAD and the
+// branch.
+func updateHEAD(repoPath, commitHash, message string) error {
+	oldHash, err := resolveHead(repoPath)
 	if err != nil {
-		return fmt.Errorf("failed to read HEAD: %w", err)
+		return err
 	}
+	return moveHEAD(repoPath, oldHash, commitHash, message)
+}
 
-	headStr := strings.TrimSpace(string(headContent))
-
-	if strings.HasPrefix(headStr, "ref: ") {
-		refPath := strings.TrimPrefix(headStr, "ref: ")
-		refFullPath := filepath.Join(repoDir, refPath)
-
-		if err := os.MkdirAll(filepath.Dir(refFullPath), 0755); err != nil {
-			return fmt.Errorf("failed to create ref directory: %w", err)
-		}
-
-		if err := os.WriteFile(refFullPath, []byte(commitHash+"\n"), 0644); err != nil {
-			return fmt.Errorf("failed to update ref: %w", err)
-		}
-	} else {
-		if err := os.WriteFile(headPath, []byte(commitHash+"\n"), 0644); err != nil {
-			return fmt.Errorf("failed to update HEAD: %w", err)
-		}
+// moveHEAD is updateHEAD for callers that know which commit HEAD should be
+// at; the update fails if another process has moved it in the meantime.
+func moveHEAD(repoPath, oldHash, commitHash, message string) error {
+	if oldHash == "" {
+		oldHash = zeroHash
 	}
-
-	return nil
+	tx := BeginRefTransaction(repoPath)
+	if err := tx.Update("HEAD", commitHash, oldHash, message); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
 func updateIndexAfterCommit(repoPath string, entries []IndexEntry) error {
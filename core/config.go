@@ -108,6 +108,75 @@ func SetConfig(repoPath, section, key, value string) error {
 	return writeConfig(configPath, cfg)
 }
 
+// UnsetConfig removes key from section, dropping the section once it is
+// empty. Removing a key that isn't set is an error.
+func UnsetConfig(repoPath, section, key string) error {
+	cfg, err := ParseConfig(repoPath)
+	if err != nil {
+		return fmt.Errorf("parse config: %w", err)
+	}
+
+	if _, ok := cfg.Sections[section][key]; !ok {
+		return fmt.Errorf("key '%s' not found in section '%s'", key, section)
+	}
+	delete(cfg.Sections[section], key)
+	if len(cfg.Sections[section]) == 0 {
+		delete(cfg.Sections, section)
+	}
+
+	configPath := filepath.Join(repoPath, RepoDirName, "config")
+	return writeConfig(configPath, cfg)
+}
+
+// RemoveConfigSection removes section and every key in it, if it exists.
+func RemoveConfigSection(repoPath, section string) error {
+	cfg, err := ParseConfig(repoPath)
+	if err != nil {
+		return fmt.Errorf("parse config: %w", err)
+	}
+	if _, ok := cfg.Sections[section]; !ok {
+		return nil
+	}
+	delete(cfg.Sections, section)
+
+	configPath := filepath.Join(repoPath, RepoDirName, "config")
+	return writeConfig(configPath, cfg)
+}
+
+// RenameConfigSection moves every key of oldSection to newSection, which
+// replaces any existing newSection.
+func RenameConfigSection(repoPath, oldSection, newSection string) error {
+	return moveConfigSection(repoPath, oldSection, newSection, false)
+}
+
+// CopyConfigSection copies every key of oldSection to newSection, which
+// replaces any existing newSection.
+func CopyConfigSection(repoPath, oldSection, newSection string) error {
+	return moveConfigSection(repoPath, oldSection, newSection, true)
+}
+
+func moveConfigSection(repoPath, oldSection, newSection string, copy bool) error {
+	cfg, err := ParseConfig(repoPath)
+	if err != nil {
+		return fmt.Errorf("parse config: %w", err)
+	}
+	keys, ok := cfg.Sections[oldSection]
+	if !ok {
+		return nil
+	}
+
+	cfg.Sections[newSection] = make(map[string]string, len(keys))
+	for key, value := range keys {
+		cfg.Sections[newSection][key] = value
+	}
+	if !copy {
+		delete(cfg.Sections, oldSection)
+	}
+
+	configPath := filepath.Join(repoPath, RepoDirName, "config")
+	return writeConfig(configPath, cfg)
+}
+
 func writeConfig(configPath string, cfg *GitConfig) error {
 	f, err := os.Create(configPath)
 	if err != nil {
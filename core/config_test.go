@@ -259,3 +259,27 @@ func TestSetConfigNewSection(t *testing.T) {
 		t.Errorf("expected 'https://github.com/test/repo.git', got %s", value)
 	}
 }
+
+func TestUnsetConfig(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	if err := InitRepo(tmpDir, "master"); err != nil {
+		t.Fatalf("InitRepo failed: %v", err)
+	}
+	if err := SetConfig(tmpDir, "user", "name", "Test User"); err != nil {
+		t.Fatalf("SetConfig failed: %v", err)
+	}
+
+	if err := UnsetConfig(tmpDir, "user", "name"); err != nil {
+		t.Fatalf("UnsetConfig failed: %v", err)
+	}
+	if _, err := GetConfig(tmpDir, "user", "name"); err == nil {
+		t.Error("expected user.name to be gone")
+	}
+	if cfg, _ := ParseConfig(tmpDir); cfg.Sections["user"] != nil {
+		t.Error("empty sections should be removed")
+	}
+	if err := UnsetConfig(tmpDir, "user", "name"); err == nil {
+		t.Error("expected an error when unsetting a missing key")
+	}
+}
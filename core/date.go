@@ -0,0 +1,231 @@
+package core
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var approxidateUnits = map[string]time.Duration{
+	"second": time.Second,
+	"minute": time.Minute,
+	"hour":   time.Hour,
+	"day":    24 * time.Hour,
+	"week":   7 * 24 * time.Hour,
+}
+
+var absoluteDateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02 15:04:05 -0700",
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+	"2006/01/02",
+	"Mon Jan 2 15:04:05 2006 -0700",
+	"Mon Jan 2 15:04:05 2006",
+	time.RFC1123Z,
+}
+
+// ParseApproxidate understands the date formats git accepts for reflog
+// selectors and --since/--until: absolute dates, unix timestamps ("@<n>"),
+// "now", "today", "yesterday", and relative dates such as "3 days ago",
+// "2.weeks.ago" or "1 year".
+func ParseApproxidate(s string, now time.Time) (time.Time, error) {
+	spec := strings.ToLower(strings.TrimSpace(s))
+
+	switch spec {
+	case "now":
+		return now, nil
+	case "today":
+		y, m, d := now.Date()
+		return time.Date(y, m, d, 0, 0, 0, 0, now.Location()), nil
+	case "yesterday":
+		return now.AddDate(0, 0, -1), nil
+	case "never":
+		return time.Time{}, nil
+	}
+
+	if strings.HasPrefix(spec, "@") {
+		if secs, err := strconv.ParseInt(spec[1:], 10, 64); err == nil {
+			return time.Unix(secs, 0), nil
+		}
+	}
+
+	for _, layout := range absoluteDateLayouts {
+		if t, err := time.ParseInLocation(layout, strings.TrimSpace(s), now.Location()); err == nil {
+			return t, nil
+		}
+	}
+
+	fields := strings.FieldsFunc(spec, func(r rune) bool { return r == ' ' || r == '.' })
+	if len(fields) > 0 && fields[len(fields)-1] == "ago" {
+		fields = fields[:len(fields)-1]
+	}
+	if len(fields) == 2 {
+		n, err := strconv.Atoi(fields[0])
+		if fields[0] == "last" || fields[0] == "a" || fields[0] == "an" {
+			n, err = 1, nil
+		}
+		if err == nil {
+			unit := strings.TrimSuffix(fields[1], "s")
+			switch unit {
+			case "month":
+				return now.AddDate(0, -n, 0), nil
+			case "year":
+				return now.AddDate(-n, 0, 0), nil
+			}
+			if d, ok := approxidateUnits[unit]; ok {
+				return now.Add(-time.Duration(n) * d), nil
+			}
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("invalid date '%s'", s)
+}
+
+// FormatDate renders a timestamp recorded with the given timezone offset
+// (such as "+0100") in one of git's --date styles: default, relative,
+// local, iso (iso8601), iso-strict, rfc (rfc2822), short, raw, unix, or
+// format:<strftime string> (format-local: to use the local timezone).
+func FormatDate(timestamp int64, timezone, style string, now time.Time) (string, error) {
+	t := time.Unix(timestamp, 0).In(parseTimezone(timezone))
+
+	if spec, ok := strings.CutPrefix(style, "format:"); ok {
+		return strftime(t, spec), nil
+	}
+	if spec, ok := strings.CutPrefix(style, "format-local:"); ok {
+		return strftime(t.Local(), spec), nil
+	}
+
+	switch style {
+	case "", "default":
+		return t.Format("Mon Jan 2 15:04:05 2006 -0700"), nil
+	case "local":
+		return t.Local().Format("Mon Jan 2 15:04:05 2006"), nil
+	case "iso", "iso8601":
+		return t.Format("2006-01-02 15:04:05 -0700"), nil
+	case "iso-strict", "iso8601-strict":
+		return t.Format(time.RFC3339), nil
+	case "rfc", "rfc2822":
+		return t.Format("Mon, 2 Jan 2006 15:04:05 -0700"), nil
+	case "short":
+		return t.Format("2006-01-02"), nil
+	case "raw":
+		return fmt.Sprintf("%d %s", timestamp, t.Format("-0700")), nil
+	case "unix":
+		return strconv.FormatInt(timestamp, 10), nil
+	case "relative":
+		return relativeDate(t, now), nil
+	}
+	return "", fmt.Errorf("unknown date format '%s'", style)
+}
+
+// strftimeLayouts maps strftime conversions to Go time layouts.
+var strftimeLayouts = map[byte]string{
+	'a': "Mon", 'A': "Monday", 'b': "Jan", 'h': "Jan", 'B': "January",
+	'd': "02", 'e': "_2", 'm': "01", 'y': "06", 'Y': "2006",
+	'H': "15", 'I': "03", 'M': "04", 'S': "05", 'p': "PM",
+	'z': "-0700", 'Z': "MST", 'F': "2006-01-02", 'T': "15:04:05",
+	'R': "15:04", 'D': "01/02/06", 'c': "Mon Jan _2 15:04:05 2006",
+	'x': "01/02/06", 'X': "15:04:05",
+}
+
+// strftime formats t using the common strftime(3) conversions, as
+// --date=format: does. Unknown conversions are copied as they are.
+func strftime(t time.Time, format string) string {
+	var sb strings.Builder
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' || i+1 == len(format) {
+			sb.WriteByte(format[i])
+			continue
+		}
+		i++
+		switch c := format[i]; c {
+		case '%':
+			sb.WriteByte('%')
+		case 'n':
+			sb.WriteByte('\n')
+		case 't':
+			sb.WriteByte('\t')
+		case 'j':
+			fmt.Fprintf(&sb, "%03d", t.YearDay())
+		case 's':
+			sb.WriteString(strconv.FormatInt(t.Unix(), 10))
+		case 'u':
+			sb.WriteString(strconv.Itoa((int(t.Weekday())+6)%7 + 1))
+		case 'w':
+			sb.WriteString(strconv.Itoa(int(t.Weekday())))
+		default:
+			if layout, ok := strftimeLayouts[c]; ok {
+				sb.WriteString(t.Format(layout))
+			} else {
+				sb.WriteByte('%')
+				sb.WriteByte(c)
+			}
+		}
+	}
+	return sb.String()
+}
+
+// parseTimezone turns a "+hhmm" offset into a fixed zone, falling back to
+// UTC for anything else.
+func parseTimezone(timezone string) *time.Location {
+	if len(timezone) != 5 || (timezone[0] != '+' && timezone[0] != '-') {
+		return time.UTC
+	}
+	hours, err1 := strconv.Atoi(timezone[1:3])
+	minutes, err2 := strconv.Atoi(timezone[3:])
+	if err1 != nil || err2 != nil {
+		return time.UTC
+	}
+	offset := hours*3600 + minutes*60
+	if timezone[0] == '-' {
+		offset = -offset
+	}
+	return time.FixedZone(timezone, offset)
+}
+
+// relativeDate describes t the way git's --date=relative does, rounding to
+// the most natural unit.
+func relativeDate(t, now time.Time) string {
+	plural := func(n int64, unit string) string {
+		if n == 1 {
+			return fmt.Sprintf("1 %s", unit)
+		}
+		return fmt.Sprintf("%d %ss", n, unit)
+	}
+
+	diff := int64(now.Sub(t) / time.Second)
+	if diff < 0 {
+		return "in the future"
+	}
+	if diff < 90 {
+		return plural(diff, "second") + " ago"
+	}
+	if diff = (diff + 30) / 60; diff < 90 {
+		return plural(diff, "minute") + " ago"
+	}
+	if diff = (diff + 30) / 60; diff < 36 {
+		return plural(diff, "hour") + " ago"
+	}
+	if diff = (diff + 12) / 24; diff < 14 {
+		return plural(diff, "day") + " ago"
+	}
+	if diff < 70 {
+		return plural((diff+3)/7, "week") + " ago"
+	}
+	if diff < 365 {
+		return plural((diff+15)/30, "month") + " ago"
+	}
+	if diff < 1825 {
+		totalMonths := (diff*12*2 + 365) / (365 * 2)
+		years, months := totalMonths/12, totalMonths%12
+		if months == 0 {
+			return plural(years, "year") + " ago"
+		}
+		return plural(years, "year") + ", " + plural(months, "month") + " ago"
+	}
+	return plural((diff+183)/365, "year") + " ago"
+}
@@ -0,0 +1,50 @@
+package core
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFormatDate(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	tests := []struct {
+		style string
+		want  string
+	}{
+		{"default", "Tue Nov 14 23:13:20 2023 +0100"},
+		{"iso", "2023-11-14 23:13:20 +0100"},
+		{"iso-strict", "2023-11-14T23:13:20+01:00"},
+		{"rfc", "Tue, 14 Nov 2023 23:13:20 +0100"},
+		{"short", "2023-11-14"},
+		{"raw", "1700000000 +0100"},
+		{"unix", "1700000000"},
+		{"format:%Y/%m/%d %H:%M %z %%", "2023/11/14 23:13 +0100 %"},
+		{"format:%a %e %b, day %j", "Tue 14 Nov, day 318"},
+	}
+	for _, tt := range tests {
+		got, err := FormatDate(1700000000, "+0100", tt.style, now)
+		if err != nil || got != tt.want {
+			t.Errorf("%s: got %q (%v), want %q", tt.style, got, err, tt.want)
+		}
+	}
+	if _, err := FormatDate(0, "+0000", "bogus", now); err == nil {
+		t.Error("expected an error for an unknown style")
+	}
+
+	relative := map[time.Duration]string{
+		30 * time.Second:     "30 seconds ago",
+		time.Hour:            "60 minutes ago",
+		3 * time.Hour:        "3 hours ago",
+		3 * 24 * time.Hour:   "3 days ago",
+		21 * 24 * time.Hour:  "3 weeks ago",
+		100 * 24 * time.Hour: "3 months ago",
+		400 * 24 * time.Hour: "1 year, 1 month ago",
+		-time.Hour:           "in the future",
+	}
+	for ago, want := range relative {
+		got, _ := FormatDate(now.Add(-ago).Unix(), "+0000", "relative", now)
+		if got != want {
+			t.Errorf("%v ago: got %q, want %q", ago, got, want)
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package core
+
+import (
+	"container/heap"
+	"fmt"
+	"strings"
+)
+
+type DescribeOptions struct {
+	// Tags lets lightweight tags describe commits, not only annotated ones.
+	Tags bool
+	// Long gives the "<tag>-<n>-g<hash>" form even for a tagged commit.
+	Long bool
+	// Abbrev is the number of hex digits of the commit hash shown. Zero
+	// shows the tag name alone.
+	Abbrev int
+	// Dirty is appended when set and the index or working tree has changes
+	// to tracked files.
+	Dirty string
+}
+
+// describeName is the tag that describes a commit: annotated tags win over
+// lightweight ones, and the newest annotated tag over older ones.
+type describeName struct {
+	name      string
+	annotated bool
+	date      int64
+}
+
+// Describe names a commit after the nearest tag it can reach, as git
+// describe does: "v1.2-14-gabcdef0" is 14 commits on top of v1.2, and a
+// tagged commit is the tag name alone. The walk goes back newest first and
+// stops at the first tagged commit it reaches.
+func Describe(repoPath, rev string, opts DescribeOptions) (string, error) {
+	hash, err := resolveCommitish(repoPath, rev)
+	if err != nil {
+		return "", err
+	}
+	names, lightweight, err := describeNames(repoPath, opts.Tags)
+	if err != nil {
+		return "", err
+	}
+	if len(names) == 0 && len(lightweight) == 0 {
+		return "", fmt.Errorf("no names found, cannot describe anything")
+	}
+
+	tagged, depth, passedLightweight, err := nearestTagged(repoPath, hash, names, lightweight)
+	if err != nil {
+		return "", err
+	}
+	if tagged == "" {
+		if passedLightweight {
+			return "", fmt.Errorf("no annotated tags can describe '%s'\nhowever, there were unannotated tags: try --tags", hash)
+		}
+		return "", fmt.Errorf("no tags can describe '%s'", hash)
+	}
+
+	description := names[tagged].name
+	if opts.Abbrev > 0 && (depth > 0 || opts.Long) {
+		description = fmt.Sprintf("%s-%d-g%s", description, depth, hash[:min(opts.Abbrev, len(hash))])
+	}
+
+	if opts.Dirty != "" {
+		dirty, err := hasLocalChanges(repoPath)
+		if err != nil {
+			return "", err
+		}
+		if dirty {
+			description += opts.Dirty
+		}
+	}
+	return description, nil
+}
+
+// describeNames maps commits to the tags that can describe them, and
+// collects the commits of the lightweight tags left out when tags is false.
+func describeNames(repoPath string, tags bool) (map[string]describeName, map[string]bool, error) {
+	refs, err := listRefs(repoPath, "refs/tags/")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	names := make(map[string]describeName)
+	lightweight := make(map[string]bool)
+	for _, ref := range sortedRefNames(refs) {
+		commit, err := peelObject(repoPath, refs[ref], "commit", ref)
+		if err != nil {
+			// tags of trees and blobs describe nothing
+			continue
+		}
+		objectType, _, err := readObjectWithType(repoPath, refs[ref])
+		if err != nil {
+			return nil, nil, err
+		}
+		candidate := describeName{name: strings.TrimPrefix(ref, "refs/tags/"), annotated: objectType == "tag"}
+		if candidate.annotated {
+			tag, err := readTag(repoPath, refs[ref])
+			if err != nil {
+				return nil, nil, err
+			}
+			_, _, candidate.date, _ = parseAuthorLine(tag.Tagger)
+		} else if !tags {
+			lightweight[commit] = true
+			continue
+		}
+
+		existing, ok := names[commit]
+		if !ok || candidate.annotated && (!existing.annotated || candidate.date > existing.date) {
+			names[commit] = candidate
+		}
+	}
+	return names, lightweight, nil
+}
+
+// nearestTagged walks back from start, newest commit first, and returns
+// the first commit that names has, or "" when none is reachable, along
+// with whether the walk passed one of the lightweight commits. The depth,
+// the number of commits start has that the tagged one doesn't, is counted
+// in the same walk: from the tagged commit on, what it reaches is marked,
+// and the walk stops once only marked commits are left.
+func nearestTagged(repoPath, start string, names map[string]describeName, lightweight map[string]bool) (tagged string, depth int, passedLightweight bool, err error) {
+	const reached, inTag = 1, 2
+	flags := make(map[string]int)
+	queue := &commitQueue{key: committerTime}
+	mark := func(hash string, flag int) error {
+		if flags[hash]|flag == flags[hash] {
+			return nil
+		}
+		flags[hash] |= flag
+		commit, err := readCommit(repoPath, hash)
+		if err != nil {
+			return err
+		}
+		heap.Push(queue, commit)
+		return nil
+	}
+	onlyInTag := func() bool {
+		for _, item := range queue.items {
+			if flags[item.commit.Hash]&inTag == 0 {
+				return false
+			}
+		}
+		return true
+	}
+
+	if err := mark(start, reached); err != nil {
+		return "", 0, false, err
+	}
+	slop := walkSlop
+	for queue.Len() > 0 {
+		if tagged == "" || !onlyInTag() {
+			slop = walkSlop
+		} else if slop--; slop < 0 {
+			break
+		}
+		commit := heap.Pop(queue).(CommitInfo)
+		if _, ok := names[commit.Hash]; ok && tagged == "" {
+			tagged = commit.Hash
+			flags[commit.Hash] |= inTag
+		}
+		if lightweight[commit.Hash] {
+			passedLightweight = true
+		}
+		for _, parent := range commit.Parents {
+			if err := mark(parent, flags[commit.Hash]); err != nil {
+				return "", 0, false, err
+			}
+		}
+	}
+
+	for _, flag := range flags {
+		if flag == reached {
+			depth++
+		}
+	}
+	return tagged, depth, passedLightweight, nil
+}
+
+// hasLocalChanges reports whether the index or the working tree differs
+// from HEAD in a tracked file.
+func hasLocalChanges(repoPath string) (bool, error) {
+	head, err := resolveHead(repoPath)
+	if err != nil {
+		return false, err
+	}
+	headTree, err := commitTreeMap(repoPath, head)
+	if err != nil {
+		return false, err
+	}
+	index, err := readIndexMap(repoPath)
+	if err != nil {
+		return false, err
+	}
+	changed, err := localChanges(repoPath, headTree, index)
+	if err != nil {
+		return false, err
+	}
+	return len(changed) > 0, nil
+}
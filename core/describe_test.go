@@ -0,0 +1,121 @@
+package core
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestDescribe(t *testing.T) {
+	repo := setupTestRepo(t)
+	first := commitFile(t, repo, "file.txt", "one\n", "first")
+	if _, err := Describe(repo, "HEAD", DescribeOptions{Abbrev: 7}); err == nil || !strings.Contains(err.Error(), "no names found") {
+		t.Errorf("expected an error without tags, got %v", err)
+	}
+	if _, err := CreateTag(repo, "light", first, TagOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Describe(repo, "HEAD", DescribeOptions{Abbrev: 7}); err == nil || !strings.Contains(err.Error(), "try --tags") {
+		t.Errorf("expected a hint to use lightweight tags, got %v", err)
+	}
+
+	if _, err := CreateTag(repo, "v1.0", first, TagOptions{Message: "v1.0", Name: "T", Email: "t@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	commitFile(t, repo, "file.txt", "two\n", "second")
+	third := commitFile(t, repo, "file.txt", "three\n", "third")
+	if _, err := CreateTag(repo, "wip", "HEAD~1", TagOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		rev  string
+		opts DescribeOptions
+		want string
+	}{
+		{"HEAD", DescribeOptions{Abbrev: 7}, "v1.0-2-g" + third[:7]},
+		{"HEAD", DescribeOptions{Abbrev: 10}, "v1.0-2-g" + third[:10]},
+		{"HEAD", DescribeOptions{}, "v1.0"},
+		{"HEAD", DescribeOptions{Tags: true, Abbrev: 7}, "wip-1-g" + third[:7]},
+		// an annotated tag wins over a lightweight one on the same commit
+		{first, DescribeOptions{Tags: true, Abbrev: 7}, "v1.0"},
+		{first, DescribeOptions{Long: true, Abbrev: 7}, "v1.0-0-g" + first[:7]},
+	}
+	for _, test := range tests {
+		got, err := Describe(repo, test.rev, test.opts)
+		if err != nil {
+			t.Errorf("Describe(%s, %+v) failed: %v", test.rev, test.opts, err)
+		} else if got != test.want {
+			t.Errorf("Describe(%s, %+v) = %s, want %s", test.rev, test.opts, got, test.want)
+		}
+	}
+
+	if err := os.WriteFile("file.txt", []byte("changed\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := Describe(repo, "HEAD", DescribeOptions{Dirty: "-dirty"}); err != nil || got != "v1.0-dirty" {
+		t.Errorf("expected v1.0-dirty with a changed file, got %q (%v)", got, err)
+	}
+}
+
+func TestDescribeStopsAtFirstTag(t *testing.T) {
+	repo := setupTestRepo(t)
+	first := commitFile(t, repo, "file.txt", "one\n", "first")
+	firstCommit, _ := readCommit(repo, first)
+	tree := firstCommit.Tree
+
+	// the side branch is newer, so its tag is reached first although the
+	// one on the first parent has fewer commits on top of it
+	old := datedCommit(t, tree, "old", 100, 100)
+	side := datedCommit(t, tree, "side", 300, 300, old)
+	main := datedCommit(t, tree, "main", 200, 200, old)
+	merge := datedCommit(t, tree, "merge", 400, 400, main, side)
+	for name, target := range map[string]string{"v1": main, "v2-rc": side} {
+		if _, err := CreateTag(repo, name, target, TagOptions{Message: name, Name: "T", Email: "t@example.com"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got, err := Describe(repo, merge, DescribeOptions{Abbrev: 7}); err != nil || got != "v2-rc-2-g"+merge[:7] {
+		t.Errorf("expected v2-rc-2-g%s, got %q (%v)", merge[:7], got, err)
+	}
+}
+
+func TestDescribeHintsOnlyAtReachableTags(t *testing.T) {
+	repo := setupTestRepo(t)
+	first := commitFile(t, repo, "file.txt", "one\n", "first")
+	firstCommit, _ := readCommit(repo, first)
+
+	// a lightweight tag HEAD can't reach is no use with --tags either
+	other := datedCommit(t, firstCommit.Tree, "other", 100, 100)
+	if _, err := CreateTag(repo, "light", other, TagOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	_, err := Describe(repo, "HEAD", DescribeOptions{Abbrev: 7})
+	if err == nil || !strings.Contains(err.Error(), "no tags can describe") || strings.Contains(err.Error(), "try --tags") {
+		t.Errorf("expected no hint for an unreachable lightweight tag, got %v", err)
+	}
+}
+
+func TestDescribeStopsBelowTheTag(t *testing.T) {
+	repo := setupTestRepo(t)
+	first := commitFile(t, repo, "file.txt", "one\n", "first")
+	firstCommit, _ := readCommit(repo, first)
+	tree := firstCommit.Tree
+
+	// the history below the tag ends in a parent that isn't there, so
+	// walking all of it fails
+	tagged := strings.Repeat("0", 2*HashSize)
+	for i := 1; i <= 20; i++ {
+		tagged = datedCommit(t, tree, "old", int64(i), int64(i), tagged)
+	}
+	if _, err := CreateTag(repo, "v1", tagged, TagOptions{Message: "v1", Name: "T", Email: "t@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	side := datedCommit(t, tree, "side", 100, 100, tagged)
+	main := datedCommit(t, tree, "main", 101, 101, tagged)
+	merge := datedCommit(t, tree, "merge", 102, 102, main, side)
+
+	if got, err := Describe(repo, merge, DescribeOptions{Abbrev: 7}); err != nil || got != "v1-3-g"+merge[:7] {
+		t.Errorf("expected v1-3-g%s, got %q (%v)", merge[:7], got, err)
+	}
+}
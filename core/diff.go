@@ -0,0 +1,496 @@
+package core
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type diffOpKind int
+
+const (
+	diffEqual diffOpKind = iota
+	diffDelete
+	diffInsert
+)
+
+type diffOp struct {
+	Kind     diffOpKind
+	OldIndex int
+	NewIndex int
+}
+
+// splitLines splits data after every newline, keeping the terminator so the
+// lines can be joined back into the exact original content.
+func splitLines(data []byte) []string {
+	if len(data) == 0 {
+		return nil
+	}
+
+	var lines []string
+	for len(data) > 0 {
+		idx := bytes.IndexByte(data, '\n')
+		if idx < 0 {
+			lines = append(lines, string(data))
+			break
+		}
+		lines = append(lines, string(data[:idx+1]))
+		data = data[idx+1:]
+	}
+	return lines
+}
+
+func isBinary(data []byte) bool {
+	limit := len(data)
+	if limit > 8000 {
+		limit = 8000
+	}
+	return bytes.IndexByte(data[:limit], 0) >= 0
+}
+
+// diffLines computes a shortest edit script between a and b using Myers'
+// algorithm. Common prefix and suffix lines are stripped first so that the
+// quadratic part only runs over the region that actually changed.
+func diffLines(a, b []string) []diffOp {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	var ops []diffOp
+	for i := 0; i < prefix; i++ {
+		ops = append(ops, diffOp{Kind: diffEqual, OldIndex: i, NewIndex: i})
+	}
+
+	middle := myersDiff(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])
+	for _, op := range middle {
+		op.OldIndex += prefix
+		op.NewIndex += prefix
+		ops = append(ops, op)
+	}
+
+	for i := 0; i < suffix; i++ {
+		ops = append(ops, diffOp{
+			Kind:     diffEqual,
+			OldIndex: len(a) - suffix + i,
+			NewIndex: len(b) - suffix + i,
+		})
+	}
+	return ops
+}
+
+func myersDiff(a, b []string) []diffOp {
+	n, m := len(a), len(b)
+	if n == 0 && m == 0 {
+		return nil
+	}
+
+	maxD := n + m
+	offset := maxD + 1
+	v := make([]int, 2*maxD+3)
+	var trace [][]int
+
+	found := false
+	for d := 0; d <= maxD && !found; d++ {
+		snapshot := make([]int, 2*d+3)
+		copy(snapshot, v[offset-d-1:offset+d+2])
+		trace = append(trace, snapshot)
+
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				found = true
+				break
+			}
+		}
+	}
+
+	var reversed []diffOp
+	x, y := n, m
+	for d := len(trace) - 1; d >= 0; d-- {
+		snapshot := trace[d]
+		at := func(k int) int { return snapshot[k+d+1] }
+
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && at(k-1) < at(k+1)) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := at(prevK)
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			reversed = append(reversed, diffOp{Kind: diffEqual, OldIndex: x - 1, NewIndex: y - 1})
+			x--
+			y--
+		}
+		if d > 0 {
+			if x == prevX {
+				reversed = append(reversed, diffOp{Kind: diffInsert, OldIndex: x, NewIndex: y - 1})
+			} else {
+				reversed = append(reversed, diffOp{Kind: diffDelete, OldIndex: x - 1, NewIndex: y})
+			}
+		}
+		x, y = prevX, prevY
+	}
+
+	ops := make([]diffOp, len(reversed))
+	for i, op := range reversed {
+		ops[len(reversed)-1-i] = op
+	}
+	return ops
+}
+
+// matchLines returns, for every line of a, the index of the line of b it is
+// paired with in the edit script, or -1 when the line was deleted.
+func matchLines(a, b []string) []int {
+	matches := make([]int, len(a))
+	for i := range matches {
+		matches[i] = -1
+	}
+	for _, op := range diffLines(a, b) {
+		if op.Kind == diffEqual {
+			matches[op.OldIndex] = op.NewIndex
+		}
+	}
+	return matches
+}
+
+func linesEqual(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// mergeFileContents performs a line based three-way merge in the style of
+// diff3. Regions changed on only one side are taken from that side; regions
+// changed differently on both sides are wrapped in conflict markers.
+func mergeFileContents(base, ours, theirs []byte, oursLabel, theirsLabel string) ([]byte, bool) {
+	if bytes.Equal(ours, theirs) {
+		return ours, false
+	}
+	if bytes.Equal(base, ours) {
+		return theirs, false
+	}
+	if bytes.Equal(base, theirs) {
+		return ours, false
+	}
+	if isBinary(base) || isBinary(ours) || isBinary(theirs) {
+		return ours, true
+	}
+
+	baseLines := splitLines(base)
+	oursLines := splitLines(ours)
+	theirsLines := splitLines(theirs)
+
+	toOurs := matchLines(baseLines, oursLines)
+	toTheirs := matchLines(baseLines, theirsLines)
+
+	var out strings.Builder
+	conflict := false
+
+	emitChunk := func(b, o, t []string) {
+		switch {
+		case linesEqual(o, t):
+			writeLines(&out, o)
+		case linesEqual(b, o):
+			writeLines(&out, t)
+		case linesEqual(b, t):
+			writeLines(&out, o)
+		default:
+			conflict = true
+			out.WriteString("<<<<<<< " + oursLabel + "\n")
+			writeLines(&out, o)
+			ensureNewline(&out)
+			out.WriteString("=======\n")
+			writeLines(&out, t)
+			ensureNewline(&out)
+			out.WriteString(">>>>>>> " + theirsLabel + "\n")
+		}
+	}
+
+	i, j, k := 0, 0, 0
+	for {
+		stable := -1
+		for o := i; o < len(baseLines); o++ {
+			if toOurs[o] >= 0 && toTheirs[o] >= 0 {
+				stable = o
+				break
+			}
+		}
+
+		if stable < 0 {
+			emitChunk(baseLines[i:], oursLines[j:], theirsLines[k:])
+			break
+		}
+
+		emitChunk(baseLines[i:stable], oursLines[j:toOurs[stable]], theirsLines[k:toTheirs[stable]])
+		out.WriteString(baseLines[stable])
+		i = stable + 1
+		j = toOurs[stable] + 1
+		k = toTheirs[stable] + 1
+	}
+
+	return []byte(out.String()), conflict
+}
+
+func writeLines(sb *strings.Builder, lines []string) {
+	for _, line := range lines {
+		sb.WriteString(line)
+	}
+}
+
+func ensureNewline(sb *strings.Builder) {
+	s := sb.String()
+	if len(s) > 0 && !strings.HasSuffix(s, "\n") {
+		sb.WriteString("\n")
+	}
+}
+
+// FileDiffStat counts the lines added and removed in one file. For binary
+// files Added and Deleted hold the sizes of the new and old content
+// instead. OldPath is set when the file was renamed.
+type FileDiffStat struct {
+	Path    string
+	OldPath string
+	Added   int
+	Deleted int
+	Binary  bool
+}
+
+// diffTreeStats counts the lines added and removed for every path whose
+// content differs between two trees.
+func diffTreeStats(repoPath string, from, to map[string]string) ([]FileDiffStat, error) {
+	paths := make(map[string]bool)
+	for path, hash := range from {
+		if to[path] != hash {
+			paths[path] = true
+		}
+	}
+	for path, hash := range to {
+		if from[path] != hash {
+			paths[path] = true
+		}
+	}
+
+	var stats []FileDiffStat
+	for _, path := range sortedKeys(paths) {
+		stat, err := fileDiffStat(repoPath, path, from[path], to[path])
+		if err != nil {
+			return nil, err
+		}
+		stats = append(stats, stat)
+	}
+	return stats, nil
+}
+
+// fileDiffStat counts the changes between two blobs, either of which may
+// be empty for a file that was added or deleted.
+func fileDiffStat(repoPath, path, oldHash, newHash string) (FileDiffStat, error) {
+	var oldContent, newContent []byte
+	if oldHash != "" {
+		content, err := readObject(repoPath, oldHash)
+		if err != nil {
+			return FileDiffStat{}, fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		oldContent = content
+	}
+	if newHash != "" {
+		content, err := readObject(repoPath, newHash)
+		if err != nil {
+			return FileDiffStat{}, fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		newContent = content
+	}
+
+	stat := FileDiffStat{Path: path}
+	if isBinary(oldContent) || isBinary(newContent) {
+		stat.Binary = true
+		stat.Added, stat.Deleted = len(newContent), len(oldContent)
+		return stat, nil
+	}
+	for _, change := range lineChanges(splitLines(oldContent), splitLines(newContent)) {
+		stat.Added += change.newCount
+		stat.Deleted += change.oldCount
+	}
+	return stat, nil
+}
+
+// FormatDiffStat renders stats the way "git diff --stat" does, in 80
+// columns.
+func FormatDiffStat(stats []FileDiffStat) string {
+	return formatDiffStat(stats, 80)
+}
+
+// formatDiffStat renders stats in width columns. Names that don't fit are
+// shortened from the front, and the bars are scaled to the space left.
+func formatDiffStat(stats []FileDiffStat, width int) string {
+	if len(stats) == 0 {
+		return ""
+	}
+
+	names := make([]string, len(stats))
+	maxName, maxChange, numberWidth, binWidth := 0, 0, 0, 0
+	for i, s := range stats {
+		names[i] = s.Path
+		if s.OldPath != "" && s.OldPath != s.Path {
+			names[i] = renameName(s.OldPath, s.Path)
+		}
+		maxName = max(maxName, len(names[i]))
+		if s.Binary {
+			// "Bin XXX -> YYY bytes"
+			binWidth = max(binWidth, 14+len(strconv.Itoa(s.Added))+len(strconv.Itoa(s.Deleted)))
+			numberWidth = 3
+			continue
+		}
+		maxChange = max(maxChange, s.Added+s.Deleted)
+	}
+	numberWidth = max(numberWidth, len(strconv.Itoa(maxChange)))
+
+	width = max(width, 16+6+numberWidth)
+	graphWidth := maxChange
+	if maxChange+4 <= binWidth {
+		graphWidth = binWidth - 4
+	}
+	nameWidth := maxName
+	if nameWidth+numberWidth+6+graphWidth > width {
+		if graphWidth > width*3/8-numberWidth-6 {
+			graphWidth = max(width*3/8-numberWidth-6, 6)
+		}
+		if nameWidth > width-numberWidth-6-graphWidth {
+			nameWidth = width - numberWidth - 6 - graphWidth
+		} else {
+			graphWidth = width - numberWidth - 6 - nameWidth
+		}
+	}
+
+	var sb strings.Builder
+	added, deleted := 0, 0
+	for i, s := range stats {
+		name, prefix := names[i], ""
+		if len(name) > nameWidth {
+			prefix = "..."
+			name = name[len(name)-max(nameWidth-3, 0):]
+			if slash := strings.IndexByte(name, '/'); slash >= 0 {
+				name = name[slash:]
+			}
+		}
+		fmt.Fprintf(&sb, " %s%-*s |", prefix, nameWidth-len(prefix), name)
+
+		if s.Binary {
+			fmt.Fprintf(&sb, " %*s", numberWidth, "Bin")
+			if s.Added != 0 || s.Deleted != 0 {
+				fmt.Fprintf(&sb, " %d -> %d bytes", s.Deleted, s.Added)
+			}
+			sb.WriteString("\n")
+			continue
+		}
+
+		plus, minus := s.Added, s.Deleted
+		if graphWidth <= maxChange {
+			total := scaleLinear(plus+minus, graphWidth, maxChange)
+			if total < 2 && plus > 0 && minus > 0 {
+				total = 2
+			}
+			if plus < minus {
+				plus = scaleLinear(plus, graphWidth, maxChange)
+				minus = total - plus
+			} else {
+				minus = scaleLinear(minus, graphWidth, maxChange)
+				plus = total - minus
+			}
+		}
+		fmt.Fprintf(&sb, " %*d", numberWidth, s.Added+s.Deleted)
+		if s.Added+s.Deleted > 0 {
+			sb.WriteString(" ")
+		}
+		sb.WriteString(strings.Repeat("+", plus) + strings.Repeat("-", minus) + "\n")
+		added += s.Added
+		deleted += s.Deleted
+	}
+
+	fmt.Fprintf(&sb, " %d file%s changed", len(stats), plural(len(stats)))
+	if added > 0 || deleted == 0 {
+		fmt.Fprintf(&sb, ", %d insertion%s(+)", added, plural(added))
+	}
+	if deleted > 0 || added == 0 {
+		fmt.Fprintf(&sb, ", %d deletion%s(-)", deleted, plural(deleted))
+	}
+	sb.WriteString("\n")
+	return sb.String()
+}
+
+// scaleLinear scales a count of changes to a bar of at most width
+// characters, keeping at least one character for any change.
+func scaleLinear(n, width, maxChange int) int {
+	if n == 0 {
+		return 0
+	}
+	return 1 + n*(width-1)/maxChange
+}
+
+// renameName shows a rename compactly, as in "dir/{old => new}.go",
+// factoring out the leading directories and trailing part the two paths
+// share.
+func renameName(oldPath, newPath string) string {
+	prefix := 0
+	for i := 0; i < len(oldPath) && i < len(newPath) && oldPath[i] == newPath[i]; i++ {
+		if oldPath[i] == '/' {
+			prefix = i + 1
+		}
+	}
+
+	// With a common prefix, let the scan reach back to its slash, so that a
+	// shared directory after the changed part is found too.
+	suffix := 0
+	adjust := 0
+	if prefix > 0 {
+		adjust = 1
+	}
+	i, j := len(oldPath)-1, len(newPath)-1
+	for i >= prefix-adjust && j >= prefix-adjust && oldPath[i] == newPath[j] {
+		if oldPath[i] == '/' {
+			suffix = len(oldPath) - i
+		}
+		i--
+		j--
+	}
+
+	oldMid := max(len(oldPath)-prefix-suffix, 0)
+	newMid := max(len(newPath)-prefix-suffix, 0)
+	if prefix+suffix == 0 {
+		return oldPath[:oldMid] + " => " + newPath[:newMid]
+	}
+	return oldPath[:prefix] + "{" + oldPath[prefix:prefix+oldMid] + " => " + newPath[prefix:prefix+newMid] + "}" + oldPath[len(oldPath)-suffix:]
+}
+
+func plural(n int) string {
+	if n == 1 {
+		return ""
+	}
+	return "s"
+}
@@ -0,0 +1,93 @@
+package core
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDiffLines(t *testing.T) {
+	a := splitLines([]byte("a\nb\nc\nd\n"))
+	b := splitLines([]byte("a\nc\nd\ne\n"))
+
+	var deleted, inserted, equal int
+	for _, op := range diffLines(a, b) {
+		switch op.Kind {
+		case diffDelete:
+			deleted++
+			if a[op.OldIndex] != "b\n" {
+				t.Errorf("unexpected deleted line %q", a[op.OldIndex])
+			}
+		case diffInsert:
+			inserted++
+			if b[op.NewIndex] != "e\n" {
+				t.Errorf("unexpected inserted line %q", b[op.NewIndex])
+			}
+		case diffEqual:
+			equal++
+		}
+	}
+
+	if deleted != 1 || inserted != 1 || equal != 3 {
+		t.Errorf("expected 1 delete, 1 insert, 3 equal; got %d, %d, %d", deleted, inserted, equal)
+	}
+}
+
+func TestMergeFileContentsClean(t *testing.T) {
+	base := []byte("one\ntwo\nthree\nfour\n")
+	ours := []byte("ONE\ntwo\nthree\nfour\n")
+	theirs := []byte("one\ntwo\nthree\nFOUR\n")
+
+	merged, conflict := mergeFileContents(base, ours, theirs, "ours", "theirs")
+	if conflict {
+		t.Fatalf("expected clean merge, got conflict:\n%s", merged)
+	}
+	if string(merged) != "ONE\ntwo\nthree\nFOUR\n" {
+		t.Errorf("unexpected merge result:\n%s", merged)
+	}
+}
+
+func TestMergeFileContentsConflict(t *testing.T) {
+	base := []byte("one\ntwo\nthree\n")
+	ours := []byte("one\nTWO\nthree\n")
+	theirs := []byte("one\n2\nthree\n")
+
+	merged, conflict := mergeFileContents(base, ours, theirs, "ours", "theirs")
+	if !conflict {
+		t.Fatalf("expected conflict, got:\n%s", merged)
+	}
+
+	want := "one\n<<<<<<< ours\nTWO\n=======\n2\n>>>>>>> theirs\nthree\n"
+	if string(merged) != want {
+		t.Errorf("unexpected conflict output:\n%s\nwant:\n%s", merged, want)
+	}
+}
+
+func TestMergeFileContentsMissingNewline(t *testing.T) {
+	merged, conflict := mergeFileContents([]byte("a"), []byte("b"), []byte("c"), "ours", "theirs")
+	if !conflict {
+		t.Fatal("expected conflict")
+	}
+	if !strings.Contains(string(merged), "b\n=======\nc\n>>>>>>> theirs\n") {
+		t.Errorf("markers should start on their own line:\n%s", merged)
+	}
+}
+
+func TestFormatDiffStat(t *testing.T) {
+	stats := []FileDiffStat{
+		{Path: "bin", Added: 5, Deleted: 3, Binary: true},
+		{Path: "shorter", OldPath: "short", Added: 1},
+		{Path: "src/very/long/directory/name/file.txt", Deleted: 50},
+	}
+	got := formatDiffStat(stats, 50)
+	want := " bin                              | Bin 3 -> 5 bytes\n" +
+		" short => shorter                 |   1 +\n" +
+		" .../long/directory/name/file.txt |  50 ---------\n" +
+		" 3 files changed, 1 insertion(+), 50 deletions(-)\n"
+	if got != want {
+		t.Errorf("unexpected diffstat:\n%s\nwant:\n%s", got, want)
+	}
+
+	if got := renameName("d0/n2", "d0/n5"); got != "d0/{n2 => n5}" {
+		t.Errorf("expected the shared directory factored out, got %q", got)
+	}
+}
@@ -0,0 +1,77 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// GetEditor picks the editor the same way git does: GIT_EDITOR, then
+// core.editor, then VISUAL and EDITOR, falling back to vi.
+func GetEditor(repoPath string) string {
+	if editor := os.Getenv("GIT_EDITOR"); editor != "" {
+		return editor
+	}
+	if editor, err := GetConfig(repoPath, "core", "editor"); err == nil && editor != "" {
+		return editor
+	}
+	if editor := os.Getenv("VISUAL"); editor != "" {
+		return editor
+	}
+	if editor := os.Getenv("EDITOR"); editor != "" {
+		return editor
+	}
+	return "vi"
+}
+
+func LaunchEditor(repoPath, path string) error {
+	editor := GetEditor(repoPath)
+
+	cmd := exec.Command("sh", "-c", editor+` "$@"`, editor, path)
+	cmd.Dir = repoPath
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("editor '%s' failed: %w", editor, err)
+	}
+	return nil
+}
+
+// editMessage lets the user edit message in COMMIT_EDITMSG and returns the
+// result with comment lines stripped.
+func editMessage(repoPath, message string) (string, error) {
+	path := filepath.Join(repoPath, RepoDirName, "COMMIT_EDITMSG")
+	if err := os.WriteFile(path, []byte(message+"\n"), 0644); err != nil {
+		return "", fmt.Errorf("failed to write commit message: %w", err)
+	}
+
+	if err := LaunchEditor(repoPath, path); err != nil {
+		return "", err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read commit message: %w", err)
+	}
+
+	edited := cleanupMessage(string(data))
+	if edited == "" {
+		return "", fmt.Errorf("aborting commit due to empty commit message")
+	}
+	return edited, nil
+}
+
+func cleanupMessage(message string) string {
+	var lines []string
+	for _, line := range strings.Split(message, "\n") {
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		lines = append(lines, strings.TrimRight(line, " \t\r"))
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
@@ -0,0 +1,524 @@
+package core
+
+import (
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Ref is a ref together with the object it points at.
+type Ref struct {
+	Name string
+	Hash string
+}
+
+// ListRefs lists every ref under refs/ in name order, symbolic refs resolved.
+func ListRefs(repoPath string) ([]Ref, error) {
+	refs, err := listRefs(repoPath, "refs/")
+	if err != nil {
+		return nil, err
+	}
+	list := make([]Ref, 0, len(refs))
+	for _, name := range sortedRefNames(refs) {
+		list = append(list, Ref{Name: name, Hash: refs[name]})
+	}
+	return list, nil
+}
+
+// shortRefName strips the well-known prefix from a ref name.
+func shortRefName(ref string) string {
+	for _, prefix := range []string{"refs/heads/", "refs/tags/", "refs/remotes/", "refs/"} {
+		if strings.HasPrefix(ref, prefix) {
+			return strings.TrimPrefix(ref, prefix)
+		}
+	}
+	return ref
+}
+
+const defaultRefFormat = "%(objectname) %(objecttype)\t%(refname)"
+
+type ForEachRefOptions struct {
+	// Format is a format string with %(atom) placeholders.
+	Format string
+	// Sort keys are atoms, "-" reversing one; the last key is the primary one.
+	Sort []string
+	// Count stops after this many refs when positive.
+	Count int
+	// PointsAt keeps refs pointing at this object, directly or through a tag.
+	PointsAt string
+	// Patterns match refs as a glob or as a prefix ending at a slash.
+	Patterns []string
+}
+
+// ForEachRef writes one line per ref matching opts, expanding %(atom)s in opts.Format.
+func ForEachRef(repoPath string, opts ForEachRefOptions, out io.Writer) error {
+	format := opts.Format
+	if format == "" {
+		format = defaultRefFormat
+	}
+	tmpl, err := parseRefFormat(format)
+	if err != nil {
+		return err
+	}
+
+	refs, err := ListRefs(repoPath)
+	if err != nil {
+		return err
+	}
+
+	pointsAt := ""
+	if opts.PointsAt != "" {
+		if pointsAt, err = ResolveRevision(repoPath, opts.PointsAt); err != nil {
+			return err
+		}
+	}
+
+	head, _ := GetCurrentBranch(repoPath)
+	var items []*refItem
+	for _, ref := range refs {
+		if len(opts.Patterns) > 0 && !refMatchesPattern(ref.Name, opts.Patterns) {
+			continue
+		}
+		item := &refItem{repoPath: repoPath, ref: ref, head: head, now: time.Now()}
+		if pointsAt != "" && ref.Hash != pointsAt {
+			if peeled, err := item.peeled(); err != nil || peeled.hash != pointsAt {
+				continue
+			}
+		}
+		items = append(items, item)
+	}
+
+	if err := sortRefItems(items, opts.Sort); err != nil {
+		return err
+	}
+	if opts.Count > 0 && len(items) > opts.Count {
+		items = items[:opts.Count]
+	}
+
+	for _, item := range items {
+		line, err := tmpl.expand(item)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(out, line)
+	}
+	return nil
+}
+
+// refMatchesPattern matches a glob or a literal prefix ending at a slash.
+func refMatchesPattern(name string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+		prefix := strings.TrimSuffix(pattern, "/")
+		if name == prefix || strings.HasPrefix(name, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// refFormat is a parsed format string: literal text interleaved with atoms.
+type refFormat struct {
+	literals []string
+	atoms    []string
+}
+
+func parseRefFormat(format string) (*refFormat, error) {
+	tmpl := &refFormat{}
+	var literal strings.Builder
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			literal.WriteByte(format[i])
+			continue
+		}
+		switch {
+		case strings.HasPrefix(format[i:], "%%"):
+			literal.WriteByte('%')
+			i++
+		case strings.HasPrefix(format[i:], "%("):
+			end := strings.IndexByte(format[i:], ')')
+			if end < 0 {
+				return nil, fmt.Errorf("malformed format string %s", format[i:])
+			}
+			tmpl.literals = append(tmpl.literals, literal.String())
+			tmpl.atoms = append(tmpl.atoms, format[i+2:i+end])
+			literal.Reset()
+			i += end
+		case i+2 < len(format) && isHexString(format[i+1:i+3]):
+			b, _ := strconv.ParseUint(format[i+1:i+3], 16, 8)
+			literal.WriteByte(byte(b))
+			i += 2
+		default:
+			literal.WriteByte('%')
+		}
+	}
+	tmpl.literals = append(tmpl.literals, literal.String())
+	return tmpl, nil
+}
+
+func (f *refFormat) expand(item *refItem) (string, error) {
+	var sb strings.Builder
+	for i, atom := range f.atoms {
+		sb.WriteString(f.literals[i])
+		value, err := item.atom(atom)
+		if err != nil {
+			return "", err
+		}
+		sb.WriteString(value)
+	}
+	sb.WriteString(f.literals[len(f.literals)-1])
+	return sb.String(), nil
+}
+
+// refObject holds what the atoms need about an object, read on first use.
+type refObject struct {
+	hash       string
+	objectType string
+	size       int
+	commit     *CommitInfo
+	tag        *TagObject
+}
+
+type refItem struct {
+	repoPath string
+	ref      Ref
+	head     string
+	now      time.Time
+
+	object   *refObject
+	deref    *refObject
+	tracking *TrackingInfo
+}
+
+func (item *refItem) load(hash string) (*refObject, error) {
+	objectType, content, err := readObjectWithType(item.repoPath, hash)
+	if err != nil {
+		return nil, err
+	}
+	object := &refObject{hash: hash, objectType: objectType, size: len(content)}
+	switch objectType {
+	case "commit":
+		commit, err := parseCommitContent(string(content))
+		if err != nil {
+			return nil, err
+		}
+		commit.Hash = hash
+		object.commit = &commit
+	case "tag":
+		tag, err := readTag(item.repoPath, hash)
+		if err != nil {
+			return nil, err
+		}
+		object.tag = &tag
+	}
+	return object, nil
+}
+
+func (item *refItem) direct() (*refObject, error) {
+	if item.object == nil {
+		object, err := item.load(item.ref.Hash)
+		if err != nil {
+			return nil, err
+		}
+		item.object = object
+	}
+	return item.object, nil
+}
+
+// peeled returns what an annotated tag ultimately points at, or the ref's object.
+func (item *refItem) peeled() (*refObject, error) {
+	if item.deref == nil {
+		object, err := item.direct()
+		if err != nil {
+			return nil, err
+		}
+		for object.tag != nil {
+			if object, err = item.load(object.tag.Object); err != nil {
+				return nil, err
+			}
+		}
+		item.deref = object
+	}
+	return item.deref, nil
+}
+
+func (item *refItem) atom(atom string) (string, error) {
+	name, modifier, _ := strings.Cut(atom, ":")
+
+	var object *refObject
+	var err error
+	if strings.HasPrefix(name, "*") {
+		name = name[1:]
+		object, err = item.direct()
+		if err != nil {
+			return "", err
+		}
+		if object.tag == nil {
+			return "", nil
+		}
+		object, err = item.peeled()
+	} else {
+		object, err = item.direct()
+	}
+	if err != nil {
+		return "", err
+	}
+
+	switch name {
+	case "refname":
+		return formatRefName(item.ref.Name, modifier)
+	case "HEAD":
+		if "refs/heads/"+item.head == item.ref.Name {
+			return "*", nil
+		}
+		return " ", nil
+	case "objectname":
+		switch {
+		case modifier == "":
+			return object.hash, nil
+		case modifier == "short":
+			return object.hash[:7], nil
+		case strings.HasPrefix(modifier, "short="):
+			n, err := strconv.Atoi(strings.TrimPrefix(modifier, "short="))
+			if err != nil || n < 4 {
+				n = 4
+			}
+			return object.hash[:min(n, len(object.hash))], nil
+		}
+	case "objecttype":
+		return object.objectType, nil
+	case "objectsize":
+		return strconv.Itoa(object.size), nil
+	case "tree":
+		if object.commit != nil {
+			return object.commit.Tree, nil
+		}
+		return "", nil
+	case "parent":
+		if object.commit != nil {
+			return strings.Join(object.commit.Parents, " "), nil
+		}
+		return "", nil
+	case "subject":
+		return refContents(object, "subject"), nil
+	case "body":
+		return refContents(object, "body"), nil
+	case "contents":
+		return refContents(object, modifier), nil
+	case "upstream":
+		return item.upstream(modifier)
+	}
+
+	for _, role := range []string{"author", "committer", "tagger", "creator"} {
+		if field, ok := strings.CutPrefix(name, role); ok {
+			return refSignature(object, role, field, modifier, item.now)
+		}
+	}
+	return "", fmt.Errorf("unknown field name: %s", atom)
+}
+
+// formatRefName applies the :short, :lstrip=<n> and :rstrip=<n> modifiers.
+func formatRefName(ref, modifier string) (string, error) {
+	switch {
+	case modifier == "":
+		return ref, nil
+	case modifier == "short":
+		return shortRefName(ref), nil
+	case strings.HasPrefix(modifier, "lstrip=") || strings.HasPrefix(modifier, "strip="):
+		_, value, _ := strings.Cut(modifier, "=")
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return "", fmt.Errorf("invalid refname modifier '%s'", modifier)
+		}
+		parts := strings.Split(ref, "/")
+		if n < 0 {
+			n = max(len(parts)+n, 0)
+		}
+		return strings.Join(parts[min(n, len(parts)):], "/"), nil
+	case strings.HasPrefix(modifier, "rstrip="):
+		n, err := strconv.Atoi(strings.TrimPrefix(modifier, "rstrip="))
+		if err != nil {
+			return "", fmt.Errorf("invalid refname modifier '%s'", modifier)
+		}
+		parts := strings.Split(ref, "/")
+		if n < 0 {
+			n = max(len(parts)+n, 0)
+		}
+		return strings.Join(parts[:max(len(parts)-n, 0)], "/"), nil
+	}
+	return "", fmt.Errorf("unknown refname modifier '%s'", modifier)
+}
+
+func refContents(object *refObject, part string) string {
+	message := ""
+	switch {
+	case object.commit != nil:
+		message = object.commit.Message
+	case object.tag != nil:
+		message = object.tag.Message
+	}
+	subject, body, _ := strings.Cut(message, "\n")
+	switch part {
+	case "subject":
+		return subject
+	case "body":
+		return strings.TrimSpace(body)
+	}
+	return message
+}
+
+// refSignature renders the name, email or date of a signature atom.
+func refSignature(object *refObject, role, field, modifier string, now time.Time) (string, error) {
+	signature := ""
+	switch {
+	case object.commit != nil && role == "author":
+		signature = object.commit.authorSignature()
+	case object.commit != nil && (role == "committer" || role == "creator"):
+		signature = object.commit.Committer
+	case object.tag != nil && (role == "tagger" || role == "creator"):
+		signature = object.tag.Tagger
+	}
+	if signature == "" {
+		return "", nil
+	}
+
+	name, email, timestamp, timezone := parseAuthorLine(signature)
+	switch field {
+	case "":
+		return signature, nil
+	case "name":
+		return name, nil
+	case "email":
+		return "<" + email + ">", nil
+	case "date":
+		return FormatDate(timestamp, timezone, modifier, now)
+	}
+	return "", fmt.Errorf("unknown field name: %s%s", role, field)
+}
+
+func (item *refItem) upstream(modifier string) (string, error) {
+	if !strings.HasPrefix(item.ref.Name, "refs/heads/") {
+		return "", nil
+	}
+	branch := strings.TrimPrefix(item.ref.Name, "refs/heads/")
+	upstream, err := upstreamRef(item.repoPath, branch)
+	if err != nil {
+		return "", nil
+	}
+
+	switch modifier {
+	case "track", "trackshort":
+		if item.tracking == nil {
+			if item.tracking, err = BranchTracking(item.repoPath, branch); err != nil {
+				return "", err
+			}
+		}
+		return formatTrack(item.tracking, modifier == "trackshort"), nil
+	}
+	return formatRefName(upstream, modifier)
+}
+
+// formatTrack renders ahead/behind counts as "[ahead 1, behind 2]" or the short form.
+func formatTrack(t *TrackingInfo, short bool) string {
+	if t.Gone {
+		if short {
+			return ""
+		}
+		return "[gone]"
+	}
+	if short {
+		switch {
+		case t.Ahead > 0 && t.Behind > 0:
+			return "<>"
+		case t.Ahead > 0:
+			return ">"
+		case t.Behind > 0:
+			return "<"
+		}
+		return "="
+	}
+
+	var parts []string
+	if t.Ahead > 0 {
+		parts = append(parts, fmt.Sprintf("ahead %d", t.Ahead))
+	}
+	if t.Behind > 0 {
+		parts = append(parts, fmt.Sprintf("behind %d", t.Behind))
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return "[" + strings.Join(parts, ", ") + "]"
+}
+
+// sortRefItems orders items by keys, the last taking priority.
+func sortRefItems(items []*refItem, keys []string) error {
+	if len(keys) == 0 {
+		keys = []string{"refname"}
+	}
+
+	for _, key := range keys {
+		reverse := strings.HasPrefix(key, "-")
+		atom := strings.TrimPrefix(key, "-")
+
+		var compare func(a, b *refItem) (int, error)
+		switch {
+		case atom == "version:refname" || atom == "v:refname":
+			compare = func(a, b *refItem) (int, error) {
+				return compareVersions(a.ref.Name, b.ref.Name), nil
+			}
+		case strings.HasSuffix(atom, "date") || atom == "objectsize" || atom == "*objectsize":
+			numeric := atom
+			if strings.HasSuffix(atom, "date") {
+				numeric += ":unix"
+			}
+			compare = func(a, b *refItem) (int, error) {
+				x, err := a.atom(numeric)
+				if err != nil {
+					return 0, err
+				}
+				y, err := b.atom(numeric)
+				if err != nil {
+					return 0, err
+				}
+				xn, _ := strconv.ParseInt(x, 10, 64)
+				yn, _ := strconv.ParseInt(y, 10, 64)
+				return int(xn - yn), nil
+			}
+		default:
+			compare = func(a, b *refItem) (int, error) {
+				x, err := a.atom(atom)
+				if err != nil {
+					return 0, err
+				}
+				y, err := b.atom(atom)
+				if err != nil {
+					return 0, err
+				}
+				return strings.Compare(x, y), nil
+			}
+		}
+
+		var sortErr error
+		sort.SliceStable(items, func(i, j int) bool {
+			c, err := compare(items[i], items[j])
+			if err != nil && sortErr == nil {
+				sortErr = err
+			}
+			if reverse {
+				return c > 0
+			}
+			return c < 0
+		})
+		if sortErr != nil {
+			return sortErr
+		}
+	}
+	return nil
+}
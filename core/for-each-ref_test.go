@@ -0,0 +1,122 @@
+package core
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func forEachRefOutput(t *testing.T, repo string, opts ForEachRefOptions) string {
+	t.Helper()
+	var out bytes.Buffer
+	if err := ForEachRef(repo, opts, &out); err != nil {
+		t.Fatalf("ForEachRef failed: %v", err)
+	}
+	return out.String()
+}
+
+func TestForEachRef(t *testing.T) {
+	repo := setupTestRepo(t)
+	first := commitFile(t, repo, "file.txt", "one\n", "first\n\nbody text")
+	firstCommit, _ := readCommit(repo, first)
+
+	// an older commit on its own branch, to sort by date
+	older, err := commitTreeWithSignatures(firstCommit.Tree, []string{first}, "older", "Old Author <old@example.com> 1000000000 +0100", "Old Author <old@example.com> 1000000000 +0100")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := CreateBranchAt(repo, "old", older); err != nil {
+		t.Fatal(err)
+	}
+	second := commitFile(t, repo, "file.txt", "two\n", "second")
+	if _, err := CreateTag(repo, "v1", first, TagOptions{Message: "release one", Name: "Tagger", Email: "tagger@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetUpstream(repo, "old", "main"); err != nil {
+		t.Fatal(err)
+	}
+
+	got := forEachRefOutput(t, repo, ForEachRefOptions{})
+	want := second + " commit\trefs/heads/main\n" + older + " commit\trefs/heads/old\n"
+	if !strings.HasPrefix(got, want) || !strings.Contains(got, " tag\trefs/tags/v1\n") {
+		t.Errorf("unexpected default output:\n%s", got)
+	}
+
+	got = forEachRefOutput(t, repo, ForEachRefOptions{
+		Format:   "%(HEAD)%(refname:short) %(objectname:short) %(contents:subject) %(upstream:short)%(upstream:track)",
+		Patterns: []string{"refs/heads"},
+	})
+	want = "*main " + second[:7] + " second \n old " + older[:7] + " older main[ahead 1, behind 1]\n"
+	if got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+
+	got = forEachRefOutput(t, repo, ForEachRefOptions{
+		Format:   "%(refname:lstrip=-1) %(objecttype) %(*objecttype) %(*objectname) %(taggername) %(contents:subject)%%",
+		Patterns: []string{"refs/tags/v*"},
+	})
+	if got != "v1 tag commit "+first+" Tagger release one%\n" {
+		t.Errorf("unexpected tag output %q", got)
+	}
+
+	got = forEachRefOutput(t, repo, ForEachRefOptions{
+		Format:   "%(refname:short) %(committerdate:unix) %(authordate:iso)",
+		Sort:     []string{"committerdate"},
+		Count:    1,
+		Patterns: []string{"refs/heads"},
+	})
+	if got != "old 1000000000 2001-09-09 02:46:40 +0100\n" {
+		t.Errorf("expected the oldest ref first, got %q", got)
+	}
+
+	got = forEachRefOutput(t, repo, ForEachRefOptions{Format: "%(refname)", PointsAt: first})
+	if got != "refs/tags/v1\n" {
+		t.Errorf("--points-at should see through tags, got %q", got)
+	}
+
+	if err := ForEachRef(repo, ForEachRefOptions{Format: "%(bogus)"}, &bytes.Buffer{}); err == nil {
+		t.Error("expected an error for an unknown atom")
+	}
+}
+
+func TestShowRef(t *testing.T) {
+	repo := setupTestRepo(t)
+	first := commitFile(t, repo, "file.txt", "one\n", "first")
+	if err := UpdateRef(repo, "refs/remotes/origin/main", first, "", "", false); err != nil {
+		t.Fatal(err)
+	}
+	tag, err := CreateTag(repo, "v1", first, TagOptions{Message: "release", Name: "Tagger", Email: "tagger@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	if n, err := ShowRef(repo, []string{"main"}, ShowRefOptions{}, &out); err != nil || n != 2 {
+		t.Fatalf("expected two matches, got %d (%v)", n, err)
+	}
+	if out.String() != first+" refs/heads/main\n"+first+" refs/remotes/origin/main\n" {
+		t.Errorf("unexpected output %q", out.String())
+	}
+
+	out.Reset()
+	if _, err := ShowRef(repo, nil, ShowRefOptions{Tags: true, Dereference: true}, &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != tag+" refs/tags/v1\n"+first+" refs/tags/v1^{}\n" {
+		t.Errorf("unexpected dereferenced output %q", out.String())
+	}
+
+	out.Reset()
+	if _, err := ShowRef(repo, []string{"refs/heads/main"}, ShowRefOptions{Verify: true, HashOnly: true, Abbrev: 7}, &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != first[:7]+"\n" {
+		t.Errorf("unexpected hash output %q", out.String())
+	}
+	if _, err := ShowRef(repo, []string{"main"}, ShowRefOptions{Verify: true}, &out); err == nil {
+		t.Error("--verify should require a full ref name")
+	}
+	if n, _ := ShowRef(repo, []string{"nothing"}, ShowRefOptions{Heads: true}, &out); n != 0 {
+		t.Errorf("expected no matches, got %d", n)
+	}
+}
@@ -0,0 +1,607 @@
+package core
+
+import (
+	"io"
+	"strings"
+)
+
+// graphState is the kind of line a Graph draws next.
+type graphState int
+
+const (
+	graphPadding graphState = iota
+	graphSkip
+	graphPreCommit
+	graphCommit
+	graphPostMerge
+	graphCollapsing
+)
+
+// Graph draws the ASCII history graph of log --graph, one line at a time,
+// using the same column layout as git: each column is a line of history
+// waiting for the commit it leads to, a commit is drawn as "*" in its
+// column, and the lines to its parents branch out below it with "|", "\"
+// and "/" before collapsing back into place.
+//
+// Call Update with every commit in the order they are shown, then take
+// lines with NextLine until IsCommitFinished.
+type Graph struct {
+	commit     string
+	parents    []string
+	numParents int
+	// width is the number of characters the lines for this commit take
+	width        int
+	expansionRow int
+	state        graphState
+	prevState    graphState
+	// commitIndex is the column the current commit is drawn in
+	commitIndex     int
+	prevCommitIndex int
+	// mergeLayout is 0 for a merge whose first parent is to its left, 1
+	// otherwise, and -1 before it is known
+	mergeLayout    int
+	edgesAdded     int
+	prevEdgesAdded int
+
+	// columns are the lines leading into the current commit's row, and
+	// newColumns the ones leaving it
+	columns    []string
+	newColumns []string
+	numColumns int
+	numNew     int
+	// mapping says, for every character position of the row being drawn,
+	// which of newColumns the line there ends up in, or -1
+	mapping     []int
+	oldMapping  []int
+	mappingSize int
+}
+
+func NewGraph() *Graph {
+	return &Graph{state: graphPadding, prevState: graphPadding}
+}
+
+// Update moves the graph on to commit. parents lists the parents that the
+// log shows, in order; the others get no line.
+func (g *Graph) Update(commit string, parents []string) {
+	g.commit = commit
+	g.parents = parents
+	g.numParents = len(parents)
+	g.prevCommitIndex = g.commitIndex
+
+	g.updateColumns()
+	g.expansionRow = 0
+
+	// If the previous commit never got as far as its padding lines, it
+	// left part of the graph undrawn; say so with a "..." line.
+	switch {
+	case g.state != graphPadding:
+		g.state = graphSkip
+	case g.needsPreCommitLine():
+		g.state = graphPreCommit
+	default:
+		g.state = graphCommit
+	}
+}
+
+// IsCommitFinished reports whether all the lines belonging to the current
+// commit have been drawn, so that only padding lines remain.
+func (g *Graph) IsCommitFinished() bool {
+	return g.state == graphPadding
+}
+
+// NextLine returns the next line of the graph and whether it is the line
+// with the current commit on it.
+func (g *Graph) NextLine() (string, bool) {
+	if g.commit == "" {
+		return "", false
+	}
+
+	var line strings.Builder
+	shownCommit := false
+	switch g.state {
+	case graphPadding:
+		g.outputPaddingLine(&line)
+	case graphSkip:
+		g.outputSkipLine(&line)
+	case graphPreCommit:
+		g.outputPreCommitLine(&line)
+	case graphCommit:
+		g.outputCommitLine(&line)
+		shownCommit = true
+	case graphPostMerge:
+		g.outputPostMergeLine(&line)
+	case graphCollapsing:
+		g.outputCollapsingLine(&line)
+	}
+	return g.pad(line.String()), shownCommit
+}
+
+// PaddingLine returns a line that leaves every line of history as it is,
+// for output that needs more lines than the graph does.
+func (g *Graph) PaddingLine() string {
+	if g.state != graphCommit {
+		line, _ := g.NextLine()
+		return line
+	}
+
+	var line strings.Builder
+	for i := 0; i < g.numColumns; i++ {
+		line.WriteByte('|')
+		if g.columns[i] == g.commit && g.numParents > 2 {
+			line.WriteString(strings.Repeat(" ", (g.numParents-2)*2))
+		} else {
+			line.WriteByte(' ')
+		}
+	}
+	g.prevState = graphPadding
+	return g.pad(line.String())
+}
+
+func (g *Graph) pad(line string) string {
+	if len(line) < g.width {
+		line += strings.Repeat(" ", g.width-len(line))
+	}
+	return line
+}
+
+func (g *Graph) setState(state graphState) {
+	g.prevState = g.state
+	g.state = state
+}
+
+func (g *Graph) ensureCapacity(n int) {
+	if len(g.columns) >= n {
+		return
+	}
+	size := max(len(g.columns), 1)
+	for size < n {
+		size *= 2
+	}
+	g.columns = append(g.columns, make([]string, size-len(g.columns))...)
+	g.newColumns = append(g.newColumns, make([]string, size-len(g.newColumns))...)
+	g.mapping = append(g.mapping, make([]int, 2*size-len(g.mapping))...)
+	g.oldMapping = append(g.oldMapping, make([]int, 2*size-len(g.oldMapping))...)
+}
+
+func (g *Graph) findNewColumn(commit string) int {
+	for i := 0; i < g.numNew; i++ {
+		if g.newColumns[i] == commit {
+			return i
+		}
+	}
+	return -1
+}
+
+// insertIntoNewColumns records that the line at the next position of the
+// row leads to commit, reusing its column if it already has one. idx is
+// the column of the current commit when commit is one of its parents, or
+// -1 for a line just passing through.
+func (g *Graph) insertIntoNewColumns(commit string, idx int) {
+	i := g.findNewColumn(commit)
+	if i < 0 {
+		i = g.numNew
+		g.newColumns[i] = commit
+		g.numNew++
+	}
+
+	var mappingIdx int
+	switch {
+	case g.numParents > 1 && idx > -1 && g.mergeLayout == -1:
+		// The first parent of a merge: lay the merge out to the left
+		// when that parent is already in a column left of the merge.
+		dist := idx - i
+		shift := 1
+		if dist > 1 {
+			shift = 2*dist - 3
+		}
+		g.mergeLayout = 1
+		if dist > 0 {
+			g.mergeLayout = 0
+		}
+		g.edgesAdded = g.numParents + g.mergeLayout - 2
+		mappingIdx = g.width + (g.mergeLayout-1)*shift
+		g.width += 2 * g.mergeLayout
+	case g.edgesAdded > 0 && i == g.mapping[g.width-2]:
+		// The merge added columns, but this one joins the last
+		// existing column, so let the two edges meet straight away.
+		mappingIdx = g.width - 2
+		g.edgesAdded = -1
+	default:
+		mappingIdx = g.width
+		g.width += 2
+	}
+	g.mapping[mappingIdx] = i
+}
+
+func (g *Graph) updateColumns() {
+	g.columns, g.newColumns = g.newColumns, g.columns
+	g.numColumns = g.numNew
+	g.numNew = 0
+
+	maxNewColumns := g.numColumns + g.numParents
+	g.ensureCapacity(maxNewColumns)
+
+	g.mappingSize = 2 * maxNewColumns
+	for i := 0; i < g.mappingSize; i++ {
+		g.mapping[i] = -1
+	}
+	g.width = 0
+	g.prevEdgesAdded = g.edgesAdded
+	g.edgesAdded = 0
+
+	// Carry every column over, replacing the current commit's with the
+	// lines to its parents. A commit nothing led to yet starts a new
+	// column on the right.
+	seenThis := false
+	for i := 0; i <= g.numColumns; i++ {
+		var colCommit string
+		if i == g.numColumns {
+			if seenThis {
+				break
+			}
+			colCommit = g.commit
+		} else {
+			colCommit = g.columns[i]
+		}
+
+		if colCommit == g.commit {
+			seenThis = true
+			g.commitIndex = i
+			g.mergeLayout = -1
+			for _, parent := range g.parents {
+				g.insertIntoNewColumns(parent, i)
+			}
+			// the commit takes up at least two characters
+			if g.numParents == 0 {
+				g.width += 2
+			}
+		} else {
+			g.insertIntoNewColumns(colCommit, -1)
+		}
+	}
+
+	for g.mappingSize > 1 && g.mapping[g.mappingSize-1] < 0 {
+		g.mappingSize--
+	}
+}
+
+func (g *Graph) numDashedParents() int {
+	return g.numParents + g.mergeLayout - 3
+}
+
+// numExpansionRows is how many rows an octopus merge needs above it to
+// spread out the lines to its right, two per dashed parent.
+func (g *Graph) numExpansionRows() int {
+	return g.numDashedParents() * 2
+}
+
+func (g *Graph) needsPreCommitLine() bool {
+	return g.numParents >= 3 &&
+		g.commitIndex < g.numColumns-1 &&
+		g.expansionRow < g.numExpansionRows()
+}
+
+func (g *Graph) isMappingCorrect() bool {
+	for i := 0; i < g.mappingSize; i++ {
+		if target := g.mapping[i]; target >= 0 && target != i/2 {
+			return false
+		}
+	}
+	return true
+}
+
+func (g *Graph) outputPaddingLine(line *strings.Builder) {
+	for i := 0; i < g.numNew; i++ {
+		line.WriteString("| ")
+	}
+}
+
+func (g *Graph) outputSkipLine(line *strings.Builder) {
+	line.WriteString("...")
+	if g.needsPreCommitLine() {
+		g.setState(graphPreCommit)
+	} else {
+		g.setState(graphCommit)
+	}
+}
+
+// outputPreCommitLine widens the gap right of an octopus merge, pushing
+// the lines there one step right per row.
+func (g *Graph) outputPreCommitLine(line *strings.Builder) {
+	seenThis := false
+	for i := 0; i < g.numColumns; i++ {
+		switch {
+		case g.columns[i] == g.commit:
+			seenThis = true
+			line.WriteByte('|')
+			line.WriteString(strings.Repeat(" ", g.expansionRow))
+		case seenThis && g.expansionRow == 0:
+			// keep going in the direction the previous merge's lines
+			// were heading
+			if g.prevState == graphPostMerge && g.prevCommitIndex < i {
+				line.WriteByte('\\')
+			} else {
+				line.WriteByte('|')
+			}
+		case seenThis && g.expansionRow > 0:
+			line.WriteByte('\\')
+		default:
+			line.WriteByte('|')
+		}
+		line.WriteByte(' ')
+	}
+
+	g.expansionRow++
+	if !g.needsPreCommitLine() {
+		g.setState(graphCommit)
+	}
+}
+
+// drawOctopusMerge draws the "-." dashes leading to the third and later
+// parents of a merge.
+func (g *Graph) drawOctopusMerge(line *strings.Builder) {
+	dashed := g.numDashedParents()
+	for i := 0; i < dashed; i++ {
+		line.WriteByte('-')
+		if i == dashed-1 {
+			line.WriteByte('.')
+		} else {
+			line.WriteByte('-')
+		}
+	}
+}
+
+func (g *Graph) outputCommitLine(line *strings.Builder) {
+	seenThis := false
+	for i := 0; i <= g.numColumns; i++ {
+		var colCommit string
+		if i == g.numColumns {
+			if seenThis {
+				break
+			}
+			colCommit = g.commit
+		} else {
+			colCommit = g.columns[i]
+		}
+
+		switch {
+		case colCommit == g.commit:
+			seenThis = true
+			line.WriteByte('*')
+			if g.numParents > 2 {
+				g.drawOctopusMerge(line)
+			}
+		case seenThis && g.edgesAdded > 1:
+			line.WriteByte('\\')
+		case seenThis && g.edgesAdded == 1:
+			// A merge with no pre-commit rows: if the previous merge
+			// left this line heading right, keep it that way.
+			if g.prevState == graphPostMerge && g.prevEdgesAdded > 0 && g.prevCommitIndex < i {
+				line.WriteByte('\\')
+			} else {
+				line.WriteByte('|')
+			}
+		case g.prevState == graphCollapsing && g.oldMapping[2*i+1] == i && g.mapping[2*i] < i:
+			line.WriteByte('/')
+		default:
+			line.WriteByte('|')
+		}
+		line.WriteByte(' ')
+	}
+
+	switch {
+	case g.numParents > 1:
+		g.setState(graphPostMerge)
+	case g.isMappingCorrect():
+		g.setState(graphPadding)
+	default:
+		g.setState(graphCollapsing)
+	}
+}
+
+var mergeChars = [3]byte{'/', '|', '\\'}
+
+// outputPostMergeLine draws the edges from a merge to its parents.
+func (g *Graph) outputPostMergeLine(line *strings.Builder) {
+	seenThis := false
+	parentCol := false
+	for i := 0; i <= g.numColumns; i++ {
+		var colCommit string
+		if i == g.numColumns {
+			if seenThis {
+				break
+			}
+			colCommit = g.commit
+		} else {
+			colCommit = g.columns[i]
+		}
+
+		switch {
+		case colCommit == g.commit:
+			seenThis = true
+			idx := g.mergeLayout
+			for j := 0; j < g.numParents; j++ {
+				line.WriteByte(mergeChars[idx])
+				if idx == 2 {
+					if g.edgesAdded > 0 || j < g.numParents-1 {
+						line.WriteByte(' ')
+					}
+				} else {
+					idx++
+				}
+			}
+			if g.edgesAdded == 0 {
+				line.WriteByte(' ')
+			}
+		case seenThis:
+			if g.edgesAdded > 0 {
+				line.WriteByte('\\')
+			} else {
+				line.WriteByte('|')
+			}
+			line.WriteByte(' ')
+		default:
+			line.WriteByte('|')
+			if g.mergeLayout != 0 || i != g.commitIndex-1 {
+				if parentCol {
+					line.WriteByte('_')
+				} else {
+					line.WriteByte(' ')
+				}
+			}
+		}
+
+		if colCommit == g.parents[0] {
+			parentCol = true
+		}
+	}
+
+	if g.isMappingCorrect() {
+		g.setState(graphPadding)
+	} else {
+		g.setState(graphCollapsing)
+	}
+}
+
+// outputCollapsingLine moves lines that are out of place one step left,
+// letting lines that lead to the same commit merge. Only one line at a
+// time may cross others, drawn with "_".
+func (g *Graph) outputCollapsingLine(line *strings.Builder) {
+	usedHorizontal := false
+	horizontalEdge := -1
+	horizontalEdgeTarget := -1
+
+	g.mapping, g.oldMapping = g.oldMapping, g.mapping
+	for i := 0; i < g.mappingSize; i++ {
+		g.mapping[i] = -1
+	}
+
+	for i := 0; i < g.mappingSize; i++ {
+		target := g.oldMapping[i]
+		if target < 0 {
+			continue
+		}
+
+		// Lines only ever move left, so whenever two cross, only one
+		// of them is moving.
+		switch {
+		case target*2 == i:
+			g.mapping[i] = target
+		case g.mapping[i-1] < 0:
+			// nothing to the left: move one step over
+			g.mapping[i-1] = target
+			if horizontalEdge == -1 {
+				horizontalEdge = i
+				horizontalEdgeTarget = target
+				for j := target*2 + 3; j < i-2; j += 2 {
+					g.mapping[j] = target
+				}
+			}
+		case g.mapping[i-1] == target:
+			// the line to the left leads to the same commit; merge
+			// into it
+		default:
+			// cross over the line to the left
+			g.mapping[i-2] = target
+			if horizontalEdge == -1 {
+				horizontalEdgeTarget = target
+				horizontalEdge = i - 1
+				for j := target*2 + 3; j < i-2; j += 2 {
+					g.mapping[j] = target
+				}
+			}
+		}
+	}
+
+	copy(g.oldMapping[:g.mappingSize], g.mapping[:g.mappingSize])
+
+	// the new mapping may be one shorter than the old one
+	if g.mapping[g.mappingSize-1] < 0 {
+		g.mappingSize--
+	}
+
+	for i := 0; i < g.mappingSize; i++ {
+		target := g.mapping[i]
+		switch {
+		case target < 0:
+			line.WriteByte(' ')
+		case target*2 == i:
+			line.WriteByte('|')
+		case target == horizontalEdgeTarget && i != horizontalEdge-1:
+			// only the first segment of a horizontal edge continues
+			// into the next line
+			if i != target*2+3 {
+				g.mapping[i] = -1
+			}
+			usedHorizontal = true
+			line.WriteByte('_')
+		default:
+			if usedHorizontal && i < horizontalEdge {
+				g.mapping[i] = -1
+			}
+			line.WriteByte('/')
+		}
+	}
+
+	if g.isMappingCorrect() {
+		g.setState(graphPadding)
+	}
+}
+
+// showCommit writes the graph lines up to and including the start of the
+// current commit's line.
+func (g *Graph) showCommit(out io.Writer) {
+	if g.IsCommitFinished() {
+		io.WriteString(out, g.PaddingLine())
+		return
+	}
+	for !g.IsCommitFinished() {
+		line, shownCommit := g.NextLine()
+		io.WriteString(out, line)
+		if shownCommit {
+			return
+		}
+		io.WriteString(out, "\n")
+	}
+}
+
+// showMessage writes text with a graph line in front of every line but
+// the first, then whatever lines the commit still needs.
+func (g *Graph) showMessage(out io.Writer, text string) {
+	terminated := strings.HasSuffix(text, "\n")
+	for len(text) > 0 {
+		line, rest, found := strings.Cut(text, "\n")
+		io.WriteString(out, line)
+		if found {
+			io.WriteString(out, "\n")
+		}
+		if rest != "" {
+			next, _ := g.NextLine()
+			io.WriteString(out, next)
+		}
+		text = rest
+	}
+
+	if g.IsCommitFinished() {
+		return
+	}
+	if !terminated {
+		io.WriteString(out, "\n")
+	}
+	g.showRemainder(out)
+	if terminated {
+		io.WriteString(out, "\n")
+	}
+}
+
+// showRemainder writes the lines the current commit still needs, with no
+// newline after the last.
+func (g *Graph) showRemainder(out io.Writer) {
+	for !g.IsCommitFinished() {
+		line, _ := g.NextLine()
+		io.WriteString(out, line)
+		if !g.IsCommitFinished() {
+			io.WriteString(out, "\n")
+		}
+	}
+}
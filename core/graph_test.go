@@ -0,0 +1,93 @@
+package core
+
+import (
+	"strings"
+	"testing"
+)
+
+func graphLog(t *testing.T, repo string, format string, args ...string) string {
+	t.Helper()
+
+	formatter, err := NewCommitFormatter(repo, PrettyOptions{Format: format})
+	if err != nil {
+		t.Fatal(err)
+	}
+	walker, err := WalkRevisions(repo, args, WalkOptions{Order: OrderTopo})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out strings.Builder
+	writer := NewLogWriter(&out, formatter, NewGraph())
+	for walker.Next() {
+		commit := walker.Commit()
+		if err := writer.Write(commit, walker.Parents(commit)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := walker.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return out.String()
+}
+
+func TestGraph(t *testing.T) {
+	repo := setupTestRepo(t)
+	first := commitFile(t, repo, "file.txt", "one\n", "first")
+	firstCommit, _ := readCommit(repo, first)
+	tree := firstCommit.Tree
+
+	root := datedCommit(t, tree, "root", 1000000100, 1000000100)
+	a := datedCommit(t, tree, "a", 1000000200, 1000000200, root)
+	b := datedCommit(t, tree, "b", 1000000300, 1000000300, root)
+	c := datedCommit(t, tree, "c", 1000000400, 1000000400, root)
+	merge := datedCommit(t, tree, "merge", 1000000500, 1000000500, a, b)
+	octopus := datedCommit(t, tree, "octopus", 1000000600, 1000000600, merge, c, b)
+	if err := UpdateRef(repo, "refs/heads/main", octopus, "", "test", false); err != nil {
+		t.Fatal(err)
+	}
+
+	// lines are padded to the width of the graph, as git does
+	want := strings.Join([]string{
+		"*-.   octopus",
+		"|\\ \\  ",
+		"| * | c",
+		"* | |   merge",
+		"|\\ \\ \\  ",
+		"| | |/  ",
+		"| |/|   ",
+		"| * | b",
+		"| |/  ",
+		"* / a",
+		"|/  ",
+		"* root",
+		"",
+	}, "\n")
+	if got := graphLog(t, repo, "%s"); got != want {
+		t.Errorf("graph:\n%s\nwant:\n%s", got, want)
+	}
+
+	want = strings.Join([]string{
+		"*   commit " + merge,
+		"|\\  Merge: " + a[:7] + " " + b[:7],
+		"| | Author: Test Author <test@example.com>",
+		"| | Date:   Sun Sep 9 01:55:00 2001 +0000",
+		"| | ",
+		"| |     merge",
+		"| | ",
+		"| * commit " + b,
+		"|   Author: Test Author <test@example.com>",
+		"|   Date:   Sun Sep 9 01:51:40 2001 +0000",
+		"|   ",
+		"|       b",
+		"| ",
+		"* commit " + a,
+		"  Author: Test Author <test@example.com>",
+		"  Date:   Sun Sep 9 01:50:00 2001 +0000",
+		"  ",
+		"      a",
+		"",
+	}, "\n")
+	if got := graphLog(t, repo, "medium", root+".."+merge); got != want {
+		t.Errorf("graph with the medium format:\n%s\nwant:\n%s", got, want)
+	}
+}
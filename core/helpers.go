@@ -1,8 +1,10 @@
 package core
 
 var (
-	RepoDirName   = ".senpai"
-	GitIgnoreFile = ".gitignore"
+	RepoDirName       = ".senpai"
+	GitIgnoreFile     = ".gitignore"
+	GitAttributesFile = ".gitattributes"
+	MailmapFile       = ".mailmap"
 )
 
 const (
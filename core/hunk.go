@@ -0,0 +1,331 @@
+package core
+
+// lineChange is a run of lines an edit script replaces: count lines of the
+// old file starting at oldStart become newCount lines of the new file
+// starting at newStart. Either count may be zero.
+type lineChange struct {
+	oldStart, oldCount int
+	newStart, newCount int
+}
+
+// lineChanges diffs a and b and groups the edit script into runs of
+// changed lines. The lines are matched up the way git's xdiff does it,
+// and a change that could sit at several places, like a block added after
+// an identical one, is placed where git places it, so that patches read
+// the same as git's.
+func lineChanges(a, b []string) []lineChange {
+	oldFile, newFile := newChangedFile(a), newChangedFile(b)
+	markChanges(oldFile, newFile)
+	oldFile.compact(newFile)
+	newFile.compact(oldFile)
+
+	var changes []lineChange
+	for i, j := 0, 0; i < len(a) || j < len(b); {
+		if !oldFile.isChanged(i) && !newFile.isChanged(j) {
+			i++
+			j++
+			continue
+		}
+		change := lineChange{oldStart: i, newStart: j}
+		for oldFile.isChanged(i) {
+			i++
+		}
+		for newFile.isChanged(j) {
+			j++
+		}
+		change.oldCount, change.newCount = i-change.oldStart, j-change.newStart
+		changes = append(changes, change)
+	}
+	return changes
+}
+
+// changedFile marks the lines of one side of a diff that the edit script
+// changes. The marks have an unchanged line on either end, so that groups
+// can be scanned without bounds checks.
+type changedFile struct {
+	lines   []string
+	changed []bool
+}
+
+func newChangedFile(lines []string) *changedFile {
+	return &changedFile{lines: lines, changed: make([]bool, len(lines)+2)}
+}
+
+func (f *changedFile) isChanged(i int) bool { return f.changed[i+1] }
+
+func (f *changedFile) setChanged(i int, changed bool) { f.changed[i+1] = changed }
+
+// changeGroup is a run of changed lines [start, end), or the empty run at
+// start when start == end.
+type changeGroup struct {
+	start, end int
+}
+
+func (f *changedFile) firstGroup() changeGroup {
+	g := changeGroup{}
+	for f.isChanged(g.end) {
+		g.end++
+	}
+	return g
+}
+
+// nextGroup moves g to the group after it, returning false at the end.
+func (f *changedFile) nextGroup(g *changeGroup) bool {
+	if g.end == len(f.lines) {
+		return false
+	}
+	g.start = g.end + 1
+	for g.end = g.start; f.isChanged(g.end); g.end++ {
+	}
+	return true
+}
+
+// previousGroup moves g to the group before it, returning false at the
+// start.
+func (f *changedFile) previousGroup(g *changeGroup) bool {
+	if g.start == 0 {
+		return false
+	}
+	g.end = g.start - 1
+	for g.start = g.end; f.isChanged(g.start - 1); g.start-- {
+	}
+	return true
+}
+
+// slideDown moves the changed run g one line down when the line after it
+// matches its first line, merging it with any run it then touches.
+func (f *changedFile) slideDown(g *changeGroup) bool {
+	if g.end >= len(f.lines) || f.lines[g.start] != f.lines[g.end] {
+		return false
+	}
+	f.setChanged(g.start, false)
+	f.setChanged(g.end, true)
+	g.start++
+	g.end++
+	for f.isChanged(g.end) {
+		g.end++
+	}
+	return true
+}
+
+// slideUp moves the changed run g one line up when the line before it
+// matches its last line, merging it with any run it then touches.
+func (f *changedFile) slideUp(g *changeGroup) bool {
+	if g.start == 0 || f.lines[g.start-1] != f.lines[g.end-1] {
+		return false
+	}
+	g.start--
+	g.end--
+	f.setChanged(g.start, true)
+	f.setChanged(g.end, false)
+	for f.isChanged(g.start - 1) {
+		g.start--
+	}
+	return true
+}
+
+// compact slides every group of changed lines in f to where git's xdiff
+// puts it, keeping other, the other side of the diff, in step: as far
+// down as it goes, unless that lines it up with a change on the other side
+// or the indent heuristic finds a better split.
+func (f *changedFile) compact(other *changedFile) {
+	g, og := f.firstGroup(), other.firstGroup()
+	for {
+		if g.end != g.start {
+			var groupSize, earliestEnd int
+			endMatchingOther := -1
+			for {
+				groupSize = g.end - g.start
+				endMatchingOther = -1
+				for f.slideUp(&g) {
+					other.previousGroup(&og)
+				}
+				earliestEnd = g.end
+				if og.end > og.start {
+					endMatchingOther = g.end
+				}
+				for f.slideDown(&g) {
+					other.nextGroup(&og)
+					if og.end > og.start {
+						endMatchingOther = g.end
+					}
+				}
+				if groupSize == g.end-g.start {
+					break
+				}
+			}
+
+			switch {
+			case g.end == earliestEnd:
+			case endMatchingOther != -1:
+				for og.end == og.start {
+					f.slideUp(&g)
+					other.previousGroup(&og)
+				}
+			default:
+				shift := max(earliestEnd, g.end-groupSize-1, g.end-indentMaxSliding)
+				bestShift := -1
+				var best splitScore
+				for ; shift <= g.end; shift++ {
+					var score splitScore
+					score.add(f.measureSplit(shift))
+					score.add(f.measureSplit(shift - groupSize))
+					if bestShift == -1 || score.compare(best) <= 0 {
+						best, bestShift = score, shift
+					}
+				}
+				for g.end > bestShift {
+					f.slideUp(&g)
+					other.previousGroup(&og)
+				}
+			}
+		}
+
+		if !f.nextGroup(&g) {
+			return
+		}
+		other.nextGroup(&og)
+	}
+}
+
+// The indent heuristic scores the places a group of changed lines could be
+// split from its surroundings by the indentation and blank lines around
+// them, preferring splits that look like the edges of a block of code.
+const (
+	indentMax        = 200
+	indentMaxBlanks  = 20
+	indentMaxSliding = 100
+
+	startOfFilePenalty              = 1
+	endOfFilePenalty                = 21
+	totalBlankWeight                = -30
+	postBlankWeight                 = 6
+	relativeIndentPenalty           = -4
+	relativeIndentWithBlankPenalty  = 10
+	relativeOutdentPenalty          = 24
+	relativeOutdentWithBlankPenalty = 17
+	relativeDedentPenalty           = 23
+	relativeDedentWithBlankPenalty  = 17
+	indentWeight                    = 60
+)
+
+type splitMeasurement struct {
+	endOfFile  bool
+	indent     int
+	preBlank   int
+	preIndent  int
+	postBlank  int
+	postIndent int
+}
+
+type splitScore struct {
+	effectiveIndent int
+	penalty         int
+}
+
+// lineIndent measures the indentation of line, counting tabs to the next
+// multiple of eight, or returns -1 for a blank line.
+func lineIndent(line string) int {
+	indent := 0
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case ' ':
+			indent++
+		case '\t':
+			indent += 8 - indent%8
+		case '\n', '\r', '\f', '\v':
+		default:
+			return indent
+		}
+		if indent >= indentMax {
+			return indentMax
+		}
+	}
+	return -1
+}
+
+// measureSplit describes the surroundings of a split just before line
+// split.
+func (f *changedFile) measureSplit(split int) splitMeasurement {
+	var m splitMeasurement
+	if split >= len(f.lines) {
+		m.endOfFile, m.indent = true, -1
+	} else {
+		m.indent = lineIndent(f.lines[split])
+	}
+
+	m.preIndent = -1
+	for i := split - 1; i >= 0; i-- {
+		if m.preIndent = lineIndent(f.lines[i]); m.preIndent != -1 {
+			break
+		}
+		if m.preBlank++; m.preBlank == indentMaxBlanks {
+			m.preIndent = 0
+			break
+		}
+	}
+
+	m.postIndent = -1
+	for i := split + 1; i < len(f.lines); i++ {
+		if m.postIndent = lineIndent(f.lines[i]); m.postIndent != -1 {
+			break
+		}
+		if m.postBlank++; m.postBlank == indentMaxBlanks {
+			m.postIndent = 0
+			break
+		}
+	}
+	return m
+}
+
+func (s *splitScore) add(m splitMeasurement) {
+	if m.preIndent == -1 && m.preBlank == 0 {
+		s.penalty += startOfFilePenalty
+	}
+	if m.endOfFile {
+		s.penalty += endOfFilePenalty
+	}
+
+	postBlank := 0
+	if m.indent == -1 {
+		postBlank = 1 + m.postBlank
+	}
+	totalBlank := m.preBlank + postBlank
+	s.penalty += totalBlankWeight * totalBlank
+	s.penalty += postBlankWeight * postBlank
+
+	indent := m.indent
+	if indent == -1 {
+		indent = m.postIndent
+	}
+	anyBlanks := totalBlank != 0
+	s.effectiveIndent += indent
+
+	pick := func(withBlank, without int) int {
+		if anyBlanks {
+			return withBlank
+		}
+		return without
+	}
+	switch {
+	case indent == -1, m.preIndent == -1, indent == m.preIndent:
+	case indent > m.preIndent:
+		s.penalty += pick(relativeIndentWithBlankPenalty, relativeIndentPenalty)
+	case m.postIndent != -1 && m.postIndent > indent:
+		s.penalty += pick(relativeOutdentWithBlankPenalty, relativeOutdentPenalty)
+	default:
+		s.penalty += pick(relativeDedentWithBlankPenalty, relativeDedentPenalty)
+	}
+}
+
+// compare orders scores, better splits first.
+func (s splitScore) compare(other splitScore) int {
+	cmpIndents := 0
+	switch {
+	case s.effectiveIndent > other.effectiveIndent:
+		cmpIndents = 1
+	case s.effectiveIndent < other.effectiveIndent:
+		cmpIndents = -1
+	}
+	return indentWeight*cmpIndents + s.penalty - other.penalty
+}
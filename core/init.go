@@ -23,6 +23,7 @@ func InitRepo(path string, initialBranch string) error {
 	dirs := []string{
 		"objects",
 		"refs/heads",
+		"refs/tags",
 	}
 
 	for _, d := range dirs {
@@ -44,3 +45,15 @@ func InitRepo(path string, initialBranch string) error {
 
 	return nil
 }
+
+// InitRepoWithRefFormat initializes a repository whose refs are kept in the
+// given ref storage format ("files" or "reftable").
+func InitRepoWithRefFormat(path, initialBranch, refFormat string) error {
+	if err := InitRepo(path, initialBranch); err != nil {
+		return err
+	}
+	if refStorageFormat(path) == refFormat {
+		return nil
+	}
+	return MigrateRefStorage(path, refFormat)
+}
@@ -1,14 +1,9 @@
 package core
 
 import (
-	"bytes"
-	"compress/zlib"
-	"errors"
+	"container/heap"
 	"fmt"
-	"io"
-	"io/fs"
-	"os"
-	"path/filepath"
+	"sort"
 	"strings"
 )
 
@@ -25,107 +20,193 @@ type CommitInfo struct {
 }
 
 func Log(repoPath string) ([]CommitInfo, error) {
-	repoDir := filepath.Join(repoPath, RepoDirName)
-	if _, err := os.Stat(repoDir); errors.Is(err, fs.ErrNotExist) {
-		return nil, fmt.Errorf("repository not initialized")
-	}
-
-	currentHash, err := getCurrentCommitHash(repoDir)
+	walker, err := WalkRevisions(repoPath, nil, WalkOptions{})
 	if err != nil {
 		return nil, err
 	}
+	return collectCommits(walker)
+}
 
-	if currentHash == "" {
-		return nil, fmt.Errorf("no commits yet")
+// LogFrom lists the commits reachable from rev, which may be any revision
+// accepted by resolveCommitish, including tags.
+func LogFrom(repoPath, rev string) ([]CommitInfo, error) {
+	return LogRange(repoPath, []string{rev})
+}
+
+// LogRange lists the commits selected by a list of revision arguments as
+// understood by ParseRevisionArgs, e.g. "main..feature" or "A...B".
+func LogRange(repoPath string, args []string) ([]CommitInfo, error) {
+	walker, err := WalkRevisions(repoPath, args, WalkOptions{})
+	if err != nil {
+		return nil, err
 	}
+	return collectCommits(walker)
+}
 
+// collectCommits drains a walker into a slice.
+func collectCommits(walker *RevWalker) ([]CommitInfo, error) {
 	var commits []CommitInfo
-	visited := make(map[string]bool)
+	for walker.Next() {
+		commits = append(commits, walker.Commit())
+	}
+	return commits, walker.Err()
+}
 
-	err = walkCommits(currentHash, &commits, visited)
+// readCommit reads and parses a commit object stored in repoPath.
+func readCommit(repoPath, hash string) (CommitInfo, error) {
+	objectType, content, err := readObjectWithType(repoPath, hash)
 	if err != nil {
-		return nil, err
+		return CommitInfo{}, fmt.Errorf("error reading commit object %s: %w", hash, err)
+	}
+	if objectType != "commit" {
+		return CommitInfo{}, fmt.Errorf("object %s is a %s, not a commit", hash, objectType)
 	}
-	return commits, nil
-}
 
-func getCurrentCommitHash(repoDir string) (string, error) {
-	headPath := filepath.Join(repoDir, "HEAD")
-	headContent, err := os.ReadFile(headPath)
+	commit, err := parseCommitContent(string(content))
 	if err != nil {
-		return "", fmt.Errorf("failed to read HEAD: %w", err)
+		return CommitInfo{}, err
 	}
-	headStr := strings.TrimSpace(string(headContent))
+	commit.Hash = hash
+	return commit, nil
+}
 
-	if strings.HasPrefix(headStr, "ref: ") {
-		refPath := strings.TrimPrefix(headStr, "ref: ")
-		refFullPath := filepath.Join(repoDir, refPath)
+// reachableCommits returns the set of commits reachable from any of starts.
+func reachableCommits(repoPath string, starts ...string) (map[string]bool, error) {
+	seen := make(map[string]bool)
+	queue := append([]string(nil), starts...)
 
-		refContent, err := os.ReadFile(refFullPath)
+	for len(queue) > 0 {
+		hash := queue[0]
+		queue = queue[1:]
+		if hash == "" || seen[hash] {
+			continue
+		}
+		seen[hash] = true
 
+		commit, err := readCommit(repoPath, hash)
 		if err != nil {
-			return "", fmt.Errorf("failed to read ref: %w", err)
+			return nil, err
 		}
-
-		return strings.TrimSpace(string(refContent)), nil
+		queue = append(queue, commit.Parents...)
 	}
-
-	return headStr, nil
+	return seen, nil
 }
 
-func walkCommits(hash string, commits *[]CommitInfo, visited map[string]bool) error {
-	if hash == "" || visited[hash] {
+// aheadBehind counts the commits reachable from a but not from b (ahead)
+// and from b but not from a (behind). Both sides are walked together,
+// newest first, each commit carrying which of them reach it, and the walk
+// stops once only commits they share are left.
+func aheadBehind(repoPath, a, b string) (ahead, behind int, err error) {
+	const fromA, fromB = 1, 2
+	flags := make(map[string]int)
+	queue := &commitQueue{key: committerTime}
+	mark := func(hash string, flag int) error {
+		if hash == "" || flags[hash]|flag == flags[hash] {
+			return nil
+		}
+		flags[hash] |= flag
+		commit, err := readCommit(repoPath, hash)
+		if err != nil {
+			return err
+		}
+		heap.Push(queue, commit)
 		return nil
 	}
-
-	visited[hash] = true
-
-	commitInfo, err := readCommitObject(hash)
-	if err != nil {
-		return err
+	onlyShared := func() bool {
+		for _, item := range queue.items {
+			if flags[item.commit.Hash] != fromA|fromB {
+				return false
+			}
+		}
+		return true
 	}
 
-	commitInfo.Hash = hash
-	*commits = append(*commits, commitInfo)
+	if err := mark(a, fromA); err != nil {
+		return 0, 0, err
+	}
+	if err := mark(b, fromB); err != nil {
+		return 0, 0, err
+	}
+	slop := walkSlop
+	for queue.Len() > 0 {
+		if !onlyShared() {
+			slop = walkSlop
+		} else if slop--; slop < 0 {
+			break
+		}
+		commit := heap.Pop(queue).(CommitInfo)
+		for _, parent := range commit.Parents {
+			if err := mark(parent, flags[commit.Hash]); err != nil {
+				return 0, 0, err
+			}
+		}
+	}
 
-	for _, parent := range commitInfo.Parents {
-		err := walkCommits(parent, commits, visited)
-		if err != nil {
-			return err
+	for _, flag := range flags {
+		switch flag {
+		case fromA:
+			ahead++
+		case fromB:
+			behind++
 		}
 	}
-	return err
+	return ahead, behind, nil
 }
 
-func readCommitObject(hash string) (CommitInfo, error) {
-	objectDir := filepath.Join(RepoDirName, "objects", hash[:2])
-	objectPath := filepath.Join(objectDir, hash[2:])
-
-	file, err := os.Open(objectPath)
+// mergeBases returns the best common ancestors of a and b: the commits
+// reachable from both that aren't ancestors of another common commit.
+func mergeBases(repoPath, a, b string) ([]string, error) {
+	fromA, err := reachableCommits(repoPath, a)
 	if err != nil {
-		return CommitInfo{}, fmt.Errorf("error reading commit object: %w", err)
+		return nil, err
 	}
-	defer file.Close()
-
-	r, err := zlib.NewReader(file)
+	fromB, err := reachableCommits(repoPath, b)
 	if err != nil {
-		return CommitInfo{}, fmt.Errorf("error decompressing object: %w", err)
+		return nil, err
 	}
-	defer r.Close()
 
-	data, err := io.ReadAll(r)
+	var common, parents []string
+	for hash := range fromA {
+		if !fromB[hash] {
+			continue
+		}
+		common = append(common, hash)
+		commit, err := readCommit(repoPath, hash)
+		if err != nil {
+			return nil, err
+		}
+		parents = append(parents, commit.Parents...)
+	}
+
+	dominated, err := reachableCommits(repoPath, parents...)
 	if err != nil {
-		return CommitInfo{}, fmt.Errorf("error reading decompressed object: %w", err)
+		return nil, err
 	}
+	var bases []string
+	for _, hash := range common {
+		if !dominated[hash] {
+			bases = append(bases, hash)
+		}
+	}
+	sort.Strings(bases)
+	return bases, nil
+}
 
-	sepIndex := bytes.IndexByte(data, 0)
-	if sepIndex < 0 {
-		return CommitInfo{}, fmt.Errorf("invalid object format")
+func isAncestor(repoPath, ancestor, descendant string) (bool, error) {
+	reachable, err := reachableCommits(repoPath, descendant)
+	if err != nil {
+		return false, err
 	}
+	return reachable[ancestor], nil
+}
 
-	content := string(data[sepIndex+1:])
+func (c CommitInfo) Subject() string {
+	subject, _, _ := strings.Cut(c.Message, "\n")
+	return subject
+}
 
-	return parseCommitContent(content)
+func (c CommitInfo) authorSignature() string {
+	return fmt.Sprintf("%s <%s> %d %s", c.Author, c.Email, c.Timestamp, c.Timezone)
 }
 
 func parseCommitContent(content string) (CommitInfo, error) {
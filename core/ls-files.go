@@ -0,0 +1,133 @@
+package core
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+type LsFilesOptions struct {
+	// Cached lists the paths in the index. It is the default when nothing
+	// else is asked for.
+	Cached bool
+	// Stage lists index entries as "<mode> <hash> <stage>\t<path>", which
+	// shows each version of an unmerged path.
+	Stage bool
+	// Modified lists tracked paths whose working tree file differs from
+	// the index, including deleted ones, and Deleted those whose file is
+	// gone.
+	Modified bool
+	Deleted  bool
+	// Others lists the untracked files in the working tree, leaving out
+	// those .gitignore excludes when ExcludeStandard is set.
+	Others          bool
+	ExcludeStandard bool
+}
+
+// LsFiles lists the files in the index and the working tree the way git
+// ls-files does: untracked files first, then for each index entry in turn
+// whether it is cached, deleted or modified, so a path may appear more than
+// once. Paths limit the listing to the files they name or contain.
+func LsFiles(repoPath string, out io.Writer, paths []string, opts LsFilesOptions) error {
+	paths = append([]string(nil), paths...)
+	for i, path := range paths {
+		paths[i] = cleanPathspec(path)
+	}
+	if !opts.Stage && !opts.Modified && !opts.Deleted && !opts.Others {
+		opts.Cached = true
+	}
+
+	entries, err := readIndexEntries(repoPath)
+	if err != nil {
+		return err
+	}
+
+	if opts.Others {
+		others, err := untrackedFiles(repoPath, entries, opts.ExcludeStandard)
+		if err != nil {
+			return err
+		}
+		for _, path := range others {
+			if inPathspec(path, paths) {
+				fmt.Fprintln(out, path)
+			}
+		}
+	}
+
+	write := func(entry IndexEntry) {
+		if opts.Stage {
+			fmt.Fprintf(out, "%s %s %d\t%s\n", fullMode(entry.Mode), entry.Hash, entry.Stage, entry.Path)
+		} else {
+			fmt.Fprintln(out, entry.Path)
+		}
+	}
+	for _, entry := range entries {
+		if !inPathspec(entry.Path, paths) {
+			continue
+		}
+		if opts.Cached || opts.Stage {
+			write(entry)
+		}
+		if !opts.Modified && !opts.Deleted {
+			continue
+		}
+		hash, exists, err := worktreeFileHash(repoPath, entry.Path)
+		if err != nil {
+			return err
+		}
+		if !exists && opts.Deleted {
+			write(entry)
+		}
+		if (!exists || hash != entry.Hash) && opts.Modified {
+			write(entry)
+		}
+	}
+	return nil
+}
+
+// untrackedFiles returns the files in the working tree that have no index
+// entry, sorted, skipping those .gitignore excludes when excludeStandard
+// is set.
+func untrackedFiles(repoPath string, entries []IndexEntry, excludeStandard bool) ([]string, error) {
+	tracked := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		tracked[entry.Path] = true
+	}
+	var ig *IgnoreMatcher
+	if excludeStandard {
+		var err error
+		if ig, err = LoadIgnore(repoPath); err != nil {
+			return nil, err
+		}
+	}
+
+	var files []string
+	err := filepath.Walk(repoPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		relPath, _ := filepath.Rel(repoPath, path)
+		if relPath == "." {
+			return nil
+		}
+		if info.IsDir() {
+			if info.Name() == RepoDirName || ig != nil && ig.Ignored(relPath, true) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		relPath = filepath.ToSlash(relPath)
+		if tracked[relPath] || ig != nil && ig.Ignored(relPath, false) {
+			return nil
+		}
+		files = append(files, relPath)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	return files, nil
+}
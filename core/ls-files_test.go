@@ -0,0 +1,64 @@
+package core
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+func TestLsFiles(t *testing.T) {
+	repo := setupTestRepo(t)
+	commitFile(t, repo, "a.txt", "a\n", "a")
+	commitFile(t, repo, "b.txt", "b\n", "b")
+	commitFile(t, repo, "dir/c.txt", "c\n", "c")
+	commitFile(t, repo, GitIgnoreFile, "*.log\n", "ignore")
+
+	if err := os.WriteFile("a.txt", []byte("changed\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove("b.txt"); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"new.txt", "debug.log"} {
+		if err := os.WriteFile(name, []byte("x\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	a, _ := ResolveRevision(repo, ":a.txt")
+
+	tests := []struct {
+		name  string
+		paths []string
+		opts  LsFilesOptions
+		want  string
+	}{
+		{"cached", nil, LsFilesOptions{}, ".gitignore\na.txt\nb.txt\ndir/c.txt\n"},
+		{"modified", nil, LsFilesOptions{Modified: true}, "a.txt\nb.txt\n"},
+		{"deleted", nil, LsFilesOptions{Deleted: true}, "b.txt\n"},
+		{"modified and deleted", nil, LsFilesOptions{Modified: true, Deleted: true}, "a.txt\nb.txt\nb.txt\n"},
+		{"others", nil, LsFilesOptions{Others: true}, "debug.log\nnew.txt\n"},
+		{"others excluding ignored", nil, LsFilesOptions{Others: true, ExcludeStandard: true}, "new.txt\n"},
+		{"stage", []string{"a.txt"}, LsFilesOptions{Stage: true}, "100644 " + a + " 0\ta.txt\n"},
+		{"path", []string{"dir"}, LsFilesOptions{}, "dir/c.txt\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			if err := LsFiles(repo, &out, tt.paths, tt.opts); err != nil {
+				t.Fatal(err)
+			}
+			if out.String() != tt.want {
+				t.Errorf("got:\n%s\nwant:\n%s", out.String(), tt.want)
+			}
+		})
+	}
+
+	paths := []string{"./dir/"}
+	var out bytes.Buffer
+	if err := LsFiles(repo, &out, paths, LsFilesOptions{}); err != nil || out.String() != "dir/c.txt\n" {
+		t.Errorf("expected dir/c.txt, got %q (%v)", out.String(), err)
+	}
+	if paths[0] != "./dir/" {
+		t.Errorf("the caller's paths should be left alone, got %q", paths[0])
+	}
+}
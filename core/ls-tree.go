@@ -0,0 +1,115 @@
+package core
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+type LsTreeOptions struct {
+	// Recursive lists the entries of subtrees instead of the subtrees.
+	Recursive bool
+	// ShowTrees lists subtrees as well when recursing into them, for -r or
+	// to reach a path.
+	ShowTrees bool
+	// Long adds the size of each blob.
+	Long bool
+	// NameOnly lists only the path of each entry.
+	NameOnly bool
+}
+
+// LsTree lists the entries of a tree-ish the way git ls-tree does, as
+// "<mode> <type> <hash>\t<path>" lines. Paths limit the listing to the
+// entries they name: "dir" names the tree itself and "dir/" its entries,
+// and the trees leading to a deeper path are entered without being
+// listed.
+func LsTree(repoPath string, out io.Writer, treeish string, paths []string, opts LsTreeOptions) error {
+	hash, err := resolveObjectName(repoPath, treeish)
+	if err != nil {
+		return err
+	}
+	tree, err := peelObject(repoPath, hash, "tree", treeish)
+	if err != nil {
+		return err
+	}
+	return lsTree(repoPath, out, tree, "", paths, opts)
+}
+
+func lsTree(repoPath string, out io.Writer, tree, prefix string, paths []string, opts LsTreeOptions) error {
+	entries, err := readTreeEntries(repoPath, tree)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		path := prefix + entry.Name
+		isTree := isTreeMode(entry.Mode)
+
+		switch {
+		case len(paths) == 0 || lsTreeMatches(path, paths):
+			if !isTree || !opts.Recursive {
+				if err := writeLsTreeEntry(repoPath, out, entry, path, opts); err != nil {
+					return err
+				}
+				continue
+			}
+		case isTree && lsTreeLeadsTo(path, paths):
+		default:
+			continue
+		}
+
+		if opts.ShowTrees {
+			if err := writeLsTreeEntry(repoPath, out, entry, path, opts); err != nil {
+				return err
+			}
+		}
+		if err := lsTree(repoPath, out, entry.Hash, path+"/", paths, opts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lsTreeMatches reports whether path is named by one of paths, or is
+// inside a directory one of them names.
+func lsTreeMatches(path string, paths []string) bool {
+	for _, p := range paths {
+		if path == p || strings.HasPrefix(path, strings.TrimSuffix(p, "/")+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// lsTreeLeadsTo reports whether one of paths is inside the tree at path.
+func lsTreeLeadsTo(path string, paths []string) bool {
+	for _, p := range paths {
+		if strings.HasPrefix(p, path+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func writeLsTreeEntry(repoPath string, out io.Writer, entry TreeEntry, path string, opts LsTreeOptions) error {
+	if opts.NameOnly {
+		_, err := fmt.Fprintln(out, path)
+		return err
+	}
+
+	objectType := treeEntryType(entry.Mode)
+	if !opts.Long {
+		_, err := fmt.Fprintf(out, "%s %s %s\t%s\n", fullMode(entry.Mode), objectType, entry.Hash, path)
+		return err
+	}
+
+	size := "-"
+	if objectType == "blob" {
+		content, err := readObject(repoPath, entry.Hash)
+		if err != nil {
+			return err
+		}
+		size = fmt.Sprint(len(content))
+	}
+	_, err := fmt.Fprintf(out, "%s %s %s %7s\t%s\n", fullMode(entry.Mode), objectType, entry.Hash, size, path)
+	return err
+}
@@ -0,0 +1,83 @@
+package core
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestLsTree(t *testing.T) {
+	repo := setupTestRepo(t)
+	tree := writeTestTree(t, map[string]string{
+		"README":        "readme\n",
+		"cmd/main.go":   "package main\n",
+		"cmd/util/x.go": "package util\n",
+	})
+	readme, _ := ResolveRevision(repo, tree+":README")
+	cmd, _ := ResolveRevision(repo, tree+":cmd")
+	main, _ := ResolveRevision(repo, tree+":cmd/main.go")
+	util, _ := ResolveRevision(repo, tree+":cmd/util")
+	x, _ := ResolveRevision(repo, tree+":cmd/util/x.go")
+
+	tests := []struct {
+		name  string
+		paths []string
+		opts  LsTreeOptions
+		want  string
+	}{
+		{"top level", nil, LsTreeOptions{}, "100644 blob " + readme + "\tREADME\n040000 tree " + cmd + "\tcmd\n"},
+		{"recursive", nil, LsTreeOptions{Recursive: true, NameOnly: true}, "README\ncmd/main.go\ncmd/util/x.go\n"},
+		{"recursive with trees", nil, LsTreeOptions{Recursive: true, ShowTrees: true, NameOnly: true}, "README\ncmd\ncmd/main.go\ncmd/util\ncmd/util/x.go\n"},
+		{"long", []string{"README", "cmd"}, LsTreeOptions{Long: true}, "100644 blob " + readme + "       7\tREADME\n040000 tree " + cmd + "       -\tcmd\n"},
+		{"tree itself", []string{"cmd"}, LsTreeOptions{}, "040000 tree " + cmd + "\tcmd\n"},
+		{"tree contents", []string{"cmd/"}, LsTreeOptions{}, "100644 blob " + main + "\tcmd/main.go\n040000 tree " + util + "\tcmd/util\n"},
+		{"deep path", []string{"cmd/util/x.go"}, LsTreeOptions{}, "100644 blob " + x + "\tcmd/util/x.go\n"},
+		{"deep path with trees", []string{"cmd/util/x.go"}, LsTreeOptions{ShowTrees: true, NameOnly: true}, "cmd\ncmd/util\ncmd/util/x.go\n"},
+		{"missing path", []string{"nope"}, LsTreeOptions{}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			if err := LsTree(repo, &out, tree, tt.paths, tt.opts); err != nil {
+				t.Fatal(err)
+			}
+			if out.String() != tt.want {
+				t.Errorf("got:\n%s\nwant:\n%s", out.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestMktree(t *testing.T) {
+	repo := setupTestRepo(t)
+	tree := writeTestTree(t, map[string]string{"a": "a\n", "b/c": "c\n"})
+
+	var listing bytes.Buffer
+	if err := LsTree(repo, &listing, tree, nil, LsTreeOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the order of the input doesn't matter
+	lines := strings.SplitAfter(strings.TrimSuffix(listing.String(), "\n"), "\n")
+	reversed := lines[1] + "\n" + lines[0]
+	got, err := Mktree(repo, strings.NewReader(reversed), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != tree {
+		t.Errorf("Mktree() = %s, want %s", got, tree)
+	}
+
+	missing := "100644 blob " + strings.Repeat("1", 40) + "\tghost\n"
+	if _, err := Mktree(repo, strings.NewReader(missing), false); err == nil {
+		t.Error("expected an error for a missing object")
+	}
+	if _, err := Mktree(repo, strings.NewReader(missing), true); err != nil {
+		t.Errorf("a missing object should be allowed with allowMissing: %v", err)
+	}
+
+	wrongType := strings.Replace(lines[0], "blob", "tree", 1)
+	if _, err := Mktree(repo, strings.NewReader(wrongType), false); err == nil {
+		t.Error("expected an error for a type that doesn't match the mode")
+	}
+}
@@ -0,0 +1,110 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// mailmap maps the names and emails commits were recorded with to the
+// canonical ones, keyed by the lowercased commit email.
+type mailmap map[string]*mailmapEntry
+
+// mailmapEntry holds the replacements for one commit email: those that
+// apply whatever the commit name, and those for particular names, keyed by
+// the lowercased name. An empty field leaves that part alone.
+type mailmapEntry struct {
+	name, email string
+	names       map[string]*mailmapEntry
+}
+
+// loadMailmap reads the .mailmap file at the top of the worktree. Its lines
+// take one of the forms
+//
+//	Proper Name <commit@email>
+//	<proper@email> <commit@email>
+//	Proper Name <proper@email> <commit@email>
+//	Proper Name <proper@email> Commit Name <commit@email>
+//
+// and later lines override earlier ones.
+func loadMailmap(repoPath string) (mailmap, error) {
+	data, err := os.ReadFile(filepath.Join(repoPath, MailmapFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	m := make(mailmap)
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, email, rest, ok := parseMailmapAddress(line)
+		if !ok {
+			continue
+		}
+		if oldName, oldEmail, _, ok := parseMailmapAddress(rest); ok {
+			m.add(name, email, oldName, oldEmail)
+		} else {
+			m.add(name, "", "", email)
+		}
+	}
+	return m, nil
+}
+
+// parseMailmapAddress splits "Name <email>" off the start of s, returning
+// what follows it. The name may be empty.
+func parseMailmapAddress(s string) (name, email, rest string, ok bool) {
+	name, after, found := strings.Cut(s, "<")
+	if !found {
+		return "", "", "", false
+	}
+	email, rest, found = strings.Cut(after, ">")
+	if !found {
+		return "", "", "", false
+	}
+	return strings.TrimSpace(name), email, rest, true
+}
+
+func (m mailmap) add(name, email, oldName, oldEmail string) {
+	key := strings.ToLower(oldEmail)
+	entry := m[key]
+	if entry == nil {
+		entry = &mailmapEntry{names: make(map[string]*mailmapEntry)}
+		m[key] = entry
+	}
+	if oldName != "" {
+		nameKey := strings.ToLower(oldName)
+		if entry.names[nameKey] == nil {
+			entry.names[nameKey] = &mailmapEntry{}
+		}
+		entry = entry.names[nameKey]
+	}
+	if name != "" {
+		entry.name = name
+	}
+	if email != "" {
+		entry.email = email
+	}
+}
+
+// lookup returns the canonical name and email for those a commit was
+// recorded with. Emails and names match regardless of case.
+func (m mailmap) lookup(name, email string) (string, string) {
+	entry := m[strings.ToLower(email)]
+	if entry == nil {
+		return name, email
+	}
+	if named := entry.names[strings.ToLower(name)]; named != nil {
+		entry = named
+	}
+	if entry.name != "" {
+		name = entry.name
+	}
+	if entry.email != "" {
+		email = entry.email
+	}
+	return name, email
+}
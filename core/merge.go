@@ -0,0 +1,101 @@
+package core
+
+import (
+	"fmt"
+	"sort"
+)
+
+type TreeMergeResult struct {
+	// Tree holds the merged path -> blob mapping. Conflicted paths map to a
+	// blob containing the conflict markers so they can be written out.
+	Tree      map[string]string
+	Conflicts []string
+}
+
+func mergeTrees(repoPath string, base, ours, theirs map[string]string, oursLabel, theirsLabel string) (*TreeMergeResult, error) {
+	result := &TreeMergeResult{Tree: make(map[string]string)}
+
+	paths := make(map[string]bool)
+	for _, tree := range []map[string]string{base, ours, theirs} {
+		for path := range tree {
+			paths[path] = true
+		}
+	}
+
+	for path := range paths {
+		b, inBase := base[path]
+		o, inOurs := ours[path]
+		t, inTheirs := theirs[path]
+
+		switch {
+		case inOurs == inTheirs && o == t:
+			if inOurs {
+				result.Tree[path] = o
+			}
+		case inBase == inOurs && b == o:
+			if inTheirs {
+				result.Tree[path] = t
+			}
+		case inBase == inTheirs && b == t:
+			if inOurs {
+				result.Tree[path] = o
+			}
+		case !inOurs || !inTheirs:
+			// modify/delete: keep the surviving version in the working tree
+			result.Conflicts = append(result.Conflicts, path)
+			if inOurs {
+				result.Tree[path] = o
+			} else {
+				result.Tree[path] = t
+			}
+		default:
+			var baseContent []byte
+			if inBase {
+				content, err := readObject(repoPath, b)
+				if err != nil {
+					return nil, fmt.Errorf("failed to read base version of %s: %w", path, err)
+				}
+				baseContent = content
+			}
+			oursContent, err := readObject(repoPath, o)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read our version of %s: %w", path, err)
+			}
+			theirsContent, err := readObject(repoPath, t)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read their version of %s: %w", path, err)
+			}
+
+			merged, conflict := mergeFileContents(baseContent, oursContent, theirsContent, oursLabel, theirsLabel)
+			hash, err := HashObject(merged, "blob", true)
+			if err != nil {
+				return nil, fmt.Errorf("failed to write merged %s: %w", path, err)
+			}
+			result.Tree[path] = hash
+			if conflict {
+				result.Conflicts = append(result.Conflicts, path)
+			}
+		}
+	}
+
+	sort.Strings(result.Conflicts)
+	return result, nil
+}
+
+// stagedTree returns the tree that should be recorded in the index after a
+// merge: clean paths take the merged result, conflicted paths keep our
+// version until the user resolves and re-adds them.
+func (r *TreeMergeResult) stagedTree(ours map[string]string) map[string]string {
+	staged := make(map[string]string, len(r.Tree))
+	for path, hash := range r.Tree {
+		staged[path] = hash
+	}
+	for _, path := range r.Conflicts {
+		if hash, ok := ours[path]; ok {
+			staged[path] = hash
+		} else {
+			delete(staged, path)
+		}
+	}
+	return staged
+}
@@ -0,0 +1,90 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Mktree builds a tree object from lines in the format ls-tree writes,
+// "<mode> <type> <hash>\t<name>", and returns its hash. The entries may
+// come in any order. Unless allowMissing is set, the objects they name
+// must exist and have the type their line gives; submodule commits are
+// never checked.
+func Mktree(repoPath string, in io.Reader, allowMissing bool) (string, error) {
+	var entries []TreeEntry
+	seen := make(map[string]bool)
+
+	scanner := bufio.NewScanner(in)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+		info, name, ok := strings.Cut(line, "\t")
+		fields := strings.Fields(info)
+		if !ok || len(fields) != 3 {
+			return "", fmt.Errorf("input format error: %s", line)
+		}
+		mode, objectType, hash := strings.TrimLeft(fields[0], "0"), fields[1], strings.ToLower(fields[2])
+
+		if name == "" || strings.Contains(name, "/") {
+			return "", fmt.Errorf("invalid entry name '%s'", name)
+		}
+		if seen[name] {
+			return "", fmt.Errorf("duplicate entry '%s'", name)
+		}
+		seen[name] = true
+		if len(hash) != 2*HashSize || !isHexString(hash) {
+			return "", fmt.Errorf("input format error: %s", line)
+		}
+		switch mode {
+		case "100644", "100755", "120000", "40000", "160000":
+		default:
+			return "", fmt.Errorf("invalid mode '%s' for '%s'", fields[0], name)
+		}
+		if want := treeEntryType(mode); objectType != want {
+			return "", fmt.Errorf("entry '%s' object type (%s) doesn't match mode type (%s)", name, objectType, want)
+		}
+
+		if mode != "160000" && !allowMissing {
+			actual, _, err := readObjectWithType(repoPath, hash)
+			if err != nil {
+				return "", fmt.Errorf("entry '%s' object %s is unavailable", name, hash)
+			}
+			if actual != objectType {
+				return "", fmt.Errorf("entry '%s' object %s is a %s but specified type was (%s)", name, hash, actual, objectType)
+			}
+		}
+		entries = append(entries, TreeEntry{Mode: mode, Name: name, Hash: hash})
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+
+	// git orders tree entries as if the names of subtrees ended in "/"
+	sortKey := func(entry TreeEntry) string {
+		if isTreeMode(entry.Mode) {
+			return entry.Name + "/"
+		}
+		return entry.Name
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return sortKey(entries[i]) < sortKey(entries[j])
+	})
+
+	var buf bytes.Buffer
+	for _, entry := range entries {
+		raw, err := hex.DecodeString(entry.Hash)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&buf, "%s %s\x00", entry.Mode, entry.Name)
+		buf.Write(raw)
+	}
+	return HashObject(buf.Bytes(), "tree", true)
+}
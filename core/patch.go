@@ -0,0 +1,280 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+)
+
+// patchContext is the number of unchanged lines shown around changes.
+const patchContext = 3
+
+// DiffFormat selects how log and show present the changes of a commit.
+type DiffFormat struct {
+	// Patch shows the changes as unified diffs.
+	Patch bool
+	// Stat shows a diffstat: a line per file with the number of lines it
+	// changed, and a summary.
+	Stat bool
+	// NameOnly lists the names of the changed files, and NameStatus adds
+	// a letter saying how each one changed.
+	NameOnly   bool
+	NameStatus bool
+}
+
+// IsZero reports whether f shows nothing at all.
+func (f DiffFormat) IsZero() bool {
+	return f == DiffFormat{}
+}
+
+// effective drops what the name listings leave out: with either one, git
+// shows neither a diffstat nor a patch.
+func (f DiffFormat) effective() DiffFormat {
+	if f.NameOnly || f.NameStatus {
+		f.Stat, f.Patch = false, false
+	}
+	return f
+}
+
+// FormatDiff renders changes as format asks, in the order git uses: the
+// names, the diffstat, and after a blank line the patch. width is the
+// number of columns the diffstat may use. Listing names leaves out the
+// diffstat and the patch.
+func FormatDiff(repoPath string, changes []FileChange, format DiffFormat, width int) (string, error) {
+	var sb strings.Builder
+	if len(changes) == 0 {
+		return "", nil
+	}
+	format = format.effective()
+
+	if format.NameOnly || format.NameStatus {
+		for _, change := range changes {
+			switch {
+			case format.NameOnly:
+				sb.WriteString(change.Path + "\n")
+			case change.Status == 'R':
+				fmt.Fprintf(&sb, "R%03d\t%s\t%s\n", change.Score, change.OldPath, change.Path)
+			default:
+				fmt.Fprintf(&sb, "%c\t%s\n", change.Status, change.Path)
+			}
+		}
+	}
+
+	if format.Stat {
+		stats := make([]FileDiffStat, len(changes))
+		for i, change := range changes {
+			stat, err := fileDiffStat(repoPath, change.Path, change.OldHash, change.Hash)
+			if err != nil {
+				return "", err
+			}
+			stat.OldPath = change.OldPath
+			stats[i] = stat
+		}
+		sb.WriteString(formatDiffStat(stats, width))
+	}
+
+	if format.Patch {
+		if sb.Len() > 0 {
+			sb.WriteString("\n")
+		}
+		for _, change := range changes {
+			if change.Status == 'T' {
+				// git can't diff a file against a symlink, so it shows
+				// one going away and the other appearing
+				deleted, added := change, change
+				deleted.Status, deleted.Mode, deleted.Hash = 'D', "", ""
+				added.Status, added.OldMode, added.OldHash = 'A', "", ""
+				if err := writePatch(&sb, repoPath, deleted); err != nil {
+					return "", err
+				}
+				if err := writePatch(&sb, repoPath, added); err != nil {
+					return "", err
+				}
+				continue
+			}
+			if err := writePatch(&sb, repoPath, change); err != nil {
+				return "", err
+			}
+		}
+	}
+	return sb.String(), nil
+}
+
+// writePatch writes the "diff --git" header of a change, the lines that
+// describe how its mode and name changed, and its hunks.
+func writePatch(sb *strings.Builder, repoPath string, change FileChange) error {
+	fmt.Fprintf(sb, "diff --git a/%s b/%s\n", change.OldPath, change.Path)
+	switch change.Status {
+	case 'A':
+		fmt.Fprintf(sb, "new file mode %s\n", fullMode(change.Mode))
+	case 'D':
+		fmt.Fprintf(sb, "deleted file mode %s\n", fullMode(change.OldMode))
+	default:
+		if change.OldMode != change.Mode {
+			fmt.Fprintf(sb, "old mode %s\nnew mode %s\n", fullMode(change.OldMode), fullMode(change.Mode))
+		}
+	}
+	if change.Status == 'R' {
+		fmt.Fprintf(sb, "similarity index %d%%\nrename from %s\nrename to %s\n", change.Score, change.OldPath, change.Path)
+	}
+	if change.OldHash == change.Hash {
+		return nil
+	}
+	fmt.Fprintf(sb, "index %s..%s", abbrevBlob(change.OldHash), abbrevBlob(change.Hash))
+	if change.OldMode == change.Mode {
+		fmt.Fprintf(sb, " %s", fullMode(change.Mode))
+	}
+	sb.WriteString("\n")
+
+	oldContent, err := patchContent(repoPath, change.OldMode, change.OldHash)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", change.OldPath, err)
+	}
+	newContent, err := patchContent(repoPath, change.Mode, change.Hash)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", change.Path, err)
+	}
+	oldLabel, newLabel := "a/"+change.OldPath, "b/"+change.Path
+	if change.OldHash == "" {
+		oldLabel = "/dev/null"
+	}
+	if change.Hash == "" {
+		newLabel = "/dev/null"
+	}
+	if isBinary(oldContent) || isBinary(newContent) {
+		fmt.Fprintf(sb, "Binary files %s and %s differ\n", oldLabel, newLabel)
+		return nil
+	}
+
+	oldLines, newLines := splitLines(oldContent), splitLines(newContent)
+	hunks := unifiedHunks(oldLines, newLines)
+	if len(hunks) == 0 {
+		return nil
+	}
+	fmt.Fprintf(sb, "--- %s\n+++ %s\n", oldLabel, newLabel)
+	for _, hunk := range hunks {
+		sb.WriteString(hunk)
+	}
+	return nil
+}
+
+// patchContent reads the content a patch compares for one side of a
+// change: nothing for a missing side, and a line naming the commit for a
+// submodule.
+func patchContent(repoPath, mode, hash string) ([]byte, error) {
+	switch {
+	case hash == "":
+		return nil, nil
+	case mode == "160000":
+		return []byte("Subproject commit " + hash + "\n"), nil
+	}
+	return readObject(repoPath, hash)
+}
+
+func fullMode(mode string) string {
+	return strings.Repeat("0", max(6-len(mode), 0)) + mode
+}
+
+// abbrevBlob abbreviates a blob hash for an index line, where a missing
+// side is shown as zeros.
+func abbrevBlob(hash string) string {
+	if hash == "" {
+		return "0000000"
+	}
+	return shortHash(hash)
+}
+
+// unifiedHunks renders the changes between two files as unified diff
+// hunks with patchContext lines of context. Changes whose contexts would
+// touch share a hunk. Each hunk header names the nearest line before it
+// that looks like the start of a function, as git does by default.
+func unifiedHunks(oldLines, newLines []string) []string {
+	changes := lineChanges(oldLines, newLines)
+	var hunks []string
+	funcLine, funcSearchEnd := "", -1
+	for i := 0; i < len(changes); {
+		j := i
+		for j+1 < len(changes) && changes[j+1].oldStart-(changes[j].oldStart+changes[j].oldCount) <= 2*patchContext {
+			j++
+		}
+		first, last := changes[i], changes[j]
+		oldStart := max(first.oldStart-patchContext, 0)
+		newStart := max(first.newStart-patchContext, 0)
+		trailing := min(patchContext, len(oldLines)-(last.oldStart+last.oldCount), len(newLines)-(last.newStart+last.newCount))
+		oldEnd := last.oldStart + last.oldCount + trailing
+		newEnd := last.newStart + last.newCount + trailing
+
+		// Look back for a function line, but only as far as the previous
+		// hunk, whose function still applies when none is found.
+		for l := oldStart - 1; l > funcSearchEnd; l-- {
+			if name, ok := funcName(oldLines[l]); ok {
+				funcLine = name
+				break
+			}
+		}
+		funcSearchEnd = oldStart - 1
+
+		var sb strings.Builder
+		fmt.Fprintf(&sb, "@@ -%s +%s @@", hunkRange(oldStart, oldEnd-oldStart), hunkRange(newStart, newEnd-newStart))
+		if funcLine != "" {
+			sb.WriteString(" " + funcLine)
+		}
+		sb.WriteString("\n")
+
+		newPos := newStart
+		for _, change := range changes[i : j+1] {
+			for ; newPos < change.newStart; newPos++ {
+				writePatchLine(&sb, ' ', newLines[newPos])
+			}
+			for _, line := range oldLines[change.oldStart : change.oldStart+change.oldCount] {
+				writePatchLine(&sb, '-', line)
+			}
+			for _, line := range newLines[change.newStart : change.newStart+change.newCount] {
+				writePatchLine(&sb, '+', line)
+			}
+			newPos = change.newStart + change.newCount
+		}
+		for ; newPos < newEnd; newPos++ {
+			writePatchLine(&sb, ' ', newLines[newPos])
+		}
+		hunks = append(hunks, sb.String())
+		i = j + 1
+	}
+	return hunks
+}
+
+// hunkRange formats the start and length of one side of a hunk header: the
+// line before an empty range, and no length when it is one line.
+func hunkRange(start, count int) string {
+	switch count {
+	case 0:
+		return fmt.Sprintf("%d,0", start)
+	case 1:
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
+
+func writePatchLine(sb *strings.Builder, marker byte, line string) {
+	sb.WriteByte(marker)
+	sb.WriteString(line)
+	if !strings.HasSuffix(line, "\n") {
+		sb.WriteString("\n\\ No newline at end of file\n")
+	}
+}
+
+// funcName reports whether line looks like the start of a function the
+// way git's default rule sees it, starting with a letter, "_" or "$", and
+// returns it trimmed to what fits a hunk header.
+func funcName(line string) (string, bool) {
+	if line == "" || !isFuncNameStart(line[0]) {
+		return "", false
+	}
+	if len(line) > 80 {
+		line = line[:80]
+	}
+	return strings.TrimRight(line, " \t\n\r\f\v"), true
+}
+
+func isFuncNameStart(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || c == '_' || c == '$'
+}
@@ -0,0 +1,89 @@
+package core
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestUnifiedHunks(t *testing.T) {
+	old := "package main\n\nfunc one() {\n\ta := 1\n\tb := 2\n\tc := 3\n\td := 4\n\te := 5\n\tf := 6\n\treturn a + b + c\n}\n\nfunc two() {\n\treturn 2\n}\n"
+	updated := "package main\n\nfunc one() {\n\ta := 1\n\tb := 20\n\tc := 3\n\td := 4\n\te := 5\n\tf := 6\n\treturn a + b + c\n}\n\nfunc two() {\n\treturn 22\n}"
+
+	got := strings.Join(unifiedHunks(splitLines([]byte(old)), splitLines([]byte(updated))), "")
+	want := "@@ -2,7 +2,7 @@ package main\n" +
+		" \n" +
+		" func one() {\n" +
+		" \ta := 1\n" +
+		"-\tb := 2\n" +
+		"+\tb := 20\n" +
+		" \tc := 3\n" +
+		" \td := 4\n" +
+		" \te := 5\n" +
+		"@@ -11,5 +11,5 @@ func one() {\n" +
+		" }\n" +
+		" \n" +
+		" func two() {\n" +
+		"-\treturn 2\n" +
+		"-}\n" +
+		"+\treturn 22\n" +
+		"+}\n" +
+		"\\ No newline at end of file\n"
+	if got != want {
+		t.Errorf("unexpected hunks:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestLineChangesSlideLikeGit(t *testing.T) {
+	// The added block could go before or after either blank line; git
+	// puts it after the first block, where the indent heuristic sees the
+	// edges of a block.
+	old := splitLines([]byte("a\n}\n\nb\n}\n"))
+	updated := splitLines([]byte("a\n}\n\nx\n}\n\nb\n}\n"))
+
+	changes := lineChanges(old, updated)
+	if len(changes) != 1 {
+		t.Fatalf("expected one change, got %+v", changes)
+	}
+	if c := changes[0]; c.oldStart != 3 || c.oldCount != 0 || c.newStart != 3 || c.newCount != 3 {
+		t.Errorf("expected lines 4-6 to be added, got %+v", c)
+	}
+}
+
+func TestFormatDiff(t *testing.T) {
+	setupTestRepo(t)
+
+	lines := numberedLines("util", 10)
+	from := writeTestTree(t, map[string]string{"util.go": lines, "gone.txt": "bye\n"})
+	to := writeTestTree(t, map[string]string{"lib/util.go": lines + "more\n", "new.txt": "hi\n"})
+	changes, err := diffTrees(".", from, to, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changes, err = detectRenames(".", changes); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := FormatDiff(".", changes, DiffFormat{NameStatus: true, Patch: true}, 80)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "D\tgone.txt\nR096\tutil.go\tlib/util.go\nA\tnew.txt\n"; got != want {
+		t.Errorf("names replace the patch; got:\n%s\nwant:\n%s", got, want)
+	}
+
+	got, err = FormatDiff(".", changes, DiffFormat{Stat: true, Patch: true}, 80)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		" util.go => lib/util.go | 1 +\n",
+		" 3 files changed, 2 insertions(+), 1 deletion(-)\n\ndiff --git a/gone.txt b/gone.txt\ndeleted file mode 100644\n",
+		"diff --git a/util.go b/lib/util.go\nsimilarity index 96%\nrename from util.go\nrename to lib/util.go\n",
+		"@@ -8,3 +8,4 @@ util line 7\n util line 8\n util line 9\n util line 10\n+more\n",
+		"diff --git a/new.txt b/new.txt\nnew file mode 100644\nindex 0000000..45b983b\n--- /dev/null\n+++ b/new.txt\n@@ -0,0 +1 @@\n+hi\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected %q in:\n%s", want, got)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package core
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// pickaxe finds the file changes that add or remove what -S or -G look for.
+type pickaxe struct {
+	re *regexp.Regexp
+	// occurrences compares how often re matches each side of a change
+	// (-S), instead of matching it against the changed lines (-G)
+	occurrences bool
+	all         bool
+}
+
+// newPickaxe compiles the pickaxe WalkOptions ask for, or returns nil when
+// they ask for none.
+func newPickaxe(opts WalkOptions) (*pickaxe, error) {
+	if opts.PickaxeString != "" && opts.PickaxeRegex != "" {
+		return nil, fmt.Errorf("-G and -S cannot be used together")
+	}
+	var pattern string
+	p := &pickaxe{all: opts.PickaxeAll}
+	switch {
+	case opts.PickaxeString != "":
+		pattern, p.occurrences = regexp.QuoteMeta(opts.PickaxeString), true
+	case opts.PickaxeRegex != "":
+		pattern = opts.PickaxeRegex
+	default:
+		return nil, nil
+	}
+	if opts.IgnoreCase {
+		pattern = "(?i)" + pattern
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern '%s': %w", pattern, err)
+	}
+	p.re = re
+	return p, nil
+}
+
+// filter returns the changes that match, or all of them when any does and
+// the pickaxe was asked for all changes.
+func (p *pickaxe) filter(repoPath string, changes []FileChange) ([]FileChange, error) {
+	var matched []FileChange
+	for _, change := range changes {
+		if change.OldMode == "160000" || change.Mode == "160000" {
+			continue
+		}
+		var oldContent, newContent []byte
+		var err error
+		if change.OldHash != "" {
+			if oldContent, err = readObject(repoPath, change.OldHash); err != nil {
+				return nil, fmt.Errorf("failed to read %s: %w", change.OldPath, err)
+			}
+		}
+		if change.Hash != "" {
+			if newContent, err = readObject(repoPath, change.Hash); err != nil {
+				return nil, fmt.Errorf("failed to read %s: %w", change.Path, err)
+			}
+		}
+		if p.matches(oldContent, newContent) {
+			matched = append(matched, change)
+		}
+	}
+	if p.all && len(matched) > 0 {
+		return changes, nil
+	}
+	return matched, nil
+}
+
+// matches reports whether a change from oldContent to newContent is one the
+// pickaxe looks for. -G skips binary files, as their lines mean nothing.
+func (p *pickaxe) matches(oldContent, newContent []byte) bool {
+	if p.occurrences {
+		return len(p.re.FindAllIndex(oldContent, -1)) != len(p.re.FindAllIndex(newContent, -1))
+	}
+	if isBinary(oldContent) || isBinary(newContent) {
+		return false
+	}
+	oldLines, newLines := splitLines(oldContent), splitLines(newContent)
+	matchesAny := func(lines []string) bool {
+		for _, line := range lines {
+			if p.re.MatchString(strings.TrimSuffix(line, "\n")) {
+				return true
+			}
+		}
+		return false
+	}
+	for _, change := range lineChanges(oldLines, newLines) {
+		if matchesAny(oldLines[change.oldStart:change.oldStart+change.oldCount]) ||
+			matchesAny(newLines[change.newStart:change.newStart+change.newCount]) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,458 @@
+package core
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type PrettyOptions struct {
+	// Format is a preset, "format:" or "tformat:" string, or a bare tformat string.
+	Format string
+	// Date is a --date style for the dates the presets and %ad/%cd show.
+	Date string
+	// AbbrevCommit shortens the hash on the commit line of the presets.
+	AbbrevCommit bool
+	// Decorate shows the refs pointing at each commit on its commit line.
+	Decorate bool
+}
+
+// CommitFormatter renders commits the way log --pretty does.
+type CommitFormatter struct {
+	repoPath    string
+	opts        PrettyOptions
+	preset      string
+	format      string
+	separator   string
+	decorations map[string][]string
+	now         time.Time
+}
+
+var prettyPresets = map[string]bool{
+	"oneline": true, "short": true, "medium": true, "full": true, "fuller": true, "raw": true,
+}
+
+// NewCommitFormatter validates opts and loads ref decorations when needed.
+func NewCommitFormatter(repoPath string, opts PrettyOptions) (*CommitFormatter, error) {
+	f := &CommitFormatter{repoPath: repoPath, opts: opts, now: time.Now()}
+
+	switch format := opts.Format; {
+	case format == "":
+		f.preset = "medium"
+	case prettyPresets[format]:
+		f.preset = format
+	case strings.HasPrefix(format, "format:"):
+		f.format = strings.TrimPrefix(format, "format:")
+	case strings.HasPrefix(format, "tformat:"):
+		f.format = strings.TrimPrefix(format, "tformat:") + "\n"
+	case strings.Contains(format, "%"):
+		f.format = format + "\n"
+	default:
+		return nil, fmt.Errorf("invalid --pretty format: %s", format)
+	}
+	if f.preset != "" && f.preset != "oneline" || strings.HasPrefix(opts.Format, "format:") {
+		f.separator = "\n"
+	}
+	if _, err := FormatDate(0, "+0000", opts.Date, f.now); err != nil {
+		return nil, err
+	}
+
+	if opts.Decorate || strings.Contains(f.format, "%d") || strings.Contains(f.format, "%D") {
+		decorations, err := Decorations(repoPath)
+		if err != nil {
+			return nil, err
+		}
+		f.decorations = decorations
+	}
+	return f, nil
+}
+
+// Separator is written between entries of formats that don't end them with a newline.
+func (f *CommitFormatter) Separator() string {
+	return f.separator
+}
+
+// Format renders one commit.
+func (f *CommitFormatter) Format(commit CommitInfo) (string, error) {
+	if f.preset == "" {
+		return f.expand(f.format, commit)
+	}
+
+	hash := commit.Hash
+	if f.opts.AbbrevCommit {
+		hash = shortHash(hash)
+	}
+	decoration := ""
+	if f.opts.Decorate {
+		decoration = f.decoration(commit.Hash, " (", ")")
+	}
+
+	var sb strings.Builder
+	if f.preset == "oneline" {
+		fmt.Fprintf(&sb, "%s%s %s\n", hash, decoration, commit.Subject())
+		return sb.String(), nil
+	}
+
+	fmt.Fprintf(&sb, "commit %s%s\n", hash, decoration)
+	if f.preset == "raw" {
+		fmt.Fprintf(&sb, "tree %s\n", commit.Tree)
+		for _, parent := range commit.Parents {
+			fmt.Fprintf(&sb, "parent %s\n", parent)
+		}
+		fmt.Fprintf(&sb, "author %s\ncommitter %s\n", commit.authorSignature(), commit.Committer)
+		sb.WriteString("\n")
+		writeIndented(&sb, commit.Message)
+		return sb.String(), nil
+	}
+
+	if len(commit.Parents) > 1 {
+		parents := make([]string, len(commit.Parents))
+		for i, parent := range commit.Parents {
+			parents[i] = shortHash(parent)
+		}
+		fmt.Fprintf(&sb, "Merge: %s\n", strings.Join(parents, " "))
+	}
+
+	authorName, authorEmail, _, _ := parseAuthorLine(commit.authorSignature())
+	committerName, committerEmail, committerTime, committerZone := parseAuthorLine(commit.Committer)
+	authorDate, err := FormatDate(commit.Timestamp, commit.Timezone, f.opts.Date, f.now)
+	if err != nil {
+		return "", err
+	}
+	switch f.preset {
+	case "short":
+		fmt.Fprintf(&sb, "Author: %s <%s>\n", authorName, authorEmail)
+	case "medium":
+		fmt.Fprintf(&sb, "Author: %s <%s>\n", authorName, authorEmail)
+		fmt.Fprintf(&sb, "Date:   %s\n", authorDate)
+	case "full":
+		fmt.Fprintf(&sb, "Author: %s <%s>\n", authorName, authorEmail)
+		fmt.Fprintf(&sb, "Commit: %s <%s>\n", committerName, committerEmail)
+	case "fuller":
+		committerDate, err := FormatDate(committerTime, committerZone, f.opts.Date, f.now)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&sb, "Author:     %s <%s>\n", authorName, authorEmail)
+		fmt.Fprintf(&sb, "AuthorDate: %s\n", authorDate)
+		fmt.Fprintf(&sb, "Commit:     %s <%s>\n", committerName, committerEmail)
+		fmt.Fprintf(&sb, "CommitDate: %s\n", committerDate)
+	}
+	sb.WriteString("\n")
+	if f.preset == "short" {
+		writeIndented(&sb, commit.Subject())
+	} else {
+		writeIndented(&sb, commit.Message)
+	}
+	return sb.String(), nil
+}
+
+// formatTagger renders an annotated tag's tagger the way git show does.
+func (f *CommitFormatter) formatTagger(tagger string) (string, error) {
+	if tagger == "" || f.preset == "oneline" {
+		return "", nil
+	}
+	name, email, timestamp, timezone := parseAuthorLine(tagger)
+	switch f.preset {
+	case "medium", "fuller":
+		date, err := FormatDate(timestamp, timezone, f.opts.Date, f.now)
+		if err != nil {
+			return "", err
+		}
+		if f.preset == "fuller" {
+			return fmt.Sprintf("Tagger:     %s <%s>\nTaggerDate: %s\n", name, email, date), nil
+		}
+		return fmt.Sprintf("Tagger: %s <%s>\nDate:   %s\n", name, email, date), nil
+	}
+	return fmt.Sprintf("Tagger: %s <%s>\n", name, email), nil
+}
+
+// writeIndented indents each line of message by four spaces.
+func writeIndented(sb *strings.Builder, message string) {
+	for _, line := range strings.Split(message, "\n") {
+		sb.WriteString("    " + line + "\n")
+	}
+}
+
+// expand fills in the %-placeholders of a --format string, copying unknown ones.
+func (f *CommitFormatter) expand(format string, commit CommitInfo) (string, error) {
+	var sb strings.Builder
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' || i+1 == len(format) {
+			sb.WriteByte(format[i])
+			continue
+		}
+
+		n := 1
+		value := ""
+		switch c := format[i+1]; c {
+		case '%':
+			value = "%"
+		case 'n':
+			value = "\n"
+		case 'H':
+			value = commit.Hash
+		case 'h':
+			value = shortHash(commit.Hash)
+		case 'T':
+			value = commit.Tree
+		case 't':
+			value = shortHash(commit.Tree)
+		case 'P':
+			value = strings.Join(commit.Parents, " ")
+		case 'p':
+			parents := make([]string, len(commit.Parents))
+			for j, parent := range commit.Parents {
+				parents[j] = shortHash(parent)
+			}
+			value = strings.Join(parents, " ")
+		case 's':
+			value = commit.Subject()
+		case 'b':
+			if _, body, ok := strings.Cut(commit.Message, "\n"); ok {
+				if body = strings.TrimLeft(body, "\n"); body != "" {
+					value = body + "\n"
+				}
+			}
+		case 'B':
+			value = commit.Message + "\n"
+		case 'd':
+			value = f.decoration(commit.Hash, " (", ")")
+		case 'D':
+			value = f.decoration(commit.Hash, "", "")
+		case 'x':
+			if i+3 < len(format) && isHexString(format[i+2:i+4]) {
+				b, _ := strconv.ParseUint(format[i+2:i+4], 16, 8)
+				value, n = string([]byte{byte(b)}), 3
+			} else {
+				value, n = "%x", 1
+			}
+		case 'a', 'c':
+			if i+2 >= len(format) {
+				value = format[i : i+2]
+				break
+			}
+			signature := commit.authorSignature()
+			if c == 'c' {
+				signature = commit.Committer
+			}
+			var ok bool
+			var err error
+			value, ok, err = f.signatureField(signature, format[i+2])
+			if err != nil {
+				return "", err
+			}
+			if ok {
+				n = 2
+			} else {
+				value = format[i : i+2]
+			}
+		default:
+			value = format[i : i+2]
+		}
+		sb.WriteString(value)
+		i += n
+	}
+	return sb.String(), nil
+}
+
+// signatureField renders one field of a signature, or reports false.
+func (f *CommitFormatter) signatureField(signature string, field byte) (string, bool, error) {
+	name, email, timestamp, timezone := parseAuthorLine(signature)
+	style := ""
+	switch field {
+	case 'n':
+		return name, true, nil
+	case 'e':
+		return email, true, nil
+	case 'd':
+		style = f.opts.Date
+	case 'r':
+		style = "relative"
+	case 't':
+		style = "unix"
+	case 'i':
+		style = "iso"
+	case 'I':
+		style = "iso-strict"
+	case 's':
+		style = "short"
+	default:
+		return "", false, nil
+	}
+	date, err := FormatDate(timestamp, timezone, style, f.now)
+	return date, true, err
+}
+
+// decoration joins the refs pointing at hash, wrapped in prefix and suffix.
+func (f *CommitFormatter) decoration(hash, prefix, suffix string) string {
+	names := f.decorations[hash]
+	if len(names) == 0 {
+		return ""
+	}
+	return prefix + strings.Join(names, ", ") + suffix
+}
+
+// Decorations maps commits to the names log --decorate shows for them.
+func Decorations(repoPath string) (map[string][]string, error) {
+	refs, err := ListRefs(repoPath)
+	if err != nil {
+		return nil, err
+	}
+	decorations := make(map[string][]string)
+
+	branch, _ := GetCurrentBranch(repoPath)
+	head, _ := resolveHead(repoPath)
+	if head != "" && branch == "" {
+		decorations[head] = append(decorations[head], "HEAD")
+	}
+	for _, ref := range refs {
+		name := shortRefName(ref.Name)
+		hash := ref.Hash
+		switch {
+		case ref.Name == "refs/heads/"+branch:
+			decorations[hash] = append([]string{"HEAD -> " + name}, decorations[hash]...)
+			continue
+		case strings.HasPrefix(ref.Name, "refs/tags/"):
+			if peeled, err := peelObject(repoPath, hash, "", ref.Name); err == nil {
+				hash = peeled
+			}
+			name = "tag: " + name
+		case strings.HasPrefix(ref.Name, "refs/heads/"), strings.HasPrefix(ref.Name, "refs/remotes/"):
+		default:
+			continue
+		}
+		decorations[hash] = append(decorations[hash], name)
+	}
+	return decorations, nil
+}
+
+// LogWriter writes formatted commits, with the history graph when one is given.
+type LogWriter struct {
+	out       io.Writer
+	formatter *CommitFormatter
+	graph     *Graph
+
+	shown          bool
+	missingNewline bool
+}
+
+func NewLogWriter(out io.Writer, formatter *CommitFormatter, graph *Graph) *LogWriter {
+	return &LogWriter{out: out, formatter: formatter, graph: graph}
+}
+
+// Write writes one commit; parents decide the graph lines below it.
+func (w *LogWriter) Write(commit CommitInfo, parents []string) error {
+	return w.WriteWithDiff(commit, parents, DiffFormat{}, nil)
+}
+
+// WriteWithDiff writes one commit followed by the diff render produces.
+func (w *LogWriter) WriteWithDiff(commit CommitInfo, parents []string, format DiffFormat, render func(width int) (string, error)) error {
+	return w.write(commit, parents, format, render, false)
+}
+
+// WriteWithCombinedDiff writes a merge followed by its combined diff.
+func (w *LogWriter) WriteWithCombinedDiff(commit CommitInfo, parents []string, format DiffFormat, render func(width int) (string, error)) error {
+	return w.write(commit, parents, format, render, true)
+}
+
+func (w *LogWriter) write(commit CommitInfo, parents []string, format DiffFormat, render func(width int) (string, error), combined bool) error {
+	entry, err := w.formatter.Format(commit)
+	if err != nil {
+		return err
+	}
+	if w.graph != nil {
+		w.graph.Update(commit.Hash, parents)
+	}
+
+	diff := ""
+	if render != nil {
+		width := terminalWidth()
+		if w.graph != nil {
+			width -= w.graph.width
+		}
+		if diff, err = render(width); err != nil {
+			return err
+		}
+	}
+
+	if w.graph == nil {
+		if w.shown {
+			io.WriteString(w.out, w.formatter.Separator())
+		}
+		w.shown = true
+		io.WriteString(w.out, entry)
+		w.writeDiff(format, diff, combined && render != nil)
+		return nil
+	}
+
+	separator := w.formatter.Separator()
+	if separator == "" {
+		// the terminator is written below, after the graph's lines
+		entry = strings.TrimSuffix(entry, "\n")
+	}
+
+	// keep the graph going on the blank line between entries
+	if w.shown && separator != "" {
+		if separator == "\n" && !w.missingNewline {
+			io.WriteString(w.out, w.graph.PaddingLine())
+		}
+		io.WriteString(w.out, separator)
+	}
+	w.shown = true
+	w.missingNewline = !strings.HasSuffix(entry, "\n")
+
+	w.graph.showCommit(w.out)
+	w.graph.showMessage(w.out, entry)
+	if separator == "" {
+		if !w.missingNewline {
+			io.WriteString(w.out, w.graph.PaddingLine())
+		}
+		io.WriteString(w.out, "\n")
+	}
+	w.writeDiff(format, diff, combined && render != nil)
+	return nil
+}
+
+// writeDiff writes the diff below a commit's message, set apart as git does.
+func (w *LogWriter) writeDiff(format DiffFormat, diff string, combined bool) {
+	if diff == "" && !combined {
+		return
+	}
+	prefix := ""
+	if w.graph != nil {
+		prefix = w.graph.PaddingLine()
+	}
+	hasBody := w.formatter.preset != "" || w.formatter.format != ""
+	switch {
+	case combined && hasBody:
+		io.WriteString(w.out, prefix+"\n")
+	case hasBody && w.formatter.preset != "oneline":
+		io.WriteString(w.out, prefix)
+		if format = format.effective(); format.Stat && format.Patch {
+			io.WriteString(w.out, "---")
+		}
+		io.WriteString(w.out, "\n")
+	}
+	if diff == "" {
+		return
+	}
+	for _, line := range strings.SplitAfter(strings.TrimSuffix(diff, "\n"), "\n") {
+		if w.graph != nil {
+			prefix = w.graph.PaddingLine()
+		}
+		io.WriteString(w.out, prefix+line)
+	}
+	io.WriteString(w.out, "\n")
+}
+
+// terminalWidth is $COLUMNS when set, 80 otherwise.
+func terminalWidth() int {
+	if columns, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && columns > 0 {
+		return columns
+	}
+	return 80
+}
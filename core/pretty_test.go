@@ -0,0 +1,81 @@
+package core
+
+import (
+	"strings"
+	"testing"
+)
+
+func formatCommit(t *testing.T, repo, hash string, opts PrettyOptions) string {
+	t.Helper()
+
+	formatter, err := NewCommitFormatter(repo, opts)
+	if err != nil {
+		t.Fatalf("NewCommitFormatter failed: %v", err)
+	}
+	commit, err := readCommit(repo, hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := formatter.Format(commit)
+	if err != nil {
+		t.Fatalf("Format failed: %v", err)
+	}
+	return out
+}
+
+func TestCommitFormatterPresets(t *testing.T) {
+	repo := setupTestRepo(t)
+	first := commitFile(t, repo, "file.txt", "one\n", "first")
+	firstCommit, _ := readCommit(repo, first)
+	author := "Ann Author <ann@example.com> 1700000000 +0100"
+	committer := "Carl Committer <carl@example.com> 1700003600 +0000"
+	hash, err := commitTreeWithSignatures(firstCommit.Tree, []string{first}, "subject line\n\nbody text\nmore body", author, committer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := UpdateRef(repo, "refs/heads/main", hash, "", "second", false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CreateTag(repo, "v1", hash, TagOptions{Annotate: true, Message: "v1", Name: "T", Email: "t@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+
+	medium := "commit " + hash + "\n" +
+		"Author: Ann Author <ann@example.com>\n" +
+		"Date:   Tue Nov 14 23:13:20 2023 +0100\n" +
+		"\n" +
+		"    subject line\n" +
+		"    \n" +
+		"    body text\n" +
+		"    more body\n"
+	if got := formatCommit(t, repo, hash, PrettyOptions{}); got != medium {
+		t.Errorf("medium:\n%s\nwant:\n%s", got, medium)
+	}
+
+	fuller := formatCommit(t, repo, hash, PrettyOptions{Format: "fuller", Date: "iso"})
+	for _, line := range []string{
+		"AuthorDate: 2023-11-14 23:13:20 +0100\n",
+		"Commit:     Carl Committer <carl@example.com>\n",
+		"CommitDate: 2023-11-14 23:13:20 +0000\n",
+	} {
+		if !strings.Contains(fuller, line) {
+			t.Errorf("fuller output is missing %q:\n%s", line, fuller)
+		}
+	}
+
+	oneline := formatCommit(t, repo, hash, PrettyOptions{Format: "oneline", AbbrevCommit: true, Decorate: true})
+	if want := hash[:7] + " (HEAD -> main, tag: v1) subject line\n"; oneline != want {
+		t.Errorf("oneline: got %q, want %q", oneline, want)
+	}
+
+	custom := formatCommit(t, repo, hash, PrettyOptions{Format: "%h %an <%ae> %ad%d%n%s|%b|%P", Date: "short"})
+	want := hash[:7] + " Ann Author <ann@example.com> 2023-11-14 (HEAD -> main, tag: v1)\n" +
+		"subject line|body text\nmore body\n|" + first + "\n"
+	if custom != want {
+		t.Errorf("custom format: got %q, want %q", custom, want)
+	}
+
+	if _, err := NewCommitFormatter(repo, PrettyOptions{Format: "bogus"}); err == nil {
+		t.Error("expected an error for an unknown preset")
+	}
+}
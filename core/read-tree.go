@@ -0,0 +1,245 @@
+package core
+
+import (
+	"fmt"
+	"sort"
+)
+
+// ReadTree reads tree-ishes into the index the way git read-tree does.
+// Without merge, the index is replaced by the one tree given. With merge,
+// one tree is read in the same way, two trees move the index from the
+// first to the second, carrying local changes along, and three trees are
+// a merge of the last two with the first as their common ancestor: paths
+// that merge trivially are staged, and the others are left unmerged with
+// an entry per version, to be resolved and added.
+//
+// A merge refuses to drop changes in the index, or in the working tree
+// for paths it has to touch.
+func ReadTree(repoPath string, treeishes []string, merge bool) error {
+	if len(treeishes) == 0 {
+		return fmt.Errorf("no tree given")
+	}
+	if !merge && len(treeishes) > 1 {
+		return fmt.Errorf("reading more than one tree requires -m")
+	}
+	if len(treeishes) > 3 {
+		return fmt.Errorf("a merge takes at most three trees")
+	}
+
+	trees := make([]map[string]IndexEntry, len(treeishes))
+	for i, treeish := range treeishes {
+		hash, err := resolveObjectName(repoPath, treeish)
+		if err != nil {
+			return err
+		}
+		tree, err := peelObject(repoPath, hash, "tree", treeish)
+		if err != nil {
+			return err
+		}
+		if trees[i], err = treeIndexEntries(repoPath, tree); err != nil {
+			return err
+		}
+	}
+	if len(trees) == 1 {
+		return writeIndexEntries(repoPath, sortedIndexEntries(trees[0]))
+	}
+
+	entries, err := readIndexEntries(repoPath)
+	if err != nil {
+		return err
+	}
+	index := make(map[string]IndexEntry, len(entries))
+	for _, entry := range entries {
+		if entry.Stage != 0 {
+			return fmt.Errorf("you need to resolve your current index first")
+		}
+		index[entry.Path] = entry
+	}
+
+	paths := make(map[string]bool)
+	for _, set := range append(trees, index) {
+		for path := range set {
+			paths[path] = true
+		}
+	}
+
+	var result []IndexEntry
+	for _, path := range sortedKeys(paths) {
+		var merged []IndexEntry
+		if len(trees) == 2 {
+			merged, err = twoWayMerge(repoPath, path, index, trees[0], trees[1])
+		} else {
+			merged, err = threeWayMerge(repoPath, path, index, trees[0], trees[1], trees[2])
+		}
+		if err != nil {
+			return err
+		}
+		result = append(result, merged...)
+	}
+	return writeIndexEntries(repoPath, result)
+}
+
+// twoWayMerge decides what the index holds for path when it moves from
+// tree h to tree m: the entry of m where the index had h, or what the
+// index has where that doesn't lose anything.
+func twoWayMerge(repoPath, path string, index, h, m map[string]IndexEntry) ([]IndexEntry, error) {
+	i, inIndex := index[path]
+	old, inH := h[path]
+	next, inM := m[path]
+
+	switch {
+	case !inIndex && !inH:
+		return []IndexEntry{next}, nil
+	case !inIndex && !inM:
+		return nil, nil
+	case !inIndex:
+		// an empty index is an initial checkout
+		if len(index) == 0 {
+			return []IndexEntry{next}, nil
+		}
+		if sameIndexEntry(old, next) {
+			return nil, nil
+		}
+	case !inH && !inM:
+		return []IndexEntry{i}, nil
+	case !inH:
+		if sameIndexEntry(i, next) {
+			return []IndexEntry{i}, nil
+		}
+	case !inM:
+		if sameIndexEntry(i, old) {
+			if err := verifyUptodate(repoPath, i); err != nil {
+				return nil, err
+			}
+			return nil, nil
+		}
+	case sameIndexEntry(old, next) || sameIndexEntry(i, next):
+		return []IndexEntry{i}, nil
+	case sameIndexEntry(i, old):
+		if err := verifyUptodate(repoPath, i); err != nil {
+			return nil, err
+		}
+		return []IndexEntry{next}, nil
+	}
+	return nil, fmt.Errorf("entry '%s' would be overwritten by merge; cannot merge", path)
+}
+
+// threeWayMerge decides what the index holds for path when the trees
+// ours and theirs are merged with base as their common ancestor. Only
+// the trivial cases are resolved: both sides agree, or only one of them
+// changed the path. Otherwise each version is staged as unmerged.
+func threeWayMerge(repoPath, path string, index, base, ours, theirs map[string]IndexEntry) ([]IndexEntry, error) {
+	i, inIndex := index[path]
+	o, inBase := base[path]
+	a, inOurs := ours[path]
+	b, inTheirs := theirs[path]
+	same := func(x IndexEntry, inX bool, y IndexEntry, inY bool) bool {
+		return inX == inY && (!inX || sameIndexEntry(x, y))
+	}
+
+	oursMatch, theirsMatch := false, false
+	if !same(a, inOurs, b, inTheirs) {
+		oursMatch = same(o, inBase, a, inOurs)
+		theirsMatch = same(o, inBase, b, inTheirs)
+	}
+
+	// only they changed it, and the index may already hold their version
+	if inTheirs && oursMatch && !theirsMatch {
+		if inIndex && !sameIndexEntry(i, b) {
+			if !same(i, true, a, inOurs) {
+				return nil, fmt.Errorf("entry '%s' would be overwritten by merge; cannot merge", path)
+			}
+			if err := verifyUptodate(repoPath, i); err != nil {
+				return nil, err
+			}
+		}
+		return []IndexEntry{stagedAs(b, 0)}, nil
+	}
+	if inIndex && !same(i, true, a, inOurs) {
+		return nil, fmt.Errorf("entry '%s' would be overwritten by merge; cannot merge", path)
+	}
+	if inOurs && (same(a, true, b, inTheirs) || theirsMatch && !oursMatch) {
+		return []IndexEntry{stagedAs(a, 0)}, nil
+	}
+	if !inBase && !inOurs && !inTheirs {
+		return nil, nil
+	}
+
+	// the conflict entries replace the file's entry, so it must not have
+	// changes of its own
+	if inIndex {
+		if err := verifyUptodate(repoPath, i); err != nil {
+			return nil, err
+		}
+	}
+	var staged []IndexEntry
+	if inBase {
+		staged = append(staged, stagedAs(o, 1))
+	}
+	if inOurs {
+		staged = append(staged, stagedAs(a, 2))
+	}
+	if inTheirs {
+		staged = append(staged, stagedAs(b, 3))
+	}
+	return staged, nil
+}
+
+func sameIndexEntry(a, b IndexEntry) bool {
+	return a.Hash == b.Hash && a.Mode == b.Mode
+}
+
+func stagedAs(entry IndexEntry, stage int) IndexEntry {
+	entry.Stage = stage
+	return entry
+}
+
+// verifyUptodate makes sure the working tree file of an index entry that
+// a merge replaces has no changes that would be lost. A missing file has
+// none.
+func verifyUptodate(repoPath string, entry IndexEntry) error {
+	hash, exists, err := worktreeFileHash(repoPath, entry.Path)
+	if err != nil {
+		return err
+	}
+	if exists && hash != entry.Hash {
+		return fmt.Errorf("entry '%s' not uptodate; cannot merge", entry.Path)
+	}
+	return nil
+}
+
+// treeIndexEntries returns the files of a tree, at any depth, as stage 0
+// index entries keyed by path.
+func treeIndexEntries(repoPath, tree string) (map[string]IndexEntry, error) {
+	files := make(map[string]IndexEntry)
+	var walk func(tree, prefix string) error
+	walk = func(tree, prefix string) error {
+		entries, err := readTreeEntries(repoPath, tree)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			path := prefix + entry.Name
+			if isTreeMode(entry.Mode) {
+				if err := walk(entry.Hash, path+"/"); err != nil {
+					return err
+				}
+				continue
+			}
+			files[path] = IndexEntry{Mode: fullMode(entry.Mode), Path: path, Hash: entry.Hash}
+		}
+		return nil
+	}
+	return files, walk(tree, "")
+}
+
+func sortedIndexEntries(entries map[string]IndexEntry) []IndexEntry {
+	sorted := make([]IndexEntry, 0, len(entries))
+	for _, entry := range entries {
+		sorted = append(sorted, entry)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Path < sorted[j].Path
+	})
+	return sorted
+}
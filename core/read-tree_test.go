@@ -0,0 +1,182 @@
+package core
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func lsFilesStage(t *testing.T, repo string) string {
+	t.Helper()
+	var out bytes.Buffer
+	if err := LsFiles(repo, &out, nil, LsFilesOptions{Stage: true}); err != nil {
+		t.Fatal(err)
+	}
+	return out.String()
+}
+
+func TestReadTree(t *testing.T) {
+	repo := setupTestRepo(t)
+	tree := writeTestTree(t, map[string]string{"a": "a\n", "d/b": "b\n"})
+
+	if err := ReadTree(repo, []string{tree}, false); err != nil {
+		t.Fatal(err)
+	}
+	a, _ := ResolveRevision(repo, tree+":a")
+	b, _ := ResolveRevision(repo, tree+":d/b")
+	want := fmt.Sprintf("100644 %s 0\ta\n100644 %s 0\td/b\n", a, b)
+	if got := lsFilesStage(t, repo); got != want {
+		t.Errorf("index after read-tree:\n%s\nwant:\n%s", got, want)
+	}
+
+	if err := ReadTree(repo, []string{tree, tree}, false); err == nil {
+		t.Error("expected an error for two trees without merge")
+	}
+}
+
+func TestReadTreeTwoWay(t *testing.T) {
+	repo := setupTestRepo(t)
+	h := writeTestTree(t, map[string]string{"same": "1\n", "changed": "1\n", "removed": "1\n", "local": "1\n"})
+	m := writeTestTree(t, map[string]string{"same": "1\n", "changed": "2\n", "local": "1\n", "added": "2\n"})
+	if err := ReadTree(repo, []string{h}, false); err != nil {
+		t.Fatal(err)
+	}
+	commitFile(t, repo, "local", "local change\n", "local")
+	local, _ := ResolveRevision(repo, ":local")
+
+	if err := ReadTree(repo, []string{h, m}, true); err != nil {
+		t.Fatal(err)
+	}
+	index, err := readIndexMap(repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	changed, _ := ResolveRevision(repo, m+":changed")
+	added, _ := ResolveRevision(repo, m+":added")
+	if index["changed"] != changed || index["added"] != added {
+		t.Errorf("the changes between the trees should be carried into the index: %v", index)
+	}
+	if index["local"] != local {
+		t.Errorf("the local change should be kept, got %s", index["local"])
+	}
+	if _, ok := index["removed"]; ok {
+		t.Error("a path removed between the trees should leave the index")
+	}
+
+	// moving back to h would lose the local change, which h doesn't have
+	other := writeTestTree(t, map[string]string{"local": "other\n"})
+	err = ReadTree(repo, []string{m, other}, true)
+	if err == nil || !strings.Contains(err.Error(), "would be overwritten") {
+		t.Errorf("expected the local change to block the merge, got %v", err)
+	}
+}
+
+func TestReadTreeThreeWay(t *testing.T) {
+	repo := setupTestRepo(t)
+	base := writeTestTree(t, map[string]string{"same": "1\n", "ours": "1\n", "theirs": "1\n", "both": "1\n", "gone": "1\n"})
+	ours := writeTestTree(t, map[string]string{"same": "1\n", "ours": "2\n", "theirs": "1\n", "both": "2\n", "gone": "1\n"})
+	theirs := writeTestTree(t, map[string]string{"same": "1\n", "ours": "1\n", "theirs": "3\n", "both": "3\n"})
+	if err := ReadTree(repo, []string{ours}, false); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ReadTree(repo, []string{base, ours, theirs}, true); err != nil {
+		t.Fatal(err)
+	}
+	blob := func(content string) string {
+		hash, _ := HashObject([]byte(content), "blob", false)
+		return hash
+	}
+	want := strings.Join([]string{
+		"100644 " + blob("1\n") + " 1\tboth",
+		"100644 " + blob("2\n") + " 2\tboth",
+		"100644 " + blob("3\n") + " 3\tboth",
+		"100644 " + blob("1\n") + " 1\tgone",
+		"100644 " + blob("1\n") + " 2\tgone",
+		"100644 " + blob("2\n") + " 0\tours",
+		"100644 " + blob("1\n") + " 0\tsame",
+		"100644 " + blob("3\n") + " 0\ttheirs",
+	}, "\n") + "\n"
+	if got := lsFilesStage(t, repo); got != want {
+		t.Errorf("index after the merge:\n%s\nwant:\n%s", got, want)
+	}
+
+	// an unmerged path counts as our version until it is resolved
+	index, err := readIndexMap(repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if index["both"] != blob("2\n") {
+		t.Errorf("expected our version of both, got %s", index["both"])
+	}
+	if err := ReadTree(repo, []string{base, ours, theirs}, true); err == nil {
+		t.Error("expected an error merging into an unmerged index")
+	}
+	if _, err := Commit(repo, "merge", "Test Author", "test@example.com"); err == nil {
+		t.Error("expected an error committing unmerged paths")
+	}
+
+	// adding the path resolves it
+	if err := os.WriteFile("both", []byte("resolved\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Add(repo, "both"); err != nil {
+		t.Fatal(err)
+	}
+	if got := lsFilesStage(t, repo); !strings.Contains(got, "100644 "+blob("resolved\n")+" 0\tboth\n") || strings.Count(got, "\tboth\n") != 1 {
+		t.Errorf("expected both to be resolved:\n%s", got)
+	}
+}
+
+func TestCheckoutIndex(t *testing.T) {
+	repo := setupTestRepo(t)
+	commitFile(t, repo, "a.txt", "a\n", "a")
+	commitFile(t, repo, "dir/b.txt", "b\n", "b")
+
+	if err := os.Remove("dir/b.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile("a.txt", []byte("local\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	err := CheckoutIndex(repo, nil, CheckoutIndexOptions{All: true})
+	if err == nil || !strings.Contains(err.Error(), "a.txt") {
+		t.Errorf("expected a.txt to be reported as existing, got %v", err)
+	}
+	if content, err := os.ReadFile("dir/b.txt"); err != nil || string(content) != "b\n" {
+		t.Errorf("dir/b.txt should be checked out, got %q, %v", content, err)
+	}
+	if content, _ := os.ReadFile("a.txt"); string(content) != "local\n" {
+		t.Errorf("a.txt should be left alone without force, got %q", content)
+	}
+
+	if err := CheckoutIndex(repo, []string{"a.txt"}, CheckoutIndexOptions{Force: true}); err != nil {
+		t.Fatal(err)
+	}
+	if content, _ := os.ReadFile("a.txt"); string(content) != "a\n" {
+		t.Errorf("a.txt should be overwritten with force, got %q", content)
+	}
+
+	if err := CheckoutIndex(repo, nil, CheckoutIndexOptions{All: true, Prefix: "export/"}); err != nil {
+		t.Fatal(err)
+	}
+	if content, err := os.ReadFile("export/dir/b.txt"); err != nil || string(content) != "b\n" {
+		t.Errorf("export/dir/b.txt should be checked out, got %q, %v", content, err)
+	}
+
+	export := t.TempDir()
+	if err := CheckoutIndex(repo, nil, CheckoutIndexOptions{All: true, Prefix: export + "/"}); err != nil {
+		t.Fatal(err)
+	}
+	if content, err := os.ReadFile(filepath.Join(export, "dir", "b.txt")); err != nil || string(content) != "b\n" {
+		t.Errorf("an absolute prefix should be used as it is, got %q, %v", content, err)
+	}
+
+	if err := CheckoutIndex(repo, []string{"nope"}, CheckoutIndexOptions{}); err == nil {
+		t.Error("expected an error for a path that isn't in the index")
+	}
+}
@@ -0,0 +1,918 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const rebaseStateDir = "rebase-merge"
+
+type RebaseOptions struct {
+	Upstream       string
+	Onto           string
+	Interactive    bool
+	Autosquash     bool
+	CommitterName  string
+	CommitterEmail string
+}
+
+type rebaseTodoItem struct {
+	Action string
+	Hash   string
+	Arg    string
+}
+
+var rebaseActions = map[string]string{
+	"p": "pick", "pick": "pick",
+	"r": "reword", "reword": "reword",
+	"e": "edit", "edit": "edit",
+	"s": "squash", "squash": "squash",
+	"f": "fixup", "fixup": "fixup",
+	"d": "drop", "drop": "drop",
+	"x": "exec", "exec": "exec",
+	"b": "break", "break": "break",
+}
+
+const rebaseTodoHelp = `
+# Commands:
+# p, pick <commit> = use commit
+# r, reword <commit> = use commit, but edit the commit message
+# e, edit <commit> = use commit, but stop for amending
+# s, squash <commit> = use commit, but meld into previous commit
+# f, fixup <commit> = like "squash", but discard this commit's log message
+# x, exec <command> = run command (the rest of the line) using shell
+# b, break = stop here (continue rebase later with 'senpai rebase --continue')
+# d, drop <commit> = remove commit
+#
+# These lines can be re-ordered; they are executed from top to bottom.
+#
+# If you remove a line here THAT COMMIT WILL BE LOST.
+#
+# However, if you remove everything, the rebase will be aborted.
+`
+
+func rebaseDir(repoPath string) string {
+	return filepath.Join(repoPath, RepoDirName, rebaseStateDir)
+}
+
+func RebaseInProgress(repoPath string) bool {
+	_, err := os.Stat(rebaseDir(repoPath))
+	return err == nil
+}
+
+func readRebaseState(repoPath, name string) (string, error) {
+	return readStateFile(rebaseDir(repoPath), name)
+}
+
+func writeRebaseState(repoPath, name, value string) error {
+	return writeStateFile(rebaseDir(repoPath), name, value)
+}
+
+func removeRebaseState(repoPath string, names ...string) {
+	removeStateFiles(rebaseDir(repoPath), names...)
+}
+
+func readStateFile(dir, name string) (string, error) {
+	data, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+func writeStateFile(dir, name, value string) error {
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(value+"\n"), 0644); err != nil {
+		return fmt.Errorf("failed to write state %s: %w", name, err)
+	}
+	return nil
+}
+
+func removeStateFiles(dir string, names ...string) {
+	for _, name := range names {
+		os.Remove(filepath.Join(dir, name))
+	}
+}
+
+// Rebase replays the commits in upstream..HEAD on top of onto (upstream by
+// default). It returns a message describing where the rebase finished or
+// stopped.
+func Rebase(repoPath string, opts RebaseOptions) (string, error) {
+	if RebaseInProgress(repoPath) {
+		return "", fmt.Errorf("a rebase is already in progress; use --continue, --skip or --abort")
+	}
+
+	head, err := resolveHead(repoPath)
+	if err != nil {
+		return "", err
+	}
+	if head == "" {
+		return "", fmt.Errorf("cannot rebase: no commits yet")
+	}
+
+	upstream, err := resolveCommitish(repoPath, opts.Upstream)
+	if err != nil {
+		return "", err
+	}
+	onto := upstream
+	if opts.Onto != "" {
+		if onto, err = resolveCommitish(repoPath, opts.Onto); err != nil {
+			return "", err
+		}
+	}
+
+	if err := requireCleanWorktree(repoPath, "rebase"); err != nil {
+		return "", err
+	}
+
+	headName := "detached HEAD"
+	if branch, err := GetCurrentBranch(repoPath); err == nil {
+		headName = "refs/heads/" + branch
+	}
+
+	if !opts.Interactive && onto == upstream {
+		upToDate, err := isAncestor(repoPath, upstream, head)
+		if err != nil {
+			return "", err
+		}
+		if upToDate {
+			return fmt.Sprintf("Current branch %s is up to date.", strings.TrimPrefix(headName, "refs/heads/")), nil
+		}
+	}
+
+	commits, merges, err := commitsToRebase(repoPath, upstream, head)
+	if err != nil {
+		return "", err
+	}
+
+	var todo []rebaseTodoItem
+	for _, c := range commits {
+		todo = append(todo, rebaseTodoItem{Action: "pick", Hash: c.Hash, Arg: c.Subject()})
+	}
+	if opts.Autosquash {
+		todo = autosquashTodo(todo)
+	}
+
+	if err := os.MkdirAll(rebaseDir(repoPath), 0755); err != nil {
+		return "", fmt.Errorf("failed to create rebase state: %w", err)
+	}
+
+	if opts.Interactive {
+		todo, err = editRebaseTodo(repoPath, todo, head, onto)
+		if err != nil {
+			os.RemoveAll(rebaseDir(repoPath))
+			return "", err
+		}
+		if len(todo) == 0 {
+			os.RemoveAll(rebaseDir(repoPath))
+			return "Nothing to do", nil
+		}
+	}
+
+	state := map[string]string{
+		"head-name":   headName,
+		"orig-head":   head,
+		"onto":        onto,
+		"interactive": fmt.Sprintf("%t", opts.Interactive),
+		"done":        "",
+	}
+	for name, value := range state {
+		if err := writeRebaseState(repoPath, name, value); err != nil {
+			return "", err
+		}
+	}
+	if err := writeRebaseTodo(repoPath, "git-rebase-todo", todo); err != nil {
+		return "", err
+	}
+
+	repoDir := filepath.Join(repoPath, RepoDirName)
+	if err := os.WriteFile(filepath.Join(repoDir, "ORIG_HEAD"), []byte(head+"\n"), 0644); err != nil {
+		return "", fmt.Errorf("failed to write ORIG_HEAD: %w", err)
+	}
+
+	if err := detachHeadAt(repoPath, head, onto); err != nil {
+		return "", err
+	}
+
+	output, err := runRebase(repoPath, opts.CommitterName, opts.CommitterEmail)
+	if err != nil || len(merges) == 0 {
+		return output, err
+	}
+	// the merges aren't replayed, only the commits they brought in
+	var notice []string
+	for _, merge := range merges {
+		notice = append(notice, fmt.Sprintf("dropping merge commit %s... %s", shortHash(merge.Hash), merge.Subject()))
+	}
+	return strings.Join(append(notice, output), "\n"), nil
+}
+
+// RebaseContinue records the resolution of a stopped step and carries on
+// with the rest of the todo list.
+func RebaseContinue(repoPath, committerName, committerEmail string) (string, error) {
+	if !RebaseInProgress(repoPath) {
+		return "", fmt.Errorf("no rebase in progress")
+	}
+
+	index, err := readIndexMap(repoPath)
+	if err != nil {
+		return "", err
+	}
+	unstaged, err := unstagedChanges(repoPath, index)
+	if err != nil {
+		return "", err
+	}
+	if len(unstaged) > 0 {
+		return "", fmt.Errorf("you must edit all merge conflicts and then mark them as resolved using senpai add:\n\t%s",
+			strings.Join(unstaged, "\n\t"))
+	}
+
+	committer := formatSignature(committerName, committerEmail, time.Now())
+
+	if stopped, err := readRebaseState(repoPath, "stopped-sha"); err == nil {
+		done, err := readRebaseTodo(repoPath, "done")
+		if err != nil {
+			return "", err
+		}
+		if len(done) == 0 {
+			return "", fmt.Errorf("corrupt rebase state: nothing was being applied")
+		}
+		current := done[len(done)-1]
+
+		commit, err := readCommit(repoPath, stopped)
+		if err != nil {
+			return "", err
+		}
+		treeHash, err := writeTreeFromMap(index)
+		if err != nil {
+			return "", err
+		}
+		if err := finishRebaseStep(repoPath, current, commit, treeHash, committer); err != nil {
+			return "", err
+		}
+		removeRebaseState(repoPath, "stopped-sha")
+	} else if amend, err := readRebaseState(repoPath, "amend"); err == nil {
+		head, err := resolveHead(repoPath)
+		if err != nil {
+			return "", err
+		}
+		if head != amend {
+			// the user already committed on top of the edited commit
+			removeRebaseState(repoPath, "amend")
+			return runRebase(repoPath, committerName, committerEmail)
+		}
+
+		headCommit, err := readCommit(repoPath, head)
+		if err != nil {
+			return "", err
+		}
+		treeHash, err := writeTreeFromMap(index)
+		if err != nil {
+			return "", err
+		}
+		if treeHash != headCommit.Tree {
+			if err := amendHead(repoPath, treeHash, headCommit.Message, headCommit.authorSignature(), committer, "continue"); err != nil {
+				return "", err
+			}
+		}
+		removeRebaseState(repoPath, "amend")
+	}
+
+	return runRebase(repoPath, committerName, committerEmail)
+}
+
+// RebaseSkip drops the step the rebase stopped at and continues.
+func RebaseSkip(repoPath, committerName, committerEmail string) (string, error) {
+	if !RebaseInProgress(repoPath) {
+		return "", fmt.Errorf("no rebase in progress")
+	}
+
+	head, err := resolveHead(repoPath)
+	if err != nil {
+		return "", err
+	}
+	headTree, err := commitTreeMap(repoPath, head)
+	if err != nil {
+		return "", err
+	}
+	if err := resetHardToTree(repoPath, headTree); err != nil {
+		return "", err
+	}
+
+	removeRebaseState(repoPath, "stopped-sha", "amend")
+	return runRebase(repoPath, committerName, committerEmail)
+}
+
+// RebaseAbort restores the branch, index and working tree to the state they
+// were in before the rebase started.
+func RebaseAbort(repoPath string) error {
+	if !RebaseInProgress(repoPath) {
+		return fmt.Errorf("no rebase in progress")
+	}
+
+	origHead, err := readRebaseState(repoPath, "orig-head")
+	if err != nil {
+		return fmt.Errorf("failed to read original HEAD: %w", err)
+	}
+	headName, err := readRebaseState(repoPath, "head-name")
+	if err != nil {
+		return fmt.Errorf("failed to read original branch: %w", err)
+	}
+
+	origTree, err := getCommitTree(repoPath, origHead)
+	if err != nil {
+		return err
+	}
+	if err := resetHardToTree(repoPath, origTree); err != nil {
+		return err
+	}
+
+	if err := restoreRebaseHead(repoPath, headName, origHead, "abort"); err != nil {
+		return err
+	}
+
+	return os.RemoveAll(rebaseDir(repoPath))
+}
+
+func runRebase(repoPath, committerName, committerEmail string) (string, error) {
+	committer := formatSignature(committerName, committerEmail, time.Now())
+
+	for {
+		todo, err := readRebaseTodo(repoPath, "git-rebase-todo")
+		if err != nil {
+			return "", err
+		}
+		if len(todo) == 0 {
+			return finishRebase(repoPath)
+		}
+
+		item := todo[0]
+		if err := writeRebaseTodo(repoPath, "git-rebase-todo", todo[1:]); err != nil {
+			return "", err
+		}
+		done, err := readRebaseTodo(repoPath, "done")
+		if err != nil {
+			return "", err
+		}
+		if err := writeRebaseTodo(repoPath, "done", append(done, item)); err != nil {
+			return "", err
+		}
+
+		if (item.Action == "squash" || item.Action == "fixup") && len(done) == 0 {
+			return "", fmt.Errorf("cannot '%s' without a previous commit", item.Action)
+		}
+
+		stop, err := executeRebaseItem(repoPath, item, committer)
+		if err != nil {
+			return "", err
+		}
+		if stop != "" {
+			return stop, nil
+		}
+	}
+}
+
+func executeRebaseItem(repoPath string, item rebaseTodoItem, committer string) (string, error) {
+	switch item.Action {
+	case "drop":
+		return "", nil
+
+	case "break":
+		return "Stopped at HEAD\nYou can continue with: senpai rebase --continue", nil
+
+	case "exec":
+		cmd := exec.Command("sh", "-c", item.Arg)
+		cmd.Dir = repoPath
+		cmd.Stdin = os.Stdin
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			return "", fmt.Errorf("execution failed: %s\n%v\nYou can fix the problem, and then run\n\n  senpai rebase --continue", item.Arg, err)
+		}
+		return "", nil
+	}
+
+	commit, err := readCommit(repoPath, item.Hash)
+	if err != nil {
+		return "", err
+	}
+	if len(commit.Parents) > 1 {
+		return "", fmt.Errorf("commit %s is a merge and cannot be picked", shortHash(commit.Hash))
+	}
+
+	head, err := resolveHead(repoPath)
+	if err != nil {
+		return "", err
+	}
+
+	var parent string
+	if len(commit.Parents) > 0 {
+		parent = commit.Parents[0]
+	}
+
+	if item.Action != "squash" && item.Action != "fixup" && parent == head {
+		// the commit already sits on top of HEAD, so just fast-forward to it
+		headTree, err := commitTreeMap(repoPath, head)
+		if err != nil {
+			return "", err
+		}
+		commitTree, err := getCommitTree(repoPath, commit.Hash)
+		if err != nil {
+			return "", err
+		}
+		if err := updateWorkingTree(repoPath, headTree, commitTree); err != nil {
+			return "", err
+		}
+		if err := updateIndexToTree(repoPath, commitTree); err != nil {
+			return "", err
+		}
+		if err := updateHEAD(repoPath, commit.Hash, fmt.Sprintf("rebase (%s): %s", item.Action, commit.Subject())); err != nil {
+			return "", err
+		}
+
+		if item.Action == "reword" {
+			message, err := editMessage(repoPath, commit.Message)
+			if err != nil {
+				return "", err
+			}
+			if err := amendHead(repoPath, commit.Tree, message, commit.authorSignature(), committer, item.Action); err != nil {
+				return "", err
+			}
+		}
+		return rebaseStopForEdit(repoPath, item, commit)
+	}
+
+	headTree, err := commitTreeMap(repoPath, head)
+	if err != nil {
+		return "", err
+	}
+	result, err := applyCommitChanges(repoPath, commit, headTree, 0, false)
+	if err != nil {
+		return "", err
+	}
+	if len(result.Conflicts) > 0 {
+		if err := writeRebaseState(repoPath, "stopped-sha", commit.Hash); err != nil {
+			return "", err
+		}
+		return "", fmt.Errorf("could not apply %s... %s\nCONFLICT in:\n\t%s\nResolve all conflicts manually, mark them as resolved with\n\"senpai add <paths>\", then run \"senpai rebase --continue\".\nYou can instead skip this commit with \"senpai rebase --skip\".\nTo abort and get back to the state before \"senpai rebase\", run \"senpai rebase --abort\".",
+			shortHash(commit.Hash), commit.Subject(), strings.Join(result.Conflicts, "\n\t"))
+	}
+
+	treeHash, err := writeTreeFromMap(result.Tree)
+	if err != nil {
+		return "", err
+	}
+	if err := finishRebaseStep(repoPath, item, commit, treeHash, committer); err != nil {
+		return "", err
+	}
+	return rebaseStopForEdit(repoPath, item, commit)
+}
+
+// finishRebaseStep records treeHash as the outcome of applying commit for
+// the given todo item, either as a new commit or by melding it into HEAD.
+func finishRebaseStep(repoPath string, item rebaseTodoItem, commit CommitInfo, treeHash, committer string) error {
+	head, err := resolveHead(repoPath)
+	if err != nil {
+		return err
+	}
+
+	switch item.Action {
+	case "squash", "fixup":
+		headCommit, err := readCommit(repoPath, head)
+		if err != nil {
+			return err
+		}
+
+		message := headCommit.Message
+		if item.Action == "squash" {
+			message = headCommit.Message + "\n\n" + commit.Message
+		}
+
+		next, err := readRebaseTodo(repoPath, "git-rebase-todo")
+		if err != nil {
+			return err
+		}
+		chainContinues := len(next) > 0 && (next[0].Action == "squash" || next[0].Action == "fixup")
+		_, pendingErr := readRebaseState(repoPath, "squash-pending")
+		squashPending := pendingErr == nil || item.Action == "squash"
+
+		if squashPending && chainContinues {
+			if err := writeRebaseState(repoPath, "squash-pending", commit.Hash); err != nil {
+				return err
+			}
+		} else if squashPending {
+			removeRebaseState(repoPath, "squash-pending")
+			if message, err = editMessage(repoPath, message); err != nil {
+				return err
+			}
+		}
+
+		return amendHead(repoPath, treeHash, message, headCommit.authorSignature(), committer, item.Action)
+
+	default:
+		message := commit.Message
+		if item.Action == "reword" {
+			if message, err = editMessage(repoPath, message); err != nil {
+				return err
+			}
+		}
+
+		var parents []string
+		if head != "" {
+			parents = []string{head}
+		}
+		newHash, err := commitTreeWithSignatures(treeHash, parents, message, commit.authorSignature(), committer)
+		if err != nil {
+			return err
+		}
+		return updateHEAD(repoPath, newHash, fmt.Sprintf("rebase (%s): %s", item.Action, commit.Subject()))
+	}
+}
+
+func rebaseStopForEdit(repoPath string, item rebaseTodoItem, commit CommitInfo) (string, error) {
+	if item.Action != "edit" {
+		return "", nil
+	}
+
+	head, err := resolveHead(repoPath)
+	if err != nil {
+		return "", err
+	}
+	if err := writeRebaseState(repoPath, "amend", head); err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("Stopped at %s... %s\nYou can amend the commit now by staging changes with senpai add.\n\nOnce you are satisfied with your changes, run\n\n  senpai rebase --continue",
+		shortHash(commit.Hash), commit.Subject()), nil
+}
+
+// applyCommitChanges merges the change commit introduces relative to its
+// parent (or, when reverting, the inverse of that change) into ours. For
+// merge commits mainline selects the parent to diff against. The working
+// tree and index are updated to the result.
+func applyCommitChanges(repoPath string, commit CommitInfo, ours map[string]string, mainline int, revert bool) (*TreeMergeResult, error) {
+	parent, err := mainlineParent(commit, mainline)
+	if err != nil {
+		return nil, err
+	}
+
+	base, err := commitTreeMap(repoPath, parent)
+	if err != nil {
+		return nil, err
+	}
+	theirs, err := getCommitTree(repoPath, commit.Hash)
+	if err != nil {
+		return nil, err
+	}
+
+	label := fmt.Sprintf("%s (%s)", shortHash(commit.Hash), commit.Subject())
+	if revert {
+		base, theirs = theirs, base
+		label = "parent of " + label
+	}
+
+	result, err := mergeTrees(repoPath, base, ours, theirs, "HEAD", label)
+	if err != nil {
+		return nil, err
+	}
+
+	index, err := readIndexMap(repoPath)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkWorktreeClobber(repoPath, ours, index, result.Tree); err != nil {
+		return nil, err
+	}
+
+	if err := updateWorkingTree(repoPath, ours, result.Tree); err != nil {
+		return nil, err
+	}
+	if err := updateIndexToTree(repoPath, result.stagedTree(ours)); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// mainlineParent returns the parent whose changes commit is taken
+// against: the only one, or for a merge the mainline-th. A root commit has
+// none. Mainline is ignored for a commit that isn't a merge, so one -m can
+// cover a range mixing merges and ordinary commits.
+func mainlineParent(commit CommitInfo, mainline int) (string, error) {
+	switch {
+	case len(commit.Parents) > 1 && mainline == 0:
+		return "", fmt.Errorf("commit %s is a merge but no -m option was given", shortHash(commit.Hash))
+	case len(commit.Parents) > 1:
+		if mainline < 1 || mainline > len(commit.Parents) {
+			return "", fmt.Errorf("commit %s does not have parent %d", shortHash(commit.Hash), mainline)
+		}
+		return commit.Parents[mainline-1], nil
+	case len(commit.Parents) == 1:
+		return commit.Parents[0], nil
+	}
+	return "", nil
+}
+
+func amendHead(repoPath, treeHash, message, author, committer, action string) error {
+	head, err := resolveHead(repoPath)
+	if err != nil {
+		return err
+	}
+	headCommit, err := readCommit(repoPath, head)
+	if err != nil {
+		return err
+	}
+
+	newHash, err := commitTreeWithSignatures(treeHash, headCommit.Parents, message, author, committer)
+	if err != nil {
+		return err
+	}
+	subject, _, _ := strings.Cut(strings.TrimSpace(message), "\n")
+	return updateHEAD(repoPath, newHash, fmt.Sprintf("rebase (%s): %s", action, subject))
+}
+
+func finishRebase(repoPath string) (string, error) {
+	headName, err := readRebaseState(repoPath, "head-name")
+	if err != nil {
+		return "", fmt.Errorf("failed to read original branch: %w", err)
+	}
+	head, err := resolveHead(repoPath)
+	if err != nil {
+		return "", err
+	}
+
+	if err := restoreRebaseHead(repoPath, headName, head, "finish"); err != nil {
+		return "", err
+	}
+	if err := os.RemoveAll(rebaseDir(repoPath)); err != nil {
+		return "", fmt.Errorf("failed to clean up rebase state: %w", err)
+	}
+
+	return fmt.Sprintf("Successfully rebased and updated %s.", headName), nil
+}
+
+// restoreRebaseHead points headName at commitHash and re-attaches HEAD to it,
+// or leaves HEAD detached at commitHash if the rebase started detached.
+func restoreRebaseHead(repoPath, headName, commitHash, action string) error {
+	oldHead, err := resolveHead(repoPath)
+	if err != nil {
+		return err
+	}
+	message := fmt.Sprintf("rebase (%s): returning to %s", action, headName)
+
+	if !strings.HasPrefix(headName, "refs/") {
+		tx := BeginRefTransaction(repoPath)
+		tx.NoDeref()
+		if err := tx.Update("HEAD", commitHash, "", message); err != nil {
+			return err
+		}
+		return tx.Commit()
+	}
+
+	refMessage := fmt.Sprintf("rebase (%s): %s onto %s", action, headName, commitHash)
+	if err := updateRef(repoPath, headName, commitHash, refMessage); err != nil {
+		return err
+	}
+	if err := writeSymref(repoPath, "HEAD", headName); err != nil {
+		return err
+	}
+	return logRefUpdate(repoPath, "HEAD", oldHead, commitHash, message)
+}
+
+// detachHeadAt moves a clean working tree from the from commit to target and
+// detaches HEAD there.
+func detachHeadAt(repoPath, from, target string) error {
+	fromTree, err := commitTreeMap(repoPath, from)
+	if err != nil {
+		return err
+	}
+	targetTree, err := getCommitTree(repoPath, target)
+	if err != nil {
+		return err
+	}
+
+	if err := updateWorkingTree(repoPath, fromTree, targetTree); err != nil {
+		return err
+	}
+	if err := updateIndexToTree(repoPath, targetTree); err != nil {
+		return err
+	}
+
+	tx := BeginRefTransaction(repoPath)
+	tx.NoDeref()
+	if err := tx.Update("HEAD", target, from, "rebase (start): checkout "+target); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// commitsToRebase lists the non-merge commits reachable from head but not
+// from upstream, parents before children, and separately the merges left
+// out.
+func commitsToRebase(repoPath, upstream, head string) (commits, merges []CommitInfo, err error) {
+	excluded, err := reachableCommits(repoPath, upstream)
+	if err != nil {
+		return nil, nil, err
+	}
+	if excluded[head] {
+		return nil, nil, nil
+	}
+
+	type frame struct {
+		commit CommitInfo
+		next   int
+	}
+
+	headCommit, err := readCommit(repoPath, head)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	visited := map[string]bool{head: true}
+	stack := []*frame{{commit: headCommit}}
+
+	for len(stack) > 0 {
+		top := stack[len(stack)-1]
+		if top.next < len(top.commit.Parents) {
+			parent := top.commit.Parents[top.next]
+			top.next++
+			if visited[parent] || excluded[parent] {
+				continue
+			}
+			visited[parent] = true
+			commit, err := readCommit(repoPath, parent)
+			if err != nil {
+				return nil, nil, err
+			}
+			stack = append(stack, &frame{commit: commit})
+			continue
+		}
+
+		stack = stack[:len(stack)-1]
+		if len(top.commit.Parents) <= 1 {
+			commits = append(commits, top.commit)
+		} else {
+			merges = append(merges, top.commit)
+		}
+	}
+	return commits, merges, nil
+}
+
+// autosquashTodo moves "fixup! <subject>" and "squash! <subject>" commits
+// right after the commit they refer to and marks them accordingly.
+func autosquashTodo(todo []rebaseTodoItem) []rebaseTodoItem {
+	type group struct {
+		items []rebaseTodoItem
+	}
+
+	var groups []*group
+	for _, item := range todo {
+		action, target := autosquashTarget(item.Arg)
+
+		var owner *group
+		if action != "" {
+			for _, g := range groups {
+				head := g.items[0]
+				if head.Arg == target || (len(target) >= 4 && strings.HasPrefix(head.Hash, target)) {
+					owner = g
+					break
+				}
+			}
+		}
+
+		if owner == nil {
+			groups = append(groups, &group{items: []rebaseTodoItem{item}})
+			continue
+		}
+		item.Action = action
+		owner.items = append(owner.items, item)
+	}
+
+	var result []rebaseTodoItem
+	for _, g := range groups {
+		result = append(result, g.items...)
+	}
+	return result
+}
+
+func autosquashTarget(subject string) (string, string) {
+	action := ""
+	for {
+		switch {
+		case strings.HasPrefix(subject, "fixup! "):
+			if action == "" {
+				action = "fixup"
+			}
+			subject = strings.TrimPrefix(subject, "fixup! ")
+		case strings.HasPrefix(subject, "squash! "):
+			if action == "" {
+				action = "squash"
+			}
+			subject = strings.TrimPrefix(subject, "squash! ")
+		default:
+			return action, subject
+		}
+	}
+}
+
+func editRebaseTodo(repoPath string, todo []rebaseTodoItem, head, onto string) ([]rebaseTodoItem, error) {
+	path := filepath.Join(rebaseDir(repoPath), "git-rebase-todo")
+
+	var sb strings.Builder
+	sb.WriteString(formatRebaseTodo(todo, true))
+	sb.WriteString(fmt.Sprintf("\n# Rebase %s onto %s (%d commands)\n#", shortHash(head), shortHash(onto), len(todo)))
+	sb.WriteString(rebaseTodoHelp)
+
+	if err := os.WriteFile(path, []byte(sb.String()), 0644); err != nil {
+		return nil, fmt.Errorf("failed to write todo list: %w", err)
+	}
+	if err := LaunchEditor(repoPath, path); err != nil {
+		return nil, err
+	}
+	return readRebaseTodo(repoPath, "git-rebase-todo")
+}
+
+func readRebaseTodo(repoPath, name string) ([]rebaseTodoItem, error) {
+	data, err := os.ReadFile(filepath.Join(rebaseDir(repoPath), name))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read %s: %w", name, err)
+	}
+	return parseRebaseTodo(repoPath, string(data))
+}
+
+func parseRebaseTodo(repoPath, content string) ([]rebaseTodoItem, error) {
+	var todo []rebaseTodoItem
+
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		word, rest, _ := strings.Cut(line, " ")
+		action, ok := rebaseActions[word]
+		if !ok {
+			return nil, fmt.Errorf("invalid line in todo list: %s", line)
+		}
+		rest = strings.TrimSpace(rest)
+
+		switch action {
+		case "break":
+			todo = append(todo, rebaseTodoItem{Action: action})
+		case "exec":
+			if rest == "" {
+				return nil, fmt.Errorf("missing command in todo list: %s", line)
+			}
+			todo = append(todo, rebaseTodoItem{Action: action, Arg: rest})
+		default:
+			rev, subject, _ := strings.Cut(rest, " ")
+			if rev == "" {
+				return nil, fmt.Errorf("missing commit in todo list: %s", line)
+			}
+			hash, err := resolveCommitish(repoPath, rev)
+			if err != nil {
+				return nil, fmt.Errorf("invalid line in todo list: %s: %w", line, err)
+			}
+			todo = append(todo, rebaseTodoItem{Action: action, Hash: hash, Arg: subject})
+		}
+	}
+	return todo, nil
+}
+
+func formatRebaseTodo(todo []rebaseTodoItem, abbreviate bool) string {
+	var sb strings.Builder
+	for _, item := range todo {
+		switch item.Action {
+		case "break":
+			sb.WriteString("break\n")
+		case "exec":
+			sb.WriteString("exec " + item.Arg + "\n")
+		default:
+			hash := item.Hash
+			if abbreviate {
+				hash = shortHash(hash)
+			}
+			sb.WriteString(fmt.Sprintf("%s %s %s\n", item.Action, hash, item.Arg))
+		}
+	}
+	return sb.String()
+}
+
+func writeRebaseTodo(repoPath, name string, todo []rebaseTodoItem) error {
+	path := filepath.Join(rebaseDir(repoPath), name)
+	if err := os.WriteFile(path, []byte(formatRebaseTodo(todo, false)), 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	return nil
+}
+
+func shortHash(hash string) string {
+	if len(hash) > 7 {
+		return hash[:7]
+	}
+	return hash
+}
@@ -0,0 +1,317 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// setupTestRepo initializes a repository in a fresh temp dir and makes it
+// the working directory, since objects are written relative to it.
+func setupTestRepo(t *testing.T) string {
+	t.Helper()
+
+	tmpDir := t.TempDir()
+	t.Chdir(tmpDir)
+	t.Setenv("GIT_EDITOR", "")
+
+	if err := InitRepo(".", "main"); err != nil {
+		t.Fatalf("InitRepo failed: %v", err)
+	}
+	return "."
+}
+
+func commitFile(t *testing.T, repoPath, name, content, message string) string {
+	t.Helper()
+
+	path := filepath.Join(repoPath, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatalf("failed to create directory for %s: %v", name, err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write %s: %v", name, err)
+	}
+	if err := Add(repoPath, name); err != nil {
+		t.Fatalf("failed to add %s: %v", name, err)
+	}
+
+	hash, err := Commit(repoPath, message, "Test Author", "test@example.com")
+	if err != nil {
+		t.Fatalf("failed to commit: %v", err)
+	}
+	return hash
+}
+
+// setTestEditor installs a shell script as core.editor.
+func setTestEditor(t *testing.T, repoPath, script string) {
+	t.Helper()
+
+	editorPath := filepath.Join(t.TempDir(), "editor.sh")
+	if err := os.WriteFile(editorPath, []byte("#!/bin/sh\n"+script+"\n"), 0755); err != nil {
+		t.Fatalf("failed to write editor script: %v", err)
+	}
+	if err := SetConfig(repoPath, "core", "editor", editorPath); err != nil {
+		t.Fatalf("failed to set core.editor: %v", err)
+	}
+}
+
+func readTestFile(t *testing.T, repoPath, name string) string {
+	t.Helper()
+
+	data, err := os.ReadFile(filepath.Join(repoPath, name))
+	if err != nil {
+		t.Fatalf("failed to read %s: %v", name, err)
+	}
+	return string(data)
+}
+
+func testRebaseOptions(upstream string) RebaseOptions {
+	return RebaseOptions{
+		Upstream:       upstream,
+		CommitterName:  "Test Committer",
+		CommitterEmail: "committer@example.com",
+	}
+}
+
+func TestRebaseOntoUpstream(t *testing.T) {
+	repo := setupTestRepo(t)
+	commitFile(t, repo, "base.txt", "base\n", "base")
+
+	if err := CreateBranch(repo, "feature"); err != nil {
+		t.Fatalf("CreateBranch failed: %v", err)
+	}
+	mainTip := commitFile(t, repo, "main.txt", "main\n", "main work")
+
+	if err := Checkout(repo, "feature"); err != nil {
+		t.Fatalf("Checkout failed: %v", err)
+	}
+	commitFile(t, repo, "feature.txt", "feature\n", "feature work")
+
+	if _, err := Rebase(repo, testRebaseOptions("main")); err != nil {
+		t.Fatalf("Rebase failed: %v", err)
+	}
+
+	branch, err := GetCurrentBranch(repo)
+	if err != nil || branch != "feature" {
+		t.Fatalf("expected to be back on feature, got %q (%v)", branch, err)
+	}
+
+	head, _ := resolveHead(repo)
+	commit, err := readCommit(repo, head)
+	if err != nil {
+		t.Fatalf("readCommit failed: %v", err)
+	}
+	if len(commit.Parents) != 1 || commit.Parents[0] != mainTip {
+		t.Errorf("expected rebased commit on top of %s, got parents %v", mainTip, commit.Parents)
+	}
+	if commit.Author != "Test Author" {
+		t.Errorf("expected original author to be kept, got %q", commit.Author)
+	}
+	if !strings.HasPrefix(commit.Committer, "Test Committer") {
+		t.Errorf("expected new committer, got %q", commit.Committer)
+	}
+	if readTestFile(t, repo, "main.txt") != "main\n" || readTestFile(t, repo, "feature.txt") != "feature\n" {
+		t.Error("working tree does not contain both sides after rebase")
+	}
+	if RebaseInProgress(repo) {
+		t.Error("rebase state should be removed after success")
+	}
+}
+
+func TestRebaseInteractiveSquashAndDrop(t *testing.T) {
+	repo := setupTestRepo(t)
+	base := commitFile(t, repo, "file.txt", "one\n", "base")
+	commitFile(t, repo, "file.txt", "one\ntwo\n", "add two")
+	commitFile(t, repo, "file.txt", "one\ntwo\nthree\n", "add three")
+	commitFile(t, repo, "other.txt", "other\n", "add other")
+
+	setTestEditor(t, repo, `case "$1" in
+*git-rebase-todo)
+	sed -i -e 's/^pick \(.*\) add three$/squash \1 add three/' -e 's/^pick \(.*\) add other$/drop \1 add other/' "$1" ;;
+*COMMIT_EDITMSG)
+	echo "two and three" > "$1" ;;
+esac`)
+
+	opts := testRebaseOptions(base)
+	opts.Interactive = true
+	if _, err := Rebase(repo, opts); err != nil {
+		t.Fatalf("Rebase failed: %v", err)
+	}
+
+	commits, err := Log(repo)
+	if err != nil {
+		t.Fatalf("Log failed: %v", err)
+	}
+	if len(commits) != 2 {
+		t.Fatalf("expected 2 commits after squash and drop, got %d", len(commits))
+	}
+	if commits[0].Message != "two and three" {
+		t.Errorf("expected edited squash message, got %q", commits[0].Message)
+	}
+	if readTestFile(t, repo, "file.txt") != "one\ntwo\nthree\n" {
+		t.Error("squashed content missing from working tree")
+	}
+	if _, err := os.Stat(filepath.Join(repo, "other.txt")); !os.IsNotExist(err) {
+		t.Error("dropped commit's file should not be in the working tree")
+	}
+}
+
+func TestRebaseAutosquash(t *testing.T) {
+	todo := []rebaseTodoItem{
+		{Action: "pick", Hash: "aaaaaaaa", Arg: "feature"},
+		{Action: "pick", Hash: "bbbbbbbb", Arg: "other"},
+		{Action: "pick", Hash: "cccccccc", Arg: "fixup! feature"},
+		{Action: "pick", Hash: "dddddddd", Arg: "squash! other"},
+	}
+
+	got := autosquashTodo(todo)
+	want := []string{"pick aaaaaaaa", "fixup cccccccc", "pick bbbbbbbb", "squash dddddddd"}
+	if len(got) != len(want) {
+		t.Fatalf("expected %d items, got %d", len(want), len(got))
+	}
+	for i, item := range got {
+		if item.Action+" "+item.Hash != want[i] {
+			t.Errorf("item %d: expected %q, got %q", i, want[i], item.Action+" "+item.Hash)
+		}
+	}
+}
+
+func TestRebaseConflictContinueAndAbort(t *testing.T) {
+	repo := setupTestRepo(t)
+	commitFile(t, repo, "file.txt", "base\n", "base")
+	if err := CreateBranch(repo, "feature"); err != nil {
+		t.Fatalf("CreateBranch failed: %v", err)
+	}
+	commitFile(t, repo, "file.txt", "main\n", "main change")
+
+	if err := Checkout(repo, "feature"); err != nil {
+		t.Fatalf("Checkout failed: %v", err)
+	}
+	featureTip := commitFile(t, repo, "file.txt", "feature\n", "feature change")
+
+	if _, err := Rebase(repo, testRebaseOptions("main")); err == nil {
+		t.Fatal("expected conflict")
+	}
+	if !strings.Contains(readTestFile(t, repo, "file.txt"), "<<<<<<< HEAD") {
+		t.Fatal("expected conflict markers in working tree")
+	}
+
+	if _, err := RebaseContinue(repo, "Test Committer", "committer@example.com"); err == nil {
+		t.Fatal("continue should refuse while conflicts are unresolved")
+	}
+
+	if err := RebaseAbort(repo); err != nil {
+		t.Fatalf("RebaseAbort failed: %v", err)
+	}
+	head, _ := resolveHead(repo)
+	if head != featureTip {
+		t.Errorf("expected abort to restore %s, got %s", featureTip, head)
+	}
+	if readTestFile(t, repo, "file.txt") != "feature\n" {
+		t.Error("abort should restore the working tree")
+	}
+
+	if _, err := Rebase(repo, testRebaseOptions("main")); err == nil {
+		t.Fatal("expected conflict")
+	}
+	if err := os.WriteFile("file.txt", []byte("resolved\n"), 0644); err != nil {
+		t.Fatalf("failed to resolve: %v", err)
+	}
+	if err := Add(repo, "file.txt"); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	if _, err := RebaseContinue(repo, "Test Committer", "committer@example.com"); err != nil {
+		t.Fatalf("RebaseContinue failed: %v", err)
+	}
+
+	commits, err := Log(repo)
+	if err != nil {
+		t.Fatalf("Log failed: %v", err)
+	}
+	if len(commits) != 3 || commits[0].Message != "feature change" {
+		t.Errorf("expected resolved commit on top of main, got %+v", commits)
+	}
+}
+
+func TestRebaseEditAndExec(t *testing.T) {
+	repo := setupTestRepo(t)
+	base := commitFile(t, repo, "file.txt", "one\n", "base")
+	commitFile(t, repo, "file.txt", "one\ntwo\n", "add two")
+
+	setTestEditor(t, repo, `sed -i -e 's/^pick/edit/' -e '1a exec touch exec-ran' "$1"`)
+
+	opts := testRebaseOptions(base)
+	opts.Interactive = true
+	msg, err := Rebase(repo, opts)
+	if err != nil {
+		t.Fatalf("Rebase failed: %v", err)
+	}
+	if !strings.HasPrefix(msg, "Stopped at") {
+		t.Fatalf("expected rebase to stop for edit, got %q", msg)
+	}
+
+	if err := os.WriteFile("file.txt", []byte("one\ntwo\namended\n"), 0644); err != nil {
+		t.Fatalf("failed to edit file: %v", err)
+	}
+	if err := Add(repo, "file.txt"); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	if _, err := RebaseContinue(repo, "Test Committer", "committer@example.com"); err != nil {
+		t.Fatalf("RebaseContinue failed: %v", err)
+	}
+
+	if _, err := os.Stat("exec-ran"); err != nil {
+		t.Error("exec line was not run")
+	}
+	commits, err := Log(repo)
+	if err != nil {
+		t.Fatalf("Log failed: %v", err)
+	}
+	if len(commits) != 2 || commits[0].Message != "add two" {
+		t.Fatalf("unexpected history after edit: %+v", commits)
+	}
+	tree, err := getCommitTree(repo, commits[0].Hash)
+	if err != nil {
+		t.Fatalf("getCommitTree failed: %v", err)
+	}
+	content, _ := readObject(repo, tree["file.txt"])
+	if string(content) != "one\ntwo\namended\n" {
+		t.Errorf("expected amended content in commit, got %q", content)
+	}
+}
+
+func TestRebaseReportsDroppedMerges(t *testing.T) {
+	repo := setupTestRepo(t)
+	base := commitFile(t, repo, "base.txt", "base\n", "base")
+	if err := CreateBranch(repo, "feature"); err != nil {
+		t.Fatalf("CreateBranch failed: %v", err)
+	}
+	commitFile(t, repo, "main.txt", "main\n", "main work")
+
+	if err := Checkout(repo, "feature"); err != nil {
+		t.Fatalf("Checkout failed: %v", err)
+	}
+	work := commitFile(t, repo, "feature.txt", "feature\n", "feature work")
+	workCommit, _ := readCommit(repo, work)
+	merge, err := commitTreeWithSignatures(workCommit.Tree, []string{work, base}, "merge base", workCommit.authorSignature(), workCommit.authorSignature())
+	if err != nil {
+		t.Fatalf("failed to create merge commit: %v", err)
+	}
+	if err := updateHEAD(repo, merge, "merge"); err != nil {
+		t.Fatal(err)
+	}
+	commitFile(t, repo, "more.txt", "more\n", "more work")
+
+	out, err := Rebase(repo, testRebaseOptions("main"))
+	if err != nil {
+		t.Fatalf("Rebase failed: %v", err)
+	}
+	if !strings.Contains(out, "dropping merge commit "+shortHash(merge)) {
+		t.Errorf("expected a notice about the dropped merge, got %q", out)
+	}
+	commits, _ := Log(repo)
+	if len(commits) != 4 || commits[0].Message != "more work" || commits[1].Message != "feature work" {
+		t.Errorf("expected the ordinary commits replayed without the merge: %+v", commits)
+	}
+}
@@ -0,0 +1,401 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var zeroHash = strings.Repeat("0", 2*HashSize)
+
+type ReflogEntry struct {
+	OldHash   string
+	NewHash   string
+	Identity  string
+	Timestamp int64
+	Timezone  string
+	Message   string
+}
+
+func reflogPath(repoPath, ref string) string {
+	return filepath.Join(repoPath, RepoDirName, "logs", ref)
+}
+
+// appendReflog records a ref update in logs/<ref> using git's reflog format:
+// "<old> <new> <name> <<email>> <timestamp> <tz>\t<message>".
+func appendReflog(repoPath, ref, oldHash, newHash, identity, message string) error {
+	if oldHash == "" {
+		oldHash = zeroHash
+	}
+	now := time.Now()
+	entry := ReflogEntry{
+		OldHash:   oldHash,
+		NewHash:   newHash,
+		Identity:  identity,
+		Timestamp: now.Unix(),
+		Timezone:  now.Format("-0700"),
+		Message:   message,
+	}
+
+	path := reflogPath(repoPath, ref)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create reflog directory: %w", err)
+	}
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open reflog: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := f.WriteString(formatReflogEntry(entry)); err != nil {
+		return fmt.Errorf("failed to write reflog: %w", err)
+	}
+	return nil
+}
+
+// reflogEnabled follows core.logallrefupdates: refs that already have a
+// reflog are always logged, "always" logs every ref, and the default logs
+// HEAD, branches and remote-tracking branches.
+func reflogEnabled(repoPath, ref string) bool {
+	if _, err := os.Stat(reflogPath(repoPath, ref)); err == nil {
+		return true
+	}
+
+	setting, err := GetConfig(repoPath, "core", "logallrefupdates")
+	if err != nil {
+		setting = "true"
+	}
+	switch setting {
+	case "always":
+		return true
+	case "false":
+		return false
+	}
+	return ref == "HEAD" || strings.HasPrefix(ref, "refs/heads/") || strings.HasPrefix(ref, "refs/remotes/")
+}
+
+// reflogIdentity returns the "Name <email>" recorded for ref updates, taken
+// from the committer environment or the user.* config.
+func reflogIdentity(repoPath string) string {
+	name := os.Getenv("GIT_COMMITTER_NAME")
+	if name == "" {
+		name = os.Getenv("GIT_AUTHOR_NAME")
+	}
+	if name == "" {
+		name, _ = GetConfig(repoPath, "user", "name")
+	}
+	email := os.Getenv("GIT_COMMITTER_EMAIL")
+	if email == "" {
+		email = os.Getenv("GIT_AUTHOR_EMAIL")
+	}
+	if email == "" {
+		email, _ = GetConfig(repoPath, "user", "email")
+	}
+
+	if name == "" {
+		name = "unknown"
+	}
+	return fmt.Sprintf("%s <%s>", name, email)
+}
+
+// logRefUpdate appends to the reflog of ref when reflogs are enabled for it.
+func logRefUpdate(repoPath, ref, oldHash, newHash, message string) error {
+	if !reflogEnabled(repoPath, ref) {
+		return nil
+	}
+	return appendReflog(repoPath, ref, oldHash, newHash, reflogIdentity(repoPath), message)
+}
+
+// updateRef points ref at newHash and records the change in its reflog.
+func updateRef(repoPath, ref, newHash, message string) error {
+	tx := BeginRefTransaction(repoPath)
+	if err := tx.Update(ref, newHash, "", message); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// deleteReflog removes the reflog of a deleted ref.
+func deleteReflog(repoPath, ref string) error {
+	if err := os.Remove(reflogPath(repoPath, ref)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete reflog: %w", err)
+	}
+	return nil
+}
+
+// renameReflog moves the reflog of oldRef over to newRef.
+func renameReflog(repoPath, oldRef, newRef string) error {
+	oldPath, newPath := reflogPath(repoPath, oldRef), reflogPath(repoPath, newRef)
+	if _, err := os.Stat(oldPath); os.IsNotExist(err) {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(newPath), 0755); err != nil {
+		return fmt.Errorf("failed to create reflog directory: %w", err)
+	}
+	if err := os.Rename(oldPath, newPath); err != nil {
+		return fmt.Errorf("failed to move reflog: %w", err)
+	}
+	return nil
+}
+
+// copyReflog gives newRef a copy of the reflog of oldRef.
+func copyReflog(repoPath, oldRef, newRef string) error {
+	data, err := os.ReadFile(reflogPath(repoPath, oldRef))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read reflog: %w", err)
+	}
+	newPath := reflogPath(repoPath, newRef)
+	if err := os.MkdirAll(filepath.Dir(newPath), 0755); err != nil {
+		return fmt.Errorf("failed to create reflog directory: %w", err)
+	}
+	if err := os.WriteFile(newPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to copy reflog: %w", err)
+	}
+	return nil
+}
+
+// readReflog returns the entries of logs/<ref>, oldest first.
+func readReflog(repoPath, ref string) ([]ReflogEntry, error) {
+	data, err := os.ReadFile(reflogPath(repoPath, ref))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read reflog: %w", err)
+	}
+
+	var entries []ReflogEntry
+	for _, line := range strings.Split(string(data), "\n") {
+		if line == "" {
+			continue
+		}
+		entry, err := parseReflogEntry(line)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func writeReflog(repoPath, ref string, entries []ReflogEntry) error {
+	var sb strings.Builder
+	for _, entry := range entries {
+		sb.WriteString(formatReflogEntry(entry))
+	}
+
+	path := reflogPath(repoPath, ref)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create reflog directory: %w", err)
+	}
+	if err := os.WriteFile(path, []byte(sb.String()), 0644); err != nil {
+		return fmt.Errorf("failed to write reflog: %w", err)
+	}
+	return nil
+}
+
+func formatReflogEntry(entry ReflogEntry) string {
+	return fmt.Sprintf("%s %s %s %d %s\t%s\n",
+		entry.OldHash, entry.NewHash, entry.Identity, entry.Timestamp, entry.Timezone, entry.Message)
+}
+
+func parseReflogEntry(line string) (ReflogEntry, error) {
+	header, message, _ := strings.Cut(line, "\t")
+
+	fields := strings.Fields(header)
+	if len(fields) < 4 {
+		return ReflogEntry{}, fmt.Errorf("invalid reflog entry: %s", line)
+	}
+
+	timestamp, err := strconv.ParseInt(fields[len(fields)-2], 10, 64)
+	if err != nil {
+		return ReflogEntry{}, fmt.Errorf("invalid reflog timestamp: %s", line)
+	}
+
+	return ReflogEntry{
+		OldHash:   fields[0],
+		NewHash:   fields[1],
+		Identity:  strings.Join(fields[2:len(fields)-2], " "),
+		Timestamp: timestamp,
+		Timezone:  fields[len(fields)-1],
+		Message:   message,
+	}, nil
+}
+
+// reflogRefName maps the name used in a reflog selector to the ref whose
+// log is read: "" is the current branch, and short names are looked up
+// under refs/heads, refs/tags and refs/remotes.
+func reflogRefName(repoPath, name string) (string, error) {
+	switch {
+	case name == "":
+		branch, err := GetCurrentBranch(repoPath)
+		if err != nil {
+			return "HEAD", nil
+		}
+		return "refs/heads/" + branch, nil
+	case name == "HEAD" || strings.HasPrefix(name, "refs/"):
+		return name, nil
+	case name == "stash":
+		return stashRef, nil
+	}
+
+	for _, prefix := range []string{"refs/heads/", "refs/tags/", "refs/remotes/"} {
+		ref := prefix + name
+		if _, ok, err := readRef(repoPath, ref); err != nil {
+			return "", err
+		} else if ok {
+			return ref, nil
+		}
+		if _, err := os.Stat(reflogPath(repoPath, ref)); err == nil {
+			return ref, nil
+		}
+	}
+	return "", fmt.Errorf("unknown ref '%s'", name)
+}
+
+// Reflog returns the reflog entries for a ref, most recent first.
+func Reflog(repoPath, name string) ([]ReflogEntry, error) {
+	ref, err := reflogRefName(repoPath, name)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := readReflog(repoPath, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+		entries[i], entries[j] = entries[j], entries[i]
+	}
+	return entries, nil
+}
+
+// resolveReflogRevision resolves <name>@{<selector>}, where selector is
+// either the number of updates to go back or an approxidate such as
+// "yesterday".
+func resolveReflogRevision(repoPath, name, selector string) (string, error) {
+	entries, err := Reflog(repoPath, name)
+	if err != nil {
+		return "", err
+	}
+	label := name + "@{" + selector + "}"
+
+	if n, err := strconv.Atoi(selector); err == nil {
+		if n < 0 {
+			return "", fmt.Errorf("invalid reflog selector '%s'", label)
+		}
+		if n == 0 && len(entries) == 0 {
+			if name == "" {
+				name = "HEAD"
+			}
+			return resolveRevisionName(repoPath, name)
+		}
+		if n >= len(entries) {
+			return "", fmt.Errorf("log for '%s' only has %d entries", name, len(entries))
+		}
+		return entries[n].NewHash, nil
+	}
+
+	when, err := ParseApproxidate(selector, time.Now())
+	if err != nil {
+		return "", fmt.Errorf("invalid reflog selector '%s': %w", label, err)
+	}
+	if len(entries) == 0 {
+		return "", fmt.Errorf("log for '%s' is empty", name)
+	}
+	for _, entry := range entries {
+		if entry.Timestamp <= when.Unix() {
+			return entry.NewHash, nil
+		}
+	}
+	// the log doesn't go back that far, so use its oldest entry
+	return entries[len(entries)-1].NewHash, nil
+}
+
+// ExpireReflog removes the entries of a ref's reflog that are older than
+// before and returns how many were removed.
+func ExpireReflog(repoPath, name string, before time.Time) (int, error) {
+	ref, err := reflogRefName(repoPath, name)
+	if err != nil {
+		return 0, err
+	}
+	entries, err := readReflog(repoPath, ref)
+	if err != nil {
+		return 0, err
+	}
+
+	var kept []ReflogEntry
+	for _, entry := range entries {
+		if entry.Timestamp >= before.Unix() {
+			kept = append(kept, entry)
+		}
+	}
+	if len(kept) == len(entries) {
+		return 0, nil
+	}
+	return len(entries) - len(kept), writeReflog(repoPath, ref, kept)
+}
+
+// DeleteReflogEntry removes a single entry, named as <ref>@{<n>}, from a
+// reflog. The ref itself is left alone.
+func DeleteReflogEntry(repoPath, spec string) error {
+	idx := strings.Index(spec, "@{")
+	if idx < 0 || !strings.HasSuffix(spec, "}") {
+		return fmt.Errorf("not a reflog entry: %s", spec)
+	}
+	n, err := strconv.Atoi(spec[idx+2 : len(spec)-1])
+	if err != nil || n < 0 {
+		return fmt.Errorf("not a reflog entry: %s", spec)
+	}
+
+	ref, err := reflogRefName(repoPath, spec[:idx])
+	if err != nil {
+		return err
+	}
+	entries, err := readReflog(repoPath, ref)
+	if err != nil {
+		return err
+	}
+	if n >= len(entries) {
+		return fmt.Errorf("reflog entry %s not found", spec)
+	}
+
+	pos := len(entries) - 1 - n
+	entries = append(entries[:pos], entries[pos+1:]...)
+	return writeReflog(repoPath, ref, entries)
+}
+
+// ListReflogs returns every ref that has a reflog.
+func ListReflogs(repoPath string) ([]string, error) {
+	logsDir := filepath.Join(repoPath, RepoDirName, "logs")
+	var refs []string
+
+	err := filepath.Walk(logsDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		ref, err := filepath.Rel(logsDir, path)
+		if err != nil {
+			return err
+		}
+		refs = append(refs, filepath.ToSlash(ref))
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list reflogs: %w", err)
+	}
+	return refs, nil
+}
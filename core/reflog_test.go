@@ -0,0 +1,115 @@
+package core
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReflogRecordsRefUpdates(t *testing.T) {
+	repo := setupTestRepo(t)
+	first := commitFile(t, repo, "file.txt", "one\n", "first")
+	second := commitFile(t, repo, "file.txt", "two\n", "second")
+
+	if err := CreateBranch(repo, "feature"); err != nil {
+		t.Fatalf("CreateBranch failed: %v", err)
+	}
+	if err := Checkout(repo, "feature"); err != nil {
+		t.Fatalf("Checkout failed: %v", err)
+	}
+	if _, err := Reset(repo, "HEAD~1", ResetHard); err != nil {
+		t.Fatalf("Reset failed: %v", err)
+	}
+
+	head, err := Reflog(repo, "HEAD")
+	if err != nil {
+		t.Fatalf("Reflog failed: %v", err)
+	}
+	wantMessages := []string{
+		"reset: moving to HEAD~1",
+		"checkout: moving from main to feature",
+		"commit: second",
+		"commit (initial): first",
+	}
+	if len(head) != len(wantMessages) {
+		t.Fatalf("expected %d HEAD entries, got %+v", len(wantMessages), head)
+	}
+	for i, want := range wantMessages {
+		if head[i].Message != want {
+			t.Errorf("HEAD@{%d}: expected %q, got %q", i, want, head[i].Message)
+		}
+	}
+	if head[0].OldHash != second || head[0].NewHash != first {
+		t.Errorf("reset entry should record %s -> %s, got %+v", second, first, head[0])
+	}
+	if head[3].OldHash != zeroHash {
+		t.Errorf("initial commit should have a zero old hash, got %s", head[3].OldHash)
+	}
+
+	feature, err := Reflog(repo, "feature")
+	if err != nil {
+		t.Fatalf("Reflog failed: %v", err)
+	}
+	if len(feature) != 2 || feature[1].Message != "branch: Created from HEAD" {
+		t.Errorf("unexpected feature reflog %+v", feature)
+	}
+
+	// HEAD@{1} is where HEAD was before the bad reset
+	if hash, err := resolveCommitish(repo, "HEAD@{1}"); err != nil || hash != second {
+		t.Errorf("HEAD@{1} should be %s, got %s (%v)", second, hash, err)
+	}
+	if hash, err := resolveCommitish(repo, "feature@{1}~1"); err != nil || hash != first {
+		t.Errorf("feature@{1}~1 should be %s, got %s (%v)", first, hash, err)
+	}
+	if hash, err := resolveCommitish(repo, "@{0}"); err != nil || hash != first {
+		t.Errorf("@{0} should be the current branch tip %s, got %s (%v)", first, hash, err)
+	}
+	if hash, err := resolveCommitish(repo, "main@{yesterday}"); err != nil || hash != first {
+		t.Errorf("a date before the log started should give the oldest entry, got %s (%v)", hash, err)
+	}
+	if _, err := resolveCommitish(repo, "HEAD@{10}"); err == nil || !strings.Contains(err.Error(), "only has") {
+		t.Errorf("expected an out of range error, got %v", err)
+	}
+
+	if err := DeleteReflogEntry(repo, "HEAD@{1}"); err != nil {
+		t.Fatalf("DeleteReflogEntry failed: %v", err)
+	}
+	if head, _ = Reflog(repo, "HEAD"); len(head) != 3 || head[1].Message != "commit: second" {
+		t.Errorf("unexpected reflog after delete %+v", head)
+	}
+
+	removed, err := ExpireReflog(repo, "HEAD", time.Now().Add(time.Hour))
+	if err != nil || removed != 3 {
+		t.Errorf("expected every entry to expire, got %d (%v)", removed, err)
+	}
+}
+
+func TestParseApproxidate(t *testing.T) {
+	now := time.Date(2024, 5, 10, 12, 0, 0, 0, time.UTC)
+
+	tests := map[string]time.Time{
+		"now":            now,
+		"yesterday":      now.AddDate(0, 0, -1),
+		"3 days ago":     now.Add(-72 * time.Hour),
+		"2.weeks.ago":    now.Add(-14 * 24 * time.Hour),
+		"1 month ago":    now.AddDate(0, -1, 0),
+		"2024-01-02":     time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC),
+		"@1700000000":    time.Unix(1700000000, 0),
+		"last week":      now.Add(-7 * 24 * time.Hour),
+		"5 minutes":      now.Add(-5 * time.Minute),
+		"today":          time.Date(2024, 5, 10, 0, 0, 0, 0, time.UTC),
+		"2024-01-02 3:4": {},
+	}
+	for input, want := range tests {
+		got, err := ParseApproxidate(input, now)
+		if want.IsZero() {
+			if err == nil {
+				t.Errorf("%q: expected an error, got %v", input, got)
+			}
+			continue
+		}
+		if err != nil || !got.Equal(want) {
+			t.Errorf("%q: expected %v, got %v (%v)", input, want, got, err)
+		}
+	}
+}
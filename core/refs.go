@@ -0,0 +1,472 @@
+package core
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+)
+
+const packedRefsFile = "packed-refs"
+
+// packedRef is one entry of the packed-refs file. Peeled is set for
+// annotated tags and holds the object the tag ultimately points at.
+type packedRef struct {
+	Name   string
+	Hash   string
+	Peeled string
+}
+
+func readPackedRef(repoPath, ref string) (string, bool, error) {
+	packed, err := readPackedRefs(repoPath)
+	if err != nil {
+		return "", false, err
+	}
+	for _, entry := range packed {
+		if entry.Name == ref {
+			return entry.Hash, true, nil
+		}
+	}
+	return "", false, nil
+}
+
+// readPackedRefs parses .senpai/packed-refs. A "^<hash>" line records the
+// peeled value of the ref on the line before it.
+func readPackedRefs(repoPath string) ([]packedRef, error) {
+	file, err := os.Open(filepath.Join(repoPath, RepoDirName, packedRefsFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read packed-refs: %w", err)
+	}
+	defer file.Close()
+
+	var refs []packedRef
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "" || strings.HasPrefix(line, "#"):
+			continue
+		case strings.HasPrefix(line, "^"):
+			if len(refs) == 0 {
+				return nil, fmt.Errorf("invalid packed-refs: peeled line without a ref")
+			}
+			refs[len(refs)-1].Peeled = line[1:]
+		default:
+			hash, name, ok := strings.Cut(line, " ")
+			if !ok {
+				return nil, fmt.Errorf("invalid packed-refs line: %s", line)
+			}
+			refs = append(refs, packedRef{Name: name, Hash: hash})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read packed-refs: %w", err)
+	}
+	return refs, nil
+}
+
+// writePackedRefs replaces packed-refs with refs, sorted by name. The file
+// is removed when refs is empty.
+func writePackedRefs(repoPath string, refs []packedRef) error {
+	lock, err := acquireLock(filepath.Join(repoPath, RepoDirName, packedRefsFile))
+	if err != nil {
+		return err
+	}
+	return commitPackedRefs(repoPath, lock, refs)
+}
+
+// commitPackedRefs writes refs through a lock already held on packed-refs.
+func commitPackedRefs(repoPath string, lock *lockFile, refs []packedRef) error {
+	if len(refs) == 0 {
+		lock.rollback()
+		if err := os.Remove(lock.path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove packed-refs: %w", err)
+		}
+		return nil
+	}
+
+	sort.Slice(refs, func(i, j int) bool { return refs[i].Name < refs[j].Name })
+
+	var content strings.Builder
+	content.WriteString("# pack-refs with: peeled fully-peeled sorted \n")
+	for _, ref := range refs {
+		fmt.Fprintf(&content, "%s %s\n", ref.Hash, ref.Name)
+		if ref.Peeled != "" {
+			fmt.Fprintf(&content, "^%s\n", ref.Peeled)
+		}
+	}
+
+	if err := lock.write([]byte(content.String())); err != nil {
+		lock.rollback()
+		return err
+	}
+	return lock.commit()
+}
+
+// filesRefStore is the "files" ref backend: HEAD and every ref are plain
+// files under the repository directory, optionally packed into packed-refs.
+// Loose refs take priority over packed entries of the same name.
+type filesRefStore struct {
+	repoPath   string
+	packedLock *lockFile
+}
+
+func (s *filesRefStore) ReadRef(ref string) (string, bool, error) {
+	content, err := os.ReadFile(filepath.Join(s.repoPath, RepoDirName, ref))
+	if errors.Is(err, fs.ErrNotExist) || errors.Is(err, syscall.EISDIR) {
+		return readPackedRef(s.repoPath, ref)
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("failed to read %s: %w", ref, err)
+	}
+	value := strings.TrimSpace(string(content))
+	return value, value != "", nil
+}
+
+func (s *filesRefStore) ListRefs(prefix string) (map[string]string, error) {
+	refs := make(map[string]string)
+
+	packed, err := readPackedRefs(s.repoPath)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range packed {
+		if strings.HasPrefix(entry.Name, prefix) {
+			refs[entry.Name] = entry.Hash
+		}
+	}
+
+	repoDir := filepath.Join(s.repoPath, RepoDirName)
+	err = filepath.Walk(filepath.Join(repoDir, "refs"), func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if info.IsDir() || strings.HasSuffix(path, ".lock") {
+			return nil
+		}
+
+		rel, err := filepath.Rel(repoDir, path)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+		if !strings.HasPrefix(name, prefix) {
+			return nil
+		}
+
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if value := strings.TrimSpace(string(content)); value != "" {
+			refs[name] = value
+		}
+		return nil
+	})
+	return refs, err
+}
+
+// lockRefs takes <ref>.lock for every update, plus packed-refs.lock when a
+// ref is deleted, since it may also be packed.
+func (s *filesRefStore) lockRefs(updates []*refUpdate) error {
+	for _, update := range updates {
+		lock, err := acquireLock(filepath.Join(s.repoPath, RepoDirName, update.ref))
+		if err != nil {
+			return fmt.Errorf("cannot lock ref '%s': %w", update.ref, err)
+		}
+		update.lock = lock
+
+		if update.isDelete() && s.packedLock == nil {
+			if s.packedLock, err = acquireLock(filepath.Join(s.repoPath, RepoDirName, packedRefsFile)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *filesRefStore) commitRefs(updates []*refUpdate) error {
+	defer s.unlockRefs(updates)
+
+	if s.packedLock != nil {
+		if err := s.deletePackedRefs(updates); err != nil {
+			return err
+		}
+	}
+
+	for _, update := range updates {
+		switch {
+		case update.isVerify():
+		case update.isDelete():
+			loosePath := filepath.Join(s.repoPath, RepoDirName, update.ref)
+			if err := os.Remove(loosePath); err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("failed to delete %s: %w", update.ref, err)
+			}
+			update.lock.rollback()
+			update.lock = nil
+			removeEmptyRefDirs(s.repoPath, filepath.Dir(loosePath))
+		default:
+			if err := update.lock.write([]byte(update.storedValue() + "\n")); err != nil {
+				return err
+			}
+			err := update.lock.commit()
+			update.lock = nil
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// deletePackedRefs drops the deleted refs from packed-refs using the lock
+// taken by lockRefs.
+func (s *filesRefStore) deletePackedRefs(updates []*refUpdate) error {
+	deleted := make(map[string]bool)
+	for _, update := range updates {
+		if update.isDelete() {
+			deleted[update.ref] = true
+		}
+	}
+
+	packed, err := readPackedRefs(s.repoPath)
+	if err != nil {
+		return err
+	}
+	kept := packed[:0]
+	for _, entry := range packed {
+		if !deleted[entry.Name] {
+			kept = append(kept, entry)
+		}
+	}
+
+	lock := s.packedLock
+	s.packedLock = nil
+	if len(kept) == len(packed) {
+		lock.rollback()
+		return nil
+	}
+	return commitPackedRefs(s.repoPath, lock, kept)
+}
+
+func (s *filesRefStore) unlockRefs(updates []*refUpdate) {
+	for _, update := range updates {
+		if update.lock != nil {
+			update.lock.rollback()
+			update.lock = nil
+		}
+	}
+	if s.packedLock != nil {
+		s.packedLock.rollback()
+		s.packedLock = nil
+	}
+}
+
+// createRefFiles writes refs (stored values keyed by name, including HEAD)
+// as a fresh files backend: HEAD as a file and everything else packed.
+func createRefFiles(repoPath string, refs map[string]string) error {
+	repoDir := filepath.Join(repoPath, RepoDirName)
+	// a reftable repository only has placeholder files here
+	if err := os.RemoveAll(filepath.Join(repoDir, "refs")); err != nil {
+		return fmt.Errorf("failed to reset refs: %w", err)
+	}
+	for _, dir := range []string{"refs/heads", "refs/tags"} {
+		if err := os.MkdirAll(filepath.Join(repoDir, dir), 0755); err != nil {
+			return fmt.Errorf("failed to create %s: %w", dir, err)
+		}
+	}
+
+	var packed []packedRef
+	for name, value := range refs {
+		if name == "HEAD" || strings.HasPrefix(value, "ref: ") {
+			path := filepath.Join(repoDir, name)
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				return fmt.Errorf("failed to create ref directory: %w", err)
+			}
+			if err := os.WriteFile(path, []byte(value+"\n"), 0644); err != nil {
+				return fmt.Errorf("failed to write %s: %w", name, err)
+			}
+			continue
+		}
+		entry := packedRef{Name: name, Hash: value}
+		if peeled, err := peelObject(repoPath, value, "", name); err == nil && peeled != value {
+			entry.Peeled = peeled
+		}
+		packed = append(packed, entry)
+	}
+	return writePackedRefs(repoPath, packed)
+}
+
+// removeRefFiles deletes the loose and packed refs of the files backend
+// after a migration. Like git, it leaves a HEAD and a refs/heads file
+// behind so that tools unaware of reftable refuse to treat the directory as
+// a files repository.
+func removeRefFiles(repoPath string) error {
+	repoDir := filepath.Join(repoPath, RepoDirName)
+	if err := os.Remove(filepath.Join(repoDir, packedRefsFile)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove packed-refs: %w", err)
+	}
+	if err := os.RemoveAll(filepath.Join(repoDir, "refs")); err != nil {
+		return fmt.Errorf("failed to remove loose refs: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Join(repoDir, "refs"), 0755); err != nil {
+		return fmt.Errorf("failed to create refs: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(repoDir, "refs", "heads"), []byte("this repository uses the reftable format\n"), 0644); err != nil {
+		return fmt.Errorf("failed to write refs/heads: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(repoDir, "HEAD"), []byte("ref: refs/heads/.invalid\n"), 0644); err != nil {
+		return fmt.Errorf("failed to write HEAD: %w", err)
+	}
+	return nil
+}
+
+// sortedRefNames returns the names of refs in ascending order.
+func sortedRefNames(refs map[string]string) []string {
+	names := make([]string, 0, len(refs))
+	for name := range refs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// deleteRef removes ref from both the loose refs and packed-refs.
+func deleteRef(repoPath, ref string) error {
+	tx := BeginRefTransaction(repoPath)
+	tx.NoDeref()
+	if err := tx.Delete(ref, "", ""); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// removeEmptyRefDirs removes empty directories left behind by a deleted ref,
+// stopping at the top-level directories such as refs/heads.
+func removeEmptyRefDirs(repoPath, dir string) {
+	refsDir := filepath.Join(repoPath, RepoDirName, "refs")
+	for filepath.Dir(dir) != refsDir && strings.HasPrefix(dir, refsDir+string(filepath.Separator)) {
+		if err := os.Remove(dir); err != nil {
+			return
+		}
+		dir = filepath.Dir(dir)
+	}
+}
+
+// PackRefs moves refs into the packed-refs file. Tags and refs that are
+// already packed are always included; all adds every other ref under refs/.
+// With prune, the loose copies of packed refs are removed, each under its
+// ref lock and only while it still holds the packed value. A reftable
+// repository is compacted into a single table instead.
+func PackRefs(repoPath string, all, prune bool) error {
+	if refStorageFormat(repoPath) == RefFormatReftable {
+		return CompactReftable(repoPath)
+	}
+
+	lock, err := acquireLock(filepath.Join(repoPath, RepoDirName, packedRefsFile))
+	if err != nil {
+		return err
+	}
+	packed, err := readPackedRefs(repoPath)
+	if err != nil {
+		lock.rollback()
+		return err
+	}
+	byName := make(map[string]packedRef)
+	for _, entry := range packed {
+		byName[entry.Name] = entry
+	}
+
+	repoDir := filepath.Join(repoPath, RepoDirName)
+	var loose []packedRef
+	err = filepath.Walk(filepath.Join(repoDir, "refs"), func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || strings.HasSuffix(path, ".lock") {
+			return nil
+		}
+		rel, err := filepath.Rel(repoDir, path)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+		if _, isPacked := byName[name]; !all && !isPacked && !strings.HasPrefix(name, "refs/tags/") {
+			return nil
+		}
+
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		hash := strings.TrimSpace(string(content))
+		if strings.HasPrefix(hash, "ref: ") || hash == "" {
+			// symbolic refs stay loose
+			return nil
+		}
+
+		entry := packedRef{Name: name, Hash: hash}
+		if peeled, err := peelObject(repoPath, hash, "", name); err == nil && peeled != hash {
+			entry.Peeled = peeled
+		}
+		byName[name] = entry
+		loose = append(loose, entry)
+		return nil
+	})
+	if err != nil {
+		lock.rollback()
+		return fmt.Errorf("failed to pack refs: %w", err)
+	}
+
+	refs := make([]packedRef, 0, len(byName))
+	for _, entry := range byName {
+		refs = append(refs, entry)
+	}
+	if err := commitPackedRefs(repoPath, lock, refs); err != nil {
+		return err
+	}
+
+	if prune {
+		for _, entry := range loose {
+			if err := pruneLooseRef(repoPath, entry); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// pruneLooseRef removes the loose copy of a ref that was just packed. The
+// ref is locked as a transaction would lock it, and left alone when it is
+// locked already or has moved on since it was packed.
+func pruneLooseRef(repoPath string, entry packedRef) error {
+	path := filepath.Join(repoPath, RepoDirName, entry.Name)
+	lock, err := acquireLock(path)
+	if err != nil {
+		return nil
+	}
+	content, err := os.ReadFile(path)
+	if err != nil || strings.TrimSpace(string(content)) != entry.Hash {
+		lock.rollback()
+		return nil
+	}
+	err = os.Remove(path)
+	lock.rollback()
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to prune %s: %w", entry.Name, err)
+	}
+	removeEmptyRefDirs(repoPath, filepath.Dir(path))
+	return nil
+}
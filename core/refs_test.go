@@ -0,0 +1,157 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPackRefs(t *testing.T) {
+	repo := setupTestRepo(t)
+	first := commitFile(t, repo, "file.txt", "one\n", "first")
+	second := commitFile(t, repo, "file.txt", "two\n", "second")
+
+	if err := CreateBranchAt(repo, "topic/old", first); err != nil {
+		t.Fatalf("CreateBranchAt failed: %v", err)
+	}
+	tagHash, err := CreateTag(repo, "v1", "", TagOptions{Message: "v1", Name: "T", Email: "t@example.com"})
+	if err != nil {
+		t.Fatalf("CreateTag failed: %v", err)
+	}
+
+	if err := PackRefs(repo, true, true); err != nil {
+		t.Fatalf("PackRefs failed: %v", err)
+	}
+
+	for _, loose := range []string{"refs/heads/main", "refs/heads/topic", "refs/tags/v1"} {
+		if _, err := os.Stat(filepath.Join(repo, RepoDirName, loose)); !os.IsNotExist(err) {
+			t.Errorf("%s should have been pruned", loose)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(repo, RepoDirName, "refs", "heads")); err != nil {
+		t.Errorf("refs/heads itself should be kept: %v", err)
+	}
+
+	packed, err := readPackedRefs(repo)
+	if err != nil {
+		t.Fatalf("readPackedRefs failed: %v", err)
+	}
+	want := []packedRef{
+		{Name: "refs/heads/main", Hash: second},
+		{Name: "refs/heads/topic/old", Hash: first},
+		{Name: "refs/tags/v1", Hash: tagHash, Peeled: second},
+	}
+	if !reflect.DeepEqual(packed, want) {
+		t.Errorf("unexpected packed refs:\n got %+v\nwant %+v", packed, want)
+	}
+
+	branches, err := ListBranches(repo)
+	if err != nil || !reflect.DeepEqual(branches, []string{"main", "topic/old"}) {
+		t.Errorf("packed branches should be listed, got %v (%v)", branches, err)
+	}
+	if tags, err := ListTags(repo, nil, ""); err != nil || !reflect.DeepEqual(tags, []string{"v1"}) {
+		t.Errorf("packed tags should be listed, got %v (%v)", tags, err)
+	}
+	if hash, err := resolveCommitish(repo, "v1~1"); err != nil || hash != first {
+		t.Errorf("v1~1 should resolve through packed-refs to %s, got %s (%v)", first, hash, err)
+	}
+
+	// a new commit writes a loose ref that shadows the packed entry
+	third := commitFile(t, repo, "file.txt", "three\n", "third")
+	if hash, err := ResolveBranchCommit(repo, "main"); err != nil || hash != third {
+		t.Errorf("loose ref should take priority, got %s (%v)", hash, err)
+	}
+	if commits, err := Log(repo); err != nil || len(commits) != 3 {
+		t.Errorf("expected 3 commits in the log, got %d (%v)", len(commits), err)
+	}
+
+	if err := DeleteBranch(repo, "topic/old", false); err != nil {
+		t.Fatalf("DeleteBranch failed: %v", err)
+	}
+	if _, err := DeleteTag(repo, "v1"); err != nil {
+		t.Fatalf("DeleteTag failed: %v", err)
+	}
+	packed, _ = readPackedRefs(repo)
+	if len(packed) != 1 || packed[0].Name != "refs/heads/main" {
+		t.Errorf("deleted refs should be removed from packed-refs, got %+v", packed)
+	}
+	if exists, _ := BranchExists(repo, "topic/old"); exists {
+		t.Error("deleted branch should no longer exist")
+	}
+}
+
+func TestPackRefsTagsOnly(t *testing.T) {
+	repo := setupTestRepo(t)
+	commitFile(t, repo, "file.txt", "one\n", "first")
+	if _, err := CreateTag(repo, "light", "", TagOptions{}); err != nil {
+		t.Fatalf("CreateTag failed: %v", err)
+	}
+
+	if err := PackRefs(repo, false, false); err != nil {
+		t.Fatalf("PackRefs failed: %v", err)
+	}
+	packed, _ := readPackedRefs(repo)
+	if len(packed) != 1 || packed[0].Name != "refs/tags/light" || packed[0].Peeled != "" {
+		t.Errorf("only the tag should be packed, got %+v", packed)
+	}
+	if _, err := os.Stat(filepath.Join(repo, RepoDirName, "refs", "tags", "light")); err != nil {
+		t.Errorf("loose tag should be kept without prune: %v", err)
+	}
+}
+
+func TestReadPackedRefsFromGit(t *testing.T) {
+	repo := setupTestRepo(t)
+	head := commitFile(t, repo, "file.txt", "one\n", "first")
+	if err := os.Remove(filepath.Join(repo, RepoDirName, "refs", "heads", "main")); err != nil {
+		t.Fatal(err)
+	}
+
+	tag := strings.Repeat("a", 40)
+	content := "# pack-refs with: peeled fully-peeled sorted \n" +
+		head + " refs/heads/main\n" +
+		head + " refs/remotes/origin/main\n" +
+		tag + " refs/tags/v2\n" +
+		"^" + head + "\n"
+	if err := os.WriteFile(filepath.Join(repo, RepoDirName, packedRefsFile), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	packed, err := readPackedRefs(repo)
+	if err != nil {
+		t.Fatalf("readPackedRefs failed: %v", err)
+	}
+	if len(packed) != 3 || packed[2].Peeled != head {
+		t.Errorf("unexpected packed refs %+v", packed)
+	}
+	if branches, _ := ListBranches(repo); !reflect.DeepEqual(branches, []string{"main"}) {
+		t.Errorf("expected the packed main branch, got %v", branches)
+	}
+	if hash, err := resolveCommitish(repo, "origin/main"); err != nil || hash != head {
+		t.Errorf("origin/main should resolve to %s, got %s (%v)", head, hash, err)
+	}
+	if hash, err := resolveHead(repo); err != nil || hash != head {
+		t.Errorf("HEAD should resolve through packed-refs, got %s (%v)", hash, err)
+	}
+}
+
+func TestPackRefsLeavesLockedRefsLoose(t *testing.T) {
+	repo := setupTestRepo(t)
+	head := commitFile(t, repo, "file.txt", "one\n", "first")
+
+	// a transaction holding the ref may be about to move it
+	lock, err := acquireLock(filepath.Join(repo, RepoDirName, "refs", "heads", "main"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := PackRefs(repo, true, true); err != nil {
+		t.Fatalf("PackRefs failed: %v", err)
+	}
+	lock.rollback()
+
+	content, err := os.ReadFile(filepath.Join(repo, RepoDirName, "refs", "heads", "main"))
+	if err != nil || strings.TrimSpace(string(content)) != head {
+		t.Errorf("a locked ref should keep its loose file, got %q (%v)", content, err)
+	}
+}
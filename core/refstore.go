@@ -0,0 +1,221 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+const (
+	RefFormatFiles    = "files"
+	RefFormatReftable = "reftable"
+)
+
+// RefStore is the storage backend for HEAD and the refs under refs/. The
+// "files" backend keeps one file per ref plus packed-refs; the "reftable"
+// backend keeps them in a stack of binary tables. Pseudo-refs such as
+// ORIG_HEAD and FETCH_HEAD are plain files with either backend, and so are
+// the reflogs under logs/.
+type RefStore interface {
+	// ReadRef returns the value stored for ref without following symbolic
+	// refs: an object hash, or "ref: <target>" for a symbolic ref.
+	ReadRef(ref string) (string, bool, error)
+	// ListRefs returns the stored value of every ref under refs/ whose name
+	// starts with prefix.
+	ListRefs(prefix string) (map[string]string, error)
+
+	// lockRefs takes whatever locks are needed to apply updates. Readers
+	// still see the old values until commitRefs.
+	lockRefs(updates []*refUpdate) error
+	// commitRefs applies updates, whose old values have been verified, and
+	// releases the locks.
+	commitRefs(updates []*refUpdate) error
+	// unlockRefs releases the locks without changing anything.
+	unlockRefs(updates []*refUpdate)
+}
+
+// refStorageFormat returns the ref backend configured by
+// extensions.refStorage.
+func refStorageFormat(repoPath string) string {
+	for _, key := range []string{"refStorage", "refstorage"} {
+		if value, err := GetConfig(repoPath, "extensions", key); err == nil {
+			return strings.ToLower(value)
+		}
+	}
+	return RefFormatFiles
+}
+
+func openRefStore(repoPath string) (RefStore, error) {
+	return newRefStore(repoPath, refStorageFormat(repoPath))
+}
+
+func newRefStore(repoPath, format string) (RefStore, error) {
+	switch format {
+	case RefFormatFiles:
+		return &filesRefStore{repoPath: repoPath}, nil
+	case RefFormatReftable:
+		return &reftableRefStore{repoPath: repoPath}, nil
+	}
+	return nil, fmt.Errorf("unknown ref storage format '%s'", format)
+}
+
+// isPseudoRef reports whether ref is a pseudo-ref like ORIG_HEAD, which is
+// stored as a file in the repository directory rather than in the RefStore.
+func isPseudoRef(ref string) bool {
+	return ref != "HEAD" && !strings.HasPrefix(ref, "refs/")
+}
+
+// readRawRef returns the stored value of ref without following symbolic
+// refs.
+func readRawRef(repoPath, ref string) (string, bool, error) {
+	if isPseudoRef(ref) {
+		content, err := os.ReadFile(filepath.Join(repoPath, RepoDirName, ref))
+		if err == nil {
+			value := strings.TrimSpace(string(content))
+			return value, value != "", nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) && !errors.Is(err, syscall.EISDIR) {
+			return "", false, fmt.Errorf("failed to read %s: %w", ref, err)
+		}
+	}
+
+	store, err := openRefStore(repoPath)
+	if err != nil {
+		return "", false, err
+	}
+	return store.ReadRef(ref)
+}
+
+// readRef returns the hash a ref points at, following symbolic refs. The
+// boolean result is false when the ref doesn't exist.
+func readRef(repoPath, ref string) (string, bool, error) {
+	for depth := 0; depth < 5; depth++ {
+		value, ok, err := readRawRef(repoPath, ref)
+		if err != nil || !ok {
+			return "", false, err
+		}
+		if !strings.HasPrefix(value, "ref: ") {
+			return value, true, nil
+		}
+		ref = strings.TrimPrefix(value, "ref: ")
+	}
+	return "", false, fmt.Errorf("too many levels of symbolic refs at %s", ref)
+}
+
+// followSymref resolves a chain of symbolic refs, returning the ref at the
+// end and the symbolic refs passed through.
+func followSymref(repoPath, ref string) (string, []string, error) {
+	var symrefs []string
+	for depth := 0; depth < 5; depth++ {
+		value, _, err := readRawRef(repoPath, ref)
+		if err != nil {
+			return "", nil, err
+		}
+		if !strings.HasPrefix(value, "ref: ") {
+			return ref, symrefs, nil
+		}
+		symrefs = append(symrefs, ref)
+		ref = strings.TrimPrefix(value, "ref: ")
+	}
+	return "", nil, fmt.Errorf("too many levels of symbolic refs at %s", ref)
+}
+
+// listRefs returns every ref whose name starts with prefix, mapped to the
+// hash it resolves to.
+func listRefs(repoPath, prefix string) (map[string]string, error) {
+	store, err := openRefStore(repoPath)
+	if err != nil {
+		return nil, err
+	}
+	stored, err := store.ListRefs(prefix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list refs: %w", err)
+	}
+
+	refs := make(map[string]string, len(stored))
+	for name, value := range stored {
+		if strings.HasPrefix(value, "ref: ") {
+			hash, ok, err := readRef(repoPath, name)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				continue
+			}
+			value = hash
+		}
+		refs[name] = value
+	}
+	return refs, nil
+}
+
+// writeSymref points the symbolic ref ref (usually HEAD) at target.
+func writeSymref(repoPath, ref, target string) error {
+	tx := BeginRefTransaction(repoPath)
+	if err := tx.queue(&refUpdate{ref: ref, symTarget: target, noDeref: true, noLog: true}); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to update %s: %w", ref, err)
+	}
+	return nil
+}
+
+// MigrateRefStorage moves every ref into a store of the given format and
+// switches extensions.refStorage over to it.
+func MigrateRefStorage(repoPath, format string) error {
+	current := refStorageFormat(repoPath)
+	if format == current {
+		return fmt.Errorf("repository already uses the '%s' format", format)
+	}
+	from, err := newRefStore(repoPath, current)
+	if err != nil {
+		return err
+	}
+	if _, err := newRefStore(repoPath, format); err != nil {
+		return err
+	}
+
+	refs, err := from.ListRefs("refs/")
+	if err != nil {
+		return err
+	}
+	head, ok, err := from.ReadRef("HEAD")
+	if err != nil {
+		return err
+	}
+	if ok {
+		refs["HEAD"] = head
+	}
+
+	switch format {
+	case RefFormatReftable:
+		if err := createReftable(repoPath, refs); err != nil {
+			return err
+		}
+	default:
+		if err := createRefFiles(repoPath, refs); err != nil {
+			return err
+		}
+	}
+
+	if err := SetConfig(repoPath, "extensions", "refStorage", format); err != nil {
+		return err
+	}
+	if format == RefFormatReftable {
+		if err := SetConfig(repoPath, "core", "repositoryformatversion", "1"); err != nil {
+			return err
+		}
+	}
+
+	switch current {
+	case RefFormatReftable:
+		return os.RemoveAll(filepath.Join(repoPath, RepoDirName, reftableDir))
+	default:
+		return removeRefFiles(repoPath)
+	}
+}
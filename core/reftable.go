@@ -0,0 +1,671 @@
+package core
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io/fs"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// The reftable backend stores refs in a stack of immutable tables under
+// .senpai/reftable. tables.list names the tables from oldest to newest;
+// every transaction appends a table holding the refs it changed, and a
+// newer table's record for a ref (including a deletion) hides older ones.
+// Tables are merged back together as the stack grows so lookups stay cheap.
+//
+// Tables use version 1 of the reftable format with SHA-1 ids. Only ref
+// blocks are written: the tables stay small enough that readers can scan
+// them without an index, and reflogs remain in logs/.
+const (
+	reftableDir             = "reftable"
+	reftableListFile        = "tables.list"
+	reftableMagic           = "REFT"
+	reftableVersion         = 1
+	reftableBlockSize       = 4096
+	reftableRestartInterval = 16
+	reftableHeaderSize      = 24
+	reftableFooterSize      = 68
+)
+
+const (
+	reftableDeletion byte = iota
+	reftableValue
+	reftableValuePeeled
+	reftableSymref
+)
+
+type reftableRecord struct {
+	name        string
+	updateIndex uint64
+	valueType   byte
+	hash        string
+	peeled      string
+	target      string
+}
+
+// value returns the record as a stored ref value.
+func (r reftableRecord) value() string {
+	if r.valueType == reftableSymref {
+		return "ref: " + r.target
+	}
+	return r.hash
+}
+
+type reftable struct {
+	minUpdateIndex uint64
+	maxUpdateIndex uint64
+	records        []reftableRecord
+}
+
+// putReftableVarint appends v using the same variable-length encoding as
+// pack offsets, where each continuation byte also adds one.
+func putReftableVarint(buf []byte, v uint64) []byte {
+	var tmp [10]byte
+	i := len(tmp) - 1
+	tmp[i] = byte(v & 0x7f)
+	for v >>= 7; v != 0; v >>= 7 {
+		v--
+		i--
+		tmp[i] = 0x80 | byte(v&0x7f)
+	}
+	return append(buf, tmp[i:]...)
+}
+
+func getReftableVarint(data []byte) (uint64, int, error) {
+	if len(data) == 0 {
+		return 0, 0, fmt.Errorf("truncated varint")
+	}
+	v := uint64(data[0] & 0x7f)
+	n := 1
+	for data[n-1]&0x80 != 0 {
+		if n >= len(data) || n >= 10 {
+			return 0, 0, fmt.Errorf("truncated varint")
+		}
+		v = (v+1)<<7 | uint64(data[n]&0x7f)
+		n++
+	}
+	return v, n, nil
+}
+
+func putUint24(buf []byte, v int) []byte {
+	return append(buf, byte(v>>16), byte(v>>8), byte(v))
+}
+
+func getUint24(data []byte) int {
+	return int(data[0])<<16 | int(data[1])<<8 | int(data[2])
+}
+
+func reftableHeader(minIndex, maxIndex uint64) []byte {
+	header := append([]byte(reftableMagic), reftableVersion)
+	header = putUint24(header, reftableBlockSize)
+	header = binary.BigEndian.AppendUint64(header, minIndex)
+	return binary.BigEndian.AppendUint64(header, maxIndex)
+}
+
+// encodeReftable serializes records, which must be sorted by name, into a
+// table covering the update indices minIndex to maxIndex.
+func encodeReftable(records []reftableRecord, minIndex, maxIndex uint64) ([]byte, error) {
+	out := reftableHeader(minIndex, maxIndex)
+
+	var block []byte
+	var restarts []int
+	var count int
+	prevName := ""
+	blockStart := 0
+	flush := func() {
+		if count == 0 {
+			return
+		}
+		for _, offset := range restarts {
+			block = putUint24(block, offset)
+		}
+		block = binary.BigEndian.AppendUint16(block, uint16(len(restarts)))
+		// the first block's length covers the file header in front of it
+		length := len(out) - blockStart + len(block)
+		out = append(out, 'r')
+		out = putUint24(out, length)
+		out = append(out, block[4:]...)
+		blockStart = len(out)
+		block, restarts, count, prevName = nil, nil, 0, ""
+	}
+
+	for _, record := range records {
+		if record.updateIndex < minIndex || record.updateIndex > maxIndex {
+			return nil, fmt.Errorf("update index of %s outside of table range", record.name)
+		}
+		encoded, err := encodeReftableRecord(record, prevName, count%reftableRestartInterval == 0, minIndex)
+		if err != nil {
+			return nil, err
+		}
+		// leave room for the restart table, including a new restart point
+		size := len(out) - blockStart + len(block) + len(encoded) + 3*(len(restarts)+1) + 2
+		if count > 0 && size > reftableBlockSize {
+			flush()
+			encoded, _ = encodeReftableRecord(record, "", true, minIndex)
+		}
+		if block == nil {
+			block = make([]byte, 4)
+		}
+		if count%reftableRestartInterval == 0 {
+			restarts = append(restarts, len(out)-blockStart+len(block))
+		}
+		block = append(block, encoded...)
+		prevName = record.name
+		count++
+	}
+	flush()
+
+	footer := append(reftableHeader(minIndex, maxIndex), make([]byte, 40)...)
+	footer = binary.BigEndian.AppendUint32(footer, crc32.ChecksumIEEE(footer))
+	return append(out, footer...), nil
+}
+
+func encodeReftableRecord(record reftableRecord, prevName string, restart bool, minIndex uint64) ([]byte, error) {
+	prefix := 0
+	if !restart {
+		for prefix < len(prevName) && prefix < len(record.name) && prevName[prefix] == record.name[prefix] {
+			prefix++
+		}
+	}
+	suffix := record.name[prefix:]
+
+	buf := putReftableVarint(nil, uint64(prefix))
+	buf = putReftableVarint(buf, uint64(len(suffix))<<3|uint64(record.valueType))
+	buf = append(buf, suffix...)
+	buf = putReftableVarint(buf, record.updateIndex-minIndex)
+
+	switch record.valueType {
+	case reftableDeletion:
+	case reftableValue, reftableValuePeeled:
+		hashes := []string{record.hash}
+		if record.valueType == reftableValuePeeled {
+			hashes = append(hashes, record.peeled)
+		}
+		for _, hash := range hashes {
+			raw, err := hex.DecodeString(hash)
+			if err != nil || len(raw) != HashSize {
+				return nil, fmt.Errorf("invalid object id '%s' for %s", hash, record.name)
+			}
+			buf = append(buf, raw...)
+		}
+	case reftableSymref:
+		buf = putReftableVarint(buf, uint64(len(record.target)))
+		buf = append(buf, record.target...)
+	default:
+		return nil, fmt.Errorf("unknown value type %d for %s", record.valueType, record.name)
+	}
+	return buf, nil
+}
+
+// decodeReftable parses a table written by encodeReftable or git.
+func decodeReftable(data []byte) (*reftable, error) {
+	if len(data) < reftableHeaderSize+reftableFooterSize || string(data[:4]) != reftableMagic {
+		return nil, fmt.Errorf("not a reftable")
+	}
+	if data[4] != reftableVersion {
+		return nil, fmt.Errorf("unsupported reftable version %d", data[4])
+	}
+	footerStart := len(data) - reftableFooterSize
+	footer := data[footerStart:]
+	if !bytes.Equal(footer[:reftableHeaderSize], data[:reftableHeaderSize]) {
+		return nil, fmt.Errorf("reftable footer doesn't match its header")
+	}
+	if crc32.ChecksumIEEE(footer[:reftableFooterSize-4]) != binary.BigEndian.Uint32(footer[reftableFooterSize-4:]) {
+		return nil, fmt.Errorf("reftable footer checksum mismatch")
+	}
+
+	table := &reftable{
+		minUpdateIndex: binary.BigEndian.Uint64(data[8:16]),
+		maxUpdateIndex: binary.BigEndian.Uint64(data[16:24]),
+	}
+	for offset := 0; ; {
+		headerOffset := offset
+		if offset == 0 {
+			headerOffset = reftableHeaderSize
+		}
+		if headerOffset+4 > footerStart || data[headerOffset] != 'r' {
+			break
+		}
+		blockEnd := offset + getUint24(data[headerOffset+1:])
+		if blockEnd > footerStart || blockEnd < headerOffset+6 {
+			return nil, fmt.Errorf("corrupt reftable block at %d", offset)
+		}
+		restartCount := int(binary.BigEndian.Uint16(data[blockEnd-2:]))
+		recordsEnd := blockEnd - 2 - 3*restartCount
+		if recordsEnd < headerOffset+4 {
+			return nil, fmt.Errorf("corrupt reftable block at %d", offset)
+		}
+		if err := table.decodeRecords(data[headerOffset+4 : recordsEnd]); err != nil {
+			return nil, err
+		}
+
+		offset = blockEnd
+		// padded tables fill every block but the last up to the block size
+		for offset < footerStart && data[offset] == 0 {
+			offset++
+		}
+	}
+	return table, nil
+}
+
+func (t *reftable) decodeRecords(data []byte) error {
+	prevName := ""
+	for len(data) > 0 {
+		prefix, n, err := getReftableVarint(data)
+		if err != nil {
+			return err
+		}
+		data = data[n:]
+		lengthAndType, n, err := getReftableVarint(data)
+		if err != nil {
+			return err
+		}
+		data = data[n:]
+		suffixLen := int(lengthAndType >> 3)
+		if int(prefix) > len(prevName) || suffixLen > len(data) {
+			return fmt.Errorf("corrupt reftable record")
+		}
+		record := reftableRecord{
+			name:      prevName[:prefix] + string(data[:suffixLen]),
+			valueType: byte(lengthAndType & 7),
+		}
+		data = data[suffixLen:]
+		delta, n, err := getReftableVarint(data)
+		if err != nil {
+			return err
+		}
+		data = data[n:]
+		record.updateIndex = t.minUpdateIndex + delta
+
+		switch record.valueType {
+		case reftableDeletion:
+		case reftableValue, reftableValuePeeled:
+			size := HashSize
+			if record.valueType == reftableValuePeeled {
+				size *= 2
+			}
+			if len(data) < size {
+				return fmt.Errorf("corrupt reftable record for %s", record.name)
+			}
+			record.hash = hex.EncodeToString(data[:HashSize])
+			if record.valueType == reftableValuePeeled {
+				record.peeled = hex.EncodeToString(data[HashSize:size])
+			}
+			data = data[size:]
+		case reftableSymref:
+			targetLen, n, err := getReftableVarint(data)
+			if err != nil {
+				return err
+			}
+			data = data[n:]
+			if uint64(len(data)) < targetLen {
+				return fmt.Errorf("corrupt reftable record for %s", record.name)
+			}
+			record.target = string(data[:targetLen])
+			data = data[targetLen:]
+		default:
+			return fmt.Errorf("unknown reftable value type %d for %s", record.valueType, record.name)
+		}
+
+		t.records = append(t.records, record)
+		prevName = record.name
+	}
+	return nil
+}
+
+func reftablePath(repoPath string, parts ...string) string {
+	return filepath.Join(append([]string{repoPath, RepoDirName, reftableDir}, parts...)...)
+}
+
+// readReftableStack returns the table names listed in tables.list, oldest
+// first.
+func readReftableStack(repoPath string) ([]string, error) {
+	content, err := os.ReadFile(reftablePath(repoPath, reftableListFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", reftableListFile, err)
+	}
+	return strings.Fields(string(content)), nil
+}
+
+func readReftable(repoPath, name string) (*reftable, error) {
+	data, err := os.ReadFile(reftablePath(repoPath, name))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read reftable %s: %w", name, err)
+	}
+	table, err := decodeReftable(data)
+	if err != nil {
+		return nil, fmt.Errorf("reftable %s: %w", name, err)
+	}
+	return table, nil
+}
+
+// writeReftable stores a new table and returns its name.
+func writeReftable(repoPath string, records []reftableRecord, minIndex, maxIndex uint64) (string, error) {
+	sort.Slice(records, func(i, j int) bool { return records[i].name < records[j].name })
+	data, err := encodeReftable(records, minIndex, maxIndex)
+	if err != nil {
+		return "", err
+	}
+
+	name := fmt.Sprintf("0x%012x-0x%012x-%08x.ref", minIndex, maxIndex, rand.Uint32())
+	if err := os.MkdirAll(reftablePath(repoPath), 0755); err != nil {
+		return "", fmt.Errorf("failed to create %s: %w", reftableDir, err)
+	}
+	if err := os.WriteFile(reftablePath(repoPath, name), data, 0644); err != nil {
+		return "", fmt.Errorf("failed to write reftable %s: %w", name, err)
+	}
+	return name, nil
+}
+
+// mergeReftables returns the newest record for every ref in tables, which
+// are ordered oldest first.
+func mergeReftables(tables []*reftable) map[string]reftableRecord {
+	merged := make(map[string]reftableRecord)
+	for _, table := range tables {
+		for _, record := range table.records {
+			merged[record.name] = record
+		}
+	}
+	return merged
+}
+
+// reftableRefStore is the "reftable" ref backend. lock is held on
+// tables.list while a transaction is prepared.
+type reftableRefStore struct {
+	repoPath string
+	lock     *lockFile
+}
+
+func (s *reftableRefStore) ReadRef(ref string) (string, bool, error) {
+	stack, err := loadReftableStack(s.repoPath)
+	if err != nil {
+		return "", false, err
+	}
+	record, ok := stack.refs[ref]
+	if !ok || record.valueType == reftableDeletion {
+		return "", false, nil
+	}
+	return record.value(), true, nil
+}
+
+func (s *reftableRefStore) ListRefs(prefix string) (map[string]string, error) {
+	stack, err := loadReftableStack(s.repoPath)
+	if err != nil {
+		return nil, err
+	}
+	refs := make(map[string]string)
+	for name, record := range stack.refs {
+		if record.valueType != reftableDeletion && strings.HasPrefix(name, "refs/") && strings.HasPrefix(name, prefix) {
+			refs[name] = record.value()
+		}
+	}
+	return refs, nil
+}
+
+// reftableStack is a stack of tables merged into the refs it holds.
+type reftableStack struct {
+	list string
+	refs map[string]reftableRecord
+}
+
+// reftableStacks caches the stack last read for each repository. Tables
+// never change once written, so a stack stays valid for as long as
+// tables.list names the same tables.
+var reftableStacks = struct {
+	sync.Mutex
+	byRepo map[string]*reftableStack
+}{byRepo: make(map[string]*reftableStack)}
+
+// loadReftableStack returns the merged refs of the stack, reading the
+// tables only when tables.list has changed since the last call. A table
+// that has disappeared was removed by a concurrent compaction, which has
+// written a new list by then, so the list is read again once.
+func loadReftableStack(repoPath string) (*reftableStack, error) {
+	key, err := filepath.Abs(repoPath)
+	if err != nil {
+		return nil, err
+	}
+	reftableStacks.Lock()
+	defer reftableStacks.Unlock()
+
+	for attempt := 0; ; attempt++ {
+		names, err := readReftableStack(repoPath)
+		if err != nil {
+			return nil, err
+		}
+		list := strings.Join(names, "\n")
+		if cached := reftableStacks.byRepo[key]; cached != nil && cached.list == list {
+			return cached, nil
+		}
+
+		tables := make([]*reftable, len(names))
+		for i, name := range names {
+			if tables[i], err = readReftable(repoPath, name); err != nil {
+				break
+			}
+		}
+		if errors.Is(err, fs.ErrNotExist) && attempt == 0 {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		stack := &reftableStack{list: list, refs: mergeReftables(tables)}
+		reftableStacks.byRepo[key] = stack
+		return stack, nil
+	}
+}
+
+// lockRefs locks the whole stack: every transaction appends to it.
+func (s *reftableRefStore) lockRefs(updates []*refUpdate) error {
+	lock, err := acquireLock(reftablePath(s.repoPath, reftableListFile))
+	if err != nil {
+		return fmt.Errorf("cannot lock references: %w", err)
+	}
+	s.lock = lock
+	return nil
+}
+
+// commitRefs writes the updates as a new table on top of the stack,
+// compacting the top of the stack when it has grown out of shape.
+func (s *reftableRefStore) commitRefs(updates []*refUpdate) error {
+	defer s.unlockRefs(updates)
+
+	names, err := readReftableStack(s.repoPath)
+	if err != nil {
+		return err
+	}
+	var next uint64 = 1
+	if len(names) > 0 {
+		top, err := readReftable(s.repoPath, names[len(names)-1])
+		if err != nil {
+			return err
+		}
+		next = top.maxUpdateIndex + 1
+	}
+
+	var records []reftableRecord
+	for _, update := range updates {
+		if update.isVerify() {
+			continue
+		}
+		records = append(records, s.updateRecord(update, next))
+	}
+	if len(records) == 0 {
+		return nil
+	}
+
+	name, err := writeReftable(s.repoPath, records, next, next)
+	if err != nil {
+		return err
+	}
+	names = append(names, name)
+
+	// compaction is only an optimization, so the update stands even if it
+	// fails
+	obsolete := []string{}
+	if start := s.compactionStart(names); start < len(names)-1 {
+		if compacted, err := compactReftables(s.repoPath, names[start:], start == 0); err == nil {
+			obsolete = names[start:]
+			names = append(names[:start:start], compacted)
+		}
+	}
+
+	lock := s.lock
+	s.lock = nil
+	if err := commitReftableStack(lock, names); err != nil {
+		os.Remove(reftablePath(s.repoPath, name))
+		return err
+	}
+	for _, table := range obsolete {
+		os.Remove(reftablePath(s.repoPath, table))
+	}
+	return nil
+}
+
+func (s *reftableRefStore) updateRecord(update *refUpdate, updateIndex uint64) reftableRecord {
+	record := reftableRecord{name: update.ref, updateIndex: updateIndex}
+	switch {
+	case update.isDelete():
+		record.valueType = reftableDeletion
+	case update.symTarget != "":
+		record.valueType = reftableSymref
+		record.target = update.symTarget
+	default:
+		record.valueType = reftableValue
+		record.hash = update.newHash
+		if peeled, err := peelObject(s.repoPath, update.newHash, "", update.ref); err == nil && peeled != update.newHash {
+			record.valueType = reftableValuePeeled
+			record.peeled = peeled
+		}
+	}
+	return record
+}
+
+// compactionStart returns the first table of the run at the top of the
+// stack that should be merged, keeping table sizes roughly geometric: a
+// table is merged into the tables above it unless it is at least twice as
+// big as all of them together.
+func (s *reftableRefStore) compactionStart(names []string) int {
+	sizes := make([]int64, len(names))
+	for i, name := range names {
+		info, err := os.Stat(reftablePath(s.repoPath, name))
+		if err != nil {
+			return len(names)
+		}
+		sizes[i] = info.Size()
+	}
+
+	i := len(names) - 1
+	total := sizes[i]
+	for i > 0 && sizes[i-1] < 2*total {
+		i--
+		total += sizes[i]
+	}
+	return i
+}
+
+func (s *reftableRefStore) unlockRefs(updates []*refUpdate) {
+	if s.lock != nil {
+		s.lock.rollback()
+		s.lock = nil
+	}
+}
+
+// compactReftables merges the given tables into a new one and returns its
+// name. Deletion records are only needed to hide older tables, so they are
+// dropped when the oldest table of the stack is part of the merge.
+func compactReftables(repoPath string, names []string, dropDeletions bool) (string, error) {
+	tables := make([]*reftable, len(names))
+	for i, name := range names {
+		table, err := readReftable(repoPath, name)
+		if err != nil {
+			return "", err
+		}
+		tables[i] = table
+	}
+
+	var records []reftableRecord
+	for _, record := range mergeReftables(tables) {
+		if dropDeletions && record.valueType == reftableDeletion {
+			continue
+		}
+		records = append(records, record)
+	}
+	return writeReftable(repoPath, records, tables[0].minUpdateIndex, tables[len(tables)-1].maxUpdateIndex)
+}
+
+func commitReftableStack(lock *lockFile, names []string) error {
+	var content strings.Builder
+	for _, name := range names {
+		content.WriteString(name + "\n")
+	}
+	if err := lock.write([]byte(content.String())); err != nil {
+		lock.rollback()
+		return err
+	}
+	return lock.commit()
+}
+
+// CompactReftable merges the whole reftable stack into a single table.
+func CompactReftable(repoPath string) error {
+	lock, err := acquireLock(reftablePath(repoPath, reftableListFile))
+	if err != nil {
+		return fmt.Errorf("cannot lock references: %w", err)
+	}
+	names, err := readReftableStack(repoPath)
+	if err != nil || len(names) == 0 {
+		lock.rollback()
+		return err
+	}
+
+	compacted, err := compactReftables(repoPath, names, true)
+	if err != nil {
+		lock.rollback()
+		return err
+	}
+	if err := commitReftableStack(lock, []string{compacted}); err != nil {
+		os.Remove(reftablePath(repoPath, compacted))
+		return err
+	}
+	for _, name := range names {
+		os.Remove(reftablePath(repoPath, name))
+	}
+	return nil
+}
+
+// createReftable writes refs (stored values keyed by name, including HEAD)
+// as a fresh reftable stack holding a single table.
+func createReftable(repoPath string, refs map[string]string) error {
+	store := &reftableRefStore{repoPath: repoPath}
+	var records []reftableRecord
+	for name, value := range refs {
+		update := &refUpdate{ref: name, newHash: value}
+		if target, ok := strings.CutPrefix(value, "ref: "); ok {
+			update = &refUpdate{ref: name, symTarget: target}
+		}
+		records = append(records, store.updateRecord(update, 1))
+	}
+
+	name, err := writeReftable(repoPath, records, 1, 1)
+	if err != nil {
+		return err
+	}
+	lock, err := acquireLock(reftablePath(repoPath, reftableListFile))
+	if err != nil {
+		return err
+	}
+	return commitReftableStack(lock, []string{name})
+}
@@ -0,0 +1,253 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestReftableVarint(t *testing.T) {
+	for _, v := range []uint64{0, 1, 127, 128, 16383, 16384, 1 << 40} {
+		buf := putReftableVarint(nil, v)
+		got, n, err := getReftableVarint(buf)
+		if err != nil || got != v || n != len(buf) {
+			t.Errorf("varint %d: got %d (%d of %d bytes), %v", v, got, n, len(buf), err)
+		}
+	}
+}
+
+func TestReftableEncodeDecode(t *testing.T) {
+	hash := strings.Repeat("ab", HashSize)
+	peeled := strings.Repeat("cd", HashSize)
+	var records []reftableRecord
+	// enough refs to need several blocks and restart points
+	for i := 0; i < 300; i++ {
+		records = append(records, reftableRecord{name: "refs/heads/topic-" + strings.Repeat("x", i%7) + string(rune('a'+i%26)) + strings.Repeat("0", i/26), updateIndex: 7, valueType: reftableValue, hash: hash})
+	}
+	records = append(records,
+		reftableRecord{name: "HEAD", updateIndex: 5, valueType: reftableSymref, target: "refs/heads/main"},
+		reftableRecord{name: "refs/tags/v1", updateIndex: 6, valueType: reftableValuePeeled, hash: hash, peeled: peeled},
+		reftableRecord{name: "refs/tags/v2", updateIndex: 7, valueType: reftableDeletion},
+	)
+	sort.Slice(records, func(i, j int) bool { return records[i].name < records[j].name })
+	byName := make(map[string]reftableRecord)
+	for _, record := range records {
+		byName[record.name] = record
+	}
+
+	data, err := encodeReftable(records, 5, 7)
+	if err != nil {
+		t.Fatalf("encodeReftable failed: %v", err)
+	}
+	if len(data) <= reftableBlockSize {
+		t.Fatalf("expected a table spanning several blocks, got %d bytes", len(data))
+	}
+	table, err := decodeReftable(data)
+	if err != nil {
+		t.Fatalf("decodeReftable failed: %v", err)
+	}
+	if table.minUpdateIndex != 5 || table.maxUpdateIndex != 7 || len(table.records) != len(records) {
+		t.Fatalf("got indices %d-%d and %d records", table.minUpdateIndex, table.maxUpdateIndex, len(table.records))
+	}
+	for _, record := range table.records {
+		if record != byName[record.name] {
+			t.Errorf("record %s: got %+v, want %+v", record.name, record, byName[record.name])
+		}
+	}
+
+	data[len(data)-1] ^= 0xff
+	if _, err := decodeReftable(data); err == nil {
+		t.Error("expected a checksum error for a corrupt footer")
+	}
+}
+
+func useReftable(t *testing.T, repo string) {
+	t.Helper()
+	if err := MigrateRefStorage(repo, RefFormatReftable); err != nil {
+		t.Fatalf("MigrateRefStorage failed: %v", err)
+	}
+}
+
+func TestMigrateRefStorage(t *testing.T) {
+	repo := setupTestRepo(t)
+	first := commitFile(t, repo, "file.txt", "one\n", "first")
+	commitFile(t, repo, "file.txt", "two\n", "second")
+	if err := CreateBranchAt(repo, "topic", first); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CreateTag(repo, "v1", first, TagOptions{Message: "release", Name: "Test Author", Email: "test@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	tag, _, _ := readRef(repo, "refs/tags/v1")
+
+	useReftable(t, repo)
+	if _, err := os.Stat(filepath.Join(repo, RepoDirName, "refs", "heads", "main")); err == nil {
+		t.Error("loose refs should be removed after migrating")
+	}
+	if branch, err := GetCurrentBranch(repo); err != nil || branch != "main" {
+		t.Errorf("HEAD should still be on main, got %q (%v)", branch, err)
+	}
+	branches, _ := ListBranches(repo)
+	if strings.Join(branches, ",") != "main,topic" {
+		t.Errorf("expected main and topic, got %v", branches)
+	}
+	if hash, _ := ResolveRevision(repo, "v1^{}"); hash != first {
+		t.Errorf("v1 should peel to %s, got %s", first, hash)
+	}
+
+	third := commitFile(t, repo, "file.txt", "three\n", "third")
+	if err := Checkout(repo, "topic"); err != nil {
+		t.Fatalf("Checkout failed: %v", err)
+	}
+	entries, _ := Reflog(repo, "main")
+	if len(entries) != 3 || entries[0].NewHash != third {
+		t.Errorf("reflogs should keep working, got %+v", entries)
+	}
+
+	if err := MigrateRefStorage(repo, RefFormatFiles); err != nil {
+		t.Fatalf("MigrateRefStorage failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(repo, RepoDirName, reftableDir)); !os.IsNotExist(err) {
+		t.Error("the reftable stack should be removed after migrating back")
+	}
+	refs, _ := listRefs(repo, "refs/")
+	if refs["refs/heads/main"] != third || refs["refs/heads/topic"] != first || refs["refs/tags/v1"] != tag {
+		t.Errorf("refs changed across migrations: %v", refs)
+	}
+	if branch, _ := GetCurrentBranch(repo); branch != "topic" {
+		t.Errorf("HEAD should be on topic, got %q", branch)
+	}
+}
+
+func TestReftableTransactions(t *testing.T) {
+	repo := setupTestRepo(t)
+	first := commitFile(t, repo, "file.txt", "one\n", "first")
+	useReftable(t, repo)
+	second := commitFile(t, repo, "file.txt", "two\n", "second")
+
+	tx := BeginRefTransaction(repo)
+	if err := tx.Create("refs/heads/a", first, "create a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Update("refs/heads/main", first, first, "stale"); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err == nil || !strings.Contains(err.Error(), "expected") {
+		t.Fatalf("expected a compare-and-swap failure, got %v", err)
+	}
+	if exists, _ := BranchExists(repo, "a"); exists {
+		t.Error("a failed transaction must not create any ref")
+	}
+
+	lock, err := acquireLock(reftablePath(repo, reftableListFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := CreateBranchAt(repo, "b", first); err == nil {
+		t.Error("expected a lock error while tables.list is locked")
+	}
+	lock.rollback()
+
+	if err := CreateBranchAt(repo, "b", first); err != nil {
+		t.Fatal(err)
+	}
+	if err := DeleteBranch(repo, "b", false); err != nil {
+		t.Fatalf("DeleteBranch failed: %v", err)
+	}
+	if exists, _ := BranchExists(repo, "b"); exists {
+		t.Error("a deletion record should hide the older value of b")
+	}
+	if hash, _ := ResolveBranchCommit(repo, "main"); hash != second {
+		t.Errorf("main should be at %s, got %s", second, hash)
+	}
+}
+
+func TestReftableCompaction(t *testing.T) {
+	repo := setupTestRepo(t)
+	first := commitFile(t, repo, "file.txt", "one\n", "first")
+	useReftable(t, repo)
+
+	for _, name := range []string{"a", "b", "c", "d", "e"} {
+		if err := CreateBranchAt(repo, name, first); err != nil {
+			t.Fatal(err)
+		}
+		names, _ := readReftableStack(repo)
+		if len(names) > 3 {
+			t.Errorf("auto-compaction should keep the stack short, got %d tables", len(names))
+		}
+	}
+	if err := DeleteBranch(repo, "c", false); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := PackRefs(repo, true, true); err != nil {
+		t.Fatalf("PackRefs failed: %v", err)
+	}
+	names, _ := readReftableStack(repo)
+	if len(names) != 1 {
+		t.Fatalf("expected a single table after compaction, got %v", names)
+	}
+	table, err := readReftable(repo, names[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, record := range table.records {
+		if record.valueType == reftableDeletion {
+			t.Errorf("full compaction should drop the deletion of %s", record.name)
+		}
+	}
+	if entries, _ := os.ReadDir(reftablePath(repo)); len(entries) != 2 {
+		t.Errorf("compacted tables should be removed, got %d files", len(entries))
+	}
+
+	branches, _ := ListBranches(repo)
+	if strings.Join(branches, ",") != "a,b,d,e,main" {
+		t.Errorf("unexpected branches after compaction: %v", branches)
+	}
+}
+
+func TestReftableStackCache(t *testing.T) {
+	repo := setupTestRepo(t)
+	first := commitFile(t, repo, "file.txt", "one\n", "first")
+	useReftable(t, repo)
+	if err := CreateBranchAt(repo, "topic", first); err != nil {
+		t.Fatal(err)
+	}
+	if hash, _ := ResolveBranchCommit(repo, "topic"); hash != first {
+		t.Fatalf("topic should be at %s, got %s", first, hash)
+	}
+
+	// while tables.list is unchanged, lookups don't go back to the tables
+	names, _ := readReftableStack(repo)
+	saved := make(map[string][]byte)
+	for _, name := range names {
+		saved[name], _ = os.ReadFile(reftablePath(repo, name))
+		os.Remove(reftablePath(repo, name))
+	}
+	if hash, _ := ResolveBranchCommit(repo, "topic"); hash != first {
+		t.Errorf("expected the cached stack to resolve topic, got %q", hash)
+	}
+	for name, data := range saved {
+		os.WriteFile(reftablePath(repo, name), data, 0644)
+	}
+
+	// a new table on the stack is seen by the next lookup
+	if err := CreateBranchAt(repo, "other", first); err != nil {
+		t.Fatal(err)
+	}
+	if exists, _ := BranchExists(repo, "other"); !exists {
+		t.Error("a ref written after the stack was cached should be found")
+	}
+
+	// a table that stays missing once the list is read again is an error
+	names, _ = readReftableStack(repo)
+	list := strings.Join(append(names, "missing.ref"), "\n") + "\n"
+	if err := os.WriteFile(reftablePath(repo, reftableListFile), []byte(list), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := listRefs(repo, "refs/"); err == nil || !strings.Contains(err.Error(), "missing.ref") {
+		t.Errorf("expected an error naming the missing table, got %v", err)
+	}
+}
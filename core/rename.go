@@ -0,0 +1,168 @@
+package core
+
+import (
+	"sort"
+	"strings"
+)
+
+const (
+	// minRenameScore is the similarity, in percent, a deleted and an added
+	// file need to be paired up as a rename.
+	minRenameScore = 50
+	// renameLimit caps the number of deleted and added files compared for
+	// inexact renames, since every pair has to be scored.
+	renameLimit = 1000
+
+	emptyBlobHash = "e69de29bb2d1d6434b8b29ae775ad8c2e48c5391"
+)
+
+// detectRenames pairs the deleted and added files in changes that hold the
+// same or similar content, and replaces each pair with an 'R' change. Files
+// with identical content are paired first; the rest are scored by how much
+// of the larger file's content the two share, best matches first. Empty
+// files are never paired, since they carry nothing to recognize.
+func detectRenames(repoPath string, changes []FileChange) ([]FileChange, error) {
+	var sources, targets []int
+	for i, change := range changes {
+		switch {
+		case change.Status == 'D' && isRenameable(change.OldMode, change.OldHash):
+			sources = append(sources, i)
+		case change.Status == 'A' && isRenameable(change.Mode, change.Hash):
+			targets = append(targets, i)
+		}
+	}
+	if len(sources) == 0 || len(targets) == 0 {
+		return changes, nil
+	}
+
+	renamedFrom := make(map[int]int)
+	used := make(map[int]bool)
+	rename := func(target, source, score int) {
+		renamedFrom[target] = source
+		used[source] = true
+		changes[target].Score = score
+	}
+
+	// exact renames, preferring a source with the same file name
+	byHash := make(map[string][]int)
+	for _, source := range sources {
+		byHash[changes[source].OldHash] = append(byHash[changes[source].OldHash], source)
+	}
+	for _, target := range targets {
+		candidates := byHash[changes[target].Hash]
+		best := -1
+		for _, source := range candidates {
+			if used[source] {
+				continue
+			}
+			if best < 0 || baseName(changes[source].OldPath) == baseName(changes[target].Path) && baseName(changes[best].OldPath) != baseName(changes[target].Path) {
+				best = source
+			}
+		}
+		if best >= 0 {
+			rename(target, best, 100)
+		}
+	}
+
+	var leftSources, leftTargets []int
+	for _, source := range sources {
+		if !used[source] {
+			leftSources = append(leftSources, source)
+		}
+	}
+	for _, target := range targets {
+		if _, ok := renamedFrom[target]; !ok {
+			leftTargets = append(leftTargets, target)
+		}
+	}
+	if len(leftSources) > 0 && len(leftTargets) > 0 && len(leftSources)*len(leftTargets) <= renameLimit*renameLimit {
+		contents := make(map[string][]byte)
+		read := func(hash string) ([]byte, error) {
+			if content, ok := contents[hash]; ok {
+				return content, nil
+			}
+			content, err := readObject(repoPath, hash)
+			if err != nil {
+				return nil, err
+			}
+			contents[hash] = content
+			return content, nil
+		}
+
+		type candidate struct{ target, source, score int }
+		var candidates []candidate
+		for _, target := range leftTargets {
+			targetContent, err := read(changes[target].Hash)
+			if err != nil {
+				return nil, err
+			}
+			for _, source := range leftSources {
+				sourceContent, err := read(changes[source].OldHash)
+				if err != nil {
+					return nil, err
+				}
+				if score := similarity(sourceContent, targetContent); score >= minRenameScore {
+					candidates = append(candidates, candidate{target, source, score})
+				}
+			}
+		}
+		sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].score > candidates[j].score })
+		for _, c := range candidates {
+			if _, ok := renamedFrom[c.target]; ok || used[c.source] {
+				continue
+			}
+			rename(c.target, c.source, c.score)
+		}
+	}
+
+	var result []FileChange
+	for i, change := range changes {
+		if change.Status == 'D' && used[i] {
+			continue
+		}
+		if source, ok := renamedFrom[i]; ok {
+			change.Status = 'R'
+			change.OldPath = changes[source].OldPath
+			change.OldMode = changes[source].OldMode
+			change.OldHash = changes[source].OldHash
+		}
+		result = append(result, change)
+	}
+	return result, nil
+}
+
+// isRenameable reports whether a file can take part in rename detection:
+// submodules and empty files can't.
+func isRenameable(mode, hash string) bool {
+	return mode != "160000" && hash != emptyBlobHash
+}
+
+// similarity estimates, in percent, how much of the larger of two contents
+// the other one also holds, by matching up their lines.
+func similarity(a, b []byte) int {
+	larger := max(len(a), len(b))
+	if larger == 0 {
+		return 100
+	}
+	// quickly rule out files whose sizes are too far apart to be similar
+	if (larger-min(len(a), len(b)))*100 > larger*(100-minRenameScore) {
+		return 0
+	}
+
+	counts := make(map[string]int)
+	for _, line := range splitLines(a) {
+		counts[line]++
+	}
+	shared := 0
+	for _, line := range splitLines(b) {
+		if counts[line] > 0 {
+			counts[line]--
+			shared += len(line)
+		}
+	}
+	return shared * 100 / larger
+}
+
+func baseName(path string) string {
+	return path[strings.LastIndexByte(path, '/')+1:]
+}
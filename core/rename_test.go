@@ -0,0 +1,80 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// writeTestTree writes a tree holding files, a map from path to content.
+func writeTestTree(t *testing.T, files map[string]string) string {
+	t.Helper()
+
+	blobs := make(map[string]string, len(files))
+	for path, content := range files {
+		hash, err := HashObject([]byte(content), "blob", true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		blobs[path] = hash
+	}
+	tree, err := writeTreeFromMap(blobs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tree
+}
+
+func numberedLines(prefix string, n int) string {
+	var sb strings.Builder
+	for i := 1; i <= n; i++ {
+		fmt.Fprintf(&sb, "%s line %d\n", prefix, i)
+	}
+	return sb.String()
+}
+
+func TestDetectRenames(t *testing.T) {
+	setupTestRepo(t)
+
+	parser := numberedLines("parser", 10)
+	lexer := numberedLines("lexer", 10)
+	from := writeTestTree(t, map[string]string{
+		"parser.go": parser,
+		"lexer.go":  lexer,
+		"notes.txt": numberedLines("notes", 10),
+		"empty.txt": "",
+		"stays.txt": "same\n",
+	})
+	to := writeTestTree(t, map[string]string{
+		"syntax/parser.go": parser,
+		"scan.go":          strings.Replace(lexer, "lexer line 3", "scanner line 3", 1),
+		"other.txt":        numberedLines("other", 10),
+		"blank.txt":        "",
+		"stays.txt":        "same\n",
+	})
+
+	changes, err := diffTrees(".", from, to, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	changes, err = detectRenames(".", changes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, change := range changes {
+		got = append(got, fmt.Sprintf("%c%d %s %s", change.Status, change.Score, change.OldPath, change.Path))
+	}
+	want := []string{
+		"A0 blank.txt blank.txt",
+		"D0 empty.txt empty.txt",
+		"D0 notes.txt notes.txt",
+		"A0 other.txt other.txt",
+		"R88 lexer.go scan.go",
+		"R100 parser.go syntax/parser.go",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("changes:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
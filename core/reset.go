@@ -0,0 +1,143 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type ResetMode int
+
+const (
+	ResetMixed ResetMode = iota
+	ResetSoft
+	ResetHard
+)
+
+// Reset moves the current branch (or a detached HEAD) to rev. A mixed reset
+// also rewrites the index to the target tree, and a hard reset additionally
+// updates the tracked files in the working tree.
+func Reset(repoPath, rev string, mode ResetMode) (CommitInfo, error) {
+	repoDir := filepath.Join(repoPath, RepoDirName)
+
+	if rev == "" {
+		rev = "HEAD"
+	}
+	target, err := resolveCommitish(repoPath, rev)
+	if err != nil {
+		return CommitInfo{}, err
+	}
+	commit, err := readCommit(repoPath, target)
+	if err != nil {
+		return CommitInfo{}, err
+	}
+
+	head, err := resolveHead(repoPath)
+	if err != nil {
+		return CommitInfo{}, err
+	}
+
+	if mode != ResetSoft {
+		targetTree, err := getCommitTree(repoPath, target)
+		if err != nil {
+			return CommitInfo{}, err
+		}
+
+		if mode == ResetHard {
+			err = resetHardToTree(repoPath, targetTree)
+		} else {
+			err = updateIndexToTree(repoPath, targetTree)
+		}
+		if err != nil {
+			return CommitInfo{}, fmt.Errorf("failed to reset: %w", err)
+		}
+	}
+
+	if head != "" {
+		if err := os.WriteFile(filepath.Join(repoDir, "ORIG_HEAD"), []byte(head+"\n"), 0644); err != nil {
+			return CommitInfo{}, fmt.Errorf("failed to write ORIG_HEAD: %w", err)
+		}
+	}
+	if err := updateHEAD(repoPath, target, "reset: moving to "+rev); err != nil {
+		return CommitInfo{}, fmt.Errorf("failed to update HEAD: %w", err)
+	}
+
+	return commit, nil
+}
+
+// ResetPaths restores the index entries matching paths to their state in rev
+// without touching HEAD or the working tree. Paths missing from rev are
+// removed from the index.
+func ResetPaths(repoPath, rev string, paths []string) error {
+	if len(paths) == 0 {
+		return fmt.Errorf("no paths specified")
+	}
+	if rev == "" {
+		rev = "HEAD"
+	}
+
+	var sourceTree map[string]string
+	target, err := resolveCommitish(repoPath, rev)
+	if err != nil {
+		head, headErr := resolveHead(repoPath)
+		if rev != "HEAD" || headErr != nil || head != "" {
+			return err
+		}
+		// unstaging on an unborn branch resets to the empty tree
+		sourceTree = map[string]string{}
+	} else if sourceTree, err = getCommitTree(repoPath, target); err != nil {
+		return err
+	}
+
+	index, err := readIndexMap(repoPath)
+	if err != nil {
+		return err
+	}
+
+	for path := range index {
+		if matchesPathspec(path, paths) {
+			delete(index, path)
+		}
+	}
+	for path, hash := range sourceTree {
+		if matchesPathspec(path, paths) {
+			index[path] = hash
+		}
+	}
+
+	return updateIndexToTree(repoPath, index)
+}
+
+// SplitResetArgs splits the arguments of reset, given without "--", into
+// the commit and the paths, as git does: the first argument is the commit
+// when it names a revision, and the rest are paths. A lone argument that
+// is both a revision and a file in the working tree is ambiguous.
+func SplitResetArgs(repoPath string, args []string) (rev string, paths []string, err error) {
+	if len(args) == 0 {
+		return "", nil, nil
+	}
+	if _, err := ResolveRevision(repoPath, args[0]); err != nil {
+		return "", args, nil
+	}
+	if len(args) == 1 {
+		if _, err := os.Stat(filepath.Join(repoPath, args[0])); err == nil {
+			return "", nil, fmt.Errorf("ambiguous argument '%s': both revision and filename\nUse '--' to separate paths from revisions", args[0])
+		}
+		return args[0], nil, nil
+	}
+	return args[0], args[1:], nil
+}
+
+// matchesPathspec reports whether path equals one of specs or lies inside a
+// directory named by one of them.
+func matchesPathspec(path string, specs []string) bool {
+	path = filepath.Clean(path)
+	for _, spec := range specs {
+		spec = filepath.Clean(spec)
+		if spec == "." || path == spec || strings.HasPrefix(path, spec+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,182 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestResetSoft(t *testing.T) {
+	repo := setupTestRepo(t)
+	first := commitFile(t, repo, "file.txt", "one\n", "first")
+	commitFile(t, repo, "file.txt", "two\n", "second")
+
+	if _, err := Reset(repo, "HEAD~1", ResetSoft); err != nil {
+		t.Fatalf("Reset failed: %v", err)
+	}
+
+	if head, _ := resolveHead(repo); head != first {
+		t.Errorf("expected HEAD at %s, got %s", first, head)
+	}
+	index, _ := readIndexMap(repo)
+	firstTree, _ := getCommitTree(repo, first)
+	if index["file.txt"] == firstTree["file.txt"] {
+		t.Error("soft reset should leave the index alone")
+	}
+	if got := readTestFile(t, repo, "file.txt"); got != "two\n" {
+		t.Errorf("soft reset should leave the working tree alone, got %q", got)
+	}
+}
+
+func TestResetMixed(t *testing.T) {
+	repo := setupTestRepo(t)
+	first := commitFile(t, repo, "file.txt", "one\n", "first")
+	commitFile(t, repo, "file.txt", "two\n", "second")
+
+	if _, err := Reset(repo, first[:7], ResetMixed); err != nil {
+		t.Fatalf("Reset failed: %v", err)
+	}
+
+	index, _ := readIndexMap(repo)
+	firstTree, _ := getCommitTree(repo, first)
+	if index["file.txt"] != firstTree["file.txt"] {
+		t.Error("mixed reset should reset the index")
+	}
+	if got := readTestFile(t, repo, "file.txt"); got != "two\n" {
+		t.Errorf("mixed reset should leave the working tree alone, got %q", got)
+	}
+}
+
+func TestResetHard(t *testing.T) {
+	repo := setupTestRepo(t)
+	commitFile(t, repo, "file.txt", "one\n", "first")
+	commitFile(t, repo, "added.txt", "added\n", "second")
+
+	if err := os.WriteFile("file.txt", []byte("dirty\n"), 0644); err != nil {
+		t.Fatalf("failed to modify file: %v", err)
+	}
+	if err := os.WriteFile("untracked.txt", []byte("keep\n"), 0644); err != nil {
+		t.Fatalf("failed to write untracked file: %v", err)
+	}
+
+	commit, err := Reset(repo, "HEAD^", ResetHard)
+	if err != nil {
+		t.Fatalf("Reset failed: %v", err)
+	}
+	if commit.Message != "first" {
+		t.Errorf("expected to land on first commit, got %q", commit.Message)
+	}
+
+	if got := readTestFile(t, repo, "file.txt"); got != "one\n" {
+		t.Errorf("hard reset should discard local changes, got %q", got)
+	}
+	if _, err := os.Stat("added.txt"); !os.IsNotExist(err) {
+		t.Error("hard reset should remove files not in the target")
+	}
+	if got := readTestFile(t, repo, "untracked.txt"); got != "keep\n" {
+		t.Error("hard reset should leave untracked files alone")
+	}
+}
+
+func TestResetPaths(t *testing.T) {
+	repo := setupTestRepo(t)
+	first := commitFile(t, repo, "a.txt", "a\n", "first")
+
+	os.WriteFile("a.txt", []byte("changed\n"), 0644)
+	os.WriteFile("new.txt", []byte("new\n"), 0644)
+	if err := Add(repo, "a.txt", "new.txt"); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+
+	if err := ResetPaths(repo, "", []string{"a.txt", "new.txt"}); err != nil {
+		t.Fatalf("ResetPaths failed: %v", err)
+	}
+
+	index, _ := readIndexMap(repo)
+	firstTree, _ := getCommitTree(repo, first)
+	if index["a.txt"] != firstTree["a.txt"] {
+		t.Error("a.txt should be unstaged")
+	}
+	if _, ok := index["new.txt"]; ok {
+		t.Error("new.txt should be removed from the index")
+	}
+	if head, _ := resolveHead(repo); head != first {
+		t.Error("path reset should not move HEAD")
+	}
+	if got := readTestFile(t, repo, "a.txt"); got != "changed\n" {
+		t.Error("path reset should not touch the working tree")
+	}
+}
+
+func TestSplitResetArgs(t *testing.T) {
+	repo := setupTestRepo(t)
+	commitFile(t, repo, "a.txt", "a\n", "first")
+	commitFile(t, repo, "b.txt", "b\n", "second")
+
+	tests := []struct {
+		args  []string
+		rev   string
+		paths []string
+	}{
+		{[]string{"HEAD~1"}, "HEAD~1", nil},
+		{[]string{"a.txt"}, "", []string{"a.txt"}},
+		{[]string{"HEAD~1", "b.txt"}, "HEAD~1", []string{"b.txt"}},
+		{[]string{"HEAD~1", "a.txt", "b.txt"}, "HEAD~1", []string{"a.txt", "b.txt"}},
+		{[]string{"a.txt", "b.txt"}, "", []string{"a.txt", "b.txt"}},
+	}
+	for _, test := range tests {
+		rev, paths, err := SplitResetArgs(repo, test.args)
+		if err != nil || rev != test.rev || !reflect.DeepEqual(paths, test.paths) {
+			t.Errorf("SplitResetArgs(%v) = %q, %v, %v, want %q, %v", test.args, rev, paths, err, test.rev, test.paths)
+		}
+	}
+
+	if err := os.WriteFile(filepath.Join(repo, "main"), []byte("main\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := SplitResetArgs(repo, []string{"main"}); err == nil || !strings.Contains(err.Error(), "ambiguous argument 'main'") {
+		t.Errorf("a branch that is also a file should be ambiguous, got %v", err)
+	}
+	os.Remove(filepath.Join(repo, "main"))
+
+	// "reset HEAD~1 b.txt" unstages b.txt back to HEAD~1, where it didn't exist
+	rev, paths, _ := SplitResetArgs(repo, []string{"HEAD~1", "b.txt"})
+	if err := ResetPaths(repo, rev, paths); err != nil {
+		t.Fatalf("ResetPaths failed: %v", err)
+	}
+	if index, _ := readIndexMap(repo); index["b.txt"] != "" || index["a.txt"] == "" {
+		t.Errorf("expected b.txt to be reset to HEAD~1, got index %v", index)
+	}
+}
+
+func TestResolveCommitishNavigation(t *testing.T) {
+	repo := setupTestRepo(t)
+	first := commitFile(t, repo, "a.txt", "1\n", "first")
+	second := commitFile(t, repo, "a.txt", "2\n", "second")
+	commitFile(t, repo, "a.txt", "3\n", "third")
+
+	tests := map[string]string{
+		"HEAD~2":    first,
+		"HEAD^":     second,
+		"main~1":    second,
+		"HEAD^^":    first,
+		"HEAD~1^0":  second,
+		second[:10]: second,
+	}
+	for rev, want := range tests {
+		got, err := resolveCommitish(repo, rev)
+		if err != nil {
+			t.Errorf("resolveCommitish(%q) failed: %v", rev, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("resolveCommitish(%q) = %s, want %s", rev, got, want)
+		}
+	}
+
+	if _, err := resolveCommitish(repo, "HEAD~5"); err == nil {
+		t.Error("expected error walking past the root commit")
+	}
+}
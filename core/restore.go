@@ -0,0 +1,224 @@
+package core
+
+import (
+	"fmt"
+)
+
+type RestoreOptions struct {
+	// Source is the tree-ish to restore from. It defaults to the index when
+	// only the working tree is restored and to HEAD otherwise.
+	Source   string
+	Staged   bool
+	Worktree bool
+}
+
+// Restore restores the index and/or working tree copies of paths from a
+// source tree. Tracked paths that don't exist in the source are removed.
+// Without Staged or Worktree, only the working tree is restored.
+func Restore(repoPath string, paths []string, opts RestoreOptions) error {
+	if !opts.Staged && !opts.Worktree {
+		opts.Worktree = true
+	}
+
+	var source map[string]string
+	var err error
+	switch {
+	case opts.Source != "":
+		source, err = resolveTreeish(repoPath, opts.Source)
+	case opts.Staged:
+		var head string
+		if head, err = resolveHead(repoPath); err == nil {
+			source, err = commitTreeMap(repoPath, head)
+		}
+	default:
+		source, err = readIndexMap(repoPath)
+	}
+	if err != nil {
+		return err
+	}
+
+	return restorePaths(repoPath, source, paths, opts.Staged, opts.Worktree, false)
+}
+
+// CheckoutPaths implements "checkout [<tree-ish>] -- <paths>". Without a
+// tree-ish the working tree copies are restored from the index; with one,
+// both the index and working tree are updated from it. Files missing from
+// the tree-ish are left alone.
+func CheckoutPaths(repoPath, treeish string, paths []string) error {
+	if treeish == "" {
+		index, err := readIndexMap(repoPath)
+		if err != nil {
+			return err
+		}
+		return restorePaths(repoPath, index, paths, false, true, true)
+	}
+
+	source, err := resolveTreeish(repoPath, treeish)
+	if err != nil {
+		return err
+	}
+	return restorePaths(repoPath, source, paths, true, true, true)
+}
+
+// restorePaths copies the entries of source that match paths into the index
+// and/or working tree. Unless overlay is set, tracked paths that match but
+// are missing from source are deleted.
+func restorePaths(repoPath string, source map[string]string, paths []string, staged, worktree, overlay bool) error {
+	if len(paths) == 0 {
+		return fmt.Errorf("you must specify path(s) to restore")
+	}
+
+	index, err := readIndexMap(repoPath)
+	if err != nil {
+		return err
+	}
+
+	for _, spec := range paths {
+		found := false
+		for _, tree := range []map[string]string{source, index} {
+			for path := range tree {
+				if matchesPathspec(path, []string{spec}) {
+					found = true
+					break
+				}
+			}
+		}
+		if !found {
+			return fmt.Errorf("pathspec '%s' did not match any file(s) known to senpai", spec)
+		}
+	}
+
+	for path, hash := range source {
+		if !matchesPathspec(path, paths) {
+			continue
+		}
+		if worktree {
+			if err := restoreFile(repoPath, path, hash); err != nil {
+				return fmt.Errorf("failed to restore %s: %w", path, err)
+			}
+		}
+		if staged {
+			index[path] = hash
+		}
+	}
+
+	if !overlay {
+		for path := range copyTree(index) {
+			if _, ok := source[path]; ok || !matchesPathspec(path, paths) {
+				continue
+			}
+			if worktree {
+				if err := removeWorktreeFile(repoPath, path); err != nil {
+					return err
+				}
+			}
+			if staged {
+				delete(index, path)
+			}
+		}
+	}
+
+	if staged {
+		return updateIndexToTree(repoPath, index)
+	}
+	return nil
+}
+
+// resolveTreeish returns the flattened tree named by rev, which may be a
+// commit-ish or a tree object.
+func resolveTreeish(repoPath, rev string) (map[string]string, error) {
+	hash, err := resolveObjectName(repoPath, rev)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		objType, _, err := readObjectWithType(repoPath, hash)
+		if err != nil {
+			return nil, err
+		}
+		switch objType {
+		case "commit":
+			return getCommitTree(repoPath, hash)
+		case "tree":
+			return readTreeRecursive(repoPath, hash, "")
+		case "tag":
+			tag, err := readTag(repoPath, hash)
+			if err != nil {
+				return nil, err
+			}
+			hash = tag.Object
+		default:
+			return nil, fmt.Errorf("reference is not a tree: %s", rev)
+		}
+	}
+}
+
+type SwitchOptions struct {
+	// Create names a new branch to create at the target and switch to.
+	Create string
+	// Orphan names a new branch with no history; the index and tracked
+	// files are emptied.
+	Orphan string
+	Detach bool
+	Force  bool
+	Merge  bool
+}
+
+// Switch changes the current branch. Unlike Checkout it refuses to detach
+// HEAD unless asked to with Detach.
+func Switch(repoPath, target string, opts SwitchOptions) error {
+	checkoutOpts := CheckoutOptions{Force: opts.Force, Merge: opts.Merge}
+
+	switch {
+	case opts.Orphan != "":
+		if target != "" {
+			return fmt.Errorf("--orphan does not take a start point")
+		}
+		exists, err := BranchExists(repoPath, opts.Orphan)
+		if err != nil {
+			return err
+		}
+		if exists {
+			return fmt.Errorf("a branch named '%s' already exists", opts.Orphan)
+		}
+		if _, err := switchToTree(repoPath, map[string]string{}, opts.Orphan, CheckoutOptions{Force: opts.Force}); err != nil {
+			return err
+		}
+		return writeSymref(repoPath, "HEAD", "refs/heads/"+opts.Orphan)
+
+	case opts.Create != "":
+		if target == "" {
+			target = "HEAD"
+		}
+		if err := CreateBranchAt(repoPath, opts.Create, target); err != nil {
+			return err
+		}
+		return CheckoutWithOptions(repoPath, opts.Create, checkoutOpts)
+
+	case opts.Detach:
+		if target == "" {
+			target = "HEAD"
+		}
+		commitHash, err := resolveCommitish(repoPath, target)
+		if err != nil {
+			return err
+		}
+		return CheckoutWithOptions(repoPath, commitHash, checkoutOpts)
+	}
+
+	if target == "" {
+		return fmt.Errorf("missing branch name")
+	}
+	exists, err := BranchExists(repoPath, target)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		if _, err := resolveCommitish(repoPath, target); err == nil {
+			return fmt.Errorf("a branch is expected, got '%s'; use --detach to switch to a commit", target)
+		}
+		return fmt.Errorf("invalid reference: %s", target)
+	}
+	return CheckoutWithOptions(repoPath, target, checkoutOpts)
+}
@@ -0,0 +1,138 @@
+package core
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestCheckoutPaths(t *testing.T) {
+	repo := setupTestRepo(t)
+	old := commitFile(t, repo, "file.txt", "old\n", "first")
+	commitFile(t, repo, "file.txt", "new\n", "second")
+
+	if err := os.WriteFile("file.txt", []byte("scratch\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckoutPaths(repo, "", []string{"file.txt"}); err != nil {
+		t.Fatalf("CheckoutPaths failed: %v", err)
+	}
+	if got := readTestFile(t, repo, "file.txt"); got != "new\n" {
+		t.Errorf("expected the index version, got %q", got)
+	}
+
+	if err := CheckoutPaths(repo, old[:7], []string{"file.txt"}); err != nil {
+		t.Fatalf("CheckoutPaths failed: %v", err)
+	}
+	if got := readTestFile(t, repo, "file.txt"); got != "old\n" {
+		t.Errorf("expected the version from the first commit, got %q", got)
+	}
+	index, _ := readIndexMap(repo)
+	if firstTree, _ := getCommitTree(repo, old); index["file.txt"] != firstTree["file.txt"] {
+		t.Error("checkout <tree-ish> -- <path> should update the index")
+	}
+
+	if err := CheckoutPaths(repo, "", []string{"missing.txt"}); err == nil {
+		t.Error("expected an error for an unknown pathspec")
+	}
+}
+
+func TestRestoreStagedAndWorktree(t *testing.T) {
+	repo := setupTestRepo(t)
+	commitFile(t, repo, "file.txt", "one\n", "first")
+
+	if err := os.WriteFile("file.txt", []byte("two\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile("added.txt", []byte("added\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Add(repo, "file.txt", "added.txt"); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+
+	if err := Restore(repo, []string{"."}, RestoreOptions{Staged: true}); err != nil {
+		t.Fatalf("Restore --staged failed: %v", err)
+	}
+	head, _ := resolveHead(repo)
+	headTree, _ := getCommitTree(repo, head)
+	index, _ := readIndexMap(repo)
+	if !treesEqual(index, headTree) {
+		t.Errorf("index should match HEAD after restore --staged, got %v", index)
+	}
+	if got := readTestFile(t, repo, "file.txt"); got != "two\n" {
+		t.Errorf("restore --staged must not touch the working tree, got %q", got)
+	}
+
+	if err := Restore(repo, []string{"file.txt"}, RestoreOptions{}); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	if got := readTestFile(t, repo, "file.txt"); got != "one\n" {
+		t.Errorf("expected the index version, got %q", got)
+	}
+}
+
+func TestSwitch(t *testing.T) {
+	repo := setupTestRepo(t)
+	first := commitFile(t, repo, "file.txt", "one\n", "first")
+	commitFile(t, repo, "file.txt", "two\n", "second")
+
+	if err := Switch(repo, first[:7], SwitchOptions{}); err == nil {
+		t.Error("switch to a commit should require --detach")
+	}
+
+	if err := Switch(repo, first[:7], SwitchOptions{Create: "old"}); err != nil {
+		t.Fatalf("switch -c failed: %v", err)
+	}
+	if branch, _ := GetCurrentBranch(repo); branch != "old" {
+		t.Errorf("expected to be on old, got %s", branch)
+	}
+	if got := readTestFile(t, repo, "file.txt"); got != "one\n" {
+		t.Errorf("expected the start point's content, got %q", got)
+	}
+
+	if err := Switch(repo, "main", SwitchOptions{Detach: true}); err != nil {
+		t.Fatalf("switch --detach failed: %v", err)
+	}
+	if _, err := GetCurrentBranch(repo); err == nil {
+		t.Error("HEAD should be detached")
+	}
+
+	if err := Switch(repo, "", SwitchOptions{Orphan: "fresh"}); err != nil {
+		t.Fatalf("switch --orphan failed: %v", err)
+	}
+	if branch, _ := GetCurrentBranch(repo); branch != "fresh" {
+		t.Errorf("expected to be on fresh, got %s", branch)
+	}
+	if _, err := os.Stat("file.txt"); !os.IsNotExist(err) {
+		t.Error("--orphan should remove tracked files")
+	}
+	if head, _ := resolveHead(repo); head != "" {
+		t.Errorf("orphan branch should be unborn, got %s", head)
+	}
+}
+
+func TestSwitchOrphanKeepsLocalChanges(t *testing.T) {
+	repo := setupTestRepo(t)
+	commitFile(t, repo, "file.txt", "one\n", "first")
+	if err := os.WriteFile("file.txt", []byte("local\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Switch(repo, "", SwitchOptions{Orphan: "fresh"}); err == nil || !strings.Contains(err.Error(), "would be overwritten") {
+		t.Fatalf("switch --orphan should refuse to drop local changes, got %v", err)
+	}
+	if got := readTestFile(t, repo, "file.txt"); got != "local\n" {
+		t.Errorf("the local change should be kept, got %q", got)
+	}
+	if branch, _ := GetCurrentBranch(repo); branch != "main" {
+		t.Errorf("expected to stay on main, got %s", branch)
+	}
+
+	if err := Switch(repo, "", SwitchOptions{Orphan: "fresh", Force: true}); err != nil {
+		t.Fatalf("switch --orphan --force failed: %v", err)
+	}
+	if _, err := os.Stat("file.txt"); !os.IsNotExist(err) {
+		t.Error("--force should remove the modified file")
+	}
+}
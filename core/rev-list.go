@@ -0,0 +1,161 @@
+package core
+
+import (
+	"fmt"
+	"io"
+)
+
+type RevListOptions struct {
+	// Count prints how many commits were selected instead of listing them.
+	Count bool
+	// LeftRight marks each commit with "<" when it is reachable from the
+	// left side of a symmetric difference A...B and ">" otherwise. With
+	// Count, the two sides are counted separately as "<left>\t<right>".
+	LeftRight bool
+	// Objects lists, after the commits, every tree and blob reachable from
+	// them as "<hash> <path>", leaving out those the excluded commits have.
+	// The paths the walk is limited to limit the objects as well.
+	Objects bool
+}
+
+// RevList lists the commits revs selects, one hash per line in the order
+// of the walk, as git rev-list does.
+func RevList(repoPath string, out io.Writer, revs RevisionSet, walk WalkOptions, opts RevListOptions) error {
+	walker, err := NewRevWalker(repoPath, revs, walk)
+	if err != nil {
+		return err
+	}
+	var commits []CommitInfo
+	for walker.Next() {
+		commits = append(commits, walker.Commit())
+	}
+	if err := walker.Err(); err != nil {
+		return err
+	}
+
+	left, err := reachableCommits(repoPath, revs.Left...)
+	if err != nil {
+		return err
+	}
+	var objects []string
+	if opts.Objects {
+		if objects, err = revListObjects(repoPath, revs, commits, walk.Paths); err != nil {
+			return err
+		}
+	}
+
+	if opts.Count {
+		if !opts.LeftRight {
+			_, err := fmt.Fprintln(out, len(commits)+len(objects))
+			return err
+		}
+		leftCount := 0
+		for _, commit := range commits {
+			if left[commit.Hash] {
+				leftCount++
+			}
+		}
+		_, err := fmt.Fprintf(out, "%d\t%d\n", leftCount, len(commits)-leftCount)
+		return err
+	}
+
+	for _, commit := range commits {
+		mark := ""
+		if opts.LeftRight {
+			mark = ">"
+			if left[commit.Hash] {
+				mark = "<"
+			}
+		}
+		if _, err := fmt.Fprintf(out, "%s%s\n", mark, commit.Hash); err != nil {
+			return err
+		}
+	}
+	for _, line := range objects {
+		if _, err := fmt.Fprintln(out, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// revListObjects lists the trees and blobs of commits as "<hash> <path>"
+// lines, each object once under the first path it is found at, with a
+// tree before its entries. The root trees have an empty path. Objects in
+// the trees of the excluded commits at the edge of the selection are left
+// out, wherever they appear. Paths limit the listing to what they name or
+// contain, and the trees leading there.
+func revListObjects(repoPath string, revs RevisionSet, commits []CommitInfo, paths []string) ([]string, error) {
+	paths = append([]string(nil), paths...)
+	for i, path := range paths {
+		paths[i] = cleanPathspec(path)
+	}
+	excluded, err := reachableCommits(repoPath, revs.Exclude...)
+	if err != nil {
+		return nil, err
+	}
+	edges := append([]string(nil), revs.Exclude...)
+	for _, commit := range commits {
+		for _, parent := range commit.Parents {
+			if excluded[parent] {
+				edges = append(edges, parent)
+			}
+		}
+	}
+
+	seen := make(map[string]bool)
+	var listed []string
+	var walk func(tree, path string, uninteresting bool) error
+	walk = func(tree, path string, uninteresting bool) error {
+		if seen[tree] {
+			return nil
+		}
+		seen[tree] = true
+		if !uninteresting {
+			listed = append(listed, tree+" "+path)
+		}
+		entries, err := readTreeEntries(repoPath, tree)
+		if err != nil {
+			return err
+		}
+		prefix := ""
+		if path != "" {
+			prefix = path + "/"
+		}
+		for _, entry := range entries {
+			name := prefix + entry.Name
+			if !uninteresting && len(paths) > 0 && !lsTreeMatches(name, paths) && !lsTreeLeadsTo(name, paths) {
+				continue
+			}
+			switch {
+			case isTreeMode(entry.Mode):
+				if err := walk(entry.Hash, name, uninteresting); err != nil {
+					return err
+				}
+			case entry.Mode == "160000" || seen[entry.Hash]:
+			default:
+				seen[entry.Hash] = true
+				if !uninteresting {
+					listed = append(listed, entry.Hash+" "+name)
+				}
+			}
+		}
+		return nil
+	}
+
+	for _, hash := range edges {
+		commit, err := readCommit(repoPath, hash)
+		if err != nil {
+			return nil, err
+		}
+		if err := walk(commit.Tree, "", true); err != nil {
+			return nil, err
+		}
+	}
+	for _, commit := range commits {
+		if err := walk(commit.Tree, "", false); err != nil {
+			return nil, err
+		}
+	}
+	return listed, nil
+}
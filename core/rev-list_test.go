@@ -0,0 +1,97 @@
+package core
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func revList(t *testing.T, repo string, args []string, walk WalkOptions, opts RevListOptions) []string {
+	t.Helper()
+
+	revs, err := ParseRevisionArgs(repo, args)
+	if err != nil {
+		t.Fatalf("ParseRevisionArgs(%v) failed: %v", args, err)
+	}
+	var out bytes.Buffer
+	if err := RevList(repo, &out, revs, walk, opts); err != nil {
+		t.Fatalf("RevList(%v) failed: %v", args, err)
+	}
+	return strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+}
+
+func TestRevList(t *testing.T) {
+	repo := setupTestRepo(t)
+	first := commitFile(t, repo, "file.txt", "one\n", "first")
+	firstCommit, _ := readCommit(repo, first)
+	tree := firstCommit.Tree
+
+	a := datedCommit(t, tree, "a", 200, 200, first)
+	b := datedCommit(t, tree, "b", 300, 300, first)
+	merge := datedCommit(t, tree, "merge", 400, 400, a, b)
+	c := datedCommit(t, tree, "c", 500, 500, b)
+
+	one := 1
+	zero := 0
+	tests := []struct {
+		name string
+		args []string
+		walk WalkOptions
+		opts RevListOptions
+		want []string
+	}{
+		{"exclusion", []string{merge, "^" + c}, WalkOptions{}, RevListOptions{}, []string{merge, a}},
+		{"not", []string{merge, "--not", c}, WalkOptions{}, RevListOptions{}, []string{merge, a}},
+		{"not twice", []string{"--not", c, "--not", merge}, WalkOptions{}, RevListOptions{}, []string{merge, a}},
+		{"count", []string{merge}, WalkOptions{}, RevListOptions{Count: true}, []string{"4"}},
+		{"left-right", []string{merge + "..." + c}, WalkOptions{}, RevListOptions{LeftRight: true}, []string{">" + c, "<" + merge, "<" + a}},
+		{"left-right count", []string{merge + "..." + c}, WalkOptions{}, RevListOptions{LeftRight: true, Count: true}, []string{"2\t1"}},
+		{"merges", []string{merge, c}, WalkOptions{MinParents: 2}, RevListOptions{}, []string{merge}},
+		{"no merges", []string{merge}, WalkOptions{MaxParents: &one}, RevListOptions{Count: true}, []string{"3"}},
+		{"roots", []string{merge, c}, WalkOptions{MaxParents: &zero}, RevListOptions{}, []string{first}},
+	}
+	for _, test := range tests {
+		if got := revList(t, repo, test.args, test.walk, test.opts); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestRevListObjects(t *testing.T) {
+	repo := setupTestRepo(t)
+	first := commitFile(t, repo, "file.txt", "one\n", "first")
+	second := commitFile(t, repo, "dir/copy.txt", "one\n", "second")
+	third := commitFile(t, repo, "dir/new.txt", "two\n", "third")
+	thirdCommit, _ := readCommit(repo, third)
+
+	got := revList(t, repo, []string{third}, WalkOptions{}, RevListOptions{Objects: true})
+	if len(got) != 3+4+2+1 || got[0] != third || got[2] != first {
+		t.Fatalf("expected the commits and then their objects, got %v", got)
+	}
+	if got[3] != thirdCommit.Tree+" " {
+		t.Errorf("expected the root tree with an empty path first, got %q", got[3])
+	}
+	var paths []string
+	for _, line := range got[3:] {
+		paths = append(paths, line[2*HashSize+1:])
+	}
+	// file.txt has the blob of dir/copy.txt, which is listed only once
+	if want := []string{"", "dir", "dir/copy.txt", "dir/new.txt", "", "dir", ""}; !reflect.DeepEqual(paths, want) {
+		t.Errorf("got object paths %q, want %q", paths, want)
+	}
+
+	got = revList(t, repo, []string{first + ".." + third}, WalkOptions{}, RevListOptions{Objects: true})
+	paths = nil
+	for _, line := range got[2:] {
+		paths = append(paths, line[2*HashSize+1:])
+	}
+	if want := []string{"", "dir", "dir/new.txt", "", "dir"}; !reflect.DeepEqual(paths, want) {
+		t.Errorf("objects of the excluded commit should be left out, got paths %q", paths)
+	}
+
+	got = revList(t, repo, []string{second}, WalkOptions{Paths: []string{"dir"}}, RevListOptions{Objects: true, Count: true})
+	if !reflect.DeepEqual(got, []string{"4"}) {
+		t.Errorf("expected one commit, two trees and a blob within dir, got %v", got)
+	}
+}
@@ -0,0 +1,624 @@
+package core
+
+import (
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// resolveHead returns the commit HEAD points at, or an empty string when the
+// current branch has no commits yet.
+func resolveHead(repoPath string) (string, error) {
+	headStr, ok, err := readRawRef(repoPath, "HEAD")
+	if err != nil {
+		return "", fmt.Errorf("failed to read HEAD: %w", err)
+	}
+	if !ok {
+		return "", fmt.Errorf("failed to read HEAD: HEAD is missing")
+	}
+
+	if !strings.HasPrefix(headStr, "ref: ") {
+		return headStr, nil
+	}
+
+	hash, _, err := readRef(repoPath, strings.TrimPrefix(headStr, "ref: "))
+	return hash, err
+}
+
+// ResolveRevision resolves a revision expression to the hash of the object
+// it names. It understands the gitrevisions(7) syntax used by this tool:
+//
+//   - refs, branches, tags, remote-tracking branches and HEAD-like names
+//   - full or abbreviated object hashes (at least 4 hex digits)
+//   - <ref>@{<n>}, <ref>@{<date>}, @{-<n>} and <branch>@{upstream}/@{u}
+//   - <rev>~<n>, <rev>^<n>, <rev>^{<type>}, <rev>^{} and <rev>^{/<regex>}
+//   - :<path> for the index and <rev>:<path> for a path in a tree
+func ResolveRevision(repoPath, rev string) (string, error) {
+	if rev == "" {
+		return "", fmt.Errorf("empty revision")
+	}
+
+	if strings.HasPrefix(rev, ":") {
+		return resolveIndexPath(repoPath, rev[1:])
+	}
+
+	if idx := indexOutsideBraces(rev, ":"); idx > 0 {
+		treeish, path := rev[:idx], rev[idx+1:]
+		hash, err := ResolveRevision(repoPath, treeish)
+		if err != nil {
+			return "", err
+		}
+		tree, err := peelObject(repoPath, hash, "tree", treeish)
+		if err != nil {
+			return "", err
+		}
+		return lookupTreePath(repoPath, tree, path, treeish)
+	}
+
+	base, suffix := rev, ""
+	if idx := indexOutsideBraces(rev, "~^"); idx == 0 {
+		return "", fmt.Errorf("invalid revision '%s'", rev)
+	} else if idx > 0 {
+		base, suffix = rev[:idx], rev[idx:]
+	}
+
+	hash, err := resolveRevisionName(repoPath, base)
+	if err != nil {
+		return "", err
+	}
+	return applyRevisionSuffix(repoPath, hash, suffix, rev)
+}
+
+// resolveCommitish resolves rev with ResolveRevision and peels the result to
+// a commit.
+func resolveCommitish(repoPath, rev string) (string, error) {
+	hash, err := ResolveRevision(repoPath, rev)
+	if err != nil {
+		return "", err
+	}
+	return peelToCommit(repoPath, hash, rev)
+}
+
+// resolveObjectName resolves rev without peeling, so it may name a tag,
+// tree or blob.
+func resolveObjectName(repoPath, rev string) (string, error) {
+	return ResolveRevision(repoPath, rev)
+}
+
+// indexOutsideBraces returns the index of the first of chars in s that isn't
+// inside a {...} group, or -1.
+func indexOutsideBraces(s, chars string) int {
+	depth := 0
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '{':
+			depth++
+		case s[i] == '}' && depth > 0:
+			depth--
+		case depth == 0 && strings.IndexByte(chars, s[i]) >= 0:
+			return i
+		}
+	}
+	return -1
+}
+
+// applyRevisionSuffix applies a chain of ~<n>, ^<n> and ^{...} operators.
+func applyRevisionSuffix(repoPath, hash, suffix, rev string) (string, error) {
+	for suffix != "" {
+		op := suffix[0]
+		suffix = suffix[1:]
+
+		if op == '^' && strings.HasPrefix(suffix, "{") {
+			end := strings.IndexByte(suffix, '}')
+			if end < 0 {
+				return "", fmt.Errorf("invalid revision '%s'", rev)
+			}
+			inner := suffix[1:end]
+			suffix = suffix[end+1:]
+
+			var err error
+			if strings.HasPrefix(inner, "/") {
+				hash, err = searchCommitMessage(repoPath, hash, inner[1:], rev)
+			} else {
+				hash, err = peelObject(repoPath, hash, inner, rev)
+			}
+			if err != nil {
+				return "", err
+			}
+			continue
+		}
+
+		digits := 0
+		for digits < len(suffix) && suffix[digits] >= '0' && suffix[digits] <= '9' {
+			digits++
+		}
+		n := 1
+		if digits > 0 {
+			n, _ = strconv.Atoi(suffix[:digits])
+		}
+		suffix = suffix[digits:]
+
+		commit, err := peelToCommit(repoPath, hash, rev)
+		if err != nil {
+			return "", err
+		}
+		hash = commit
+
+		switch op {
+		case '~':
+			for i := 0; i < n; i++ {
+				if hash, err = nthParent(repoPath, hash, 1, rev); err != nil {
+					return "", err
+				}
+			}
+		case '^':
+			if hash, err = nthParent(repoPath, hash, n, rev); err != nil {
+				return "", err
+			}
+		default:
+			return "", fmt.Errorf("invalid revision '%s'", rev)
+		}
+	}
+	return hash, nil
+}
+
+func nthParent(repoPath, hash string, n int, rev string) (string, error) {
+	if n == 0 {
+		return hash, nil
+	}
+	commit, err := readCommit(repoPath, hash)
+	if err != nil {
+		return "", err
+	}
+	if n > len(commit.Parents) {
+		return "", fmt.Errorf("revision '%s' does not exist: %s has no parent %d", rev, shortHash(hash), n)
+	}
+	return commit.Parents[n-1], nil
+}
+
+// peelObject follows tags (and commits, when a tree is wanted) until it
+// reaches an object of the wanted type. An empty want peels tags only.
+func peelObject(repoPath, hash, want, rev string) (string, error) {
+	switch want {
+	case "", "object", "commit", "tree", "blob", "tag":
+	default:
+		return "", fmt.Errorf("invalid object type '%s' in '%s'", want, rev)
+	}
+
+	for {
+		objectType, _, err := readObjectWithType(repoPath, hash)
+		if err != nil {
+			return "", fmt.Errorf("failed to read %s: %w", hash, err)
+		}
+		if objectType == want || want == "object" || (want == "" && objectType != "tag") {
+			return hash, nil
+		}
+
+		switch {
+		case objectType == "tag":
+			tag, err := readTag(repoPath, hash)
+			if err != nil {
+				return "", err
+			}
+			hash = tag.Object
+		case objectType == "commit" && want == "tree":
+			commit, err := readCommit(repoPath, hash)
+			if err != nil {
+				return "", err
+			}
+			hash = commit.Tree
+		default:
+			return "", fmt.Errorf("'%s' could not be peeled to a %s", rev, want)
+		}
+	}
+}
+
+// peelToCommit follows annotated tags until it reaches a commit.
+func peelToCommit(repoPath, hash, rev string) (string, error) {
+	for {
+		objectType, _, err := readObjectWithType(repoPath, hash)
+		if err != nil {
+			return "", err
+		}
+		switch objectType {
+		case "commit":
+			return hash, nil
+		case "tag":
+			tag, err := readTag(repoPath, hash)
+			if err != nil {
+				return "", err
+			}
+			hash = tag.Object
+		default:
+			return "", fmt.Errorf("'%s' is a %s, not a commit", rev, objectType)
+		}
+	}
+}
+
+// searchCommitMessage finds the youngest commit reachable from hash whose
+// message matches pattern, for the ^{/<regex>} syntax.
+func searchCommitMessage(repoPath, hash, pattern, rev string) (string, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return "", fmt.Errorf("invalid regex in '%s': %w", rev, err)
+	}
+	start, err := peelToCommit(repoPath, hash, rev)
+	if err != nil {
+		return "", err
+	}
+	reachable, err := reachableCommits(repoPath, start)
+	if err != nil {
+		return "", err
+	}
+
+	var best CommitInfo
+	for candidate := range reachable {
+		commit, err := readCommit(repoPath, candidate)
+		if err != nil {
+			return "", err
+		}
+		if re.MatchString(commit.Message) && (best.Hash == "" || commit.Timestamp > best.Timestamp) {
+			best = commit
+		}
+	}
+	if best.Hash == "" {
+		return "", fmt.Errorf("no commit message matches '%s'", pattern)
+	}
+	return best.Hash, nil
+}
+
+// resolveIndexPath looks up the blob staged for a path, as in ":<path>" or
+// ":0:<path>".
+func resolveIndexPath(repoPath, spec string) (string, error) {
+	if len(spec) >= 2 && spec[1] == ':' && spec[0] >= '0' && spec[0] <= '3' {
+		if spec[0] != '0' {
+			return "", fmt.Errorf("path '%s' is not at stage %c of the index", spec[2:], spec[0])
+		}
+		spec = spec[2:]
+	}
+
+	index, err := readIndexMap(repoPath)
+	if err != nil {
+		return "", err
+	}
+	hash, ok := index[filepath.Clean(spec)]
+	if !ok {
+		return "", fmt.Errorf("path '%s' does not exist in the index", spec)
+	}
+	return hash, nil
+}
+
+// lookupTreePath walks from treeHash down to path and returns the hash of
+// the blob or tree found there.
+func lookupTreePath(repoPath, treeHash, path, treeish string) (string, error) {
+	path = strings.Trim(filepath.ToSlash(filepath.Clean(path)), "/")
+	if path == "." || path == "" {
+		return treeHash, nil
+	}
+
+	hash := treeHash
+	for _, part := range strings.Split(path, "/") {
+		entries, err := readTreeEntries(repoPath, hash)
+		if err != nil {
+			return "", fmt.Errorf("path '%s' does not exist in '%s'", path, treeish)
+		}
+		found := false
+		for _, entry := range entries {
+			if entry.Name == part {
+				hash, found = entry.Hash, true
+				break
+			}
+		}
+		if !found {
+			return "", fmt.Errorf("path '%s' does not exist in '%s'", path, treeish)
+		}
+	}
+	return hash, nil
+}
+
+func resolveRevisionName(repoPath, rev string) (string, error) {
+	if idx := strings.Index(rev, "@{"); idx >= 0 && strings.HasSuffix(rev, "}") {
+		name, selector := rev[:idx], rev[idx+2:len(rev)-1]
+
+		switch strings.ToLower(selector) {
+		case "u", "upstream", "push":
+			ref, err := upstreamRef(repoPath, name)
+			if err != nil {
+				return "", err
+			}
+			return resolveRevisionName(repoPath, ref)
+		}
+		if name == "" && strings.HasPrefix(selector, "-") {
+			n, err := strconv.Atoi(selector[1:])
+			if err != nil || n < 1 {
+				return "", fmt.Errorf("invalid revision '%s'", rev)
+			}
+			branch, err := previousBranch(repoPath, n)
+			if err != nil {
+				return "", err
+			}
+			return resolveRevisionName(repoPath, branch)
+		}
+		return resolveReflogRevision(repoPath, name, selector)
+	}
+
+	if rev == "HEAD" || rev == "@" {
+		head, err := resolveHead(repoPath)
+		if err != nil {
+			return "", err
+		}
+		if head == "" {
+			return "", fmt.Errorf("HEAD does not point to a commit yet")
+		}
+		return head, nil
+	}
+
+	if len(rev) == 2*HashSize && isHexString(rev) {
+		return expandObjectHash(repoPath, rev)
+	}
+
+	var candidates []string
+	if strings.HasPrefix(rev, "refs/") {
+		candidates = []string{rev}
+	} else {
+		if rev == strings.ToUpper(rev) && strings.HasSuffix(rev, "HEAD") {
+			// pseudo-refs such as ORIG_HEAD and FETCH_HEAD
+			candidates = append(candidates, rev)
+		}
+		candidates = append(candidates,
+			"refs/"+rev,
+			"refs/tags/"+rev,
+			"refs/heads/"+rev,
+			"refs/remotes/"+rev,
+			"refs/remotes/"+rev+"/HEAD",
+		)
+	}
+	for _, ref := range candidates {
+		hash, ok, err := readRef(repoPath, ref)
+		if err != nil {
+			return "", err
+		}
+		if ok {
+			// FETCH_HEAD lines carry extra fields after the hash
+			hash, _, _ = strings.Cut(hash, "\t")
+			return hash, nil
+		}
+	}
+
+	if isHexString(rev) && len(rev) >= 4 {
+		return expandObjectHash(repoPath, rev)
+	}
+
+	return "", fmt.Errorf("unknown revision '%s'", rev)
+}
+
+// upstreamRef returns the ref configured as the upstream of branch (the
+// current branch when empty) via branch.<name>.remote and .merge.
+func upstreamRef(repoPath, branch string) (string, error) {
+	if branch == "" {
+		current, err := GetCurrentBranch(repoPath)
+		if err != nil {
+			return "", fmt.Errorf("HEAD does not point to a branch")
+		}
+		branch = current
+	}
+
+	remote, remoteErr := GetConfig(repoPath, branchSection(branch), "remote")
+	merge, mergeErr := GetConfig(repoPath, branchSection(branch), "merge")
+	if remoteErr != nil || mergeErr != nil {
+		return "", fmt.Errorf("no upstream configured for branch '%s'", branch)
+	}
+
+	if remote == "." {
+		return merge, nil
+	}
+	return fmt.Sprintf("refs/remotes/%s/%s", remote, strings.TrimPrefix(merge, "refs/heads/")), nil
+}
+
+// previousBranch returns the branch that was checked out before the nth most
+// recent checkout, according to the HEAD reflog.
+func previousBranch(repoPath string, n int) (string, error) {
+	entries, err := Reflog(repoPath, "HEAD")
+	if err != nil {
+		return "", err
+	}
+
+	found := 0
+	for _, entry := range entries {
+		rest, ok := strings.CutPrefix(entry.Message, "checkout: moving from ")
+		if !ok {
+			continue
+		}
+		found++
+		if found == n {
+			from, _, _ := strings.Cut(rest, " to ")
+			return from, nil
+		}
+	}
+	return "", fmt.Errorf("only %d branch switches found in the HEAD reflog", found)
+}
+
+func isHexString(s string) bool {
+	if s == "" || len(s) > 2*HashSize {
+		return false
+	}
+	if len(s)%2 == 1 {
+		s += "0"
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
+
+// expandObjectHash looks up the object whose hash starts with prefix.
+func expandObjectHash(repoPath, prefix string) (string, error) {
+	prefix = strings.ToLower(prefix)
+	objectsDir := filepath.Join(repoPath, RepoDirName, "objects")
+
+	if len(prefix) == 2*HashSize {
+		if _, err := os.Stat(filepath.Join(objectsDir, prefix[:2], prefix[2:])); err != nil {
+			return "", fmt.Errorf("object %s not found", prefix)
+		}
+		return prefix, nil
+	}
+
+	entries, err := os.ReadDir(filepath.Join(objectsDir, prefix[:2]))
+	if err != nil {
+		return "", fmt.Errorf("unknown revision '%s'", prefix)
+	}
+
+	var matches []string
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), prefix[2:]) {
+			matches = append(matches, prefix[:2]+entry.Name())
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return "", fmt.Errorf("unknown revision '%s'", prefix)
+	case 1:
+		return matches[0], nil
+	default:
+		return "", fmt.Errorf("short object ID %s is ambiguous", prefix)
+	}
+}
+
+// RevisionSet is a list of revision arguments resolved to commits: the
+// selected commits are those reachable from Include but not from Exclude.
+// Left holds the left side of each symmetric difference A...B, to tell
+// which side a selected commit comes from.
+type RevisionSet struct {
+	Include []string
+	Exclude []string
+	Left    []string
+}
+
+// SplitRevisionsAndPaths separates arguments given without "--" into
+// revisions and paths, as git does: from the first argument that is not a
+// revision on, the arguments are paths, and they have to exist in the
+// working tree. With lastIsPath, as for --follow, a last argument that is
+// not a revision is taken as a path even when the file is gone.
+func SplitRevisionsAndPaths(repoPath string, args []string, lastIsPath bool) (revs, paths []string, err error) {
+	for i, arg := range args {
+		if _, err := ParseRevisionArgs(repoPath, []string{arg}); err == nil {
+			continue
+		}
+		for j, path := range args[i:] {
+			if lastIsPath && i+j == len(args)-1 {
+				continue
+			}
+			if _, err := os.Lstat(filepath.Join(repoPath, path)); err != nil {
+				return nil, nil, fmt.Errorf("ambiguous argument '%s': unknown revision or path not in the working tree", path)
+			}
+		}
+		return args[:i], args[i:], nil
+	}
+	return args, nil, nil
+}
+
+// ParseRevisionArgs resolves revision arguments such as "A", "^A",
+// "A..B", "A...B", "A^@" and "A^!" into a RevisionSet. An omitted side of
+// a range defaults to HEAD, and no arguments at all means HEAD. "--not"
+// flips whether the arguments after it include or exclude, up to the next
+// "--not".
+func ParseRevisionArgs(repoPath string, args []string) (RevisionSet, error) {
+	var revs RevisionSet
+	if len(args) == 0 {
+		args = []string{"HEAD"}
+	}
+	not := false
+	include := func(hashes ...string) {
+		if not {
+			revs.Exclude = append(revs.Exclude, hashes...)
+		} else {
+			revs.Include = append(revs.Include, hashes...)
+		}
+	}
+	exclude := func(hashes ...string) {
+		if not {
+			revs.Include = append(revs.Include, hashes...)
+		} else {
+			revs.Exclude = append(revs.Exclude, hashes...)
+		}
+	}
+
+	resolve := func(rev string) (string, error) {
+		if rev == "" {
+			rev = "HEAD"
+		}
+		return resolveCommitish(repoPath, rev)
+	}
+
+	for _, arg := range args {
+		switch {
+		case arg == "--not":
+			not = !not
+
+		case strings.Contains(arg, "..."):
+			left, right, _ := strings.Cut(arg, "...")
+			a, err := resolve(left)
+			if err != nil {
+				return revs, err
+			}
+			b, err := resolve(right)
+			if err != nil {
+				return revs, err
+			}
+			bases, err := mergeBases(repoPath, a, b)
+			if err != nil {
+				return revs, err
+			}
+			include(a, b)
+			exclude(bases...)
+			revs.Left = append(revs.Left, a)
+
+		case strings.Contains(arg, ".."):
+			left, right, _ := strings.Cut(arg, "..")
+			a, err := resolve(left)
+			if err != nil {
+				return revs, err
+			}
+			b, err := resolve(right)
+			if err != nil {
+				return revs, err
+			}
+			exclude(a)
+			include(b)
+
+		case strings.HasPrefix(arg, "^"):
+			hash, err := resolve(arg[1:])
+			if err != nil {
+				return revs, err
+			}
+			exclude(hash)
+
+		case strings.HasSuffix(arg, "^@"), strings.HasSuffix(arg, "^!"):
+			hash, err := resolve(arg[:len(arg)-2])
+			if err != nil {
+				return revs, err
+			}
+			commit, err := readCommit(repoPath, hash)
+			if err != nil {
+				return revs, err
+			}
+			if strings.HasSuffix(arg, "^@") {
+				include(commit.Parents...)
+			} else {
+				include(hash)
+				exclude(commit.Parents...)
+			}
+
+		default:
+			hash, err := resolve(arg)
+			if err != nil {
+				return revs, err
+			}
+			include(hash)
+		}
+	}
+	return revs, nil
+}
@@ -0,0 +1,213 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestResolveRevision(t *testing.T) {
+	repo := setupTestRepo(t)
+	first := commitFile(t, repo, "file.txt", "one\n", "first")
+	second := commitFile(t, repo, "dir/sub.txt", "sub\n", "second: add dir")
+
+	if err := CreateBranch(repo, "feature"); err != nil {
+		t.Fatalf("CreateBranch failed: %v", err)
+	}
+	third := commitFile(t, repo, "file.txt", "three\n", "third")
+
+	if err := Checkout(repo, "feature"); err != nil {
+		t.Fatalf("Checkout failed: %v", err)
+	}
+	side := commitFile(t, repo, "side.txt", "side\n", "side")
+	if err := Checkout(repo, "main"); err != nil {
+		t.Fatalf("Checkout failed: %v", err)
+	}
+
+	thirdCommit, err := readCommit(repo, third)
+	if err != nil {
+		t.Fatalf("readCommit failed: %v", err)
+	}
+	signature := "Test Author <test@example.com> 1700000000 +0000"
+	merge, err := commitTreeWithSignatures(thirdCommit.Tree, []string{third, side}, "merge", signature, signature)
+	if err != nil {
+		t.Fatalf("failed to write merge commit: %v", err)
+	}
+	if _, err := CreateTag(repo, "v1", first, TagOptions{Annotate: true, Message: "v1", Name: "T", Email: "t@example.com"}); err != nil {
+		t.Fatalf("CreateTag failed: %v", err)
+	}
+
+	firstCommit, _ := readCommit(repo, first)
+	subBlob, _ := HashObject([]byte("sub\n"), "blob", false)
+	threeBlob, _ := HashObject([]byte("three\n"), "blob", false)
+
+	tests := map[string]string{
+		"HEAD":             third,
+		"@":                third,
+		"main~2":           first,
+		"HEAD^":            second,
+		"HEAD^^":           first,
+		"HEAD~1^":          first,
+		"feature":          side,
+		"refs/heads/main":  third,
+		third[:7]:          third,
+		merge + "^2":       side,
+		merge + "^2~1":     second,
+		merge + "^1":       third,
+		merge + "^0":       merge,
+		"v1^{commit}":      first,
+		"v1^{}":            first,
+		"v1^{tree}":        firstCommit.Tree,
+		"HEAD:dir/sub.txt": subBlob,
+		"main:file.txt":    threeBlob,
+		":file.txt":        threeBlob,
+		":0:file.txt":      threeBlob,
+		"HEAD^{/add dir}":  second,
+		"@{-1}":            side,
+	}
+	for rev, want := range tests {
+		got, err := ResolveRevision(repo, rev)
+		if err != nil || got != want {
+			t.Errorf("%s: expected %s, got %s (%v)", rev, want, got, err)
+		}
+	}
+
+	for _, rev := range []string{"nope", "HEAD~5", "HEAD^2", "HEAD:missing", "HEAD^{blob}", "^HEAD", ":1:file.txt"} {
+		if got, err := ResolveRevision(repo, rev); err == nil {
+			t.Errorf("%s: expected an error, got %s", rev, got)
+		}
+	}
+}
+
+func TestResolveRevisionAmbiguousPrefix(t *testing.T) {
+	repo := setupTestRepo(t)
+	commitFile(t, repo, "file.txt", "one\n", "first")
+
+	dir := filepath.Join(repo, RepoDirName, "objects", "ab")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"cd" + strings.Repeat("0", 36), "cd" + strings.Repeat("1", 36)} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := ResolveRevision(repo, "abcd"); err == nil || !strings.Contains(err.Error(), "ambiguous") {
+		t.Errorf("expected an ambiguity error, got %v", err)
+	}
+	if got, err := ResolveRevision(repo, "abcd1"); err != nil || got != "abcd"+strings.Repeat("1", 36) {
+		t.Errorf("a longer prefix should be unique, got %s (%v)", got, err)
+	}
+}
+
+func TestResolveUpstream(t *testing.T) {
+	repo := setupTestRepo(t)
+	first := commitFile(t, repo, "file.txt", "one\n", "first")
+	commitFile(t, repo, "file.txt", "two\n", "second")
+
+	if err := os.MkdirAll(filepath.Join(repo, RepoDirName, "refs", "remotes", "origin"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(repo, RepoDirName, "refs", "remotes", "origin", "main"), []byte(first+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ResolveRevision(repo, "@{u}"); err == nil {
+		t.Error("expected an error without upstream configuration")
+	}
+
+	if err := SetConfig(repo, `branch "main"`, "remote", "origin"); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetConfig(repo, `branch "main"`, "merge", "refs/heads/main"); err != nil {
+		t.Fatal(err)
+	}
+	for _, rev := range []string{"@{u}", "main@{upstream}", "origin/main"} {
+		if got, err := ResolveRevision(repo, rev); err != nil || got != first {
+			t.Errorf("%s: expected %s, got %s (%v)", rev, first, got, err)
+		}
+	}
+}
+
+func TestParseRevisionArgs(t *testing.T) {
+	repo := setupTestRepo(t)
+	base := commitFile(t, repo, "file.txt", "one\n", "base")
+	if err := CreateBranch(repo, "feature"); err != nil {
+		t.Fatalf("CreateBranch failed: %v", err)
+	}
+	mainTip := commitFile(t, repo, "file.txt", "two\n", "main")
+	if err := Checkout(repo, "feature"); err != nil {
+		t.Fatalf("Checkout failed: %v", err)
+	}
+	featureTip := commitFile(t, repo, "other.txt", "x\n", "feature")
+
+	hashes := func(commits []CommitInfo) []string {
+		var out []string
+		for _, c := range commits {
+			out = append(out, c.Hash)
+		}
+		return out
+	}
+
+	tests := map[string][]string{
+		"main..feature":  {featureTip},
+		"feature..main":  {mainTip},
+		"main..":         {featureTip},
+		"feature...main": {featureTip, mainTip},
+		"feature^!":      {featureTip},
+	}
+	for arg, want := range tests {
+		commits, err := LogRange(repo, []string{arg})
+		if err != nil {
+			t.Errorf("%s: %v", arg, err)
+			continue
+		}
+		if got := hashes(commits); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: expected %v, got %v", arg, want, got)
+		}
+	}
+
+	commits, err := LogRange(repo, []string{"main", "^feature"})
+	if err != nil || !reflect.DeepEqual(hashes(commits), []string{mainTip}) {
+		t.Errorf("main ^feature: expected [%s], got %v (%v)", mainTip, hashes(commits), err)
+	}
+
+	bases, err := mergeBases(repo, mainTip, featureTip)
+	if err != nil || !reflect.DeepEqual(bases, []string{base}) {
+		t.Errorf("expected merge base %s, got %v (%v)", base, bases, err)
+	}
+}
+
+func TestSplitRevisionsAndPaths(t *testing.T) {
+	repo := setupTestRepo(t)
+	first := commitFile(t, repo, "moved.txt", "one\n", "first")
+	commitFile(t, repo, "dir/other.txt", "two\n", "second")
+
+	tests := []struct {
+		args        []string
+		revs, paths []string
+	}{
+		{[]string{"HEAD~1"}, []string{"HEAD~1"}, nil},
+		{[]string{"moved.txt"}, []string{}, []string{"moved.txt"}},
+		{[]string{"HEAD", "moved.txt", "dir"}, []string{"HEAD"}, []string{"moved.txt", "dir"}},
+		{[]string{first[:7] + "..HEAD", "dir/other.txt"}, []string{first[:7] + "..HEAD"}, []string{"dir/other.txt"}},
+	}
+	for _, test := range tests {
+		revs, paths, err := SplitRevisionsAndPaths(repo, test.args, false)
+		if err != nil || !reflect.DeepEqual(revs, test.revs) || !reflect.DeepEqual(paths, test.paths) {
+			t.Errorf("SplitRevisionsAndPaths(%v) = %v, %v, %v, want %v, %v", test.args, revs, paths, err, test.revs, test.paths)
+		}
+	}
+
+	if _, _, err := SplitRevisionsAndPaths(repo, []string{"HEAD", "gone.txt"}, false); err == nil || !strings.Contains(err.Error(), "ambiguous argument 'gone.txt'") {
+		t.Errorf("expected an ambiguous argument error, got %v", err)
+	}
+	// --follow can look for a file that has since been renamed away
+	revs, paths, err := SplitRevisionsAndPaths(repo, []string{"HEAD", "gone.txt"}, true)
+	if err != nil || !reflect.DeepEqual(revs, []string{"HEAD"}) || !reflect.DeepEqual(paths, []string{"gone.txt"}) {
+		t.Errorf("with lastIsPath: got %v, %v, %v", revs, paths, err)
+	}
+}
@@ -0,0 +1,738 @@
+package core
+
+import (
+	"container/heap"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"time"
+)
+
+// WalkOrder is the order a RevWalker produces commits in.
+type WalkOrder int
+
+const (
+	// OrderDefault yields commits newest first, as soon as they are reached.
+	OrderDefault WalkOrder = iota
+	// OrderDate shows no parent before its children, otherwise by committer date.
+	OrderDate
+	// OrderAuthorDate is OrderDate by author date.
+	OrderAuthorDate
+	// OrderTopo shows no parent before its children and keeps lines of history together.
+	OrderTopo
+)
+
+type WalkOptions struct {
+	Order WalkOrder
+	// Reverse yields the selected commits oldest first.
+	Reverse bool
+	// FirstParent follows only the first parent of merge commits.
+	FirstParent bool
+
+	// MaxCount limits the number of commits shown; Skip leaves out the first ones.
+	MaxCount int
+	Skip     int
+	// Author and Committer match "name <email>" against any of the patterns.
+	Author    []string
+	Committer []string
+	// Grep matches the message against any of the patterns, or all with AllMatch.
+	Grep     []string
+	AllMatch bool
+	// IgnoreCase applies to Author, Committer and Grep.
+	IgnoreCase bool
+	// Since and Until bound the committer date when set.
+	Since time.Time
+	Until time.Time
+	// MinParents and MaxParents bound the number of parents.
+	MinParents int
+	MaxParents *int
+	// Paths limits the walk to commits changing them, simplifying history.
+	Paths []string
+
+	// PickaxeString and PickaxeRegex are log -S and -G.
+	PickaxeString string
+	PickaxeRegex  string
+	// PickaxeAll makes Changes report every file of a matching commit.
+	PickaxeAll bool
+	// Follow tracks the single path in Paths back through renames.
+	Follow bool
+}
+
+// commitFilter holds the compiled WalkOptions filters.
+type commitFilter struct {
+	author    []*regexp.Regexp
+	committer []*regexp.Regexp
+	grep      []*regexp.Regexp
+	allMatch  bool
+	since     time.Time
+	until     time.Time
+
+	minParents int
+	maxParents *int
+}
+
+func newCommitFilter(opts WalkOptions) (*commitFilter, error) {
+	compile := func(patterns []string) ([]*regexp.Regexp, error) {
+		var compiled []*regexp.Regexp
+		for _, pattern := range patterns {
+			if opts.IgnoreCase {
+				pattern = "(?i)" + pattern
+			}
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("invalid pattern '%s': %w", pattern, err)
+			}
+			compiled = append(compiled, re)
+		}
+		return compiled, nil
+	}
+
+	f := &commitFilter{
+		allMatch:   opts.AllMatch,
+		since:      opts.Since,
+		until:      opts.Until,
+		minParents: opts.MinParents,
+		maxParents: opts.MaxParents,
+	}
+	var err error
+	if f.author, err = compile(opts.Author); err != nil {
+		return nil, err
+	}
+	if f.committer, err = compile(opts.Committer); err != nil {
+		return nil, err
+	}
+	if f.grep, err = compile(opts.Grep); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// matches reports whether commit passes every filter.
+func (f *commitFilter) matches(commit CommitInfo) bool {
+	anyMatch := func(patterns []*regexp.Regexp, s string) bool {
+		if len(patterns) == 0 {
+			return true
+		}
+		for _, re := range patterns {
+			if re.MatchString(s) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if !anyMatch(f.author, fmt.Sprintf("%s <%s>", commit.Author, commit.Email)) {
+		return false
+	}
+	committerName, committerEmail, committerTime, _ := parseAuthorLine(commit.Committer)
+	if !anyMatch(f.committer, fmt.Sprintf("%s <%s>", committerName, committerEmail)) {
+		return false
+	}
+	if f.allMatch {
+		for _, re := range f.grep {
+			if !re.MatchString(commit.Message) {
+				return false
+			}
+		}
+	} else if !anyMatch(f.grep, commit.Message) {
+		return false
+	}
+	if !f.since.IsZero() && committerTime < f.since.Unix() {
+		return false
+	}
+	if !f.until.IsZero() && committerTime > f.until.Unix() {
+		return false
+	}
+	if len(commit.Parents) < f.minParents || f.maxParents != nil && len(commit.Parents) > *f.maxParents {
+		return false
+	}
+	return true
+}
+
+func (f *commitFilter) isEmpty() bool {
+	return len(f.author) == 0 && len(f.committer) == 0 && len(f.grep) == 0 && f.since.IsZero() && f.until.IsZero() &&
+		f.minParents == 0 && f.maxParents == nil
+}
+
+// pathState records how path limiting treated a commit.
+type pathState struct {
+	// parents are the parents the walk followed from the commit
+	parents []string
+	// treesame is set for commits that changed none of the paths
+	treesame bool
+}
+
+// RevWalker yields the commits a RevisionSet selects; use it like a bufio.Scanner.
+type RevWalker struct {
+	repoPath string
+	opts     WalkOptions
+	// excluded holds the commits found to be reachable from an excluded one
+	excluded map[string]bool
+	bottoms  map[string]bool
+	seen     map[string]bool
+	walked   map[string]bool
+	slop     int
+	queue    commitQueue
+	filter   *commitFilter
+	paths    map[string]pathState
+	pickaxe  *pickaxe
+	skipped  int
+	shown    int
+
+	// follow is the current name of the followed path; changes caches diffs
+	follow  string
+	changes map[string][]FileChange
+
+	// sorted holds the output of a walk that had to be completed up front
+	sorted  []CommitInfo
+	limited bool
+
+	commit CommitInfo
+	err    error
+}
+
+// NewRevWalker prepares a walk over the commits revs selects.
+func NewRevWalker(repoPath string, revs RevisionSet, opts WalkOptions) (*RevWalker, error) {
+	filter, err := newCommitFilter(opts)
+	if err != nil {
+		return nil, err
+	}
+	paths := make([]string, len(opts.Paths))
+	for i, path := range opts.Paths {
+		paths[i] = cleanPathspec(path)
+	}
+	opts.Paths = paths
+	pickaxe, err := newPickaxe(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &RevWalker{
+		repoPath: repoPath,
+		opts:     opts,
+		excluded: make(map[string]bool),
+		bottoms:  make(map[string]bool),
+		seen:     make(map[string]bool),
+		walked:   make(map[string]bool),
+		slop:     walkSlop,
+		queue:    commitQueue{key: committerTime},
+		filter:   filter,
+		pickaxe:  pickaxe,
+		changes:  make(map[string][]FileChange),
+	}
+	if opts.Follow {
+		if len(opts.Paths) != 1 {
+			return nil, fmt.Errorf("--follow requires exactly one path")
+		}
+		w.follow = opts.Paths[0]
+	} else if len(opts.Paths) > 0 {
+		w.paths = make(map[string]pathState)
+	}
+	for _, hash := range revs.Exclude {
+		w.bottoms[hash] = true
+		if err := w.push(hash, true); err != nil {
+			return nil, err
+		}
+	}
+	for _, hash := range revs.Include {
+		if err := w.push(hash, false); err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.Order != OrderDefault || opts.Reverse || w.paths != nil || len(revs.Exclude) > 0 {
+		var walked []CommitInfo
+		for w.step() {
+			walked = append(walked, w.commit)
+		}
+		if w.err != nil {
+			return nil, w.err
+		}
+		// sort before filtering, so hidden commits still connect the history
+		if opts.Order != OrderDefault {
+			walked = sortTopologically(walked, opts.Order, w.followedParents)
+		}
+		var commits []CommitInfo
+		for _, commit := range walked {
+			// reached before the excluded side caught up with it
+			if w.excluded[commit.Hash] {
+				continue
+			}
+			shown, err := w.shows(commit)
+			if err != nil {
+				return nil, err
+			}
+			if shown {
+				commits = append(commits, commit)
+			}
+		}
+		commits = commits[min(opts.Skip, len(commits)):]
+		if opts.MaxCount > 0 && len(commits) > opts.MaxCount {
+			commits = commits[:opts.MaxCount]
+		}
+		if opts.Reverse {
+			slices.Reverse(commits)
+		}
+		w.sorted, w.limited = commits, true
+	}
+	return w, nil
+}
+
+// WalkRevisions walks what revision arguments select, HEAD by default.
+func WalkRevisions(repoPath string, args []string, opts WalkOptions) (*RevWalker, error) {
+	if len(args) == 0 {
+		repoDir := filepath.Join(repoPath, RepoDirName)
+		if _, err := os.Stat(repoDir); errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("repository not initialized")
+		}
+		head, err := resolveHead(repoPath)
+		if err != nil {
+			return nil, err
+		}
+		if head == "" {
+			return nil, fmt.Errorf("no commits yet")
+		}
+	}
+	revs, err := ParseRevisionArgs(repoPath, args)
+	if err != nil {
+		return nil, err
+	}
+	return NewRevWalker(repoPath, revs, opts)
+}
+
+// Next advances to the next commit, returning false at the end or on an error.
+func (w *RevWalker) Next() bool {
+	if w.limited {
+		if len(w.sorted) == 0 {
+			return false
+		}
+		w.commit, w.sorted = w.sorted[0], w.sorted[1:]
+		return true
+	}
+
+	for {
+		if w.opts.MaxCount > 0 && w.shown >= w.opts.MaxCount {
+			return false
+		}
+		if !w.step() {
+			return false
+		}
+		shown, err := w.shows(w.commit)
+		if err != nil {
+			w.err = err
+			return false
+		}
+		if !shown {
+			continue
+		}
+		if w.skipped < w.opts.Skip {
+			w.skipped++
+			continue
+		}
+		w.shown++
+		return true
+	}
+}
+
+// Commit returns the commit Next advanced to.
+func (w *RevWalker) Commit() CommitInfo {
+	return w.commit
+}
+
+// Err returns the error that stopped the walk, if any.
+func (w *RevWalker) Err() error {
+	return w.err
+}
+
+// Parents returns the parents of commit the walk shows, for drawing a graph.
+func (w *RevWalker) Parents(commit CommitInfo) []string {
+	var parents []string
+	for _, parent := range w.rewrittenParents(commit) {
+		if w.excluded[parent] {
+			continue
+		}
+		if !w.filter.isEmpty() {
+			parentCommit, err := readCommit(w.repoPath, parent)
+			if err != nil || !w.filter.matches(parentCommit) {
+				continue
+			}
+		}
+		parents = append(parents, parent)
+	}
+	return parents
+}
+
+// rewrittenParents skips the parents path limiting hides.
+func (w *RevWalker) rewrittenParents(commit CommitInfo) []string {
+	if w.paths == nil {
+		return walkParents(commit, w.opts)
+	}
+
+	var parents []string
+	for _, parent := range w.paths[commit.Hash].parents {
+		for {
+			state, ok := w.paths[parent]
+			if !ok || !state.treesame {
+				break
+			}
+			if len(state.parents) == 0 {
+				parent = ""
+				break
+			}
+			parent = state.parents[0]
+		}
+		if parent != "" && !slices.Contains(parents, parent) {
+			parents = append(parents, parent)
+		}
+	}
+	return parents
+}
+
+// followedParents gives the edges a topological sort has to respect.
+func (w *RevWalker) followedParents(commit CommitInfo) []string {
+	if w.paths != nil && w.paths[commit.Hash].treesame {
+		return w.paths[commit.Hash].parents
+	}
+	return commit.Parents
+}
+
+// shows reports whether the walk outputs commit; call it in output order.
+func (w *RevWalker) shows(commit CommitInfo) (bool, error) {
+	if w.paths != nil && w.paths[commit.Hash].treesame {
+		return false, nil
+	}
+	if !w.filter.matches(commit) {
+		return false, nil
+	}
+	if w.pickaxe == nil && !w.opts.Follow {
+		return true, nil
+	}
+
+	changes, err := w.diff(commit)
+	if err != nil {
+		return false, err
+	}
+	if w.pickaxe != nil {
+		if changes, err = w.pickaxe.filter(w.repoPath, changes); err != nil {
+			return false, err
+		}
+	}
+	w.changes[commit.Hash] = changes
+	return len(changes) > 0, nil
+}
+
+// diff lists what commit changed in the limiting paths since its first parent.
+func (w *RevWalker) diff(commit CommitInfo) ([]FileChange, error) {
+	if len(commit.Parents) > 1 && !w.opts.FirstParent {
+		return nil, nil
+	}
+	parentTree := ""
+	if len(commit.Parents) > 0 {
+		parent, err := readCommit(w.repoPath, commit.Parents[0])
+		if err != nil {
+			return nil, err
+		}
+		parentTree = parent.Tree
+	}
+
+	paths := w.opts.Paths
+	if w.opts.Follow {
+		paths = []string{w.follow}
+	}
+	changes, err := diffTrees(w.repoPath, parentTree, commit.Tree, paths)
+	if err != nil {
+		return nil, err
+	}
+	if w.opts.Follow && len(changes) == 1 && changes[0].Status == 'A' {
+		all, err := diffTrees(w.repoPath, parentTree, commit.Tree, nil)
+		if err != nil {
+			return nil, err
+		}
+		if all, err = detectRenames(w.repoPath, all); err != nil {
+			return nil, err
+		}
+		for _, change := range all {
+			if change.Status == 'R' && change.Path == changes[0].Path {
+				w.follow = change.OldPath
+				return []FileChange{change}, nil
+			}
+		}
+		return changes, nil
+	}
+	return detectRenames(w.repoPath, changes)
+}
+
+// Changes returns what commit changed since its first parent, as its diff shows it.
+func (w *RevWalker) Changes(commit CommitInfo) ([]FileChange, error) {
+	if changes, ok := w.changes[commit.Hash]; ok {
+		return changes, nil
+	}
+	changes, err := w.diff(commit)
+	if err != nil {
+		return nil, err
+	}
+	w.changes[commit.Hash] = changes
+	return changes, nil
+}
+
+// walkSlop is how far the walk goes on once only excluded commits are left.
+const walkSlop = 5
+
+// push queues a commit, excluded when reached from an excluded one.
+func (w *RevWalker) push(hash string, excluded bool) error {
+	if hash == "" {
+		return nil
+	}
+	if excluded {
+		if err := w.exclude(hash); err != nil {
+			return err
+		}
+	}
+	if w.seen[hash] {
+		return nil
+	}
+	w.seen[hash] = true
+	commit, err := readCommit(w.repoPath, hash)
+	if err != nil {
+		return err
+	}
+	heap.Push(&w.queue, commit)
+	return nil
+}
+
+// exclude marks a commit and the ancestors walked from it excluded.
+func (w *RevWalker) exclude(hash string) error {
+	stack := []string{hash}
+	for len(stack) > 0 {
+		hash := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if w.excluded[hash] {
+			continue
+		}
+		w.excluded[hash] = true
+		if !w.walked[hash] {
+			continue
+		}
+		commit, err := readCommit(w.repoPath, hash)
+		if err != nil {
+			return err
+		}
+		stack = append(stack, commit.Parents...)
+	}
+	return nil
+}
+
+// onlyExcludedQueued reports whether the walk has nothing left to find.
+func (w *RevWalker) onlyExcludedQueued() bool {
+	for _, item := range w.queue.items {
+		if !w.excluded[item.commit.Hash] {
+			return false
+		}
+	}
+	return true
+}
+
+// step pops the newest commit that isn't excluded and queues its parents.
+func (w *RevWalker) step() bool {
+	for {
+		if w.err != nil || w.queue.Len() == 0 {
+			return false
+		}
+		if !w.onlyExcludedQueued() {
+			w.slop = walkSlop
+		} else if w.slop--; w.slop < 0 {
+			return false
+		}
+		w.commit = heap.Pop(&w.queue).(CommitInfo)
+		w.walked[w.commit.Hash] = true
+		if !w.excluded[w.commit.Hash] {
+			break
+		}
+		for _, parent := range w.commit.Parents {
+			if err := w.push(parent, true); err != nil {
+				w.err = err
+				return false
+			}
+		}
+	}
+
+	parents := walkParents(w.commit, w.opts)
+	if !w.opts.Since.IsZero() && committerTime(w.commit) < w.opts.Since.Unix() {
+		// like git, don't look past commits older than --since
+		parents = nil
+	}
+	if w.paths != nil {
+		state, err := w.simplify(w.commit, parents)
+		if err != nil {
+			w.err = err
+			return false
+		}
+		w.paths[w.commit.Hash] = state
+		parents = state.parents
+	}
+	for _, parent := range parents {
+		if err := w.push(parent, false); err != nil {
+			w.err = err
+			return false
+		}
+	}
+	return true
+}
+
+// simplify compares a commit with its parents within the limiting paths, as git does.
+func (w *RevWalker) simplify(commit CommitInfo, parents []string) (pathState, error) {
+	if len(parents) == 0 {
+		changed, err := diffTrees(w.repoPath, "", commit.Tree, w.opts.Paths)
+		return pathState{treesame: len(changed) == 0}, err
+	}
+
+	relevantParents := 0
+	relevantChange, irrelevantChange := false, false
+	for _, parent := range parents {
+		relevant := !w.excluded[parent] || w.bottoms[parent]
+		if relevant {
+			relevantParents++
+		}
+		parentCommit, err := readCommit(w.repoPath, parent)
+		if err != nil {
+			return pathState{}, err
+		}
+		changed, err := diffTrees(w.repoPath, parentCommit.Tree, commit.Tree, w.opts.Paths)
+		if err != nil {
+			return pathState{}, err
+		}
+		switch {
+		case len(changed) == 0 && relevant:
+			return pathState{parents: []string{parent}, treesame: true}, nil
+		case len(changed) == 0:
+		case relevant:
+			relevantChange = true
+		default:
+			irrelevantChange = true
+		}
+	}
+	if relevantParents > 0 {
+		return pathState{parents: parents, treesame: !relevantChange}, nil
+	}
+	return pathState{parents: parents, treesame: !irrelevantChange}, nil
+}
+
+func walkParents(commit CommitInfo, opts WalkOptions) []string {
+	if opts.FirstParent && len(commit.Parents) > 1 {
+		return commit.Parents[:1]
+	}
+	return commit.Parents
+}
+
+// sortTopologically puts every commit before the parents parentsOf gives for it.
+func sortTopologically(commits []CommitInfo, order WalkOrder, parentsOf func(CommitInfo) []string) []CommitInfo {
+	byHash := make(map[string]CommitInfo, len(commits))
+	for _, commit := range commits {
+		byHash[commit.Hash] = commit
+	}
+	children := make(map[string]int, len(commits))
+	for _, commit := range commits {
+		for _, parent := range parentsOf(commit) {
+			if _, ok := byHash[parent]; ok {
+				children[parent]++
+			}
+		}
+	}
+
+	sorted := make([]CommitInfo, 0, len(commits))
+	if order == OrderTopo {
+		// a stack, seeded so that the first tip is popped first
+		var stack []CommitInfo
+		for i := len(commits) - 1; i >= 0; i-- {
+			if children[commits[i].Hash] == 0 {
+				stack = append(stack, commits[i])
+			}
+		}
+		for len(stack) > 0 {
+			commit := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			sorted = append(sorted, commit)
+			for _, parent := range parentsOf(commit) {
+				if _, ok := byHash[parent]; !ok {
+					continue
+				}
+				if children[parent]--; children[parent] == 0 {
+					stack = append(stack, byHash[parent])
+				}
+			}
+		}
+		return sorted
+	}
+
+	queue := commitQueue{key: committerTime}
+	if order == OrderAuthorDate {
+		queue.key = authorTime
+	}
+	for _, commit := range commits {
+		if children[commit.Hash] == 0 {
+			heap.Push(&queue, commit)
+		}
+	}
+	for queue.Len() > 0 {
+		commit := heap.Pop(&queue).(CommitInfo)
+		sorted = append(sorted, commit)
+		for _, parent := range parentsOf(commit) {
+			if _, ok := byHash[parent]; !ok {
+				continue
+			}
+			if children[parent]--; children[parent] == 0 {
+				heap.Push(&queue, byHash[parent])
+			}
+		}
+	}
+	return sorted
+}
+
+func committerTime(commit CommitInfo) int64 {
+	_, _, timestamp, _ := parseAuthorLine(commit.Committer)
+	return timestamp
+}
+
+func authorTime(commit CommitInfo) int64 {
+	return commit.Timestamp
+}
+
+// commitQueue is a heap of commits, newest first, then in the order queued.
+type commitQueue struct {
+	items []queuedCommit
+	key   func(CommitInfo) int64
+	seq   int
+}
+
+type queuedCommit struct {
+	commit CommitInfo
+	date   int64
+	seq    int
+}
+
+func (q commitQueue) Len() int { return len(q.items) }
+
+func (q commitQueue) Less(i, j int) bool {
+	if q.items[i].date != q.items[j].date {
+		return q.items[i].date > q.items[j].date
+	}
+	return q.items[i].seq < q.items[j].seq
+}
+
+func (q commitQueue) Swap(i, j int) { q.items[i], q.items[j] = q.items[j], q.items[i] }
+
+func (q *commitQueue) Push(x any) {
+	commit := x.(CommitInfo)
+	q.items = append(q.items, queuedCommit{commit: commit, date: q.key(commit), seq: q.seq})
+	q.seq++
+}
+
+func (q *commitQueue) Pop() any {
+	last := q.items[len(q.items)-1]
+	q.items = q.items[:len(q.items)-1]
+	return last.commit
+}
@@ -0,0 +1,366 @@
+package core
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// datedCommit writes a commit with the given author and committer times,
+// so tests can set up clock skew between branches.
+func datedCommit(t *testing.T, tree, message string, authorTime, commitTime int64, parents ...string) string {
+	t.Helper()
+
+	author := fmt.Sprintf("Test Author <test@example.com> %d +0000", authorTime)
+	committer := fmt.Sprintf("Test Author <test@example.com> %d +0000", commitTime)
+	hash, err := commitTreeWithSignatures(tree, parents, message, author, committer)
+	if err != nil {
+		t.Fatalf("failed to write commit %s: %v", message, err)
+	}
+	return hash
+}
+
+func walkSubjects(t *testing.T, repo string, args []string, opts WalkOptions) []string {
+	t.Helper()
+
+	walker, err := WalkRevisions(repo, args, opts)
+	if err != nil {
+		t.Fatalf("WalkRevisions failed: %v", err)
+	}
+	var subjects []string
+	for walker.Next() {
+		subjects = append(subjects, walker.Commit().Subject())
+	}
+	if err := walker.Err(); err != nil {
+		t.Fatalf("walk failed: %v", err)
+	}
+	return subjects
+}
+
+func TestRevWalkerOrders(t *testing.T) {
+	repo := setupTestRepo(t)
+	first := commitFile(t, repo, "file.txt", "one\n", "first")
+	firstCommit, _ := readCommit(repo, first)
+	tree := firstCommit.Tree
+
+	root := datedCommit(t, tree, "root", 10, 10)
+	// a1 was committed on a machine whose clock ran far behind, so a plain
+	// date walk reaches base before it
+	base := datedCommit(t, tree, "base", 100, 100, root)
+	a1 := datedCommit(t, tree, "a1", 700, 50, base)
+	a2 := datedCommit(t, tree, "a2", 800, 400, a1)
+	b1 := datedCommit(t, tree, "b1", 200, 300, base)
+	b2 := datedCommit(t, tree, "b2", 300, 500, b1)
+	merge := datedCommit(t, tree, "merge", 900, 600, a2, b2)
+	if err := UpdateRef(repo, "refs/heads/main", merge, "", "merge", false); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		opts WalkOptions
+		want []string
+	}{
+		{"default", WalkOptions{}, []string{"merge", "b2", "a2", "b1", "base", "a1", "root"}},
+		{"date", WalkOptions{Order: OrderDate}, []string{"merge", "b2", "a2", "b1", "a1", "base", "root"}},
+		{"author-date", WalkOptions{Order: OrderAuthorDate}, []string{"merge", "a2", "a1", "b2", "b1", "base", "root"}},
+		{"topo", WalkOptions{Order: OrderTopo}, []string{"merge", "b2", "b1", "a2", "a1", "base", "root"}},
+		{"reverse", WalkOptions{Order: OrderTopo, Reverse: true}, []string{"root", "base", "a1", "a2", "b1", "b2", "merge"}},
+		{"first-parent", WalkOptions{FirstParent: true}, []string{"merge", "a2", "a1", "base", "root"}},
+	}
+	for _, test := range tests {
+		if got := walkSubjects(t, repo, nil, test.opts); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s order: got %v, want %v", test.name, got, test.want)
+		}
+	}
+
+	if got := walkSubjects(t, repo, []string{a2 + ".." + merge}, WalkOptions{}); !reflect.DeepEqual(got, []string{"merge", "b2", "b1"}) {
+		t.Errorf("a range should exclude what its left side reaches, got %v", got)
+	}
+}
+
+func TestRevWalkerLongHistory(t *testing.T) {
+	repo := setupTestRepo(t)
+	root := commitFile(t, repo, "file.txt", "one\n", "root")
+	rootCommit, _ := readCommit(repo, root)
+
+	tip := root
+	for i := 1; i <= 2000; i++ {
+		tip = datedCommit(t, rootCommit.Tree, fmt.Sprintf("commit %d", i), int64(i), int64(i), tip)
+	}
+	if err := UpdateRef(repo, "refs/heads/main", tip, "", "long", false); err != nil {
+		t.Fatal(err)
+	}
+
+	walker, err := WalkRevisions(repo, nil, WalkOptions{})
+	if err != nil {
+		t.Fatalf("WalkRevisions failed: %v", err)
+	}
+	// the default order streams, so stopping early reads only a few commits
+	for i := 0; i < 3 && walker.Next(); i++ {
+	}
+	if len(walker.seen) > 4 {
+		t.Errorf("expected a lazy walk, but %d commits were read", len(walker.seen))
+	}
+
+	// a range stops once only excluded commits are left
+	feature := datedCommit(t, rootCommit.Tree, "feature", 3000, 3000, tip)
+	walker, err = WalkRevisions(repo, []string{"main.." + feature}, WalkOptions{})
+	if err != nil {
+		t.Fatalf("WalkRevisions failed: %v", err)
+	}
+	var subjects []string
+	for walker.Next() {
+		subjects = append(subjects, walker.Commit().Subject())
+	}
+	if !reflect.DeepEqual(subjects, []string{"feature"}) {
+		t.Errorf("expected only the feature commit, got %v", subjects)
+	}
+	if len(walker.excluded) > 10 {
+		t.Errorf("expected the excluded history to be left unwalked, but %d commits were marked", len(walker.excluded))
+	}
+
+	commits, err := Log(repo)
+	if err != nil {
+		t.Fatalf("Log failed: %v", err)
+	}
+	if len(commits) != 2001 || commits[0].Hash != tip || commits[2000].Hash != root {
+		t.Errorf("expected the whole history newest first, got %d commits", len(commits))
+	}
+}
+
+func TestRevWalkerFilters(t *testing.T) {
+	repo := setupTestRepo(t)
+	first := commitFile(t, repo, "file.txt", "one\n", "first")
+	firstCommit, _ := readCommit(repo, first)
+
+	tip := ""
+	for i, c := range []struct{ author, message string }{
+		{"Ann", "add parser"},
+		{"Bob", "fix parser crash"},
+		{"Ann", "Fix typo in README"},
+		{"Bob", "add lexer"},
+		{"Ann", "fix lexer and parser"},
+	} {
+		signature := fmt.Sprintf("%s <%s@example.com> %d +0000", c.author, c.author, 1000000000+i*86400)
+		var parents []string
+		if tip != "" {
+			parents = []string{tip}
+		}
+		hash, err := commitTreeWithSignatures(firstCommit.Tree, parents, c.message, signature, signature)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tip = hash
+	}
+	if err := UpdateRef(repo, "refs/heads/main", tip, "", "filters", false); err != nil {
+		t.Fatal(err)
+	}
+
+	since := time.Unix(1000000000+86400, 0)
+	tests := []struct {
+		name string
+		opts WalkOptions
+		want []string
+	}{
+		{"max count", WalkOptions{MaxCount: 2}, []string{"fix lexer and parser", "add lexer"}},
+		{"skip", WalkOptions{Skip: 3, MaxCount: 1}, []string{"fix parser crash"}},
+		{"reverse after max count", WalkOptions{MaxCount: 2, Reverse: true}, []string{"add lexer", "fix lexer and parser"}},
+		{"author", WalkOptions{Author: []string{"^Bob"}}, []string{"add lexer", "fix parser crash"}},
+		{"grep", WalkOptions{Grep: []string{"^fix"}}, []string{"fix lexer and parser", "fix parser crash"}},
+		{"grep ignoring case", WalkOptions{Grep: []string{"^fix"}, IgnoreCase: true}, []string{"fix lexer and parser", "Fix typo in README", "fix parser crash"}},
+		{"grep any", WalkOptions{Grep: []string{"lexer", "crash"}}, []string{"fix lexer and parser", "add lexer", "fix parser crash"}},
+		{"grep all", WalkOptions{Grep: []string{"fix", "parser"}, AllMatch: true}, []string{"fix lexer and parser", "fix parser crash"}},
+		{"author and grep", WalkOptions{Author: []string{"Ann"}, Grep: []string{"parser"}}, []string{"fix lexer and parser", "add parser"}},
+		{"since", WalkOptions{Since: since}, []string{"fix lexer and parser", "add lexer", "Fix typo in README", "fix parser crash"}},
+		{"until", WalkOptions{Until: since}, []string{"fix parser crash", "add parser"}},
+	}
+	for _, test := range tests {
+		if got := walkSubjects(t, repo, nil, test.opts); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+	}
+
+	if _, err := WalkRevisions(repo, nil, WalkOptions{Grep: []string{"("}}); err == nil {
+		t.Error("expected an error for an invalid pattern")
+	}
+}
+
+func TestRevWalkerPaths(t *testing.T) {
+	repo := setupTestRepo(t)
+	addA := commitFile(t, repo, "a.txt", "1\n", "add a")
+	addB := commitFile(t, repo, "b.txt", "1\n", "add b")
+	changeA := commitFile(t, repo, "a.txt", "2\n", "change a")
+	addC := commitFile(t, repo, "dir/c.txt", "1\n", "add c")
+
+	// side also sets a.txt to 2, but the merge takes its tree from addC, so
+	// following the first parent explains a.txt and side stays hidden
+	changeACommit, _ := readCommit(repo, changeA)
+	addCCommit, _ := readCommit(repo, addC)
+	side := datedCommit(t, changeACommit.Tree, "side", 1000000000, 1000000000, addB)
+	merge := datedCommit(t, addCCommit.Tree, "merge", 1000000100, 1000000100, addC, side)
+	if err := UpdateRef(repo, "refs/heads/main", merge, "", "merge", false); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		args  []string
+		paths []string
+		want  []string
+	}{
+		{nil, []string{"a.txt"}, []string{"change a", "add a"}},
+		{nil, []string{"b.txt"}, []string{"add b"}},
+		{nil, []string{"dir"}, []string{"add c"}},
+		{nil, []string{"./dir/c.txt", "b.txt"}, []string{"add c", "add b"}},
+		{nil, []string{"missing"}, nil},
+		{[]string{addA + ".." + merge}, []string{"a.txt"}, []string{"change a"}},
+		{[]string{side}, []string{"a.txt"}, []string{"side", "add a"}},
+	}
+	for _, test := range tests {
+		got := walkSubjects(t, repo, test.args, WalkOptions{Paths: test.paths})
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%v -- %v: got %v, want %v", test.args, test.paths, got, test.want)
+		}
+	}
+
+	walker, err := WalkRevisions(repo, nil, WalkOptions{Paths: []string{"a.txt"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !walker.Next() || walker.Commit().Hash != changeA {
+		t.Fatalf("expected change a first")
+	}
+	if parents := walker.Parents(walker.Commit()); !reflect.DeepEqual(parents, []string{addA}) {
+		t.Errorf("parents should skip commits that leave the paths alone, got %v", parents)
+	}
+}
+
+func TestRevWalkerPickaxe(t *testing.T) {
+	repo := setupTestRepo(t)
+
+	util := numberedLines("util", 10)
+	root := datedCommit(t, writeTestTree(t, map[string]string{
+		"main.go": "package main\n",
+		"util.go": util,
+	}), "root", 1000000100, 1000000100)
+	addHelper := datedCommit(t, writeTestTree(t, map[string]string{
+		"main.go": "package main\nfunc helper() {}\n",
+		"util.go": util + "more\n",
+	}), "add helper", 1000000200, 1000000200, root)
+	callHelper := datedCommit(t, writeTestTree(t, map[string]string{
+		"main.go": "package main\nfunc helper() {}\nhelper()\n",
+		"util.go": util + "more\n",
+	}), "call helper", 1000000300, 1000000300, addHelper)
+	side := datedCommit(t, writeTestTree(t, map[string]string{
+		"main.go": "package main\nfunc helper() {}\nfunc other() { helper() }\n",
+		"util.go": util + "more\n",
+	}), "side", 1000000350, 1000000350, addHelper)
+	merge := datedCommit(t, writeTestTree(t, map[string]string{
+		"main.go": "package main\nfunc helper() {}\nhelper()\nfunc other() { helper() }\n",
+		"util.go": util + "more\n",
+	}), "merge", 1000000400, 1000000400, callHelper, side)
+	tip := datedCommit(t, writeTestTree(t, map[string]string{
+		"main.go": "package main\nhelper()\nfunc other() { helper() }\n",
+		"util.go": util + "more\n",
+	}), "drop helper", 1000000500, 1000000500, merge)
+	if err := UpdateRef(repo, "refs/heads/main", tip, "", "pickaxe", false); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		opts WalkOptions
+		want []string
+	}{
+		{"string", WalkOptions{PickaxeString: "func helper"}, []string{"drop helper", "add helper"}},
+		{"string ignoring case", WalkOptions{PickaxeString: "FUNC HELPER", IgnoreCase: true}, []string{"drop helper", "add helper"}},
+		{"string counts", WalkOptions{PickaxeString: "helper()"}, []string{"drop helper", "side", "call helper", "add helper"}},
+		{"first parent", WalkOptions{PickaxeString: "helper()", FirstParent: true}, []string{"drop helper", "merge", "call helper", "add helper"}},
+		{"regex", WalkOptions{PickaxeRegex: "^helper"}, []string{"call helper"}},
+		{"regex on removed lines", WalkOptions{PickaxeRegex: "^func helper"}, []string{"drop helper", "add helper"}},
+		{"paths", WalkOptions{PickaxeRegex: "more", Paths: []string{"main.go"}}, nil},
+	}
+	for _, test := range tests {
+		if got := walkSubjects(t, repo, nil, test.opts); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+	}
+
+	changedFiles := func(opts WalkOptions) []string {
+		walker, err := WalkRevisions(repo, []string{addHelper}, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var files []string
+		if walker.Next() {
+			changes, err := walker.Changes(walker.Commit())
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, change := range changes {
+				files = append(files, change.Path)
+			}
+		}
+		return files
+	}
+	if got := changedFiles(WalkOptions{PickaxeString: "helper"}); !reflect.DeepEqual(got, []string{"main.go"}) {
+		t.Errorf("expected only the matching file, got %v", got)
+	}
+	if got := changedFiles(WalkOptions{PickaxeString: "helper", PickaxeAll: true}); !reflect.DeepEqual(got, []string{"main.go", "util.go"}) {
+		t.Errorf("expected every changed file with PickaxeAll, got %v", got)
+	}
+
+	if _, err := WalkRevisions(repo, nil, WalkOptions{PickaxeString: "a", PickaxeRegex: "b"}); err == nil {
+		t.Error("expected an error for -S together with -G")
+	}
+}
+
+func TestRevWalkerFollow(t *testing.T) {
+	repo := setupTestRepo(t)
+
+	util := numberedLines("util", 10)
+	root := datedCommit(t, writeTestTree(t, map[string]string{
+		"util.go": util,
+	}), "root", 1000000100, 1000000100)
+	edit := datedCommit(t, writeTestTree(t, map[string]string{
+		"util.go": util + "edit\n",
+	}), "edit", 1000000200, 1000000200, root)
+	move := datedCommit(t, writeTestTree(t, map[string]string{
+		"lib/util.go": util + "edit\nmoved\n",
+		"readme":      "hi\n",
+	}), "move", 1000000300, 1000000300, edit)
+	tip := datedCommit(t, writeTestTree(t, map[string]string{
+		"lib/util.go": util + "edit\nmoved\nagain\n",
+		"readme":      "hi\n",
+	}), "edit again", 1000000400, 1000000400, move)
+	if err := UpdateRef(repo, "refs/heads/main", tip, "", "follow", false); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := walkSubjects(t, repo, nil, WalkOptions{Paths: []string{"lib/util.go"}}); !reflect.DeepEqual(got, []string{"edit again", "move"}) {
+		t.Errorf("without --follow: got %v", got)
+	}
+	if got := walkSubjects(t, repo, nil, WalkOptions{Paths: []string{"lib/util.go"}, Follow: true}); !reflect.DeepEqual(got, []string{"edit again", "move", "edit", "root"}) {
+		t.Errorf("with --follow: got %v", got)
+	}
+
+	walker, err := WalkRevisions(repo, []string{move}, WalkOptions{Paths: []string{"lib/util.go"}, Follow: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !walker.Next() {
+		t.Fatal("expected the rename")
+	}
+	changes, err := walker.Changes(walker.Commit())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 1 || changes[0].Status != 'R' || changes[0].OldPath != "util.go" || changes[0].Path != "lib/util.go" {
+		t.Errorf("expected the rename from util.go, got %+v", changes)
+	}
+
+	if _, err := WalkRevisions(repo, nil, WalkOptions{Paths: []string{"a", "b"}, Follow: true}); err == nil {
+		t.Error("expected an error following two paths")
+	}
+}
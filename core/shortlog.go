@@ -0,0 +1,81 @@
+package core
+
+import (
+	"fmt"
+	"io"
+	"sort"
+)
+
+type ShortlogOptions struct {
+	// Summary prints only the number of commits of each author.
+	Summary bool
+	// Numbered sorts authors by their number of commits, most first,
+	// rather than by name.
+	Numbered bool
+	// Email groups and shows authors as "Name <email>".
+	Email bool
+}
+
+type shortlogGroup struct {
+	author   string
+	subjects []string
+}
+
+// Shortlog summarizes the commits of a walk by author, as git shortlog
+// does: each author with their number of commits, followed unless
+// opts.Summary is set by the subjects of those commits, oldest first.
+// Authors are mapped through .mailmap before being grouped.
+func Shortlog(repoPath string, out io.Writer, walker *RevWalker, opts ShortlogOptions) error {
+	m, err := loadMailmap(repoPath)
+	if err != nil {
+		return err
+	}
+
+	byAuthor := make(map[string]*shortlogGroup)
+	var groups []*shortlogGroup
+	for walker.Next() {
+		commit := walker.Commit()
+		name, email := m.lookup(commit.Author, commit.Email)
+		author := name
+		if opts.Email {
+			author = fmt.Sprintf("%s <%s>", name, email)
+		}
+		group := byAuthor[author]
+		if group == nil {
+			group = &shortlogGroup{author: author}
+			byAuthor[author] = group
+			groups = append(groups, group)
+		}
+		group.subjects = append(group.subjects, commit.Subject())
+	}
+	if err := walker.Err(); err != nil {
+		return err
+	}
+
+	sort.Slice(groups, func(i, j int) bool {
+		if opts.Numbered && len(groups[i].subjects) != len(groups[j].subjects) {
+			return len(groups[i].subjects) > len(groups[j].subjects)
+		}
+		return groups[i].author < groups[j].author
+	})
+	for _, group := range groups {
+		if opts.Summary {
+			if _, err := fmt.Fprintf(out, "%6d\t%s\n", len(group.subjects), group.author); err != nil {
+				return err
+			}
+			continue
+		}
+		if _, err := fmt.Fprintf(out, "%s (%d):\n", group.author, len(group.subjects)); err != nil {
+			return err
+		}
+		for i := len(group.subjects) - 1; i >= 0; i-- {
+			if _, err := fmt.Fprintf(out, "      %s\n", group.subjects[i]); err != nil {
+				return err
+			}
+		}
+		if _, err := fmt.Fprintln(out); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package core
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"testing"
+)
+
+func TestShortlog(t *testing.T) {
+	repo := setupTestRepo(t)
+	first := commitFile(t, repo, "file.txt", "one\n", "first")
+	firstCommit, _ := readCommit(repo, first)
+
+	tip := first
+	for i, c := range []struct{ name, email, message string }{
+		{"Ann", "ann@example.com", "add parser"},
+		{"Bob", "bob@old.example.com", "fix parser crash"},
+		{"bob", "BOB@example.com", "add lexer"},
+		{"Ann", "ann@example.com", "fix lexer"},
+	} {
+		signature := fmt.Sprintf("%s <%s> %d +0000", c.name, c.email, 1000000000+i)
+		hash, err := commitTreeWithSignatures(firstCommit.Tree, []string{tip}, c.message, signature, signature)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tip = hash
+	}
+	if err := UpdateRef(repo, "refs/heads/main", tip, "", "shortlog", false); err != nil {
+		t.Fatal(err)
+	}
+
+	shortlog := func(opts ShortlogOptions) string {
+		t.Helper()
+		walker, err := WalkRevisions(repo, []string{first + ".."}, WalkOptions{})
+		if err != nil {
+			t.Fatalf("WalkRevisions failed: %v", err)
+		}
+		var out bytes.Buffer
+		if err := Shortlog(repo, &out, walker, opts); err != nil {
+			t.Fatalf("Shortlog failed: %v", err)
+		}
+		return out.String()
+	}
+
+	want := "Ann (2):\n      add parser\n      fix lexer\n\nBob (1):\n      fix parser crash\n\nbob (1):\n      add lexer\n\n"
+	if got := shortlog(ShortlogOptions{}); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+
+	mailmap := "# Bob changed jobs\nBob Smith <bob@example.com> <BOB@example.com>\nBob Smith <bob@example.com> Bob <bob@old.example.com>\n"
+	if err := os.WriteFile(MailmapFile, []byte(mailmap), 0644); err != nil {
+		t.Fatal(err)
+	}
+	want = "     2\tAnn <ann@example.com>\n     2\tBob Smith <bob@example.com>\n"
+	if got := shortlog(ShortlogOptions{Summary: true, Email: true}); got != want {
+		t.Errorf("with a mailmap, got\n%s\nwant\n%s", got, want)
+	}
+}
@@ -0,0 +1,105 @@
+package core
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+type ShowRefOptions struct {
+	// Heads and Tags limit the output to branches and/or tags.
+	Heads bool
+	Tags  bool
+	// Head includes HEAD, which is otherwise left out.
+	Head bool
+	// Dereference adds a "<ref>^{}" line with the peeled object of every
+	// annotated tag.
+	Dereference bool
+	// HashOnly prints just the object names, abbreviated to Abbrev digits
+	// when it is set.
+	HashOnly bool
+	Abbrev   int
+	// Verify requires every pattern to be an exact ref name, and fails on
+	// the first one that doesn't exist.
+	Verify bool
+}
+
+// ShowRef lists refs matching any of patterns as "<hash> <ref>" lines and
+// returns how many matched. Without Verify, a pattern matches a ref whose
+// name ends with it on a slash boundary, so "main" matches both
+// refs/heads/main and refs/remotes/origin/main.
+func ShowRef(repoPath string, patterns []string, opts ShowRefOptions, out io.Writer) (int, error) {
+	var matched []Ref
+	if opts.Verify {
+		for _, pattern := range patterns {
+			if pattern != "HEAD" && !strings.HasPrefix(pattern, "refs/") {
+				return len(matched), fmt.Errorf("'%s' - not a valid ref", pattern)
+			}
+			hash, ok, err := readRef(repoPath, pattern)
+			if err != nil {
+				return len(matched), err
+			}
+			if !ok {
+				return len(matched), fmt.Errorf("'%s' - not a valid ref", pattern)
+			}
+			matched = append(matched, Ref{Name: pattern, Hash: hash})
+		}
+	} else {
+		refs, err := ListRefs(repoPath)
+		if err != nil {
+			return 0, err
+		}
+		if opts.Head {
+			if hash, ok, err := readRef(repoPath, "HEAD"); err == nil && ok {
+				refs = append([]Ref{{Name: "HEAD", Hash: hash}}, refs...)
+			}
+		}
+		for _, ref := range refs {
+			if showRefSelected(ref.Name, patterns, opts) {
+				matched = append(matched, ref)
+			}
+		}
+	}
+
+	for _, ref := range matched {
+		writeShowRefLine(out, ref.Hash, ref.Name, opts)
+		if !opts.Dereference {
+			continue
+		}
+		if peeled, err := peelObject(repoPath, ref.Hash, "", ref.Name); err == nil && peeled != ref.Hash {
+			writeShowRefLine(out, peeled, ref.Name+"^{}", opts)
+		}
+	}
+	return len(matched), nil
+}
+
+func showRefSelected(name string, patterns []string, opts ShowRefOptions) bool {
+	if name == "HEAD" {
+		return true
+	}
+	if opts.Heads || opts.Tags {
+		if !(opts.Heads && strings.HasPrefix(name, "refs/heads/")) && !(opts.Tags && strings.HasPrefix(name, "refs/tags/")) {
+			return false
+		}
+	}
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		if name == pattern || strings.HasSuffix(name, "/"+pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+func writeShowRefLine(out io.Writer, hash, name string, opts ShowRefOptions) {
+	if opts.Abbrev > 0 && opts.Abbrev < len(hash) {
+		hash = hash[:max(opts.Abbrev, 4)]
+	}
+	if opts.HashOnly {
+		fmt.Fprintln(out, hash)
+		return
+	}
+	fmt.Fprintf(out, "%s %s\n", hash, name)
+}
@@ -0,0 +1,123 @@
+package core
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+type ShowOptions struct {
+	// Pretty is how commits, and the taggers of tags, are shown.
+	Pretty PrettyOptions
+	// Diff is what is shown of the changes a commit makes: against its
+	// parent, or for a merge against all of its parents at once.
+	Diff DiffFormat
+}
+
+// Show writes each named object the way git show does: a commit with its
+// diff, an annotated tag with its message followed by the object it tags,
+// the entries of a tree, or the content of a blob.
+func Show(repoPath string, out io.Writer, names []string, opts ShowOptions) error {
+	formatter, err := NewCommitFormatter(repoPath, opts.Pretty)
+	if err != nil {
+		return err
+	}
+	w := NewLogWriter(out, formatter, nil)
+	for _, name := range names {
+		hash, err := resolveObjectName(repoPath, name)
+		if err != nil {
+			return err
+		}
+		if err := showObject(repoPath, w, name, hash, opts.Diff); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// showObject writes one object, and for a tag the objects it leads to.
+func showObject(repoPath string, w *LogWriter, name, hash string, format DiffFormat) error {
+	objectType, content, err := readObjectWithType(repoPath, hash)
+	if err != nil {
+		return err
+	}
+
+	switch objectType {
+	case "blob":
+		_, err := w.out.Write(content)
+		return err
+
+	case "tag":
+		tag, err := readTag(repoPath, hash)
+		if err != nil {
+			return err
+		}
+		tagger, err := w.formatter.formatTagger(tag.Tagger)
+		if err != nil {
+			return err
+		}
+		if w.shown {
+			io.WriteString(w.out, "\n")
+		}
+		w.shown = true
+		fmt.Fprintf(w.out, "tag %s\n%s", tag.Tag, tagger)
+		// the message goes out as it is stored, from the empty line
+		// that ends the header
+		if end := bytes.Index(content, []byte("\n\n")); end >= 0 {
+			w.out.Write(content[end+1:])
+		}
+		return showObject(repoPath, w, name, tag.Object, format)
+
+	case "tree":
+		entries, err := readTreeEntries(repoPath, hash)
+		if err != nil {
+			return err
+		}
+		if w.shown {
+			io.WriteString(w.out, "\n")
+		}
+		w.shown = true
+		fmt.Fprintf(w.out, "tree %s\n\n", name)
+		for _, entry := range entries {
+			if isTreeMode(entry.Mode) {
+				fmt.Fprintf(w.out, "%s/\n", entry.Name)
+			} else {
+				fmt.Fprintf(w.out, "%s\n", entry.Name)
+			}
+		}
+		return nil
+
+	case "commit":
+		commit, err := readCommit(repoPath, hash)
+		if err != nil {
+			return err
+		}
+		if format.IsZero() {
+			return w.Write(commit, commit.Parents)
+		}
+		if len(commit.Parents) > 1 {
+			return w.WriteWithCombinedDiff(commit, commit.Parents, format, func(width int) (string, error) {
+				return FormatCombinedDiff(repoPath, commit, format, width)
+			})
+		}
+		return w.WriteWithDiff(commit, commit.Parents, format, func(width int) (string, error) {
+			parentTree := ""
+			if len(commit.Parents) > 0 {
+				parent, err := readCommit(repoPath, commit.Parents[0])
+				if err != nil {
+					return "", err
+				}
+				parentTree = parent.Tree
+			}
+			changes, err := diffTrees(repoPath, parentTree, commit.Tree, nil)
+			if err != nil {
+				return "", err
+			}
+			if changes, err = detectRenames(repoPath, changes); err != nil {
+				return "", err
+			}
+			return FormatDiff(repoPath, changes, format, width)
+		})
+	}
+	return fmt.Errorf("unknown type: %s", objectType)
+}
@@ -0,0 +1,60 @@
+package core
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestShow(t *testing.T) {
+	repo := setupTestRepo(t)
+
+	tree := writeTestTree(t, map[string]string{
+		"README":      "hello\n",
+		"cmd/main.go": "package main\n",
+	})
+	root := datedCommit(t, tree, "add readme", 1000000000, 1000000000)
+	if err := UpdateRef(repo, "refs/heads/main", root, "", "show", false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CreateTag(repo, "v1", root, TagOptions{Message: "release one", Name: "Tagger", Email: "tagger@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+
+	show := func(names []string, opts ShowOptions) string {
+		t.Helper()
+		var out bytes.Buffer
+		if err := Show(repo, &out, names, opts); err != nil {
+			t.Fatalf("show %v: %v", names, err)
+		}
+		return out.String()
+	}
+
+	got := show([]string{"v1"}, ShowOptions{Pretty: PrettyOptions{Format: "short"}, Diff: DiffFormat{Stat: true}})
+	want := "tag v1\n" +
+		"Tagger: Tagger <tagger@example.com>\n" +
+		"\n" +
+		"release one\n" +
+		"\n" +
+		"commit " + root + "\n" +
+		"Author: Test Author <test@example.com>\n" +
+		"\n" +
+		"    add readme\n" +
+		"\n" +
+		" README      | 1 +\n" +
+		" cmd/main.go | 1 +\n" +
+		" 2 files changed, 2 insertions(+)\n"
+	if got != want {
+		t.Errorf("unexpected tag output:\n%s\nwant:\n%s", got, want)
+	}
+
+	got = show([]string{"main:README", "main^{tree}"}, ShowOptions{})
+	if want := "hello\ntree main^{tree}\n\nREADME\ncmd/\n"; got != want {
+		t.Errorf("expected the blob, then the tree's entries, got %q", got)
+	}
+
+	got = show([]string{"main"}, ShowOptions{Pretty: PrettyOptions{Format: "oneline"}, Diff: DiffFormat{Patch: true}})
+	if !strings.HasPrefix(got, root+" add readme\ndiff --git a/README b/README\nnew file mode 100644\n") {
+		t.Errorf("expected the root commit's patch against the empty tree, got:\n%s", got)
+	}
+}
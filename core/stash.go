@@ -0,0 +1,472 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const stashRef = "refs/stash"
+
+type StashOptions struct {
+	Message          string
+	IncludeUntracked bool
+	KeepIndex        bool
+	Paths            []string
+	Name             string
+	Email            string
+}
+
+type StashEntry struct {
+	Index   int
+	Hash    string
+	Message string
+}
+
+var stashSelector = regexp.MustCompile(`^(?:stash@\{(\d+)\}|(\d+))$`)
+
+// StashPush saves the local modifications as a WIP commit under refs/stash
+// and reverts them from the index and working tree. The stash commit's
+// parents are HEAD, a commit holding the index state and, with
+// IncludeUntracked, a commit holding the untracked files.
+func StashPush(repoPath string, opts StashOptions) (string, error) {
+	head, err := resolveHead(repoPath)
+	if err != nil {
+		return "", err
+	}
+	if head == "" {
+		return "", fmt.Errorf("you do not have the initial commit yet")
+	}
+
+	headCommit, err := readCommit(repoPath, head)
+	if err != nil {
+		return "", err
+	}
+	headTree, err := getCommitTree(repoPath, head)
+	if err != nil {
+		return "", err
+	}
+	index, err := readIndexMap(repoPath)
+	if err != nil {
+		return "", err
+	}
+
+	matches := func(path string) bool {
+		return len(opts.Paths) == 0 || matchesPathspec(path, opts.Paths)
+	}
+
+	indexTree := copyTree(headTree)
+	worktreeTree := copyTree(headTree)
+	for _, tracked := range []map[string]string{headTree, index} {
+		for path := range tracked {
+			if !matches(path) {
+				continue
+			}
+
+			if hash, ok := index[path]; ok {
+				indexTree[path] = hash
+			} else {
+				delete(indexTree, path)
+			}
+
+			content, err := os.ReadFile(filepath.Join(repoPath, path))
+			if os.IsNotExist(err) {
+				delete(worktreeTree, path)
+				continue
+			}
+			if err != nil {
+				return "", fmt.Errorf("failed to read %s: %w", path, err)
+			}
+			hash, err := HashObject(content, "blob", true)
+			if err != nil {
+				return "", err
+			}
+			worktreeTree[path] = hash
+		}
+	}
+
+	untracked := map[string]string{}
+	if opts.IncludeUntracked {
+		statuses, err := Status(repoPath)
+		if err != nil {
+			return "", err
+		}
+		for _, s := range statuses {
+			if s.Status != Untracked || !matches(s.Path) {
+				continue
+			}
+			content, err := os.ReadFile(filepath.Join(repoPath, s.Path))
+			if err != nil {
+				return "", fmt.Errorf("failed to read %s: %w", s.Path, err)
+			}
+			hash, err := HashObject(content, "blob", true)
+			if err != nil {
+				return "", err
+			}
+			untracked[s.Path] = hash
+		}
+	}
+
+	if treesEqual(indexTree, headTree) && treesEqual(worktreeTree, headTree) && len(untracked) == 0 {
+		return "No local changes to save", nil
+	}
+
+	branch, err := GetCurrentBranch(repoPath)
+	if err != nil {
+		branch = "(no branch)"
+	}
+	describe := fmt.Sprintf("%s: %s %s", branch, shortHash(head), headCommit.Subject())
+	signature := formatSignature(opts.Name, opts.Email, time.Now())
+
+	indexTreeHash, err := writeTreeFromMap(indexTree)
+	if err != nil {
+		return "", err
+	}
+	indexCommit, err := commitTreeWithSignatures(indexTreeHash, []string{head}, "index on "+describe, signature, signature)
+	if err != nil {
+		return "", err
+	}
+	parents := []string{head, indexCommit}
+
+	if len(untracked) > 0 {
+		untrackedTreeHash, err := writeTreeFromMap(untracked)
+		if err != nil {
+			return "", err
+		}
+		untrackedCommit, err := commitTreeWithSignatures(untrackedTreeHash, nil, "untracked files on "+describe, signature, signature)
+		if err != nil {
+			return "", err
+		}
+		parents = append(parents, untrackedCommit)
+	}
+
+	message := "WIP on " + describe
+	if opts.Message != "" {
+		message = fmt.Sprintf("On %s: %s", branch, opts.Message)
+	}
+
+	worktreeTreeHash, err := writeTreeFromMap(worktreeTree)
+	if err != nil {
+		return "", err
+	}
+	stashCommit, err := commitTreeWithSignatures(worktreeTreeHash, parents, message, signature, signature)
+	if err != nil {
+		return "", err
+	}
+
+	if err := updateStashRef(repoPath, stashCommit, message, opts); err != nil {
+		return "", err
+	}
+
+	// put the stashed paths back to their HEAD (or, with --keep-index,
+	// their staged) state
+	newIndex := copyTree(index)
+	target := copyTree(worktreeTree)
+	for _, tracked := range []map[string]string{headTree, index, worktreeTree} {
+		for path := range tracked {
+			if !matches(path) {
+				continue
+			}
+			source := headTree
+			if opts.KeepIndex {
+				source = indexTree
+			} else if hash, ok := headTree[path]; ok {
+				newIndex[path] = hash
+			} else {
+				delete(newIndex, path)
+			}
+
+			if hash, ok := source[path]; ok {
+				target[path] = hash
+			} else {
+				delete(target, path)
+			}
+		}
+	}
+
+	if err := updateWorkingTree(repoPath, worktreeTree, target); err != nil {
+		return "", err
+	}
+	if err := updateIndexToTree(repoPath, newIndex); err != nil {
+		return "", err
+	}
+	for path := range untracked {
+		if err := removeWorktreeFile(repoPath, path); err != nil {
+			return "", err
+		}
+	}
+
+	return "Saved working directory and index state " + message, nil
+}
+
+func updateStashRef(repoPath, stashCommit, message string, opts StashOptions) error {
+	old, exists, err := readRef(repoPath, stashRef)
+	if err != nil {
+		return err
+	}
+	expected := old
+	if !exists {
+		expected = zeroHash
+	}
+	if err := moveStashRef(repoPath, expected, stashCommit); err != nil {
+		return err
+	}
+
+	identity := fmt.Sprintf("%s <%s>", opts.Name, opts.Email)
+	return appendReflog(repoPath, stashRef, old, stashCommit, identity, message)
+}
+
+// StashList returns the stash entries, most recent first.
+func StashList(repoPath string) ([]StashEntry, error) {
+	entries, err := readReflog(repoPath, stashRef)
+	if err != nil {
+		return nil, err
+	}
+
+	stashes := make([]StashEntry, 0, len(entries))
+	for i := len(entries) - 1; i >= 0; i-- {
+		stashes = append(stashes, StashEntry{
+			Index:   len(stashes),
+			Hash:    entries[i].NewHash,
+			Message: entries[i].Message,
+		})
+	}
+	return stashes, nil
+}
+
+func resolveStash(repoPath, selector string) (StashEntry, error) {
+	stashes, err := StashList(repoPath)
+	if err != nil {
+		return StashEntry{}, err
+	}
+	if len(stashes) == 0 {
+		return StashEntry{}, fmt.Errorf("no stash entries found")
+	}
+	if selector == "" {
+		return stashes[0], nil
+	}
+
+	m := stashSelector.FindStringSubmatch(selector)
+	if m == nil {
+		return StashEntry{}, fmt.Errorf("'%s' is not a stash reference", selector)
+	}
+	n, _ := strconv.Atoi(m[1] + m[2])
+	if n >= len(stashes) {
+		return StashEntry{}, fmt.Errorf("stash@{%d} does not exist", n)
+	}
+	return stashes[n], nil
+}
+
+// StashApply merges a stash entry into the working tree. Conflicting paths
+// get conflict markers just like a merge. With restoreIndex the staged part
+// of the stash is re-applied to the index as well.
+func StashApply(repoPath, selector string, restoreIndex bool) (StashEntry, error) {
+	entry, err := resolveStash(repoPath, selector)
+	if err != nil {
+		return StashEntry{}, err
+	}
+
+	stash, err := readCommit(repoPath, entry.Hash)
+	if err != nil {
+		return StashEntry{}, err
+	}
+	if len(stash.Parents) < 2 {
+		return StashEntry{}, fmt.Errorf("%s is not a valid stash commit", shortHash(entry.Hash))
+	}
+
+	baseTree, err := getCommitTree(repoPath, stash.Parents[0])
+	if err != nil {
+		return StashEntry{}, err
+	}
+	stashIndexTree, err := getCommitTree(repoPath, stash.Parents[1])
+	if err != nil {
+		return StashEntry{}, err
+	}
+	stashTree, err := getCommitTree(repoPath, stash.Hash)
+	if err != nil {
+		return StashEntry{}, err
+	}
+	untracked := map[string]string{}
+	if len(stash.Parents) > 2 {
+		if untracked, err = getCommitTree(repoPath, stash.Parents[2]); err != nil {
+			return StashEntry{}, err
+		}
+	}
+
+	index, err := readIndexMap(repoPath)
+	if err != nil {
+		return StashEntry{}, err
+	}
+
+	var newIndex map[string]string
+	if restoreIndex {
+		indexResult, err := mergeTrees(repoPath, baseTree, index, stashIndexTree, "Updated upstream", "Stashed changes")
+		if err != nil {
+			return StashEntry{}, err
+		}
+		if len(indexResult.Conflicts) > 0 {
+			return StashEntry{}, fmt.Errorf("conflicts in index; try without --index")
+		}
+		newIndex = indexResult.Tree
+	}
+
+	result, err := mergeTrees(repoPath, baseTree, index, stashTree, "Updated upstream", "Stashed changes")
+	if err != nil {
+		return StashEntry{}, err
+	}
+	if err := checkWorktreeClobber(repoPath, index, index, result.Tree); err != nil {
+		return StashEntry{}, err
+	}
+
+	for path := range untracked {
+		if _, err := os.Stat(filepath.Join(repoPath, path)); err == nil {
+			return StashEntry{}, fmt.Errorf("%s already exists, no checkout", path)
+		}
+	}
+
+	if err := updateWorkingTree(repoPath, index, result.Tree); err != nil {
+		return StashEntry{}, err
+	}
+	for path, hash := range untracked {
+		if err := restoreFile(repoPath, path, hash); err != nil {
+			return StashEntry{}, err
+		}
+	}
+
+	if newIndex == nil {
+		// keep the current index, but stage files the stash added so they
+		// don't come back as untracked
+		newIndex = copyTree(index)
+		for path, hash := range result.Tree {
+			_, inBase := baseTree[path]
+			_, inIndex := index[path]
+			if !inBase && !inIndex {
+				newIndex[path] = hash
+			}
+		}
+	}
+	for _, path := range result.Conflicts {
+		if hash, ok := index[path]; ok {
+			newIndex[path] = hash
+		} else {
+			delete(newIndex, path)
+		}
+	}
+	if err := updateIndexToTree(repoPath, newIndex); err != nil {
+		return StashEntry{}, err
+	}
+
+	if len(result.Conflicts) > 0 {
+		return entry, fmt.Errorf("CONFLICT applying stash in:\n\t%s\nThe stash entry is kept in case you need it again.",
+			strings.Join(result.Conflicts, "\n\t"))
+	}
+	return entry, nil
+}
+
+// StashPop applies a stash entry and drops it if it applied cleanly.
+func StashPop(repoPath, selector string, restoreIndex bool) (StashEntry, error) {
+	entry, err := StashApply(repoPath, selector, restoreIndex)
+	if err != nil {
+		return entry, err
+	}
+	if _, err := StashDrop(repoPath, fmt.Sprintf("stash@{%d}", entry.Index)); err != nil {
+		return entry, err
+	}
+	return entry, nil
+}
+
+// StashDrop removes a single stash entry from the stash reflog, moving
+// refs/stash to the next entry or deleting it once the list is empty.
+func StashDrop(repoPath, selector string) (StashEntry, error) {
+	entry, err := resolveStash(repoPath, selector)
+	if err != nil {
+		return StashEntry{}, err
+	}
+
+	entries, err := readReflog(repoPath, stashRef)
+	if err != nil {
+		return StashEntry{}, err
+	}
+	pos := len(entries) - 1 - entry.Index
+	entries = append(entries[:pos], entries[pos+1:]...)
+
+	if len(entries) == 0 {
+		// deleting the ref removes its reflog as well
+		if err := deleteRef(repoPath, stashRef); err != nil {
+			return StashEntry{}, err
+		}
+		return entry, nil
+	}
+
+	if err := writeReflog(repoPath, stashRef, entries); err != nil {
+		return StashEntry{}, err
+	}
+	if err := moveStashRef(repoPath, "", entries[len(entries)-1].NewHash); err != nil {
+		return StashEntry{}, err
+	}
+	return entry, nil
+}
+
+// moveStashRef points refs/stash at hash, checking oldHash like
+// RefTransaction.Update does. The stash reflog is the list of entries and
+// is maintained by the callers, so the move isn't logged.
+func moveStashRef(repoPath, oldHash, hash string) error {
+	tx := BeginRefTransaction(repoPath)
+	if err := tx.queue(&refUpdate{ref: stashRef, newHash: hash, oldHash: oldHash, noLog: true}); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to update %s: %w", stashRef, err)
+	}
+	return nil
+}
+
+// StashShow returns the changes recorded in a stash entry relative to the
+// commit it was created on.
+func StashShow(repoPath, selector string) ([]FileDiffStat, error) {
+	entry, err := resolveStash(repoPath, selector)
+	if err != nil {
+		return nil, err
+	}
+	stash, err := readCommit(repoPath, entry.Hash)
+	if err != nil {
+		return nil, err
+	}
+	if len(stash.Parents) == 0 {
+		return nil, fmt.Errorf("%s is not a valid stash commit", shortHash(entry.Hash))
+	}
+
+	baseTree, err := getCommitTree(repoPath, stash.Parents[0])
+	if err != nil {
+		return nil, err
+	}
+	stashTree, err := getCommitTree(repoPath, stash.Hash)
+	if err != nil {
+		return nil, err
+	}
+	return diffTreeStats(repoPath, baseTree, stashTree)
+}
+
+func copyTree(tree map[string]string) map[string]string {
+	copied := make(map[string]string, len(tree))
+	for path, hash := range tree {
+		copied[path] = hash
+	}
+	return copied
+}
+
+func treesEqual(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for path, hash := range a {
+		if other, ok := b[path]; !ok || other != hash {
+			return false
+		}
+	}
+	return true
+}
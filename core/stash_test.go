@@ -0,0 +1,157 @@
+package core
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func testStashOptions() StashOptions {
+	return StashOptions{Name: "Test Author", Email: "author@example.com"}
+}
+
+func TestStashPushAndPop(t *testing.T) {
+	repo := setupTestRepo(t)
+	commitFile(t, repo, "file.txt", "one\n", "base")
+
+	if err := os.WriteFile("file.txt", []byte("one\ntwo\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile("new.txt", []byte("new\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := testStashOptions()
+	opts.IncludeUntracked = true
+	msg, err := StashPush(repo, opts)
+	if err != nil {
+		t.Fatalf("StashPush failed: %v", err)
+	}
+	if !strings.Contains(msg, "WIP on main") {
+		t.Errorf("unexpected push message %q", msg)
+	}
+
+	if got := readTestFile(t, repo, "file.txt"); got != "one\n" {
+		t.Errorf("worktree should be reset to HEAD, got %q", got)
+	}
+	if _, err := os.Stat("new.txt"); !os.IsNotExist(err) {
+		t.Error("untracked file should have been stashed away")
+	}
+
+	entries, err := StashList(repo)
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("expected one stash entry, got %v (%v)", entries, err)
+	}
+
+	stats, err := StashShow(repo, "")
+	if err != nil {
+		t.Fatalf("StashShow failed: %v", err)
+	}
+	if len(stats) != 1 || stats[0].Path != "file.txt" || stats[0].Added != 1 {
+		t.Errorf("unexpected stash stats %+v", stats)
+	}
+
+	if _, err := StashPop(repo, "stash@{0}", false); err != nil {
+		t.Fatalf("StashPop failed: %v", err)
+	}
+	if got := readTestFile(t, repo, "file.txt"); got != "one\ntwo\n" {
+		t.Errorf("stashed change not restored, got %q", got)
+	}
+	if got := readTestFile(t, repo, "new.txt"); got != "new\n" {
+		t.Errorf("untracked file not restored, got %q", got)
+	}
+	if entries, _ := StashList(repo); len(entries) != 0 {
+		t.Errorf("pop should drop the entry, got %v", entries)
+	}
+}
+
+func TestStashNoChanges(t *testing.T) {
+	repo := setupTestRepo(t)
+	commitFile(t, repo, "file.txt", "one\n", "base")
+
+	msg, err := StashPush(repo, testStashOptions())
+	if err != nil {
+		t.Fatalf("StashPush failed: %v", err)
+	}
+	if msg != "No local changes to save" {
+		t.Errorf("unexpected message %q", msg)
+	}
+	if entries, _ := StashList(repo); len(entries) != 0 {
+		t.Errorf("no entry should be created, got %v", entries)
+	}
+}
+
+func TestStashApplyConflictKeepsEntry(t *testing.T) {
+	repo := setupTestRepo(t)
+	commitFile(t, repo, "file.txt", "one\n", "base")
+
+	if err := os.WriteFile("file.txt", []byte("stashed\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := StashPush(repo, testStashOptions()); err != nil {
+		t.Fatalf("StashPush failed: %v", err)
+	}
+	commitFile(t, repo, "file.txt", "committed\n", "change file")
+
+	if _, err := StashPop(repo, "", false); err == nil {
+		t.Fatal("expected a conflict")
+	}
+	if got := readTestFile(t, repo, "file.txt"); !strings.Contains(got, "<<<<<<< Updated upstream") {
+		t.Errorf("expected conflict markers, got %q", got)
+	}
+	if entries, _ := StashList(repo); len(entries) != 1 {
+		t.Errorf("conflicting pop must keep the entry, got %v", entries)
+	}
+}
+
+func TestStashDropAndKeepIndex(t *testing.T) {
+	repo := setupTestRepo(t)
+	commitFile(t, repo, "file.txt", "one\n", "base")
+
+	if err := os.WriteFile("file.txt", []byte("first\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	opts := testStashOptions()
+	opts.Message = "first"
+	if _, err := StashPush(repo, opts); err != nil {
+		t.Fatalf("StashPush failed: %v", err)
+	}
+
+	if err := os.WriteFile("file.txt", []byte("staged\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Add(repo, "file.txt"); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	if err := os.WriteFile("file.txt", []byte("unstaged\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	opts.Message = "second"
+	opts.KeepIndex = true
+	if _, err := StashPush(repo, opts); err != nil {
+		t.Fatalf("StashPush failed: %v", err)
+	}
+	if got := readTestFile(t, repo, "file.txt"); got != "staged\n" {
+		t.Errorf("--keep-index should leave the staged content, got %q", got)
+	}
+
+	entries, _ := StashList(repo)
+	if len(entries) != 2 || entries[0].Message != "On main: second" || entries[1].Message != "On main: first" {
+		t.Fatalf("unexpected stash list %+v", entries)
+	}
+
+	if _, err := StashDrop(repo, "1"); err != nil {
+		t.Fatalf("StashDrop failed: %v", err)
+	}
+	entries, _ = StashList(repo)
+	if len(entries) != 1 || entries[0].Message != "On main: second" {
+		t.Fatalf("wrong entry dropped: %+v", entries)
+	}
+
+	if _, err := StashDrop(repo, ""); err != nil {
+		t.Fatalf("StashDrop failed: %v", err)
+	}
+	if _, err := os.Stat(".senpai/refs/stash"); !os.IsNotExist(err) {
+		t.Error("refs/stash should be removed with the last entry")
+	}
+}
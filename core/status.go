@@ -17,6 +17,8 @@ const (
 	Modified
 	Staged
 	Untracked
+	// Unmerged is a path with conflict stages in the index.
+	Unmerged
 )
 
 type FileStatus struct {
@@ -28,13 +30,17 @@ func Status(repoPath string) ([]FileStatus, error) {
 	indexPath := filepath.Join(repoPath, RepoDirName, "index")
 
 	index := map[string]string{}
+	unmerged := map[string]bool{}
 	if data, err := os.ReadFile(indexPath); err == nil {
 		lines := strings.Split(strings.TrimSpace(string(data)), "\n")
 
 		for _, line := range lines {
 			parts := strings.Fields(line)
-			if len(parts) >= 3 {
+			switch {
+			case len(parts) == 3 || len(parts) > 3 && parts[3] == "0":
 				index[parts[1]] = parts[2]
+			case len(parts) > 3:
+				unmerged[parts[1]] = true
 			}
 		}
 	}
@@ -83,6 +89,12 @@ func Status(repoPath string) ([]FileStatus, error) {
 			return err
 		}
 
+		if unmerged[relPath] {
+			statuses = append(statuses, FileStatus{Path: relPath, Status: Unmerged})
+			delete(unmerged, relPath)
+			return nil
+		}
+
 		idxHash, inIndex := index[relPath]
 		commitHash, inCommit := lastCommitTree[relPath]
 
@@ -119,6 +131,12 @@ func Status(repoPath string) ([]FileStatus, error) {
 		return nil, err
 	}
 
+	// unmerged paths missing from the working tree, such as one side's
+	// deletion
+	for _, path := range sortedKeys(unmerged) {
+		statuses = append(statuses, FileStatus{Path: path, Status: Unmerged})
+	}
+
 	return statuses, nil
 }
 
@@ -131,33 +149,19 @@ func PrettyPrint(statuses []FileStatus) {
 			fmt.Printf("A\t%s\n", s.Path)
 		case Untracked:
 			fmt.Printf("??\t%s\n", s.Path)
+		case Unmerged:
+			fmt.Printf("U\t%s\n", s.Path)
 		}
 	}
 }
 
 func getLastCommitTree(repoPath string) (map[string]string, error) {
-	repoDir := filepath.Join(repoPath, RepoDirName)
-
-	headPath := filepath.Join(repoDir, "HEAD")
-	headContent, err := os.ReadFile(headPath)
+	commitHash, err := resolveHead(repoPath)
 	if err != nil {
 		return nil, err
 	}
-
-	headStr := strings.TrimSpace(string(headContent))
-	var commitHash string
-
-	if strings.HasPrefix(headStr, "ref: ") {
-		refPath := strings.TrimPrefix(headStr, "ref: ")
-		refFullPath := filepath.Join(repoDir, refPath)
-
-		refContent, err := os.ReadFile(refFullPath)
-		if err != nil {
-			return nil, fmt.Errorf("no commits yet")
-		}
-		commitHash = strings.TrimSpace(string(refContent))
-	} else {
-		commitHash = headStr
+	if commitHash == "" {
+		return nil, fmt.Errorf("no commits yet")
 	}
 
 	commitContent, err := readObject(repoPath, commitHash)
@@ -182,31 +186,40 @@ func getLastCommitTree(repoPath string) (map[string]string, error) {
 }
 
 func readObject(repoPath string, hash string) ([]byte, error) {
+	_, content, err := readObjectWithType(repoPath, hash)
+	return content, err
+}
+
+func readObjectWithType(repoPath string, hash string) (string, []byte, error) {
+	if len(hash) < 3 {
+		return "", nil, fmt.Errorf("invalid object name '%s'", hash)
+	}
 	objectPath := filepath.Join(repoPath, RepoDirName, "objects", hash[:2], hash[2:])
 
 	file, err := os.Open(objectPath)
 	if err != nil {
-		return nil, err
+		return "", nil, err
 	}
 	defer file.Close()
 
 	r, err := zlib.NewReader(file)
 	if err != nil {
-		return nil, err
+		return "", nil, err
 	}
 	defer r.Close()
 
 	data, err := io.ReadAll(r)
 	if err != nil {
-		return nil, err
+		return "", nil, err
 	}
 
 	sepIndex := bytes.IndexByte(data, 0)
 	if sepIndex < 0 {
-		return nil, fmt.Errorf("invalid object format")
+		return "", nil, fmt.Errorf("invalid object format")
 	}
 
-	return data[sepIndex+1:], nil
+	objectType, _, _ := strings.Cut(string(data[:sepIndex]), " ")
+	return objectType, data[sepIndex+1:], nil
 }
 
 func readTreeRecursive(repoPath string, treeHash string, prefix string) (map[string]string, error) {
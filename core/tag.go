@@ -0,0 +1,227 @@
+package core
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+type TagObject struct {
+	Hash    string
+	Object  string
+	Type    string
+	Tag     string
+	Tagger  string
+	Message string
+}
+
+type TagOptions struct {
+	// Annotate creates a tag object instead of a plain ref. It is implied
+	// by a non-empty Message.
+	Annotate bool
+	Message  string
+	Force    bool
+	Name     string
+	Email    string
+}
+
+// CreateTag creates refs/tags/<name> pointing at target (HEAD by default).
+// Annotated tags point at a tag object recording the tagger and message.
+func CreateTag(repoPath, name, target string, opts TagOptions) (string, error) {
+	if err := validateRefName(name); err != nil {
+		return "", err
+	}
+	if _, exists, err := readRef(repoPath, "refs/tags/"+name); err != nil {
+		return "", err
+	} else if exists && !opts.Force {
+		return "", fmt.Errorf("tag '%s' already exists", name)
+	}
+
+	if target == "" {
+		target = "HEAD"
+	}
+	hash, err := resolveObjectName(repoPath, target)
+	if err != nil {
+		return "", err
+	}
+
+	if opts.Annotate || opts.Message != "" {
+		objectType, _, err := readObjectWithType(repoPath, hash)
+		if err != nil {
+			return "", err
+		}
+
+		message := opts.Message
+		if message == "" {
+			template := fmt.Sprintf("\n# Write a message for tag:\n#   %s\n# Lines starting with '#' will be ignored.\n", name)
+			if message, err = editMessage(repoPath, template); err != nil {
+				return "", err
+			}
+		}
+
+		content := fmt.Sprintf("object %s\ntype %s\ntag %s\ntagger %s\n\n%s\n",
+			hash, objectType, name, formatSignature(opts.Name, opts.Email, time.Now()), strings.TrimSpace(message))
+		if hash, err = HashObject([]byte(content), "tag", true); err != nil {
+			return "", err
+		}
+	}
+
+	oldHash := zeroHash
+	if opts.Force {
+		oldHash = ""
+	}
+	tx := BeginRefTransaction(repoPath)
+	if err := tx.Update("refs/tags/"+name, hash, oldHash, "tag: tagging "+target); err != nil {
+		return "", err
+	}
+	if err := tx.Commit(); err != nil {
+		return "", fmt.Errorf("failed to create tag: %w", err)
+	}
+	return hash, nil
+}
+
+// DeleteTag removes refs/tags/<name> and returns the hash it pointed at.
+func DeleteTag(repoPath, name string) (string, error) {
+	ref := "refs/tags/" + name
+	hash, ok, err := readRef(repoPath, ref)
+	if err != nil {
+		return "", fmt.Errorf("failed to read tag: %w", err)
+	}
+	if !ok {
+		return "", fmt.Errorf("tag '%s' not found", name)
+	}
+
+	if err := deleteRef(repoPath, ref); err != nil {
+		return "", fmt.Errorf("failed to delete tag: %w", err)
+	}
+	return hash, nil
+}
+
+// ListTags returns the tag names matching any of patterns (all tags when
+// there are none). sortKey is "refname" (the default) or "version:refname",
+// optionally prefixed with "-" to reverse the order.
+func ListTags(repoPath string, patterns []string, sortKey string) ([]string, error) {
+	refs, err := listRefs(repoPath, "refs/tags/")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tags: %w", err)
+	}
+
+	tags := []string{}
+	for ref := range refs {
+		name := strings.TrimPrefix(ref, "refs/tags/")
+		if len(patterns) > 0 && !matchesAnyPattern(name, patterns) {
+			continue
+		}
+		tags = append(tags, name)
+	}
+
+	reverse := strings.HasPrefix(sortKey, "-")
+	sortKey = strings.TrimPrefix(sortKey, "-")
+	switch sortKey {
+	case "", "refname":
+		sort.Strings(tags)
+	case "version:refname", "v:refname":
+		sort.SliceStable(tags, func(i, j int) bool {
+			return compareVersions(tags[i], tags[j]) < 0
+		})
+	default:
+		return nil, fmt.Errorf("unsupported sort key '%s'", sortKey)
+	}
+
+	if reverse {
+		for i, j := 0, len(tags)-1; i < j; i, j = i+1, j-1 {
+			tags[i], tags[j] = tags[j], tags[i]
+		}
+	}
+	return tags, nil
+}
+
+func matchesAnyPattern(name string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// compareVersions orders names so that runs of digits compare numerically,
+// which puts v1.10 after v1.9.
+func compareVersions(a, b string) int {
+	for a != "" && b != "" {
+		aNum, bNum := isDigit(a[0]), isDigit(b[0])
+		aRun, bRun := leadingRun(a, aNum), leadingRun(b, bNum)
+
+		if aNum && bNum {
+			x := strings.TrimLeft(aRun, "0")
+			y := strings.TrimLeft(bRun, "0")
+			if len(x) != len(y) {
+				return len(x) - len(y)
+			}
+			if c := strings.Compare(x, y); c != 0 {
+				return c
+			}
+		} else if c := strings.Compare(aRun, bRun); c != 0 {
+			return c
+		}
+
+		a, b = a[len(aRun):], b[len(bRun):]
+	}
+	return len(a) - len(b)
+}
+
+func leadingRun(s string, digits bool) string {
+	i := 0
+	for i < len(s) && isDigit(s[i]) == digits {
+		i++
+	}
+	return s[:i]
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// readTag reads and parses an annotated tag object.
+func readTag(repoPath, hash string) (TagObject, error) {
+	objectType, content, err := readObjectWithType(repoPath, hash)
+	if err != nil {
+		return TagObject{}, fmt.Errorf("error reading tag object %s: %w", hash, err)
+	}
+	if objectType != "tag" {
+		return TagObject{}, fmt.Errorf("object %s is a %s, not a tag", hash, objectType)
+	}
+
+	tag := TagObject{Hash: hash}
+	header, message, _ := strings.Cut(string(content), "\n\n")
+	for _, line := range strings.Split(header, "\n") {
+		key, value, _ := strings.Cut(line, " ")
+		switch key {
+		case "object":
+			tag.Object = value
+		case "type":
+			tag.Type = value
+		case "tag":
+			tag.Tag = value
+		case "tagger":
+			tag.Tagger = value
+		}
+	}
+	tag.Message = strings.TrimSpace(message)
+
+	if tag.Object == "" {
+		return TagObject{}, fmt.Errorf("invalid tag %s: no object", hash)
+	}
+	return tag, nil
+}
+
+func validateRefName(name string) error {
+	if name == "" || strings.HasPrefix(name, "-") || strings.HasPrefix(name, "/") || strings.HasSuffix(name, "/") ||
+		strings.HasSuffix(name, ".lock") || strings.Contains(name, "..") || strings.Contains(name, "@{") ||
+		strings.ContainsAny(name, " ~^:?*[\\\t\n") {
+		return fmt.Errorf("'%s' is not a valid name", name)
+	}
+	return nil
+}
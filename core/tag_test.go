@@ -0,0 +1,98 @@
+package core
+
+import (
+	"os"
+	"reflect"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestCreateTags(t *testing.T) {
+	repo := setupTestRepo(t)
+	// a named zone away from UTC, which has to be written as an offset
+	local := time.Local
+	time.Local = time.FixedZone("EDT", -4*3600)
+	defer func() { time.Local = local }()
+
+	first := commitFile(t, repo, "file.txt", "one\n", "first")
+	second := commitFile(t, repo, "file.txt", "two\n", "second")
+
+	if _, err := os.Stat(".senpai/refs/tags"); err != nil {
+		t.Errorf("InitRepo should create refs/tags: %v", err)
+	}
+
+	if _, err := CreateTag(repo, "light", first[:7], TagOptions{}); err != nil {
+		t.Fatalf("lightweight tag failed: %v", err)
+	}
+	opts := TagOptions{Message: "Release 1.0", Name: "Test Author", Email: "author@example.com"}
+	tagHash, err := CreateTag(repo, "v1.0", "", opts)
+	if err != nil {
+		t.Fatalf("annotated tag failed: %v", err)
+	}
+
+	tag, err := readTag(repo, tagHash)
+	if err != nil {
+		t.Fatalf("readTag failed: %v", err)
+	}
+	if tag.Object != second || tag.Type != "commit" || tag.Tag != "v1.0" || tag.Message != "Release 1.0" {
+		t.Errorf("unexpected tag object %+v", tag)
+	}
+	if !regexp.MustCompile(`^\S.* <.*> \d+ [+-]\d{4}$`).MatchString(tag.Tagger) {
+		t.Errorf("tagger line %q should end in a timestamp and a +hhmm offset", tag.Tagger)
+	}
+
+	if hash, err := resolveCommitish(repo, "v1.0"); err != nil || hash != second {
+		t.Errorf("annotated tag should peel to %s, got %s (%v)", second, hash, err)
+	}
+	if hash, err := resolveCommitish(repo, "v1.0~1"); err != nil || hash != first {
+		t.Errorf("v1.0~1 should be %s, got %s (%v)", first, hash, err)
+	}
+
+	if _, err := CreateTag(repo, "v1.0", "", TagOptions{}); err == nil {
+		t.Error("creating an existing tag without force should fail")
+	}
+
+	commits, err := LogFrom(repo, "light")
+	if err != nil || len(commits) != 1 || commits[0].Hash != first {
+		t.Errorf("log from a tag should start at the tagged commit, got %v (%v)", commits, err)
+	}
+
+	if err := Checkout(repo, "light"); err != nil {
+		t.Fatalf("checkout of a tag failed: %v", err)
+	}
+	if got := readTestFile(t, repo, "file.txt"); got != "one\n" {
+		t.Errorf("expected tagged content, got %q", got)
+	}
+
+	if _, err := DeleteTag(repo, "light"); err != nil {
+		t.Fatalf("DeleteTag failed: %v", err)
+	}
+	if tags, _ := ListTags(repo, nil, ""); !reflect.DeepEqual(tags, []string{"v1.0"}) {
+		t.Errorf("unexpected tags after delete: %v", tags)
+	}
+}
+
+func TestListTagsSortAndPattern(t *testing.T) {
+	repo := setupTestRepo(t)
+	commitFile(t, repo, "file.txt", "one\n", "first")
+
+	for _, name := range []string{"v1.10", "v1.2", "v1.9", "release"} {
+		if _, err := CreateTag(repo, name, "", TagOptions{}); err != nil {
+			t.Fatalf("CreateTag %s failed: %v", name, err)
+		}
+	}
+
+	tags, err := ListTags(repo, []string{"v1.*"}, "version:refname")
+	if err != nil {
+		t.Fatalf("ListTags failed: %v", err)
+	}
+	if want := []string{"v1.2", "v1.9", "v1.10"}; !reflect.DeepEqual(tags, want) {
+		t.Errorf("expected %v, got %v", want, tags)
+	}
+
+	tags, _ = ListTags(repo, nil, "-refname")
+	if want := []string{"v1.9", "v1.2", "v1.10", "release"}; !reflect.DeepEqual(tags, want) {
+		t.Errorf("expected %v, got %v", want, tags)
+	}
+}
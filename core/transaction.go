@@ -0,0 +1,287 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// lockFile is a "<path>.lock" file held while path is rewritten. New content
+// goes into the lock and is renamed over path on commit, so readers never
+// see a partially written file and concurrent writers fail to take the lock.
+type lockFile struct {
+	path string
+	file *os.File
+}
+
+func acquireLock(path string) (*lockFile, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("unable to create '%s.lock': %w", path, err)
+	}
+	file, err := os.OpenFile(path+".lock", os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		if os.IsExist(err) {
+			return nil, fmt.Errorf("unable to create '%s.lock': file exists; another senpai process seems to be running", path)
+		}
+		return nil, fmt.Errorf("unable to create '%s.lock': %w", path, err)
+	}
+	return &lockFile{path: path, file: file}, nil
+}
+
+func (l *lockFile) write(content []byte) error {
+	if _, err := l.file.Write(content); err != nil {
+		return fmt.Errorf("failed to write '%s.lock': %w", l.path, err)
+	}
+	return nil
+}
+
+// commit replaces path with the content written to the lock.
+func (l *lockFile) commit() error {
+	if err := l.file.Close(); err != nil {
+		l.rollback()
+		return fmt.Errorf("failed to write '%s.lock': %w", l.path, err)
+	}
+	if err := os.Rename(l.path+".lock", l.path); err != nil {
+		l.rollback()
+		return fmt.Errorf("failed to rename '%s.lock': %w", l.path, err)
+	}
+	return nil
+}
+
+// rollback releases the lock and leaves path untouched.
+func (l *lockFile) rollback() {
+	l.file.Close()
+	os.Remove(l.path + ".lock")
+}
+
+type refTransactionState int
+
+const (
+	refTransactionOpen refTransactionState = iota
+	refTransactionPrepared
+	refTransactionClosed
+)
+
+type refUpdate struct {
+	ref string
+	// symrefs holds the symbolic refs followed to reach ref, such as HEAD;
+	// their reflogs record the update too.
+	symrefs []string
+	// newHash is zeroHash for a deletion and empty for a verify.
+	newHash string
+	// symTarget turns ref into a symbolic ref pointing at it instead.
+	symTarget string
+	// oldHash is the expected current value; zeroHash means the ref must
+	// not exist and an empty string skips the check.
+	oldHash string
+	message string
+	noLog   bool
+	noDeref bool
+
+	lock    *lockFile
+	current string
+}
+
+func (u *refUpdate) isVerify() bool {
+	return u.newHash == "" && u.symTarget == ""
+}
+
+func (u *refUpdate) isDelete() bool {
+	return u.newHash == zeroHash
+}
+
+// storedValue is what the ref's storage holds after the update.
+func (u *refUpdate) storedValue() string {
+	if u.symTarget != "" {
+		return "ref: " + u.symTarget
+	}
+	return u.newHash
+}
+
+// RefTransaction updates several refs atomically. Updates are queued, then
+// Prepare locks the refs in the RefStore and checks the expected old values,
+// and Commit moves the new values into place. If anything fails before
+// Commit, all locks are released and no ref is changed.
+type RefTransaction struct {
+	repoPath string
+	store    RefStore
+	updates  []*refUpdate
+	noDeref  bool
+	state    refTransactionState
+}
+
+func BeginRefTransaction(repoPath string) *RefTransaction {
+	return &RefTransaction{repoPath: repoPath}
+}
+
+// Update queues setting ref to newHash. A non-empty oldHash must match the
+// ref's current value when the transaction is prepared; zeroHash requires
+// that the ref doesn't exist yet.
+func (tx *RefTransaction) Update(ref, newHash, oldHash, message string) error {
+	if newHash == "" || newHash == zeroHash {
+		return fmt.Errorf("update of '%s' needs a new value", ref)
+	}
+	return tx.queue(&refUpdate{ref: ref, newHash: newHash, oldHash: oldHash, message: message})
+}
+
+// Create queues creating ref, which must not exist yet.
+func (tx *RefTransaction) Create(ref, newHash, message string) error {
+	return tx.Update(ref, newHash, zeroHash, message)
+}
+
+// Delete queues deleting ref.
+func (tx *RefTransaction) Delete(ref, oldHash, message string) error {
+	if oldHash == zeroHash {
+		return fmt.Errorf("delete of '%s' can't expect it to be missing", ref)
+	}
+	return tx.queue(&refUpdate{ref: ref, newHash: zeroHash, oldHash: oldHash, message: message})
+}
+
+// Verify queues a check that ref has oldHash (or doesn't exist, for
+// zeroHash) without changing it.
+func (tx *RefTransaction) Verify(ref, oldHash string) error {
+	if oldHash == "" {
+		oldHash = zeroHash
+	}
+	return tx.queue(&refUpdate{ref: ref, oldHash: oldHash})
+}
+
+// NoDeref makes the next queued command act on a symbolic ref itself
+// instead of the ref it points at.
+func (tx *RefTransaction) NoDeref() {
+	tx.noDeref = true
+}
+
+func (tx *RefTransaction) queue(update *refUpdate) error {
+	if tx.state != refTransactionOpen {
+		return fmt.Errorf("transaction is no longer open")
+	}
+	if err := validateFullRefName(update.ref); err != nil {
+		return err
+	}
+
+	noDeref := tx.noDeref || update.noDeref
+	tx.noDeref = false
+	if !noDeref {
+		ref, symrefs, err := followSymref(tx.repoPath, update.ref)
+		if err != nil {
+			return err
+		}
+		update.ref, update.symrefs = ref, symrefs
+	}
+
+	for _, queued := range tx.updates {
+		if queued.ref == update.ref {
+			return fmt.Errorf("multiple updates for ref '%s' not allowed", update.ref)
+		}
+	}
+	tx.updates = append(tx.updates, update)
+	return nil
+}
+
+// validateFullRefName accepts HEAD-like names and anything under refs/.
+func validateFullRefName(ref string) error {
+	if ref == strings.ToUpper(ref) && strings.HasSuffix(ref, "HEAD") && !strings.Contains(ref, "/") {
+		return nil
+	}
+	if !strings.HasPrefix(ref, "refs/") {
+		return fmt.Errorf("invalid ref name '%s'", ref)
+	}
+	return validateRefName(strings.TrimPrefix(ref, "refs/"))
+}
+
+// Prepare locks every queued ref and checks its expected old value.
+func (tx *RefTransaction) Prepare() error {
+	if tx.state != refTransactionOpen {
+		return fmt.Errorf("transaction is no longer open")
+	}
+
+	store, err := openRefStore(tx.repoPath)
+	if err != nil {
+		tx.Abort()
+		return err
+	}
+	tx.store = store
+
+	// always lock in the same order so concurrent transactions can't
+	// deadlock each other
+	sort.Slice(tx.updates, func(i, j int) bool { return tx.updates[i].ref < tx.updates[j].ref })
+
+	if err := store.lockRefs(tx.updates); err != nil {
+		tx.Abort()
+		return err
+	}
+	for _, update := range tx.updates {
+		if err := tx.checkOldValue(update); err != nil {
+			tx.Abort()
+			return err
+		}
+	}
+	tx.state = refTransactionPrepared
+	return nil
+}
+
+func (tx *RefTransaction) checkOldValue(update *refUpdate) error {
+	current, exists, err := readRef(tx.repoPath, update.ref)
+	if err != nil {
+		return err
+	}
+	update.current = current
+
+	switch {
+	case update.oldHash == "":
+	case update.oldHash == zeroHash && exists:
+		return fmt.Errorf("cannot lock ref '%s': reference already exists", update.ref)
+	case update.oldHash != zeroHash && !exists:
+		return fmt.Errorf("cannot lock ref '%s': unable to resolve reference", update.ref)
+	case update.oldHash != zeroHash && current != update.oldHash:
+		return fmt.Errorf("cannot lock ref '%s': is at %s but expected %s", update.ref, current, update.oldHash)
+	}
+	return nil
+}
+
+// Commit prepares the transaction if needed and applies every update,
+// recording them in the reflogs.
+func (tx *RefTransaction) Commit() error {
+	if tx.state == refTransactionOpen {
+		if err := tx.Prepare(); err != nil {
+			return err
+		}
+	}
+	if tx.state != refTransactionPrepared {
+		return fmt.Errorf("transaction is no longer open")
+	}
+	defer tx.Abort()
+
+	if err := tx.store.commitRefs(tx.updates); err != nil {
+		return err
+	}
+
+	for _, update := range tx.updates {
+		if update.isDelete() {
+			if err := deleteReflog(tx.repoPath, update.ref); err != nil {
+				return err
+			}
+			continue
+		}
+		if update.isVerify() || update.symTarget != "" || update.noLog {
+			continue
+		}
+		for _, ref := range append([]string{update.ref}, update.symrefs...) {
+			if err := logRefUpdate(tx.repoPath, ref, update.current, update.newHash, update.message); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Abort releases every lock without changing any ref.
+func (tx *RefTransaction) Abort() {
+	if tx.store != nil && tx.state != refTransactionClosed {
+		tx.store.unlockRefs(tx.updates)
+	}
+	tx.state = refTransactionClosed
+}
@@ -0,0 +1,138 @@
+package core
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRefTransactionIsAtomic(t *testing.T) {
+	repo := setupTestRepo(t)
+	first := commitFile(t, repo, "file.txt", "one\n", "first")
+	second := commitFile(t, repo, "file.txt", "two\n", "second")
+
+	tx := BeginRefTransaction(repo)
+	if err := tx.Create("refs/heads/a", first, "create a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Update("refs/heads/main", first, first, "stale"); err != nil {
+		t.Fatal(err)
+	}
+	err := tx.Commit()
+	if err == nil || !strings.Contains(err.Error(), "expected") {
+		t.Fatalf("expected a compare-and-swap failure, got %v", err)
+	}
+	if exists, _ := BranchExists(repo, "a"); exists {
+		t.Error("a failed transaction must not create any ref")
+	}
+	if hash, _ := ResolveBranchCommit(repo, "main"); hash != second {
+		t.Errorf("main should be untouched, got %s", hash)
+	}
+	if _, err := os.Stat(filepath.Join(repo, RepoDirName, "refs", "heads", "a.lock")); !os.IsNotExist(err) {
+		t.Error("locks should be released after a failed transaction")
+	}
+
+	tx = BeginRefTransaction(repo)
+	if err := tx.Update("HEAD", first, second, "move HEAD"); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Update("refs/heads/main", first, "", "again"); err == nil {
+		t.Error("updating main twice through HEAD should be rejected")
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+	if hash, _ := ResolveBranchCommit(repo, "main"); hash != first {
+		t.Errorf("updating HEAD should move main, got %s", hash)
+	}
+	head, _ := Reflog(repo, "HEAD")
+	branch, _ := Reflog(repo, "main")
+	if head[0].Message != "move HEAD" || branch[0].Message != "move HEAD" {
+		t.Errorf("both HEAD and main reflogs should record the update: %q, %q", head[0].Message, branch[0].Message)
+	}
+}
+
+func TestRefTransactionRespectsLocks(t *testing.T) {
+	repo := setupTestRepo(t)
+	first := commitFile(t, repo, "file.txt", "one\n", "first")
+
+	lock, err := acquireLock(filepath.Join(repo, RepoDirName, "refs", "heads", "main"))
+	if err != nil {
+		t.Fatalf("acquireLock failed: %v", err)
+	}
+	if err := CreateBranchAt(repo, "other", first); err != nil {
+		t.Fatalf("unrelated refs should still be writable: %v", err)
+	}
+	if _, err := Commit(repo, "blocked", "Test Author", "test@example.com"); err == nil || !strings.Contains(err.Error(), "lock") {
+		t.Errorf("expected a lock error, got %v", err)
+	}
+	lock.rollback()
+
+	if err := UpdateRef(repo, "refs/heads/main", "other", first, "", false); err != nil {
+		t.Errorf("UpdateRef should succeed once the lock is gone: %v", err)
+	}
+}
+
+func TestUpdateRefStdin(t *testing.T) {
+	repo := setupTestRepo(t)
+	first := commitFile(t, repo, "file.txt", "one\n", "first")
+	second := commitFile(t, repo, "file.txt", "two\n", "second")
+	if err := CreateBranchAt(repo, "old", first); err != nil {
+		t.Fatal(err)
+	}
+	if err := PackRefs(repo, true, true); err != nil {
+		t.Fatal(err)
+	}
+
+	input := strings.Join([]string{
+		"start",
+		"create refs/heads/new " + second,
+		"update refs/heads/main HEAD~1 " + second,
+		"delete refs/heads/old " + first,
+		"verify refs/heads/missing",
+		"prepare",
+		"commit",
+	}, "\n") + "\n"
+	var out bytes.Buffer
+	if err := UpdateRefStdin(repo, strings.NewReader(input), &out, "batch"); err != nil {
+		t.Fatalf("UpdateRefStdin failed: %v", err)
+	}
+	if out.String() != "start: ok\nprepare: ok\ncommit: ok\n" {
+		t.Errorf("unexpected output %q", out.String())
+	}
+
+	branches, _ := ListBranches(repo)
+	if strings.Join(branches, ",") != "main,new" {
+		t.Errorf("expected main and new, got %v", branches)
+	}
+	if hash, _ := ResolveBranchCommit(repo, "main"); hash != first {
+		t.Errorf("main should have moved to %s, got %s", first, hash)
+	}
+	if packed, _ := readPackedRefs(repo); len(packed) != 1 || packed[0].Name != "refs/heads/main" {
+		t.Errorf("old should be gone from packed-refs, got %+v", packed)
+	}
+
+	// without start, everything commits at the end of input or not at all
+	input = "update refs/heads/new " + first + "\nupdate refs/heads/main " + second + " " + second + "\n"
+	if err := UpdateRefStdin(repo, strings.NewReader(input), &out, ""); err == nil {
+		t.Fatal("expected the stale old value to fail the transaction")
+	}
+	if hash, _ := ResolveBranchCommit(repo, "new"); hash != second {
+		t.Errorf("new must not move when the transaction fails, got %s", hash)
+	}
+
+	out.Reset()
+	input = "start\nupdate refs/heads/new " + first + "\nabort\n"
+	if err := UpdateRefStdin(repo, strings.NewReader(input), &out, ""); err != nil {
+		t.Fatalf("UpdateRefStdin failed: %v", err)
+	}
+	if hash, _ := ResolveBranchCommit(repo, "new"); hash != second || out.String() != "start: ok\nabort: ok\n" {
+		t.Errorf("abort should leave new at %s, got %s (%q)", second, hash, out.String())
+	}
+
+	if err := UpdateRefStdin(repo, strings.NewReader("frobnicate refs/heads/new\n"), &out, ""); err == nil {
+		t.Error("expected an error for an unknown command")
+	}
+}
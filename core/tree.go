@@ -0,0 +1,192 @@
+package core
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// readTreeEntries parses the direct entries of a tree object.
+func readTreeEntries(repoPath, treeHash string) ([]TreeEntry, error) {
+	objectType, content, err := readObjectWithType(repoPath, treeHash)
+	if err != nil {
+		return nil, err
+	}
+	if objectType != "tree" {
+		return nil, fmt.Errorf("object %s is a %s, not a tree", treeHash, objectType)
+	}
+	return parseTreeEntries(treeHash, content)
+}
+
+// parseTreeEntries parses the content of the tree object treeHash.
+func parseTreeEntries(treeHash string, content []byte) ([]TreeEntry, error) {
+	var entries []TreeEntry
+	for i := 0; i < len(content); {
+		spaceIdx := bytes.IndexByte(content[i:], ' ')
+		if spaceIdx < 0 {
+			return nil, fmt.Errorf("invalid tree %s", treeHash)
+		}
+		mode := string(content[i : i+spaceIdx])
+		i += spaceIdx + 1
+
+		nullIdx := bytes.IndexByte(content[i:], 0)
+		if nullIdx < 0 || i+nullIdx+1+HashSize > len(content) {
+			return nil, fmt.Errorf("invalid tree %s", treeHash)
+		}
+		name := string(content[i : i+nullIdx])
+		i += nullIdx + 1
+
+		entries = append(entries, TreeEntry{
+			Mode: mode,
+			Name: name,
+			Hash: fmt.Sprintf("%x", content[i:i+HashSize]),
+		})
+		i += HashSize
+	}
+	return entries, nil
+}
+
+// cleanPathspec normalizes a path given to limit a command, so that "./"
+// prefixes and trailing slashes don't matter and "." means everything.
+func cleanPathspec(path string) string {
+	path = filepath.ToSlash(filepath.Clean(path))
+	if path == "." {
+		return ""
+	}
+	return path
+}
+
+// inPathspec reports whether path is, or is inside, one of paths. No paths
+// means everything.
+func inPathspec(path string, paths []string) bool {
+	if len(paths) == 0 {
+		return true
+	}
+	for _, spec := range paths {
+		if spec == "" || path == spec || strings.HasPrefix(path, spec+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// pathspecReaches reports whether something inside the directory dir may
+// be in one of paths.
+func pathspecReaches(dir string, paths []string) bool {
+	if inPathspec(dir, paths) {
+		return true
+	}
+	for _, spec := range paths {
+		if strings.HasPrefix(spec, dir+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func isTreeMode(mode string) bool {
+	return mode == "40000" || mode == "040000"
+}
+
+// FileChange describes a file that differs between two trees. Status is
+// 'A' (added), 'D' (deleted), 'M' (modified), 'T' (changed between a file
+// and a symlink) or 'R' for a file renamed from OldPath, with Score giving
+// the percentage of its content that stayed the same. The old side of an
+// added file and the new side of a deleted one have empty modes and hashes.
+type FileChange struct {
+	Status  byte
+	Score   int
+	OldPath string
+	OldMode string
+	OldHash string
+	Path    string
+	Mode    string
+	Hash    string
+}
+
+// diffTrees lists the files that differ between two trees in path order,
+// limited to paths when there are any. An empty hash stands for the empty
+// tree. Subtrees with the same hash on both sides are skipped without
+// reading them.
+func diffTrees(repoPath, fromTree, toTree string, paths []string) ([]FileChange, error) {
+	var changes []FileChange
+	var walk func(from, to, prefix string) error
+	walk = func(from, to, prefix string) error {
+		if from == to {
+			return nil
+		}
+		entries := make(map[string][2]TreeEntry)
+		for side, tree := range []string{from, to} {
+			if tree == "" {
+				continue
+			}
+			list, err := readTreeEntries(repoPath, tree)
+			if err != nil {
+				return err
+			}
+			for _, entry := range list {
+				pair := entries[entry.Name]
+				pair[side] = entry
+				entries[entry.Name] = pair
+			}
+		}
+
+		names := make([]string, 0, len(entries))
+		for name := range entries {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			pair := entries[name]
+			if pair[0] == pair[1] {
+				continue
+			}
+			path := prefix + name
+			fromSub, toSub := "", ""
+			fromFile, toFile := pair[0], pair[1]
+			if isTreeMode(pair[0].Mode) {
+				fromSub, fromFile = pair[0].Hash, TreeEntry{}
+			}
+			if isTreeMode(pair[1].Mode) {
+				toSub, toFile = pair[1].Hash, TreeEntry{}
+			}
+			if (fromSub != "" || toSub != "") && pathspecReaches(path, paths) {
+				if err := walk(fromSub, toSub, path+"/"); err != nil {
+					return err
+				}
+			}
+			if fromFile == toFile || !inPathspec(path, paths) {
+				continue
+			}
+			change := FileChange{
+				OldPath: path, OldMode: fromFile.Mode, OldHash: fromFile.Hash,
+				Path: path, Mode: toFile.Mode, Hash: toFile.Hash,
+			}
+			switch {
+			case fromFile.Mode == "":
+				change.Status = 'A'
+			case toFile.Mode == "":
+				change.Status = 'D'
+			case isSymlinkMode(fromFile.Mode) != isSymlinkMode(toFile.Mode):
+				change.Status = 'T'
+			default:
+				change.Status = 'M'
+			}
+			changes = append(changes, change)
+		}
+		return nil
+	}
+
+	if err := walk(fromTree, toTree, ""); err != nil {
+		return nil, err
+	}
+	// a file replaced by a directory sorts before the directory's contents
+	sort.SliceStable(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	return changes, nil
+}
+
+func isSymlinkMode(mode string) bool {
+	return mode == "120000"
+}
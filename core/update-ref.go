@@ -0,0 +1,163 @@
+package core
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// UpdateRef sets ref to newValue, which may be any revision. A non-empty
+// oldValue must match the ref's current value; all zeros means the ref must
+// not exist.
+func UpdateRef(repoPath, ref, newValue, oldValue, message string, noDeref bool) error {
+	tx := BeginRefTransaction(repoPath)
+	if noDeref {
+		tx.NoDeref()
+	}
+	if err := queueRefCommand(repoPath, tx, "update", ref, []string{newValue, oldValue}, message); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// DeleteRefChecked deletes ref, provided it currently has oldValue when one
+// is given.
+func DeleteRefChecked(repoPath, ref, oldValue, message string, noDeref bool) error {
+	tx := BeginRefTransaction(repoPath)
+	if noDeref {
+		tx.NoDeref()
+	}
+	if err := queueRefCommand(repoPath, tx, "delete", ref, []string{oldValue}, message); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// UpdateRefStdin runs the "update-ref --stdin" protocol:
+//
+//	update SP <ref> SP <new> [SP <old>]
+//	create SP <ref> SP <new>
+//	delete SP <ref> [SP <old>]
+//	verify SP <ref> [SP <old>]
+//	option SP no-deref
+//	start / prepare / commit / abort
+//
+// Without "start", every command is part of a single transaction that is
+// committed at the end of input. With it, transactions are delimited by the
+// control commands, which are acknowledged on out, and a transaction left
+// open at the end of input is aborted.
+func UpdateRefStdin(repoPath string, in io.Reader, out io.Writer, message string) error {
+	tx := BeginRefTransaction(repoPath)
+	explicit := false
+
+	scanner := bufio.NewScanner(in)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+		command, rest, _ := strings.Cut(line, " ")
+
+		var err error
+		switch command {
+		case "start":
+			if tx.state != refTransactionOpen || len(tx.updates) > 0 {
+				err = fmt.Errorf("start: transaction already in progress")
+				break
+			}
+			explicit = true
+			fmt.Fprintln(out, "start: ok")
+		case "prepare":
+			if err = tx.Prepare(); err == nil {
+				fmt.Fprintln(out, "prepare: ok")
+			}
+		case "commit":
+			if err = tx.Commit(); err == nil {
+				fmt.Fprintln(out, "commit: ok")
+				tx = BeginRefTransaction(repoPath)
+			}
+		case "abort":
+			tx.Abort()
+			fmt.Fprintln(out, "abort: ok")
+			tx = BeginRefTransaction(repoPath)
+		case "option":
+			if rest != "no-deref" {
+				err = fmt.Errorf("option unknown: %s", rest)
+				break
+			}
+			tx.NoDeref()
+		case "update", "create", "delete", "verify":
+			fields := strings.Split(rest, " ")
+			err = queueRefCommand(repoPath, tx, command, fields[0], fields[1:], message)
+		default:
+			err = fmt.Errorf("unknown command: %s", line)
+		}
+		if err != nil {
+			tx.Abort()
+			return fmt.Errorf("line %d: %w", lineNo, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		tx.Abort()
+		return fmt.Errorf("failed to read commands: %w", err)
+	}
+
+	if explicit {
+		tx.Abort()
+		return nil
+	}
+	return tx.Commit()
+}
+
+// queueRefCommand adds one update-ref command to tx. values holds the new
+// and/or old values the command takes; missing values are empty.
+func queueRefCommand(repoPath string, tx *RefTransaction, command, ref string, values []string, message string) error {
+	want := map[string]int{"update": 2, "create": 1, "delete": 1, "verify": 1}[command]
+	if ref == "" {
+		return fmt.Errorf("%s: missing <ref>", command)
+	}
+	for len(values) > 0 && values[len(values)-1] == "" {
+		values = values[:len(values)-1]
+	}
+	if len(values) > want {
+		return fmt.Errorf("%s %s: extra input: %s", command, ref, strings.Join(values[want:], " "))
+	}
+	for len(values) < want {
+		values = append(values, "")
+	}
+
+	for i, value := range values {
+		if value == "" || strings.Trim(value, "0") == "" {
+			if value != "" {
+				values[i] = zeroHash
+			}
+			continue
+		}
+		hash, err := ResolveRevision(repoPath, value)
+		if err != nil {
+			return fmt.Errorf("%s %s: invalid value '%s': %w", command, ref, value, err)
+		}
+		values[i] = hash
+	}
+
+	switch command {
+	case "update":
+		if values[0] == "" {
+			return fmt.Errorf("update %s: missing <new-oid>", ref)
+		}
+		if values[0] == zeroHash {
+			return tx.Delete(ref, values[1], message)
+		}
+		return tx.Update(ref, values[0], values[1], message)
+	case "create":
+		if values[0] == "" || values[0] == zeroHash {
+			return fmt.Errorf("create %s: missing or zero <new-oid>", ref)
+		}
+		return tx.Create(ref, values[0], message)
+	case "delete":
+		return tx.Delete(ref, values[0], message)
+	default:
+		return tx.Verify(ref, values[0])
+	}
+}
@@ -0,0 +1,321 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+func readIndexMap(repoPath string) (map[string]string, error) {
+	index := make(map[string]string)
+
+	data, err := os.ReadFile(filepath.Join(repoPath, RepoDirName, "index"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return index, nil
+		}
+		return nil, fmt.Errorf("failed to read index: %w", err)
+	}
+
+	entries, err := parseIndex(string(data))
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		// an unmerged path keeps our version until it is resolved
+		if entry.Stage == 1 || entry.Stage == 3 {
+			continue
+		}
+		index[entry.Path] = entry.Hash
+	}
+	return index, nil
+}
+
+// readIndexEntries returns the entries of the index sorted by path and
+// stage, the order git lists them in.
+func readIndexEntries(repoPath string) ([]IndexEntry, error) {
+	data, err := os.ReadFile(filepath.Join(repoPath, RepoDirName, "index"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read index: %w", err)
+	}
+
+	entries, err := parseIndex(string(data))
+	if err != nil {
+		return nil, err
+	}
+	sortIndexEntries(entries)
+	return entries, nil
+}
+
+// writeIndexEntries replaces the index with entries, writing the stage
+// of those that are unmerged.
+func writeIndexEntries(repoPath string, entries []IndexEntry) error {
+	sortIndexEntries(entries)
+	var sb strings.Builder
+	for _, entry := range entries {
+		fmt.Fprintf(&sb, "%s %s %s", entry.Mode, entry.Path, entry.Hash)
+		if entry.Stage != 0 {
+			fmt.Fprintf(&sb, " %d", entry.Stage)
+		}
+		sb.WriteString("\n")
+	}
+	return os.WriteFile(filepath.Join(repoPath, RepoDirName, "index"), []byte(sb.String()), 0644)
+}
+
+func sortIndexEntries(entries []IndexEntry) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].Path != entries[j].Path {
+			return entries[i].Path < entries[j].Path
+		}
+		return entries[i].Stage < entries[j].Stage
+	})
+}
+
+func writeTreeFromMap(tree map[string]string) (string, error) {
+	entries := make([]IndexEntry, 0, len(tree))
+	for path, hash := range tree {
+		entries = append(entries, IndexEntry{Mode: "100644", Path: path, Hash: hash})
+	}
+	return writeTreeFromIndex(entries)
+}
+
+// commitTreeMap is getCommitTree that treats an empty hash (an unborn branch
+// or a root commit's parent) as the empty tree.
+func commitTreeMap(repoPath, commitHash string) (map[string]string, error) {
+	if commitHash == "" {
+		return map[string]string{}, nil
+	}
+	return getCommitTree(repoPath, commitHash)
+}
+
+// worktreeFileHash hashes the working tree copy of path without writing it.
+// The boolean result reports whether the file exists.
+func worktreeFileHash(repoPath, path string) (string, bool, error) {
+	content, err := os.ReadFile(filepath.Join(repoPath, path))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", false, nil
+		}
+		return "", false, err
+	}
+
+	hash, err := HashObject(content, "blob", false)
+	if err != nil {
+		return "", false, err
+	}
+	return hash, true, nil
+}
+
+// localChanges lists tracked paths whose index entry differs from head or
+// whose working tree copy differs from the index.
+func localChanges(repoPath string, head, index map[string]string) ([]string, error) {
+	changed := make(map[string]bool)
+
+	for path, hash := range head {
+		if index[path] != hash {
+			changed[path] = true
+		}
+	}
+	for path, hash := range index {
+		if head[path] != hash {
+			changed[path] = true
+			continue
+		}
+		wtHash, exists, err := worktreeFileHash(repoPath, path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		if !exists || wtHash != hash {
+			changed[path] = true
+		}
+	}
+
+	return sortedKeys(changed), nil
+}
+
+func requireCleanWorktree(repoPath, action string) error {
+	head, err := resolveHead(repoPath)
+	if err != nil {
+		return err
+	}
+	headTree, err := commitTreeMap(repoPath, head)
+	if err != nil {
+		return err
+	}
+	index, err := readIndexMap(repoPath)
+	if err != nil {
+		return err
+	}
+
+	changed, err := localChanges(repoPath, headTree, index)
+	if err != nil {
+		return err
+	}
+	if len(changed) > 0 {
+		return fmt.Errorf("cannot %s: you have uncommitted changes:\n\t%s\nPlease commit or stash them.",
+			action, strings.Join(changed, "\n\t"))
+	}
+	return nil
+}
+
+// checkWorktreeClobber makes sure that moving from ours to target will not
+// overwrite staged or unstaged modifications, or untracked files.
+func checkWorktreeClobber(repoPath string, ours, index, target map[string]string) error {
+	var modified, untracked []string
+
+	paths := make(map[string]bool)
+	for path, hash := range target {
+		if ours[path] != hash {
+			paths[path] = true
+		}
+	}
+	for path := range ours {
+		if _, ok := target[path]; !ok {
+			paths[path] = true
+		}
+	}
+
+	for _, path := range sortedKeys(paths) {
+		wtHash, exists, err := worktreeFileHash(repoPath, path)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", path, err)
+		}
+
+		idxHash, inIndex := index[path]
+		oursHash, inOurs := ours[path]
+
+		switch {
+		case inIndex != inOurs || idxHash != oursHash:
+			modified = append(modified, path)
+		case inIndex && exists && wtHash != idxHash:
+			modified = append(modified, path)
+		case !inIndex && exists && wtHash != target[path]:
+			untracked = append(untracked, path)
+		}
+	}
+
+	if len(modified) > 0 {
+		return fmt.Errorf("your local changes to the following files would be overwritten:\n\t%s\nPlease commit your changes or stash them before you proceed.",
+			strings.Join(modified, "\n\t"))
+	}
+	if len(untracked) > 0 {
+		return fmt.Errorf("the following untracked working tree files would be overwritten:\n\t%s\nPlease move or remove them before you proceed.",
+			strings.Join(untracked, "\n\t"))
+	}
+	return nil
+}
+
+// unstagedChanges lists index entries whose working tree copy is different.
+func unstagedChanges(repoPath string, index map[string]string) ([]string, error) {
+	var changed []string
+	for path, hash := range index {
+		wtHash, exists, err := worktreeFileHash(repoPath, path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		if exists && wtHash != hash {
+			changed = append(changed, path)
+		}
+	}
+	sort.Strings(changed)
+	return changed, nil
+}
+
+// updateWorkingTree moves the working tree from one tree to another, only
+// touching paths whose content differs between the two.
+func updateWorkingTree(repoPath string, from, to map[string]string) error {
+	for path, hash := range to {
+		if from[path] == hash {
+			continue
+		}
+		if err := restoreFile(repoPath, path, hash); err != nil {
+			return fmt.Errorf("failed to restore file %s: %w", path, err)
+		}
+	}
+
+	for path := range from {
+		if _, ok := to[path]; ok {
+			continue
+		}
+		if err := removeWorktreeFile(repoPath, path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeWorktreeFile deletes a tracked file and any parent directories that
+// become empty as a result.
+func removeWorktreeFile(repoPath, path string) error {
+	fullPath := filepath.Join(repoPath, path)
+	if err := os.Remove(fullPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove %s: %w", path, err)
+	}
+
+	root := filepath.Clean(repoPath)
+	dir := filepath.Dir(fullPath)
+	for dir != root && dir != "." && dir != string(filepath.Separator) {
+		if err := os.Remove(dir); err != nil {
+			break
+		}
+		dir = filepath.Dir(dir)
+	}
+	return nil
+}
+
+// resetHardToTree makes both the index and the tracked files in the working
+// tree match target, discarding any local modifications.
+func resetHardToTree(repoPath string, target map[string]string) error {
+	index, err := readIndexMap(repoPath)
+	if err != nil {
+		return err
+	}
+	head, err := resolveHead(repoPath)
+	if err != nil {
+		return err
+	}
+	headTree, err := commitTreeMap(repoPath, head)
+	if err != nil {
+		return err
+	}
+
+	for path, hash := range target {
+		wtHash, exists, err := worktreeFileHash(repoPath, path)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		if exists && wtHash == hash {
+			continue
+		}
+		if err := restoreFile(repoPath, path, hash); err != nil {
+			return fmt.Errorf("failed to restore file %s: %w", path, err)
+		}
+	}
+
+	for _, tracked := range []map[string]string{index, headTree} {
+		for path := range tracked {
+			if _, ok := target[path]; ok {
+				continue
+			}
+			if err := removeWorktreeFile(repoPath, path); err != nil {
+				return err
+			}
+		}
+	}
+
+	return updateIndexToTree(repoPath, target)
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,379 @@
+package core
+
+import "math"
+
+// Tuning of the diff git's xdiff computes, which markChanges follows so
+// that it picks the same edit script among equally short ones, and the
+// same shortcuts when the files are too different to diff exactly.
+const (
+	// maxEqualLimit caps how often a line may occur on the other side
+	// before it counts as too common to anchor the diff on.
+	maxEqualLimit = 1024
+	// simScanWindow limits how far around a common line discardable
+	// neighbours are looked for.
+	simScanWindow = 100
+	// keepDiscardedRun is how much rarer than discardable lines the common
+	// lines around a line have to be for it to be discarded too.
+	keepDiscardedRun = 4
+	// minMaxCost is the least edit cost after which a split gives up on an
+	// exact answer.
+	minMaxCost = 256
+	// snakeCount is the length of a run of matching lines that counts as a
+	// good one for the heuristics.
+	snakeCount = 20
+	// heuristicMinCost is the edit cost after which good runs are taken
+	// as split points right away.
+	heuristicMinCost = 256
+	heuristicFactor  = 4
+)
+
+// markChanges marks the lines that differ between the two sides of a diff.
+// Lines that occur on only one side are changed without further ado, and
+// lines that occur very often on the other side are left out of the search
+// when they sit among such lines, as they would only slow it down.
+func markChanges(oldFile, newFile *changedFile) {
+	classes := make(map[string]int)
+	classify := func(lines []string) []int {
+		ids := make([]int, len(lines))
+		for i, line := range lines {
+			id, ok := classes[line]
+			if !ok {
+				id = len(classes)
+				classes[line] = id
+			}
+			ids[i] = id
+		}
+		return ids
+	}
+	oldIDs, newIDs := classify(oldFile.lines), classify(newFile.lines)
+	oldCounts, newCounts := make([]int, len(classes)), make([]int, len(classes))
+	for _, id := range oldIDs {
+		oldCounts[id]++
+	}
+	for _, id := range newIDs {
+		newCounts[id]++
+	}
+
+	// Matching lines at either end stay unchanged.
+	start := 0
+	for start < len(oldIDs) && start < len(newIDs) && oldIDs[start] == newIDs[start] {
+		start++
+	}
+	oldEnd, newEnd := len(oldIDs)-1, len(newIDs)-1
+	for oldEnd >= start && newEnd >= start && oldIDs[oldEnd] == newIDs[newEnd] {
+		oldEnd--
+		newEnd--
+	}
+
+	oldSide := discardLines(oldFile, oldIDs, newCounts, start, oldEnd)
+	newSide := discardLines(newFile, newIDs, oldCounts, start, newEnd)
+	size := len(oldSide.ids) + len(newSide.ids) + 3
+	s := &xdiffSplitter{
+		old:     oldSide,
+		new:     newSide,
+		forward: make([]int, size),
+		back:    make([]int, size),
+		offset:  len(newSide.ids) + 1,
+		maxCost: max(bogoSqrt(size), minMaxCost),
+	}
+	s.compare(0, len(oldSide.ids), 0, len(newSide.ids), false)
+}
+
+// xdiffSide is the part of one side of a diff that the search runs over:
+// the lines that were not discarded, and where each one sits in the file.
+type xdiffSide struct {
+	file  *changedFile
+	ids   []int
+	index []int
+}
+
+// discardLines marks the lines of f between start and end that can't match
+// anything, or that are too common and surrounded by such lines, as
+// changed, and returns the rest. counts holds how often each line occurs
+// on the other side.
+func discardLines(f *changedFile, ids, counts []int, start, end int) xdiffSide {
+	limit := min(bogoSqrt(len(ids)), maxEqualLimit)
+	discard := make([]byte, len(ids))
+	for i := start; i <= end; i++ {
+		switch n := counts[ids[i]]; {
+		case n == 0:
+			discard[i] = 0
+		case n >= limit:
+			discard[i] = 2
+		default:
+			discard[i] = 1
+		}
+	}
+
+	side := xdiffSide{file: f}
+	for i := start; i <= end; i++ {
+		if discard[i] == 1 || discard[i] == 2 && !isDiscardable(discard, i, start, end) {
+			side.ids = append(side.ids, ids[i])
+			side.index = append(side.index, i)
+		} else {
+			f.setChanged(i, true)
+		}
+	}
+	return side
+}
+
+// isDiscardable reports whether the common line i sits in a run of lines
+// that mostly can't match.
+func isDiscardable(discard []byte, i, start, end int) bool {
+	start = max(start, i-simScanWindow)
+	end = min(end, i+simScanWindow)
+
+	before, commonBefore := 0, 1
+	for r := 1; i-r >= start; r++ {
+		if discard[i-r] == 0 {
+			before++
+		} else if discard[i-r] == 2 {
+			commonBefore++
+		} else {
+			break
+		}
+	}
+	if before == 0 {
+		return false
+	}
+	after, commonAfter := 0, 1
+	for r := 1; i+r <= end; r++ {
+		if discard[i+r] == 0 {
+			after++
+		} else if discard[i+r] == 2 {
+			commonAfter++
+		} else {
+			break
+		}
+	}
+	if after == 0 {
+		return false
+	}
+	unmatched, common := before+after, commonBefore+commonAfter
+	return common*keepDiscardedRun < common+unmatched
+}
+
+// bogoSqrt approximates the square root of n with the power of two xdiff
+// uses.
+func bogoSqrt(n int) int {
+	i := 1
+	for ; n > 0; n >>= 2 {
+		i <<= 1
+	}
+	return i
+}
+
+// xdiffSplitter runs the divide and conquer form of Myers' algorithm over
+// two sides, searching forward and backward at once for the middle of the
+// shortest edit script. forward and back hold the furthest point reached
+// on each diagonal, indexed from offset.
+type xdiffSplitter struct {
+	old, new      xdiffSide
+	forward, back []int
+	offset        int
+	maxCost       int
+}
+
+// compare marks the changed lines among old[off1:lim1] and new[off2:lim2].
+// needMin asks for a shortest edit script even when that is slow.
+func (s *xdiffSplitter) compare(off1, lim1, off2, lim2 int, needMin bool) {
+	a, b := s.old.ids, s.new.ids
+	for off1 < lim1 && off2 < lim2 && a[off1] == b[off2] {
+		off1++
+		off2++
+	}
+	for off1 < lim1 && off2 < lim2 && a[lim1-1] == b[lim2-1] {
+		lim1--
+		lim2--
+	}
+
+	switch {
+	case off1 == lim1:
+		for ; off2 < lim2; off2++ {
+			s.new.file.setChanged(s.new.index[off2], true)
+		}
+	case off2 == lim2:
+		for ; off1 < lim1; off1++ {
+			s.old.file.setChanged(s.old.index[off1], true)
+		}
+	default:
+		i1, i2, minLow, minHigh := s.split(off1, lim1, off2, lim2, needMin)
+		s.compare(off1, i1, off2, i2, minLow)
+		s.compare(i1, lim1, i2, lim2, minHigh)
+	}
+}
+
+// split finds the point where the shortest edit script between the two
+// ranges crosses the middle, or when that costs too much a point on a
+// good long run of matches or the furthest any path got. It reports
+// whether each half still has to be diffed exactly.
+func (s *xdiffSplitter) split(off1, lim1, off2, lim2 int, needMin bool) (int, int, bool, bool) {
+	a, b := s.old.ids, s.new.ids
+	kf := func(d int) *int { return &s.forward[s.offset+d] }
+	kb := func(d int) *int { return &s.back[s.offset+d] }
+
+	dmin, dmax := off1-lim2, lim1-off2
+	fmid, bmid := off1-off2, lim1-lim2
+	odd := (fmid-bmid)&1 != 0
+	fmin, fmax := fmid, fmid
+	bmin, bmax := bmid, bmid
+	*kf(fmid) = off1
+	*kb(bmid) = lim1
+
+	for cost := 1; ; cost++ {
+		gotSnake := false
+
+		if fmin > dmin {
+			fmin--
+			*kf(fmin - 1) = -1
+		} else {
+			fmin++
+		}
+		if fmax < dmax {
+			fmax++
+			*kf(fmax + 1) = -1
+		} else {
+			fmax--
+		}
+		for d := fmax; d >= fmin; d -= 2 {
+			var i1 int
+			if *kf(d - 1) >= *kf(d + 1) {
+				i1 = *kf(d - 1) + 1
+			} else {
+				i1 = *kf(d + 1)
+			}
+			prev := i1
+			i2 := i1 - d
+			for i1 < lim1 && i2 < lim2 && a[i1] == b[i2] {
+				i1++
+				i2++
+			}
+			if i1-prev > snakeCount {
+				gotSnake = true
+			}
+			*kf(d) = i1
+			if odd && bmin <= d && d <= bmax && *kb(d) <= i1 {
+				return i1, i2, true, true
+			}
+		}
+
+		if bmin > dmin {
+			bmin--
+			*kb(bmin - 1) = math.MaxInt
+		} else {
+			bmin++
+		}
+		if bmax < dmax {
+			bmax++
+			*kb(bmax + 1) = math.MaxInt
+		} else {
+			bmax--
+		}
+		for d := bmax; d >= bmin; d -= 2 {
+			var i1 int
+			if *kb(d - 1) < *kb(d + 1) {
+				i1 = *kb(d - 1)
+			} else {
+				i1 = *kb(d + 1) - 1
+			}
+			prev := i1
+			i2 := i1 - d
+			for i1 > off1 && i2 > off2 && a[i1-1] == b[i2-1] {
+				i1--
+				i2--
+			}
+			if prev-i1 > snakeCount {
+				gotSnake = true
+			}
+			*kb(d) = i1
+			if !odd && fmin <= d && d <= fmax && i1 <= *kf(d) {
+				return i1, i2, true, true
+			}
+		}
+
+		if needMin {
+			continue
+		}
+
+		// Past the heuristic's threshold, take a diagonal that got far
+		// along a good run of matches as the split.
+		if gotSnake && cost > heuristicMinCost {
+			best, split1, split2 := 0, 0, 0
+			for d := fmax; d >= fmin; d -= 2 {
+				dd := d - fmid
+				if dd < 0 {
+					dd = -dd
+				}
+				i1 := *kf(d)
+				i2 := i1 - d
+				v := (i1 - off1) + (i2 - off2) - dd
+				if v > heuristicFactor*cost && v > best &&
+					off1+snakeCount <= i1 && i1 < lim1 &&
+					off2+snakeCount <= i2 && i2 < lim2 {
+					for k := 1; a[i1-k] == b[i2-k]; k++ {
+						if k == snakeCount {
+							best, split1, split2 = v, i1, i2
+							break
+						}
+					}
+				}
+			}
+			if best > 0 {
+				return split1, split2, true, false
+			}
+
+			for d := bmax; d >= bmin; d -= 2 {
+				dd := d - bmid
+				if dd < 0 {
+					dd = -dd
+				}
+				i1 := *kb(d)
+				i2 := i1 - d
+				v := (lim1 - i1) + (lim2 - i2) - dd
+				if v > heuristicFactor*cost && v > best &&
+					off1 < i1 && i1 <= lim1-snakeCount &&
+					off2 < i2 && i2 <= lim2-snakeCount {
+					for k := 0; a[i1+k] == b[i2+k]; k++ {
+						if k == snakeCount-1 {
+							best, split1, split2 = v, i1, i2
+							break
+						}
+					}
+				}
+			}
+			if best > 0 {
+				return split1, split2, false, true
+			}
+		}
+
+		// Enough is enough: split where a path got furthest.
+		if cost >= s.maxCost {
+			fbest, fbest1 := -1, -1
+			for d := fmax; d >= fmin; d -= 2 {
+				i1 := min(*kf(d), lim1)
+				i2 := i1 - d
+				if lim2 < i2 {
+					i1, i2 = lim2+d, lim2
+				}
+				if fbest < i1+i2 {
+					fbest, fbest1 = i1+i2, i1
+				}
+			}
+			bbest, bbest1 := math.MaxInt, math.MaxInt
+			for d := bmax; d >= bmin; d -= 2 {
+				i1 := max(off1, *kb(d))
+				i2 := i1 - d
+				if i2 < off2 {
+					i1, i2 = off2+d, off2
+				}
+				if i1+i2 < bbest {
+					bbest, bbest1 = i1+i2, i1
+				}
+			}
+			if (lim1+lim2)-bbest < fbest-(off1+off2) {
+				return fbest1, fbest - fbest1, true, false
+			}
+			return bbest1, bbest - bbest1, false, true
+		}
+	}
+}